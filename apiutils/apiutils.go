@@ -1,65 +1,216 @@
 package apiutils
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"helm-api/problemutils"
 	"net/http"
-	"os"
+	"path"
+	"slices"
 	"strings"
 )
 
+// QueryWriteKeyName is the key allowed to run write statements against environment databases.
+const QueryWriteKeyName = "HELM_API_QUERY_WRITE_API_KEY"
+
+// ConnectKeyName is the key allowed to open tunnels to environment services.
+const ConnectKeyName = "HELM_API_CONNECT_API_KEY"
+
 type EndpointConfig struct {
-	Path   string
-	APIKey string
-	NoAuth bool
+	Path string
+	// Methods limits the rule to these methods, it applies to every method when empty.
+	Methods []string
+	KeyName string
+	// AltKeyNames are wider scopes that are accepted as well.
+	AltKeyNames []string
+	NoAuth      bool
+	// Glob matches Path as a path.Match pattern against the whole path instead of a substring.
+	Glob bool
 }
 
+// ValidateEndpoint checks the key against the rules that apply to every method.
 func ValidateEndpoint(path, apiKey string) bool {
+	return ValidateRequest("", path, apiKey)
+}
+
+// ValidateRequest checks the key against the first rule matching the method and path.
+func ValidateRequest(method, path, apiKey string) bool {
+	_, valid := AuthorizeRequest(method, path, apiKey)
+
+	return valid
+}
+
+// AuthorizeRequest checks the key against the first rule matching the method and path, and
+// returns the name of the key that grants it, empty for routes without auth.
+func AuthorizeRequest(method, urlPath, apiKey string) (string, bool) {
+	// Paths are matched by substring in order, so prefixes containing user supplied
+	// names (e.g. /envs/list/logs) must come before the fixed ones.
 	endpoints := []EndpointConfig{
+		// Environment names can't contain a colon, so this only matches the scale action.
+		{
+			Path:    ":scale",
+			Methods: []string{http.MethodPost},
+			KeyName: "HELM_API_UPDATE_API_KEY",
+		},
+		{
+			Path:    "/v1/envs/",
+			Methods: []string{http.MethodPatch},
+			KeyName: "HELM_API_UPDATE_API_KEY",
+		},
+		{
+			Path:    "/v1/envs/",
+			Methods: []string{http.MethodDelete},
+			KeyName: "HELM_API_DELETE_API_KEY",
+		},
+		{
+			Path:    "/v1/envs",
+			Methods: []string{http.MethodPost},
+			KeyName: "HELM_API_CREATE_API_KEY",
+		},
+		{
+			Path:    "/v1/envs",
+			Methods: []string{http.MethodGet},
+			KeyName: "HELM_API_READ_API_KEY",
+		},
+		// Tunnel keys only open tunnels, they don't read the environments.
+		{
+			Path:    "/envs/*/connect",
+			KeyName: ConnectKeyName,
+			Glob:    true,
+		},
+		{
+			Path:        "/envs/",
+			KeyName:     "HELM_API_READ_API_KEY",
+			AltKeyNames: []string{QueryWriteKeyName},
+		},
 		{
-			Path:   "create-env",
-			APIKey: os.Getenv("HELM_API_CREATE_API_KEY"),
+			Path:    "create-env",
+			KeyName: "HELM_API_CREATE_API_KEY",
 		},
 		{
-			Path:   "update-env",
-			APIKey: os.Getenv("HELM_API_UPDATE_API_KEY"),
+			Path:    "update-env",
+			KeyName: "HELM_API_UPDATE_API_KEY",
 		},
 		{
-			Path:   "delete-env",
-			APIKey: os.Getenv("HELM_API_DELETE_API_KEY"),
+			Path:    "delete-env",
+			KeyName: "HELM_API_DELETE_API_KEY",
 		},
 		{
 			Path:   "health-check",
 			NoAuth: true,
 		},
+		{
+			Path:   "livez",
+			NoAuth: true,
+		},
+		{
+			Path:   "readyz",
+			NoAuth: true,
+		},
 		{
 			Path:   "list",
 			NoAuth: true,
 		},
+		{
+			Path:        "quotas",
+			KeyName:     "HELM_API_READ_API_KEY",
+			AltKeyNames: []string{"HELM_API_CREATE_API_KEY", "HELM_API_UPDATE_API_KEY", "HELM_API_DELETE_API_KEY"},
+		},
+		{
+			Path:   "metrics",
+			NoAuth: true,
+		},
+		{
+			Path:   "openapi.json",
+			NoAuth: true,
+		},
+		{
+			Path:   "/docs",
+			NoAuth: true,
+		},
+		{
+			Path:    "audit",
+			KeyName: "HELM_API_AUDIT_API_KEY",
+		},
+		{
+			Path:    "admin",
+			KeyName: "HELM_API_ADMIN_API_KEY",
+		},
 	}
 
 	for _, endpoint := range endpoints {
-		if strings.Contains(path, endpoint.Path) {
+		if len(endpoint.Methods) > 0 && !slices.Contains(endpoint.Methods, method) {
+			continue
+		}
+
+		matches := strings.Contains(urlPath, endpoint.Path)
+		if endpoint.Glob {
+			matches, _ = path.Match(endpoint.Path, urlPath)
+		}
+
+		if matches {
 			if endpoint.NoAuth {
 
-				return true
+				return "", true
 			}
 
-			return endpoint.APIKey == apiKey
+			for _, keyName := range append([]string{endpoint.KeyName}, endpoint.AltKeyNames...) {
+				if name, valid := Keys.Match(keyName, apiKey); valid {
+
+					return name, true
+				}
+			}
+
+			return "", false
 		}
 	}
 
-	return false
+	return "", false
+}
+
+// KeyID returns a short, non-reversible identifier of an API key for logging.
+func KeyID(apiKey string) string {
+	if apiKey == "" {
+
+		return ""
+	}
+
+	sum := sha256.Sum256([]byte(apiKey))
+
+	return hex.EncodeToString(sum[:4])
+}
+
+type callerKey struct{}
+
+// WithCaller returns a context carrying the name of the key that authorized the request.
+func WithCaller(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, callerKey{}, name)
+}
+
+// Caller returns the name of the key that authorized the request, empty for routes without auth.
+func Caller(ctx context.Context) string {
+	name, _ := ctx.Value(callerKey{}).(string)
+
+	return name
+}
+
+// CallerTeam returns the team of the key that authorized the request.
+func CallerTeam(ctx context.Context) string {
+	return KeyTeam(Caller(ctx))
 }
 
 func AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		apiKey := r.Header.Get("X-API-Key")
 
-		if ValidateEndpoint(r.URL.Path, apiKey) {
-			next.ServeHTTP(w, r)
+		if name, valid := AuthorizeRequest(r.Method, r.URL.Path, apiKey); valid {
+			next.ServeHTTP(w, r.WithContext(WithCaller(r.Context(), name)))
 
 			return
 		}
 
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		problemutils.Write(w, r, problemutils.New(problemutils.CodeUnauthorized, "Unauthorized", errors.New("the API key is missing or doesn't grant this route")))
 	})
 }
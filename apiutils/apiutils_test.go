@@ -11,9 +11,13 @@ import (
 func TestValidateEndpoint(t *testing.T) {
 	// Save original env vars to restore later
 	originalEnvVars := map[string]string{
-		"HELM_API_CREATE_API_KEY": os.Getenv("HELM_API_CREATE_API_KEY"),
-		"HELM_API_UPDATE_API_KEY": os.Getenv("HELM_API_UPDATE_API_KEY"),
-		"HELM_API_DELETE_API_KEY": os.Getenv("HELM_API_DELETE_API_KEY"),
+		"HELM_API_CREATE_API_KEY":  os.Getenv("HELM_API_CREATE_API_KEY"),
+		"HELM_API_UPDATE_API_KEY":  os.Getenv("HELM_API_UPDATE_API_KEY"),
+		"HELM_API_DELETE_API_KEY":  os.Getenv("HELM_API_DELETE_API_KEY"),
+		"HELM_API_ADMIN_API_KEY":   os.Getenv("HELM_API_ADMIN_API_KEY"),
+		"HELM_API_READ_API_KEY":    os.Getenv("HELM_API_READ_API_KEY"),
+		apiutils.QueryWriteKeyName: os.Getenv(apiutils.QueryWriteKeyName),
+		apiutils.ConnectKeyName:    os.Getenv(apiutils.ConnectKeyName),
 	}
 
 	// Restore env vars after test
@@ -27,6 +31,10 @@ func TestValidateEndpoint(t *testing.T) {
 	os.Setenv("HELM_API_CREATE_API_KEY", "create-key")
 	os.Setenv("HELM_API_UPDATE_API_KEY", "update-key")
 	os.Setenv("HELM_API_DELETE_API_KEY", "delete-key")
+	os.Setenv("HELM_API_ADMIN_API_KEY", "admin-key")
+	os.Setenv("HELM_API_READ_API_KEY", "read-key")
+	os.Setenv(apiutils.QueryWriteKeyName, "write-key")
+	os.Setenv(apiutils.ConnectKeyName, "connect-key")
 
 	tests := []struct {
 		name     string
@@ -42,10 +50,30 @@ func TestValidateEndpoint(t *testing.T) {
 		{"invalid delete key", "/api/v1/delete-env", "wrong-key", false},
 		{"health check no auth", "/api/v1/health-check", "", true},
 		{"health check with key", "/api/v1/health-check", "any-key", true},
+		{"livez no auth", "/livez", "", true},
+		{"readyz no auth", "/readyz", "", true},
+		{"openapi no auth", "/openapi.json", "", true},
+		{"docs no auth", "/docs", "", true},
 		{"list no auth", "/api/v1/list", "", true},
 		{"list with key", "/api/v1/list", "any-key", true},
 		{"unknown endpoint", "/api/v1/unknown", "any-key", false},
 		{"empty path", "", "any-key", false},
+		{"unset audit key", "/api/v1/audit", "", false},
+		{"valid admin key", "/admin/log-level", "admin-key", true},
+		{"invalid admin key", "/admin/log-level", "create-key", false},
+		{"valid env logs key", "/envs/demo/logs", "read-key", true},
+		{"env named like a public endpoint", "/envs/list/events", "", false},
+		{"query with read key", "/envs/demo/query", "read-key", true},
+		{"query with write key", "/envs/demo/query", "write-key", true},
+		{"query with other key", "/envs/demo/query", "create-key", false},
+		{"connect with connect key", "/envs/demo/connect", "connect-key", true},
+		{"connect with read key", "/envs/demo/connect", "read-key", false},
+		{"logs with connect key", "/envs/demo/logs", "connect-key", false},
+		{"query with connect key", "/envs/demo/query", "connect-key", false},
+		{"env named connect", "/envs/connect", "read-key", true},
+		{"quotas without key", "/quotas", "", false},
+		{"quotas with read key", "/quotas", "read-key", true},
+		{"quotas with create key", "/quotas", "create-key", true},
 	}
 
 	for _, tt := range tests {
@@ -59,6 +87,45 @@ func TestValidateEndpoint(t *testing.T) {
 	}
 }
 
+func TestValidateRequest(t *testing.T) {
+	t.Setenv("HELM_API_CREATE_API_KEY", "create-key")
+	t.Setenv("HELM_API_UPDATE_API_KEY", "update-key")
+	t.Setenv("HELM_API_DELETE_API_KEY", "delete-key")
+	t.Setenv("HELM_API_READ_API_KEY", "read-key")
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		apiKey   string
+		expected bool
+	}{
+		{"create with create key", http.MethodPost, "/v1/envs", "create-key", true},
+		{"create with read key", http.MethodPost, "/v1/envs", "read-key", false},
+		{"list with read key", http.MethodGet, "/v1/envs", "read-key", true},
+		{"list without key", http.MethodGet, "/v1/envs", "", false},
+		{"get with read key", http.MethodGet, "/v1/envs/demo", "read-key", true},
+		{"patch with update key", http.MethodPatch, "/v1/envs/demo", "update-key", true},
+		{"patch with read key", http.MethodPatch, "/v1/envs/demo", "read-key", false},
+		{"delete with delete key", http.MethodDelete, "/v1/envs/demo", "delete-key", true},
+		{"delete with update key", http.MethodDelete, "/v1/envs/demo", "update-key", false},
+		{"scale with update key", http.MethodPost, "/v1/envs/demo:scale", "update-key", true},
+		{"scale with create key", http.MethodPost, "/v1/envs/demo:scale", "create-key", false},
+		{"legacy routes ignore the method", http.MethodPost, "/create-env", "create-key", true},
+		{"env subresources keep the read key", http.MethodPost, "/envs/demo/render", "read-key", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := apiutils.ValidateRequest(tt.method, tt.path, tt.apiKey)
+			if result != tt.expected {
+				t.Errorf("ValidateRequest(%q, %q, %q) = %v, want %v",
+					tt.method, tt.path, tt.apiKey, result, tt.expected)
+			}
+		})
+	}
+}
+
 func TestAuthMiddleware(t *testing.T) {
 	// Save original env vars
 	originalEnvVars := map[string]string{
@@ -134,3 +201,29 @@ func TestAuthMiddleware(t *testing.T) {
 		})
 	}
 }
+
+func TestKeyID(t *testing.T) {
+	tests := []struct {
+		name   string
+		apiKey string
+		want   int
+	}{
+		{"empty key", "", 0},
+		{"non-empty key", "create-key", 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := apiutils.KeyID(tt.apiKey)
+			if len(got) != tt.want {
+				t.Errorf("KeyID(%q) = %q, want length %d", tt.apiKey, got, tt.want)
+			}
+			if got != "" && got == tt.apiKey {
+				t.Errorf("KeyID(%q) leaked the key", tt.apiKey)
+			}
+			if got != apiutils.KeyID(tt.apiKey) {
+				t.Errorf("KeyID(%q) is not stable", tt.apiKey)
+			}
+		})
+	}
+}
@@ -0,0 +1,315 @@
+package apiutils
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"helm-api/quotautils"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Keys is the key set used by ValidateEndpoint.
+var Keys = NewKeyStore()
+
+// KeyNames are the API keys the routes are granted to.
+var KeyNames = []string{
+	"HELM_API_CREATE_API_KEY",
+	"HELM_API_UPDATE_API_KEY",
+	"HELM_API_DELETE_API_KEY",
+	"HELM_API_READ_API_KEY",
+	"HELM_API_AUDIT_API_KEY",
+	"HELM_API_ADMIN_API_KEY",
+	QueryWriteKeyName,
+	ConnectKeyName,
+}
+
+// RequiredKeyNames are the scopes that need at least one key for the API to start.
+var RequiredKeyNames = []string{
+	"HELM_API_CREATE_API_KEY",
+	"HELM_API_DELETE_API_KEY",
+	"HELM_API_UPDATE_API_KEY",
+}
+
+// TeamSeparator binds a key to a team in its name, e.g. HELM_API_CREATE_API_KEY@qa.
+const TeamSeparator = "@"
+
+// KeyScope returns the name of a key without the team it is bound to.
+func KeyScope(name string) string {
+	scope, _, _ := strings.Cut(name, TeamSeparator)
+
+	return scope
+}
+
+// KeyTeam returns the team a key is bound to, the default team for keys without one.
+func KeyTeam(name string) string {
+	if _, team, found := strings.Cut(name, TeamSeparator); found && team != "" {
+
+		return team
+	}
+
+	return quotautils.DefaultTeam
+}
+
+type previousKey struct {
+	value string
+	until time.Time
+}
+
+type keySet struct {
+	current  map[string]string
+	previous map[string]previousKey
+	// loaded is set once the keys come from a source, the process environment is ignored then.
+	loaded bool
+}
+
+// KeyStore holds the API keys by name (e.g. HELM_API_CREATE_API_KEY).
+// The whole set is swapped atomically so readers never see a partial rotation.
+type KeyStore struct {
+	keys atomic.Pointer[keySet]
+	now  func() time.Time
+}
+
+func NewKeyStore() *KeyStore {
+	store := &KeyStore{now: time.Now}
+	store.keys.Store(&keySet{
+		current:  map[string]string{},
+		previous: map[string]previousKey{},
+	})
+
+	return store
+}
+
+// Valid reports whether apiKey is a current key of the scope, or a previous key still in its
+// grace period. Keys bound to a team (e.g. HELM_API_CREATE_API_KEY@qa) are valid for their scope.
+// Until the store is loaded with Rotate, keys are read from the process environment.
+func (s *KeyStore) Valid(name, apiKey string) bool {
+	_, valid := s.Match(name, apiKey)
+
+	return valid
+}
+
+// Match returns the name of the key of the scope that apiKey matches, e.g.
+// HELM_API_CREATE_API_KEY@qa for the create scope.
+func (s *KeyStore) Match(scope, apiKey string) (string, bool) {
+	if apiKey == "" {
+
+		return "", false
+	}
+
+	set := s.keys.Load()
+
+	if !set.loaded {
+		if value := os.Getenv(scope); value != "" && subtle.ConstantTimeCompare([]byte(value), []byte(apiKey)) == 1 {
+
+			return scope, true
+		}
+	}
+
+	for _, name := range sortedNames(set.current) {
+		if KeyScope(name) == scope && set.current[name] != "" && subtle.ConstantTimeCompare([]byte(set.current[name]), []byte(apiKey)) == 1 {
+
+			return name, true
+		}
+	}
+
+	now := s.now()
+	for _, name := range sortedNames(set.previous) {
+		prev := set.previous[name]
+		if KeyScope(name) == scope && now.Before(prev.until) && subtle.ConstantTimeCompare([]byte(prev.value), []byte(apiKey)) == 1 {
+
+			return name, true
+		}
+	}
+
+	return "", false
+}
+
+// Require fails when a scope has no key, whatever the team it is bound to. Until the store is
+// loaded with Rotate, keys are read from the process environment.
+func (s *KeyStore) Require(scopes ...string) error {
+	set := s.keys.Load()
+
+	for _, scope := range scopes {
+		found := !set.loaded && os.Getenv(scope) != ""
+		for name, value := range set.current {
+			found = found || (KeyScope(name) == scope && value != "")
+		}
+		if !found {
+
+			return fmt.Errorf("master %s missing", strings.ToLower(strings.TrimPrefix(scope, "HELM_API_")))
+		}
+	}
+
+	return nil
+}
+
+// Lookup returns the name of the key apiKey matches, whatever its scope.
+func (s *KeyStore) Lookup(apiKey string) (string, bool) {
+	set := s.keys.Load()
+
+	scopes := map[string]bool{}
+	for _, name := range KeyNames {
+		scopes[name] = true
+	}
+	for name := range set.current {
+		scopes[KeyScope(name)] = true
+	}
+	for name := range set.previous {
+		scopes[KeyScope(name)] = true
+	}
+
+	for _, scope := range sortedNames(scopes) {
+		if name, valid := s.Match(scope, apiKey); valid {
+
+			return name, true
+		}
+	}
+
+	return "", false
+}
+
+func sortedNames[V any](keys map[string]V) []string {
+	names := make([]string, 0, len(keys))
+	for name := range keys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Rotate replaces the key set. Keys whose value changed or that were removed stay valid for the
+// grace period. It returns the sorted names of the rotated keys.
+func (s *KeyStore) Rotate(keys map[string]string, grace time.Duration) []string {
+	old := s.keys.Load()
+	now := s.now()
+
+	next := &keySet{
+		current:  make(map[string]string, len(keys)),
+		previous: map[string]previousKey{},
+		loaded:   true,
+	}
+
+	// Carry over previous keys that are still in their grace period.
+	for name, prev := range old.previous {
+		if now.Before(prev.until) {
+			next.previous[name] = prev
+		}
+	}
+
+	var rotated []string
+	for name, value := range keys {
+		next.current[name] = value
+
+		if oldValue, exists := old.current[name]; exists && oldValue != value {
+			rotated = append(rotated, name)
+			if grace > 0 && oldValue != "" {
+				next.previous[name] = previousKey{value: oldValue, until: now.Add(grace)}
+			}
+		}
+	}
+
+	// Keys removed from the set are rotated away too.
+	for name, oldValue := range old.current {
+		if _, exists := keys[name]; !exists {
+			rotated = append(rotated, name)
+			if grace > 0 && oldValue != "" {
+				next.previous[name] = previousKey{value: oldValue, until: now.Add(grace)}
+			}
+		}
+	}
+
+	s.keys.Store(next)
+	sort.Strings(rotated)
+
+	return rotated
+}
+
+// KeySource fetches the API keys by name from a secret backend.
+type KeySource interface {
+	Fetch(ctx context.Context) (map[string]string, error)
+}
+
+// FileKeySource reads API keys from a local JSON or YAML file of name/value pairs.
+type FileKeySource struct {
+	Path string
+}
+
+func (f *FileKeySource) Fetch(ctx context.Context) (map[string]string, error) {
+	data, err := os.ReadFile(f.Path)
+	if err != nil {
+
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+
+	// YAML is a superset of JSON, so both formats are accepted.
+	keys := map[string]string{}
+	if err := yaml.Unmarshal(data, &keys); err != nil {
+
+		return nil, fmt.Errorf("failed to parse key file: %w", err)
+	}
+
+	return keys, nil
+}
+
+// RefreshLogger reports key refreshes.
+type RefreshLogger interface {
+	Infof(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// Refresher periodically reloads the key store from a KeySource.
+type Refresher struct {
+	Source   KeySource
+	Store    *KeyStore
+	Interval time.Duration
+	Grace    time.Duration
+	Timeout  time.Duration
+	Logger   RefreshLogger
+}
+
+// Refresh fetches the keys once and swaps them into the store.
+func (r *Refresher) Refresh(ctx context.Context) error {
+	if r.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+
+	keys, err := r.Source.Fetch(ctx)
+	if err != nil {
+
+		return err
+	}
+
+	for _, name := range r.Store.Rotate(keys, r.Grace) {
+		r.Logger.Infof("API key %s rotated, previous key valid for %v", name, r.Grace)
+	}
+
+	return nil
+}
+
+// Run refreshes the keys every interval until the context is cancelled.
+// Failed refreshes keep the current keys and are retried on the next tick.
+func (r *Refresher) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+
+			return
+		case <-ticker.C:
+			if err := r.Refresh(ctx); err != nil {
+				r.Logger.Errorf("Refreshing API keys failed: %v", err)
+			}
+		}
+	}
+}
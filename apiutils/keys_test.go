@@ -0,0 +1,294 @@
+package apiutils_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"helm-api/apiutils"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// MockKeySource is a mock implementation of the KeySource interface.
+type MockKeySource struct {
+	mock.Mock
+}
+
+func (m *MockKeySource) Fetch(ctx context.Context) (map[string]string, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(map[string]string), args.Error(1)
+}
+
+type MockRefreshLogger struct {
+	mock.Mock
+}
+
+func (m *MockRefreshLogger) Infof(format string, args ...interface{}) {
+	m.Called(args...)
+}
+
+func (m *MockRefreshLogger) Errorf(format string, args ...interface{}) {
+	m.Called(args...)
+}
+
+func TestKeyStoreRotate(t *testing.T) {
+	tests := []struct {
+		name        string
+		grace       time.Duration
+		wantOldKey  bool
+		wantNewKey  bool
+		wantRotated []string
+	}{
+		{
+			name:        "old key valid during grace period",
+			grace:       time.Hour,
+			wantOldKey:  true,
+			wantNewKey:  true,
+			wantRotated: []string{"HELM_API_CREATE_API_KEY"},
+		},
+		{
+			name:        "old key invalid without grace period",
+			grace:       0,
+			wantOldKey:  false,
+			wantNewKey:  true,
+			wantRotated: []string{"HELM_API_CREATE_API_KEY"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := apiutils.NewKeyStore()
+
+			rotated := store.Rotate(map[string]string{
+				"HELM_API_CREATE_API_KEY": "old-key",
+				"HELM_API_DELETE_API_KEY": "delete-key",
+			}, tt.grace)
+			assert.Empty(t, rotated)
+
+			rotated = store.Rotate(map[string]string{
+				"HELM_API_CREATE_API_KEY": "new-key",
+				"HELM_API_DELETE_API_KEY": "delete-key",
+			}, tt.grace)
+			assert.Equal(t, tt.wantRotated, rotated)
+
+			assert.Equal(t, tt.wantOldKey, store.Valid("HELM_API_CREATE_API_KEY", "old-key"))
+			assert.Equal(t, tt.wantNewKey, store.Valid("HELM_API_CREATE_API_KEY", "new-key"))
+			assert.True(t, store.Valid("HELM_API_DELETE_API_KEY", "delete-key"))
+			assert.False(t, store.Valid("HELM_API_DELETE_API_KEY", "old-key"))
+		})
+	}
+}
+
+func TestKeyStoreFallsBackToEnv(t *testing.T) {
+	original := os.Getenv("HELM_API_UPDATE_API_KEY")
+	defer os.Setenv("HELM_API_UPDATE_API_KEY", original)
+
+	os.Setenv("HELM_API_UPDATE_API_KEY", "env-key")
+
+	store := apiutils.NewKeyStore()
+	assert.True(t, store.Valid("HELM_API_UPDATE_API_KEY", "env-key"))
+	assert.False(t, store.Valid("HELM_API_UPDATE_API_KEY", ""))
+
+	store.Rotate(map[string]string{"HELM_API_UPDATE_API_KEY": "store-key"}, time.Hour)
+	assert.True(t, store.Valid("HELM_API_UPDATE_API_KEY", "store-key"))
+	assert.False(t, store.Valid("HELM_API_UPDATE_API_KEY", "env-key"))
+}
+
+func TestKeyStoreIgnoresEnvOnceLoaded(t *testing.T) {
+	t.Setenv("HELM_API_CREATE_API_KEY", "old-key")
+	t.Setenv("HELM_API_READ_API_KEY", "read-key")
+
+	store := apiutils.NewKeyStore()
+	assert.True(t, store.Valid("HELM_API_READ_API_KEY", "read-key"))
+
+	grace := 50 * time.Millisecond
+	store.Rotate(map[string]string{"HELM_API_CREATE_API_KEY": "old-key"}, grace)
+	assert.False(t, store.Valid("HELM_API_READ_API_KEY", "read-key"), "keys missing from the source aren't read from the environment")
+
+	rotated := store.Rotate(map[string]string{"HELM_API_CREATE_API_KEY": "new-key"}, grace)
+	assert.Equal(t, []string{"HELM_API_CREATE_API_KEY"}, rotated)
+	assert.True(t, store.Valid("HELM_API_CREATE_API_KEY", "old-key"))
+
+	time.Sleep(2 * grace)
+
+	// The environment still holds the old key, which must not keep it valid.
+	assert.False(t, store.Valid("HELM_API_CREATE_API_KEY", "old-key"))
+	assert.True(t, store.Valid("HELM_API_CREATE_API_KEY", "new-key"))
+
+	// A key removed from the source gets the grace period as well.
+	rotated = store.Rotate(map[string]string{}, grace)
+	assert.Equal(t, []string{"HELM_API_CREATE_API_KEY"}, rotated)
+	assert.True(t, store.Valid("HELM_API_CREATE_API_KEY", "new-key"))
+
+	time.Sleep(2 * grace)
+
+	assert.False(t, store.Valid("HELM_API_CREATE_API_KEY", "new-key"))
+	assert.False(t, store.Valid("HELM_API_CREATE_API_KEY", "old-key"))
+}
+
+func TestKeyStoreTeamKeys(t *testing.T) {
+	store := apiutils.NewKeyStore()
+	store.Rotate(map[string]string{
+		"HELM_API_CREATE_API_KEY":    "default-key",
+		"HELM_API_CREATE_API_KEY@qa": "qa-key",
+		"HELM_API_UPDATE_API_KEY@qa": "qa-update-key",
+	}, 0)
+
+	name, valid := store.Match("HELM_API_CREATE_API_KEY", "qa-key")
+	assert.True(t, valid)
+	assert.Equal(t, "HELM_API_CREATE_API_KEY@qa", name)
+	assert.Equal(t, "qa", apiutils.KeyTeam(name))
+
+	name, valid = store.Match("HELM_API_CREATE_API_KEY", "default-key")
+	assert.True(t, valid)
+	assert.Equal(t, "default", apiutils.KeyTeam(name))
+
+	name, valid = store.Lookup("qa-update-key")
+	assert.True(t, valid)
+	assert.Equal(t, "HELM_API_UPDATE_API_KEY@qa", name)
+	_, valid = store.Lookup("unknown-key")
+	assert.False(t, valid)
+
+	// A team key only grants its own scope.
+	assert.False(t, store.Valid("HELM_API_CREATE_API_KEY", "qa-update-key"))
+	assert.True(t, store.Valid("HELM_API_UPDATE_API_KEY", "qa-update-key"))
+}
+
+func TestKeyStoreRequire(t *testing.T) {
+	t.Setenv("HELM_API_CREATE_API_KEY", "env-key")
+	t.Setenv("HELM_API_DELETE_API_KEY", "")
+	t.Setenv("HELM_API_UPDATE_API_KEY", "")
+
+	// Before loading, the environment holds the keys.
+	store := apiutils.NewKeyStore()
+	assert.NoError(t, store.Require("HELM_API_CREATE_API_KEY"))
+	assert.EqualError(t, store.Require(apiutils.RequiredKeyNames...), "master delete_api_key missing")
+
+	// A deployment can start with team keys only.
+	store.Rotate(map[string]string{
+		"HELM_API_CREATE_API_KEY@qa":  "qa-create-key",
+		"HELM_API_DELETE_API_KEY@qa":  "qa-delete-key",
+		"HELM_API_UPDATE_API_KEY@dev": "dev-update-key",
+	}, 0)
+	assert.NoError(t, store.Require(apiutils.RequiredKeyNames...))
+
+	// Once loaded, the environment no longer counts.
+	store.Rotate(map[string]string{"HELM_API_DELETE_API_KEY@qa": "qa-delete-key"}, 0)
+	assert.EqualError(t, store.Require(apiutils.RequiredKeyNames...), "master create_api_key missing")
+}
+
+func TestRefresherRefresh(t *testing.T) {
+	source := new(MockKeySource)
+	logger := new(MockRefreshLogger)
+	store := apiutils.NewKeyStore()
+
+	refresher := &apiutils.Refresher{
+		Source:  source,
+		Store:   store,
+		Grace:   time.Hour,
+		Timeout: time.Second,
+		Logger:  logger,
+	}
+
+	source.On("Fetch", mock.Anything).Return(map[string]string{"HELM_API_CREATE_API_KEY": "key-1"}, nil).Once()
+	require.NoError(t, refresher.Refresh(context.Background()))
+
+	source.On("Fetch", mock.Anything).Return(map[string]string{"HELM_API_CREATE_API_KEY": "key-2"}, nil).Once()
+	logger.On("Infof", "HELM_API_CREATE_API_KEY", time.Hour).Return().Once()
+	require.NoError(t, refresher.Refresh(context.Background()))
+
+	source.On("Fetch", mock.Anything).Return(map[string]string{}, errors.New("ssm unavailable")).Once()
+	assert.Error(t, refresher.Refresh(context.Background()))
+
+	// A failed refresh keeps the last known keys.
+	assert.True(t, store.Valid("HELM_API_CREATE_API_KEY", "key-2"))
+	assert.True(t, store.Valid("HELM_API_CREATE_API_KEY", "key-1"))
+
+	source.AssertExpectations(t)
+	logger.AssertExpectations(t)
+}
+
+func TestRefresherRunStopsOnCancel(t *testing.T) {
+	source := new(MockKeySource)
+	logger := new(MockRefreshLogger)
+
+	source.On("Fetch", mock.Anything).Return(map[string]string{"HELM_API_CREATE_API_KEY": "key-1"}, nil)
+
+	refresher := &apiutils.Refresher{
+		Source:   source,
+		Store:    apiutils.NewKeyStore(),
+		Interval: 10 * time.Millisecond,
+		Logger:   logger,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		refresher.Run(ctx)
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool {
+		return refresher.Store.Valid("HELM_API_CREATE_API_KEY", "key-1")
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("refresher did not stop after cancel")
+	}
+}
+
+func TestFileKeySourceFetch(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name     string
+		content  string
+		wantKeys map[string]string
+		wantErr  bool
+	}{
+		{
+			name:     "json file",
+			content:  `{"HELM_API_CREATE_API_KEY": "create-key"}`,
+			wantKeys: map[string]string{"HELM_API_CREATE_API_KEY": "create-key"},
+		},
+		{
+			name:     "yaml file",
+			content:  "HELM_API_DELETE_API_KEY: delete-key\n",
+			wantKeys: map[string]string{"HELM_API_DELETE_API_KEY": "delete-key"},
+		},
+		{
+			name:    "invalid file",
+			content: "[not, a, map]",
+			wantErr: true,
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, fmt.Sprintf("keys-%d", i))
+			require.NoError(t, os.WriteFile(path, []byte(tt.content), 0600))
+
+			keys, err := (&apiutils.FileKeySource{Path: path}).Fetch(context.Background())
+			if tt.wantErr {
+				assert.Error(t, err)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantKeys, keys)
+		})
+	}
+
+	_, err := (&apiutils.FileKeySource{Path: filepath.Join(dir, "missing")}).Fetch(context.Background())
+	assert.Error(t, err)
+}
@@ -0,0 +1,200 @@
+package auditutils
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const redacted = "[REDACTED]"
+
+// sensitiveKeys are matched case-insensitively against JSON field names.
+var sensitiveKeys = []string{"password", "secret", "token", "apikey", "api_key", "credential"}
+
+// Entry is a single audit record.
+type Entry struct {
+	Time     time.Time       `json:"time"`
+	Actor    string          `json:"actor"`
+	KeyID    string          `json:"keyId,omitempty"`
+	Method   string          `json:"method"`
+	Endpoint string          `json:"endpoint"`
+	Env      string          `json:"env,omitempty"`
+	Body     json.RawMessage `json:"body,omitempty"`
+	Status   int             `json:"status"`
+	Outcome  string          `json:"outcome"`
+	Revision int             `json:"revision,omitempty"`
+}
+
+// Filter selects audit entries. Empty fields match everything.
+type Filter struct {
+	Env   string
+	Actor string
+	Since time.Time
+	Until time.Time
+}
+
+// Match reports whether the entry satisfies the filter.
+func (f Filter) Match(e Entry) bool {
+	if f.Env != "" && e.Env != f.Env {
+
+		return false
+	}
+	if f.Actor != "" && e.Actor != f.Actor {
+
+		return false
+	}
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+
+		return false
+	}
+	if !f.Until.IsZero() && e.Time.After(f.Until) {
+
+		return false
+	}
+
+	return true
+}
+
+// Store persists and queries audit entries.
+type Store interface {
+	Append(entry Entry) error
+	Query(filter Filter) ([]Entry, error)
+}
+
+// FileStore writes audit entries to an append-only JSON-lines file.
+type FileStore struct {
+	path string
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileStore opens (or creates) the audit file at path.
+func NewFileStore(path string) (*FileStore, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+
+		return nil, fmt.Errorf("failed to open audit file: %w", err)
+	}
+
+	return &FileStore{path: path, file: file}, nil
+}
+
+// Append writes the entry as a single JSON line.
+func (s *FileStore) Append(entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+
+		return fmt.Errorf("failed to marshal audit entry: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.file.Write(append(data, '\n')); err != nil {
+
+		return fmt.Errorf("failed to write audit entry: %w", err)
+	}
+
+	return nil
+}
+
+// Query reads the audit file and returns the entries matching the filter, oldest first.
+func (s *FileStore) Query(filter Filter) ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := os.Open(s.path)
+	if err != nil {
+
+		return nil, fmt.Errorf("failed to open audit file: %w", err)
+	}
+	defer file.Close()
+
+	entries := []Entry{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+
+			return nil, fmt.Errorf("failed to parse audit entry: %w", err)
+		}
+
+		if filter.Match(entry) {
+			entries = append(entries, entry)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+
+		return nil, fmt.Errorf("failed to read audit file: %w", err)
+	}
+
+	return entries, nil
+}
+
+// Close closes the underlying file.
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.file.Close()
+}
+
+// RedactBody replaces the values of sensitive fields in a JSON body.
+// Bodies that aren't valid JSON are replaced by a placeholder rather than stored verbatim.
+func RedactBody(body []byte) json.RawMessage {
+	if len(body) == 0 {
+
+		return nil
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+
+		return json.RawMessage(`"` + redacted + `"`)
+	}
+
+	data, err := json.Marshal(redact(value))
+	if err != nil {
+
+		return nil
+	}
+
+	return data
+}
+
+func redact(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, val := range v {
+			if isSensitive(key) {
+				v[key] = redacted
+				continue
+			}
+			v[key] = redact(val)
+		}
+	case []interface{}:
+		for i, val := range v {
+			v[i] = redact(val)
+		}
+	}
+
+	return value
+}
+
+func isSensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, sensitive := range sensitiveKeys {
+		if strings.Contains(key, sensitive) {
+
+			return true
+		}
+	}
+
+	return false
+}
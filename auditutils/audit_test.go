@@ -0,0 +1,93 @@
+package auditutils_test
+
+import (
+	"encoding/json"
+	"helm-api/auditutils"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileStoreQuery(t *testing.T) {
+	store, err := auditutils.NewFileStore(filepath.Join(t.TempDir(), "audit.jsonl"))
+	require.NoError(t, err)
+	defer store.Close()
+
+	now := time.Date(2024, 12, 1, 12, 0, 0, 0, time.UTC)
+	entries := []auditutils.Entry{
+		{Time: now.Add(-2 * time.Hour), Actor: "qa", Env: "chart1", Endpoint: "/create-env", Status: 201, Outcome: "success"},
+		{Time: now.Add(-time.Hour), Actor: "dev", Env: "chart2", Endpoint: "/create-env", Status: 201, Outcome: "success"},
+		{Time: now, Actor: "qa", Env: "chart1", Endpoint: "/delete-env/{chartName}", Status: 500, Outcome: "failure"},
+	}
+	for _, entry := range entries {
+		require.NoError(t, store.Append(entry))
+	}
+
+	tests := []struct {
+		name      string
+		filter    auditutils.Filter
+		wantCount int
+	}{
+		{"no filter", auditutils.Filter{}, 3},
+		{"by env", auditutils.Filter{Env: "chart1"}, 2},
+		{"by actor", auditutils.Filter{Actor: "dev"}, 1},
+		{"since", auditutils.Filter{Since: now.Add(-90 * time.Minute)}, 2},
+		{"until", auditutils.Filter{Until: now.Add(-90 * time.Minute)}, 1},
+		{"combined", auditutils.Filter{Env: "chart1", Actor: "qa", Since: now.Add(-time.Minute)}, 1},
+		{"no match", auditutils.Filter{Env: "unknown"}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := store.Query(tt.filter)
+			require.NoError(t, err)
+			assert.Len(t, got, tt.wantCount)
+		})
+	}
+}
+
+func TestRedactBody(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "nested secrets",
+			body: `{"chartMetadata":{"name":"chart1"},"values":{"rootPassword":"hunter2","db":{"apiToken":"abc"}}}`,
+			want: `{"chartMetadata":{"name":"chart1"},"values":{"db":{"apiToken":"[REDACTED]"},"rootPassword":"[REDACTED]"}}`,
+		},
+		{
+			name: "secrets in arrays",
+			body: `[{"secret":"x"},{"name":"y"}]`,
+			want: `[{"secret":"[REDACTED]"},{"name":"y"}]`,
+		},
+		{
+			name: "invalid json",
+			body: `password=hunter2`,
+			want: `"[REDACTED]"`,
+		},
+		{
+			name: "empty body",
+			body: ``,
+			want: ``,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := auditutils.RedactBody([]byte(tt.body))
+			if tt.want == "" {
+				assert.Nil(t, got)
+
+				return
+			}
+
+			assert.True(t, json.Valid(got))
+			assert.JSONEq(t, tt.want, string(got))
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package auditutils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// maxBodySize limits how much of a request body is kept in the audit log.
+const maxBodySize = 64 * 1024
+
+type contextKey struct{}
+
+// IdentityFunc resolves the actor and key ID of a request.
+type IdentityFunc func(r *http.Request) (actor, keyID string)
+
+// ErrorLogger reports audit write failures.
+type ErrorLogger interface {
+	Errorf(format string, args ...interface{})
+}
+
+// SetRevision records the Helm revision produced by the request.
+func SetRevision(ctx context.Context, revision int) {
+	if entry, ok := ctx.Value(contextKey{}).(*Entry); ok {
+		entry.Revision = revision
+	}
+}
+
+// SetEnv records the environment the request acted on.
+func SetEnv(ctx context.Context, env string) {
+	if entry, ok := ctx.Value(contextKey{}).(*Entry); ok {
+		entry.Env = env
+	}
+}
+
+// Middleware records every mutating request routed through chi into the store.
+func Middleware(store Store, identity IdentityFunc, logger ErrorLogger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+				next.ServeHTTP(w, r)
+
+				return
+			}
+
+			var body []byte
+			if r.Body != nil {
+				body, _ = io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+				r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+			}
+
+			actor, keyID := identity(r)
+			entry := &Entry{
+				Time:   time.Now().UTC(),
+				Actor:  actor,
+				KeyID:  keyID,
+				Method: r.Method,
+				Body:   RedactBody(body),
+				Env:    envFromBody(body),
+			}
+
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r.WithContext(context.WithValue(r.Context(), contextKey{}, entry)))
+
+			entry.Endpoint = r.URL.Path
+			if rctx := chi.RouteContext(r.Context()); rctx != nil {
+				if pattern := rctx.RoutePattern(); pattern != "" {
+					entry.Endpoint = pattern
+				}
+				if entry.Env == "" {
+					entry.Env = rctx.URLParam("chartName")
+				}
+				if entry.Env == "" {
+					entry.Env = rctx.URLParam("name")
+				}
+			}
+
+			entry.Status = ww.Status()
+			if entry.Status == 0 {
+				entry.Status = http.StatusOK
+			}
+			entry.Outcome = "success"
+			if entry.Status >= http.StatusBadRequest {
+				entry.Outcome = "failure"
+			}
+
+			if err := store.Append(*entry); err != nil {
+				logger.Errorf("Failed to write audit entry: %v", err)
+			}
+		})
+	}
+}
+
+func envFromBody(body []byte) string {
+	var req struct {
+		ChartMetadata struct {
+			Name string `json:"name"`
+		} `json:"chartMetadata"`
+	}
+
+	if err := json.Unmarshal(body, &req); err != nil {
+
+		return ""
+	}
+
+	return req.ChartMetadata.Name
+}
@@ -0,0 +1,156 @@
+package auditutils_test
+
+import (
+	"helm-api/auditutils"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// MockStore is a mock implementation of the Store interface.
+type MockStore struct {
+	mock.Mock
+}
+
+func (m *MockStore) Append(entry auditutils.Entry) error {
+	args := m.Called(entry)
+	return args.Error(0)
+}
+
+func (m *MockStore) Query(filter auditutils.Filter) ([]auditutils.Entry, error) {
+	args := m.Called(filter)
+	return args.Get(0).([]auditutils.Entry), args.Error(1)
+}
+
+type MockErrorLogger struct {
+	mock.Mock
+}
+
+func (m *MockErrorLogger) Errorf(format string, args ...interface{}) {
+	m.Called(args...)
+}
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		body         string
+		status       int
+		wantRecorded bool
+		wantEntry    auditutils.Entry
+	}{
+		{
+			name:         "create records env from body and revision",
+			method:       http.MethodPost,
+			path:         "/create-env",
+			body:         `{"chartMetadata":{"name":"chart1"}}`,
+			status:       http.StatusCreated,
+			wantRecorded: true,
+			wantEntry: auditutils.Entry{
+				Actor:    "qa",
+				KeyID:    "key1",
+				Method:   http.MethodPost,
+				Endpoint: "/create-env",
+				Env:      "chart1",
+				Status:   http.StatusCreated,
+				Outcome:  "success",
+				Revision: 1,
+			},
+		},
+		{
+			name:         "delete records env from url and failure",
+			method:       http.MethodPost,
+			path:         "/delete-env/chart2",
+			status:       http.StatusInternalServerError,
+			wantRecorded: true,
+			wantEntry: auditutils.Entry{
+				Actor:    "qa",
+				KeyID:    "key1",
+				Method:   http.MethodPost,
+				Endpoint: "/delete-env/{chartName}",
+				Env:      "chart2",
+				Status:   http.StatusInternalServerError,
+				Outcome:  "failure",
+				Revision: 1,
+			},
+		},
+		{
+			name:         "env routes record env from name",
+			method:       http.MethodPost,
+			path:         "/envs/demo/connect",
+			status:       http.StatusBadGateway,
+			wantRecorded: true,
+			wantEntry: auditutils.Entry{
+				Actor:    "qa",
+				KeyID:    "key1",
+				Method:   http.MethodPost,
+				Endpoint: "/envs/{name}/connect",
+				Env:      "demo",
+				Status:   http.StatusBadGateway,
+				Outcome:  "failure",
+				Revision: 1,
+			},
+		},
+		{
+			name:         "reads are not recorded",
+			method:       http.MethodGet,
+			path:         "/list",
+			status:       http.StatusOK,
+			wantRecorded: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := new(MockStore)
+			logger := new(MockErrorLogger)
+
+			var recorded []auditutils.Entry
+			store.On("Append", mock.Anything).Run(func(args mock.Arguments) {
+				recorded = append(recorded, args.Get(0).(auditutils.Entry))
+			}).Return(nil)
+
+			identity := func(r *http.Request) (string, string) {
+				return "qa", "key1"
+			}
+
+			handler := func(w http.ResponseWriter, r *http.Request) {
+				auditutils.SetRevision(r.Context(), 1)
+				w.WriteHeader(tt.status)
+			}
+
+			r := chi.NewRouter()
+			r.Use(auditutils.Middleware(store, identity, logger))
+			r.Post("/create-env", handler)
+			r.Post("/delete-env/{chartName}", handler)
+			r.Post("/envs/{name}/connect", handler)
+			r.Get("/list", handler)
+
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.status, rr.Code)
+
+			if !tt.wantRecorded {
+				assert.Empty(t, recorded)
+
+				return
+			}
+
+			require.Len(t, recorded, 1)
+			got := recorded[0]
+			assert.False(t, got.Time.IsZero())
+			got.Time = tt.wantEntry.Time
+			got.Body = nil
+			assert.Equal(t, tt.wantEntry, got)
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
 	"github.com/aws/aws-sdk-go-v2/service/ssm"
 )
 
@@ -24,7 +25,8 @@ func (r *RealAWSConfigLoader) Load(ctx context.Context, region string) (aws.Conf
 }
 
 type AWSClients struct {
-	SSM SSM
+	SSM            SSM
+	SecretsManager SecretsManager
 	// Add other clients as needed.
 }
 
@@ -47,7 +49,8 @@ func InitializeAWSClients(ctx context.Context, loader AWSConfigLoader, region st
 	}
 
 	clients := &AWSClients{
-		SSM: ssm.NewFromConfig(cfg),
+		SSM:            ssm.NewFromConfig(cfg),
+		SecretsManager: secretsmanager.NewFromConfig(cfg),
 		// Initialize other clients.
 	}
 
@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
 	"github.com/aws/aws-sdk-go-v2/service/ssm"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -43,6 +44,7 @@ func TestInitializeAWSClients_Success(t *testing.T) {
 	require.NoError(t, err)
 	assert.NotNil(t, clients)
 	assert.IsType(t, &ssm.Client{}, clients.SSM)
+	assert.IsType(t, &secretsmanager.Client{}, clients.SecretsManager)
 
 	// Verify that all expectations were met.
 	mockLoader.AssertExpectations(t)
@@ -0,0 +1,84 @@
+package awsutils
+
+import (
+	"errors"
+	"fmt"
+	"helm-api/defaults"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// SSMConfig describes which SSM parameters hold the API keys.
+type SSMConfig struct {
+	Region string `yaml:"region"`
+	// Parameters maps SSM parameter names to API key names.
+	Parameters map[string]string `yaml:"parameters"`
+	// Path loads every parameter under the prefix, named after its last path element.
+	Path      string `yaml:"path"`
+	Recursive bool   `yaml:"recursive"`
+}
+
+// LoadSSMConfig reads the SSM configuration from an optional YAML file and applies the
+// HELM_API_AWS_REGION, HELM_API_SSM_PARAMETERS and HELM_API_SSM_PATH overrides.
+func LoadSSMConfig(path string) (*SSMConfig, error) {
+	config := &SSMConfig{
+		Region:     defaults.AwsRegion,
+		Parameters: map[string]string{},
+	}
+
+	for name, key := range defaults.SsmParams {
+		config.Parameters[name] = key
+	}
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+
+			return nil, fmt.Errorf("failed to read SSM config: %w", err)
+		}
+
+		var fileConfig SSMConfig
+		if err := yaml.UnmarshalStrict(data, &fileConfig); err != nil {
+
+			return nil, fmt.Errorf("failed to parse SSM config: %w", err)
+		}
+
+		if fileConfig.Region != "" {
+			config.Region = fileConfig.Region
+		}
+		for name, key := range fileConfig.Parameters {
+			config.Parameters[name] = key
+		}
+		config.Path = fileConfig.Path
+		config.Recursive = fileConfig.Recursive
+	}
+
+	if region := os.Getenv("HELM_API_AWS_REGION"); region != "" {
+		config.Region = region
+	}
+
+	// HELM_API_SSM_PARAMETERS is a comma separated list of <ssm-name>=<key-name> pairs.
+	if params := os.Getenv("HELM_API_SSM_PARAMETERS"); params != "" {
+		for _, pair := range strings.Split(params, ",") {
+			name, key, found := strings.Cut(strings.TrimSpace(pair), "=")
+			if !found || name == "" || key == "" {
+
+				return nil, fmt.Errorf("invalid HELM_API_SSM_PARAMETERS entry %q, expected <ssm-name>=<key-name>", pair)
+			}
+			config.Parameters[name] = key
+		}
+	}
+
+	if prefix := os.Getenv("HELM_API_SSM_PATH"); prefix != "" {
+		config.Path = prefix
+	}
+
+	if len(config.Parameters) == 0 && config.Path == "" {
+
+		return nil, errors.New("no SSM parameters configured, set HELM_API_SSM_PARAMETERS, HELM_API_SSM_PATH or HELM_API_SSM_CONFIG")
+	}
+
+	return config, nil
+}
@@ -0,0 +1,108 @@
+package awsutils_test
+
+import (
+	"helm-api/awsutils"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadSSMConfig(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "ssm.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte(`region: eu-west-1
+parameters:
+  /helm-api/create: HELM_API_CREATE_API_KEY
+path: /helm-api/keys
+recursive: true
+`), 0644))
+
+	invalidFile := filepath.Join(dir, "invalid.yaml")
+	require.NoError(t, os.WriteFile(invalidFile, []byte("unknown: field\n"), 0644))
+
+	tests := []struct {
+		name        string
+		path        string
+		envVars     map[string]string
+		expected    *awsutils.SSMConfig
+		expectError bool
+	}{
+		{
+			name: "config file",
+			path: configFile,
+			expected: &awsutils.SSMConfig{
+				Region:     "eu-west-1",
+				Parameters: map[string]string{"/helm-api/create": "HELM_API_CREATE_API_KEY"},
+				Path:       "/helm-api/keys",
+				Recursive:  true,
+			},
+		},
+		{
+			name: "env overrides file",
+			path: configFile,
+			envVars: map[string]string{
+				"HELM_API_AWS_REGION":     "us-west-2",
+				"HELM_API_SSM_PARAMETERS": "/helm-api/delete=HELM_API_DELETE_API_KEY, /helm-api/create=CREATE",
+				"HELM_API_SSM_PATH":       "/other",
+			},
+			expected: &awsutils.SSMConfig{
+				Region: "us-west-2",
+				Parameters: map[string]string{
+					"/helm-api/create": "CREATE",
+					"/helm-api/delete": "HELM_API_DELETE_API_KEY",
+				},
+				Path:      "/other",
+				Recursive: true,
+			},
+		},
+		{
+			name:    "env only",
+			envVars: map[string]string{"HELM_API_SSM_PATH": "/helm-api/keys"},
+			expected: &awsutils.SSMConfig{
+				Region:     "us-east-1",
+				Parameters: map[string]string{},
+				Path:       "/helm-api/keys",
+			},
+		},
+		{
+			name:        "nothing configured",
+			expectError: true,
+		},
+		{
+			name:        "invalid parameter pair",
+			envVars:     map[string]string{"HELM_API_SSM_PARAMETERS": "/helm-api/create"},
+			expectError: true,
+		},
+		{
+			name:        "unknown field in file",
+			path:        invalidFile,
+			expectError: true,
+		},
+		{
+			name:        "missing file",
+			path:        filepath.Join(dir, "missing.yaml"),
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"HELM_API_AWS_REGION", "HELM_API_SSM_PARAMETERS", "HELM_API_SSM_PATH"} {
+				t.Setenv(key, tt.envVars[key])
+			}
+
+			config, err := awsutils.LoadSSMConfig(tt.path)
+			if tt.expectError {
+				assert.Error(t, err)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, config)
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package awsutils
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"helm-api/helmutils"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+// S3ChartStore keeps each chart packed in the object <Prefix><name>.tgz of an S3 bucket. Endpoint
+// selects an S3 compatible storage, such as MinIO, instead of AWS. Buckets are addressed in the
+// path, which every S3 compatible storage supports.
+type S3ChartStore struct {
+	Endpoint    string
+	Region      string
+	Bucket      string
+	Prefix      string
+	Credentials aws.CredentialsProvider
+	Client      *http.Client
+}
+
+var _ helmutils.ChartStore = (*S3ChartStore)(nil)
+
+// s3Error is the error document returned by S3.
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// listBucketResult is the page of keys returned by ListObjectsV2.
+type listBucketResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// Put uploads the packed chart.
+func (s *S3ChartStore) Put(ctx context.Context, name string, files []*helmutils.ChartFile) error {
+	data, err := helmutils.ArchiveChart(name, files)
+	if err != nil {
+
+		return err
+	}
+
+	resp, err := s.do(ctx, http.MethodPut, s.key(name), nil, data)
+	if err != nil {
+
+		return fmt.Errorf("failed to store chart %s: %w", name, err)
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+// Get downloads and unpacks the chart.
+func (s *S3ChartStore) Get(ctx context.Context, name string) ([]*helmutils.ChartFile, error) {
+	resp, err := s.do(ctx, http.MethodGet, s.key(name), nil, nil)
+	if err != nil {
+
+		return nil, fmt.Errorf("failed to read chart %s: %w", name, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+
+		return nil, fmt.Errorf("failed to read chart %s: %w", name, err)
+	}
+
+	return helmutils.UnarchiveChart(data)
+}
+
+// List returns the charts under the prefix, following the pages of ListObjectsV2.
+func (s *S3ChartStore) List(ctx context.Context) ([]string, error) {
+	names := []string{}
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {s.Prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		resp, err := s.do(ctx, http.MethodGet, "", query, nil)
+		if err != nil {
+
+			return nil, fmt.Errorf("failed to list charts: %w", err)
+		}
+
+		var page listBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+
+			return nil, fmt.Errorf("failed to list charts: %w", err)
+		}
+
+		for _, object := range page.Contents {
+			name, found := strings.CutSuffix(strings.TrimPrefix(object.Key, s.Prefix), ".tgz")
+			if found && name != "" && !strings.Contains(name, "/") {
+				names = append(names, name)
+			}
+		}
+
+		if !page.IsTruncated {
+			break
+		}
+		token = page.NextContinuationToken
+	}
+	slices.Sort(names)
+
+	return names, nil
+}
+
+// Delete removes the object of the chart, S3 ignores missing objects.
+func (s *S3ChartStore) Delete(ctx context.Context, name string) error {
+	resp, err := s.do(ctx, http.MethodDelete, s.key(name), nil, nil)
+	if err != nil {
+
+		return fmt.Errorf("failed to delete chart %s: %w", name, err)
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+func (s *S3ChartStore) key(name string) string {
+	return s.Prefix + name + ".tgz"
+}
+
+// do sends a request signed with Signature Version 4 for the key of the bucket, or the bucket
+// itself when key is empty. Missing keys fail with helmutils.ErrChartNotFound, the other
+// failures with the S3 error code.
+func (s *S3ChartStore) do(ctx context.Context, method, key string, query url.Values, body []byte) (*http.Response, error) {
+	endpoint := s.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + s.Region + ".amazonaws.com"
+	}
+
+	path := "/" + s.Bucket
+	if key != "" {
+		path += "/" + key
+	}
+	target, err := url.Parse(strings.TrimSuffix(endpoint, "/") + path)
+	if err != nil {
+
+		return nil, fmt.Errorf("invalid S3 endpoint %q: %w", endpoint, err)
+	}
+	target.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), bytes.NewReader(body))
+	if err != nil {
+
+		return nil, err
+	}
+
+	credentials, err := s.Credentials.Retrieve(ctx)
+	if err != nil {
+
+		return nil, fmt.Errorf("failed to retrieve AWS credentials: %w", err)
+	}
+
+	hash := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(hash[:])
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	signer := v4.NewSigner(func(options *v4.SignerOptions) { options.DisableURIPathEscaping = true })
+	if err := signer.SignHTTP(ctx, credentials, req, payloadHash, "s3", s.Region, time.Now()); err != nil {
+
+		return nil, fmt.Errorf("failed to sign S3 request: %w", err)
+	}
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+
+		return nil, err
+	}
+	if resp.StatusCode < http.StatusMultipleChoices {
+
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	var failure s3Error
+	xml.NewDecoder(resp.Body).Decode(&failure)
+	switch {
+	case resp.StatusCode == http.StatusNotFound && key != "" && (failure.Code == "" || failure.Code == "NoSuchKey"):
+
+		return nil, fmt.Errorf("%w: %s", helmutils.ErrChartNotFound, key)
+	case failure.Code == "":
+
+		return nil, fmt.Errorf("S3 %s %s: %s", method, target.Path, resp.Status)
+	default:
+
+		return nil, fmt.Errorf("S3 %s %s: %s: %s", method, target.Path, failure.Code, failure.Message)
+	}
+}
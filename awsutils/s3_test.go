@@ -0,0 +1,154 @@
+package awsutils_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"helm-api/awsutils"
+	"helm-api/helmutils"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeS3 is a stand-in for the S3 API serving one bucket, listing one key per page.
+type fakeS3 struct {
+	mu      sync.Mutex
+	bucket  string
+	objects map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	hash := sha256.Sum256(body)
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") || r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(hash[:]) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`<Error><Code>SignatureDoesNotMatch</Code><Message>bad signature</Message></Error>`))
+
+		return
+	}
+
+	key, found := strings.CutPrefix(r.URL.Path, "/"+f.bucket+"/")
+	if r.URL.Path == "/"+f.bucket && r.Method == http.MethodGet {
+		f.list(w, r)
+
+		return
+	}
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`<Error><Code>NoSuchBucket</Code><Message>The specified bucket does not exist</Message></Error>`))
+
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		f.objects[key] = body
+	case http.MethodGet:
+		data, exists := f.objects[key]
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`))
+
+			return
+		}
+		w.Write(data)
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, r *http.Request) {
+	keys := []string{}
+	for key := range f.objects {
+		if strings.HasPrefix(key, r.URL.Query().Get("prefix")) {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+
+	start := 0
+	if token := r.URL.Query().Get("continuation-token"); token != "" {
+		start = slices.Index(keys, token)
+	}
+
+	type object struct {
+		Key string `xml:"Key"`
+	}
+	page := struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		Contents              []object `xml:"Contents"`
+		IsTruncated           bool     `xml:"IsTruncated"`
+		NextContinuationToken string   `xml:"NextContinuationToken,omitempty"`
+	}{}
+	if start < len(keys) {
+		page.Contents = []object{{Key: keys[start]}}
+	}
+	if start+1 < len(keys) {
+		page.IsTruncated = true
+		page.NextContinuationToken = keys[start+1]
+	}
+	xml.NewEncoder(w).Encode(page)
+}
+
+func TestS3ChartStore(t *testing.T) {
+	fake := &fakeS3{bucket: "charts", objects: map[string][]byte{"other/unrelated.tgz": []byte("x")}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	store := &awsutils.S3ChartStore{
+		Endpoint: server.URL,
+		Region:   "us-east-1",
+		Bucket:   "charts",
+		Prefix:   "helm-api/",
+		Credentials: aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}, nil
+		}),
+	}
+	files := []*helmutils.ChartFile{
+		{Name: "Chart.yaml", Data: []byte("apiVersion: v2\nname: test-demo\nversion: 0.1.0\n")},
+		{Name: "templates/statefulset.yaml", Data: []byte("kind: StatefulSet\n")},
+	}
+	ctx := context.Background()
+
+	_, err := store.Get(ctx, "test-demo")
+	assert.ErrorIs(t, err, helmutils.ErrChartNotFound)
+
+	require.NoError(t, store.Put(ctx, "test-demo", files))
+	require.NoError(t, store.Put(ctx, "test-other", files))
+	assert.Contains(t, fake.objects, "helm-api/test-demo.tgz")
+
+	stored, err := store.Get(ctx, "test-demo")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, files, stored)
+
+	// Every page is listed, the keys outside the prefix are skipped.
+	names, err := store.List(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"test-demo", "test-other"}, names)
+
+	require.NoError(t, store.Delete(ctx, "test-demo"))
+	_, err = store.Get(ctx, "test-demo")
+	assert.ErrorIs(t, err, helmutils.ErrChartNotFound)
+
+	// S3 failures carry the error code.
+	store.Bucket = "missing"
+	_, err = store.List(ctx)
+	assert.ErrorContains(t, err, "NoSuchBucket")
+	_, err = store.Get(ctx, "test-other")
+	assert.ErrorContains(t, err, "NoSuchBucket")
+	assert.NotErrorIs(t, err, helmutils.ErrChartNotFound)
+}
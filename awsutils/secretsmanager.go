@@ -0,0 +1,69 @@
+package awsutils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// SecretsManager defines the interface for the GetSecretValue function.
+// We use this interface to test the function using a mock.
+type SecretsManager interface {
+	GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
+}
+
+// FetchSecretKeys reads a JSON secret and returns its string fields.
+// When keysMap is set, only the mapped fields are returned under their mapped name.
+func FetchSecretKeys(ctx context.Context, client SecretsManager, secretID string, keysMap map[string]string) (map[string]string, error) {
+
+	result, err := client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: &secretID,
+	})
+	if err != nil {
+
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	if result.SecretString == nil {
+
+		return nil, fmt.Errorf("secret %s has no string value", secretID)
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(*result.SecretString), &fields); err != nil {
+
+		return nil, fmt.Errorf("secret %s is not a JSON object: %w", secretID, err)
+	}
+
+	values := make(map[string]string, len(fields))
+	for field, value := range fields {
+		str, ok := value.(string)
+		if !ok {
+			continue
+		}
+
+		if len(keysMap) == 0 {
+			values[field] = str
+			continue
+		}
+
+		if name, exists := keysMap[field]; exists {
+			values[name] = str
+		}
+	}
+
+	return values, nil
+}
+
+// SecretsManagerKeySource reads API keys from a JSON secret for the key refresher.
+type SecretsManagerKeySource struct {
+	Client   SecretsManager
+	SecretID string
+	Keys     map[string]string
+}
+
+func (s *SecretsManagerKeySource) Fetch(ctx context.Context) (map[string]string, error) {
+	return FetchSecretKeys(ctx, s.Client, s.SecretID, s.Keys)
+}
@@ -0,0 +1,95 @@
+package awsutils_test
+
+import (
+	"context"
+	"helm-api/awsutils"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockSecretsManager is a mock implementation of the SecretsManager interface
+type MockSecretsManager struct {
+	mock.Mock
+}
+
+func (m *MockSecretsManager) GetSecretValue(ctx context.Context, input *secretsmanager.GetSecretValueInput, opts ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	args := m.Called(ctx, input, opts)
+	return args.Get(0).(*secretsmanager.GetSecretValueOutput), args.Error(1)
+}
+
+func TestSecretsManagerKeySourceFetch(t *testing.T) {
+	tests := []struct {
+		name         string
+		keysMap      map[string]string
+		mockResponse *secretsmanager.GetSecretValueOutput
+		mockError    error
+		expectedKeys map[string]string
+		expectError  bool
+	}{
+		{
+			name: "fields used as key names",
+			mockResponse: &secretsmanager.GetSecretValueOutput{
+				SecretString: stringPtr(`{"HELM_API_CREATE_API_KEY":"create","HELM_API_DELETE_API_KEY":"delete","version":2}`),
+			},
+			expectedKeys: map[string]string{
+				"HELM_API_CREATE_API_KEY": "create",
+				"HELM_API_DELETE_API_KEY": "delete",
+			},
+		},
+		{
+			name: "mapped fields only",
+			keysMap: map[string]string{
+				"create": "HELM_API_CREATE_API_KEY",
+			},
+			mockResponse: &secretsmanager.GetSecretValueOutput{
+				SecretString: stringPtr(`{"create":"create-key","other":"ignored"}`),
+			},
+			expectedKeys: map[string]string{
+				"HELM_API_CREATE_API_KEY": "create-key",
+			},
+		},
+		{
+			name: "secret is not JSON",
+			mockResponse: &secretsmanager.GetSecretValueOutput{
+				SecretString: stringPtr("plain-text"),
+			},
+			expectError: true,
+		},
+		{
+			name:         "binary secret",
+			mockResponse: &secretsmanager.GetSecretValueOutput{},
+			expectError:  true,
+		},
+		{
+			name:         "AWS service error",
+			mockResponse: &secretsmanager.GetSecretValueOutput{},
+			mockError:    assert.AnError,
+			expectError:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := new(MockSecretsManager)
+			secretID := "helm-api/api-keys"
+
+			expectedInput := &secretsmanager.GetSecretValueInput{SecretId: &secretID}
+			mockClient.On("GetSecretValue", mock.Anything, expectedInput, mock.Anything).Return(tt.mockResponse, tt.mockError)
+
+			source := &awsutils.SecretsManagerKeySource{Client: mockClient, SecretID: secretID, Keys: tt.keysMap}
+			keys, err := source.Fetch(context.Background())
+
+			if tt.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedKeys, keys)
+			}
+
+			mockClient.AssertExpectations(t)
+		})
+	}
+}
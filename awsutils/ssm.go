@@ -4,43 +4,159 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path"
+	"sort"
+	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/service/ssm"
 )
 
+// maxParametersPerCall is the GetParameters limit on names per request.
+const maxParametersPerCall = 10
+
 // SSMPutParameterAPI defines the interface for the PutParameter function.
 // We use this interface to test the function using a mock.
 type SSM interface {
 	GetParameters(ctx context.Context, params *ssm.GetParametersInput, optFns ...func(*ssm.Options)) (*ssm.GetParametersOutput, error)
+	GetParametersByPath(ctx context.Context, params *ssm.GetParametersByPathInput, optFns ...func(*ssm.Options)) (*ssm.GetParametersByPathOutput, error)
+}
+
+// InvalidParametersError lists the requested parameters SSM couldn't find.
+type InvalidParametersError struct {
+	Names []string
+}
+
+func (e *InvalidParametersError) Error() string {
+	return fmt.Sprintf("required SSM parameters not found: %s", strings.Join(e.Names, ", "))
 }
 
 // Gett SSM Parameters values.
 func GetSSMParameters(ctx context.Context, client SSM, parametersMap map[string]string) error {
 
+	values, err := FetchSSMParameters(ctx, client, parametersMap)
+	if err != nil {
+
+		return err
+	}
+
+	// Set environment variables using mapping.
+	for envName, value := range values {
+		if err := os.Setenv(envName, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// FetchSSMParameters returns the decrypted parameter values keyed by their mapped name.
+// Every mapped parameter is required, missing ones are reported in an InvalidParametersError.
+func FetchSSMParameters(ctx context.Context, client SSM, parametersMap map[string]string) (map[string]string, error) {
+
 	var paramNames []string
 	for ssmName := range parametersMap {
 		paramNames = append(paramNames, ssmName)
 	}
+	sort.Strings(paramNames)
+
+	values := make(map[string]string, len(paramNames))
+	var invalid []string
+
+	for start := 0; start < len(paramNames); start += maxParametersPerCall {
+		end := min(start+maxParametersPerCall, len(paramNames))
+
+		decryption := true
+		input := &ssm.GetParametersInput{
+			Names:          paramNames[start:end],
+			WithDecryption: &decryption,
+		}
+
+		result, err := client.GetParameters(ctx, input)
+		if err != nil {
+
+			return nil, fmt.Errorf("%w", err)
+		}
+
+		for _, param := range result.Parameters {
+			if envName, exists := parametersMap[*param.Name]; exists {
+				values[envName] = *param.Value
+			}
+		}
+
+		invalid = append(invalid, result.InvalidParameters...)
+	}
+
+	if len(invalid) > 0 {
+
+		return nil, &InvalidParametersError{Names: invalid}
+	}
+
+	return values, nil
+}
+
+// FetchSSMParametersByPath returns the decrypted values of every parameter under the prefix,
+// keyed by the last element of the parameter name.
+func FetchSSMParametersByPath(ctx context.Context, client SSM, prefix string, recursive bool) (map[string]string, error) {
+
 	decryption := true
-	input := &ssm.GetParametersInput{
-		Names:          paramNames,
+	input := &ssm.GetParametersByPathInput{
+		Path:           &prefix,
+		Recursive:      &recursive,
 		WithDecryption: &decryption,
 	}
 
-	result, err := client.GetParameters(ctx, input)
-	if err != nil {
+	values := map[string]string{}
+	paginator := ssm.NewGetParametersByPathPaginator(client, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+
+			return nil, fmt.Errorf("%w", err)
+		}
 
-		return fmt.Errorf("%w", err)
+		for _, param := range page.Parameters {
+			values[path.Base(*param.Name)] = *param.Value
+		}
 	}
 
-	// Set environment variables using mapping.
-	for _, param := range result.Parameters {
-		if envName, exists := parametersMap[*param.Name]; exists {
-			if err := os.Setenv(envName, *param.Value); err != nil {
-				return err
-			}
+	return values, nil
+}
+
+// SSMKeySource reads API keys from SSM Parameter Store for the key refresher.
+type SSMKeySource struct {
+	Client    SSM
+	Params    map[string]string
+	Path      string
+	Recursive bool
+}
+
+func (s *SSMKeySource) Fetch(ctx context.Context) (map[string]string, error) {
+	values := map[string]string{}
+
+	if s.Path != "" {
+		byPath, err := FetchSSMParametersByPath(ctx, s.Client, s.Path, s.Recursive)
+		if err != nil {
+
+			return nil, err
+		}
+
+		for name, value := range byPath {
+			values[name] = value
 		}
 	}
 
-	return nil
+	// Explicitly mapped parameters take precedence over the prefix.
+	if len(s.Params) > 0 {
+		mapped, err := FetchSSMParameters(ctx, s.Client, s.Params)
+		if err != nil {
+
+			return nil, err
+		}
+
+		for name, value := range mapped {
+			values[name] = value
+		}
+	}
+
+	return values, nil
 }
@@ -2,8 +2,10 @@ package awsutils_test
 
 import (
 	"context"
+	"fmt"
 	"helm-api/awsutils"
 	"os"
+	"sort"
 	"testing"
 
 	"github.com/aws/aws-sdk-go-v2/service/ssm"
@@ -22,6 +24,11 @@ func (m *MockSSM) GetParameters(ctx context.Context, input *ssm.GetParametersInp
 	return args.Get(0).(*ssm.GetParametersOutput), args.Error(1)
 }
 
+func (m *MockSSM) GetParametersByPath(ctx context.Context, input *ssm.GetParametersByPathInput, opts ...func(*ssm.Options)) (*ssm.GetParametersByPathOutput, error) {
+	args := m.Called(ctx, input, opts)
+	return args.Get(0).(*ssm.GetParametersByPathOutput), args.Error(1)
+}
+
 func TestGetSSMParameters(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -84,6 +91,7 @@ func TestGetSSMParameters(t *testing.T) {
 			for name := range tt.parametersMap {
 				expectedParamNames = append(expectedParamNames, name)
 			}
+			sort.Strings(expectedParamNames)
 			decryption := true
 			expectedInput := &ssm.GetParametersInput{
 				Names:          expectedParamNames,
@@ -119,3 +127,106 @@ func TestGetSSMParameters(t *testing.T) {
 func stringPtr(s string) *string {
 	return &s
 }
+
+func TestSSMKeySourceFetch(t *testing.T) {
+	mockClient := new(MockSSM)
+	params := map[string]string{
+		"/helm-api/create-key": "HELM_API_CREATE_API_KEY",
+	}
+
+	mockClient.On("GetParameters", mock.Anything, mock.Anything, mock.Anything).Return(&ssm.GetParametersOutput{
+		Parameters: []types.Parameter{
+			{
+				Name:  stringPtr("/helm-api/create-key"),
+				Value: stringPtr("rotated-key"),
+			},
+			{
+				Name:  stringPtr("/helm-api/unmapped"),
+				Value: stringPtr("ignored"),
+			},
+		},
+	}, nil)
+
+	source := &awsutils.SSMKeySource{Client: mockClient, Params: params}
+	keys, err := source.Fetch(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"HELM_API_CREATE_API_KEY": "rotated-key"}, keys)
+	mockClient.AssertExpectations(t)
+}
+
+func TestFetchSSMParametersBatchesAndReportsInvalid(t *testing.T) {
+	mockClient := new(MockSSM)
+
+	// 12 parameters need two GetParameters calls.
+	params := map[string]string{}
+	for i := 0; i < 12; i++ {
+		params[fmt.Sprintf("/helm-api/key-%02d", i)] = fmt.Sprintf("KEY_%02d", i)
+	}
+
+	mockClient.On("GetParameters", mock.Anything, mock.MatchedBy(func(input *ssm.GetParametersInput) bool {
+		return len(input.Names) == 10
+	}), mock.Anything).Return(&ssm.GetParametersOutput{
+		Parameters: []types.Parameter{
+			{Name: stringPtr("/helm-api/key-00"), Value: stringPtr("value-00")},
+		},
+		InvalidParameters: []string{"/helm-api/key-01"},
+	}, nil).Once()
+
+	mockClient.On("GetParameters", mock.Anything, mock.MatchedBy(func(input *ssm.GetParametersInput) bool {
+		return len(input.Names) == 2
+	}), mock.Anything).Return(&ssm.GetParametersOutput{
+		InvalidParameters: []string{"/helm-api/key-11"},
+	}, nil).Once()
+
+	values, err := awsutils.FetchSSMParameters(context.Background(), mockClient, params)
+
+	var invalidErr *awsutils.InvalidParametersError
+	assert.ErrorAs(t, err, &invalidErr)
+	assert.Equal(t, []string{"/helm-api/key-01", "/helm-api/key-11"}, invalidErr.Names)
+	assert.Contains(t, err.Error(), "/helm-api/key-01, /helm-api/key-11")
+	assert.Nil(t, values)
+	mockClient.AssertExpectations(t)
+}
+
+func TestSSMKeySourceFetchByPath(t *testing.T) {
+	mockClient := new(MockSSM)
+	prefix := "/helm-api/keys"
+
+	mockClient.On("GetParametersByPath", mock.Anything, mock.MatchedBy(func(input *ssm.GetParametersByPathInput) bool {
+		return *input.Path == prefix && input.NextToken == nil
+	}), mock.Anything).Return(&ssm.GetParametersByPathOutput{
+		Parameters: []types.Parameter{
+			{Name: stringPtr("/helm-api/keys/HELM_API_CREATE_API_KEY"), Value: stringPtr("create-key")},
+		},
+		NextToken: stringPtr("page-2"),
+	}, nil).Once()
+
+	mockClient.On("GetParametersByPath", mock.Anything, mock.MatchedBy(func(input *ssm.GetParametersByPathInput) bool {
+		return input.NextToken != nil && *input.NextToken == "page-2"
+	}), mock.Anything).Return(&ssm.GetParametersByPathOutput{
+		Parameters: []types.Parameter{
+			{Name: stringPtr("/helm-api/keys/HELM_API_DELETE_API_KEY"), Value: stringPtr("delete-key")},
+		},
+	}, nil).Once()
+
+	mockClient.On("GetParameters", mock.Anything, mock.Anything, mock.Anything).Return(&ssm.GetParametersOutput{
+		Parameters: []types.Parameter{
+			{Name: stringPtr("/override/create"), Value: stringPtr("override-key")},
+		},
+	}, nil).Once()
+
+	source := &awsutils.SSMKeySource{
+		Client: mockClient,
+		Params: map[string]string{"/override/create": "HELM_API_CREATE_API_KEY"},
+		Path:   prefix,
+	}
+	keys, err := source.Fetch(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"HELM_API_CREATE_API_KEY": "override-key",
+		"HELM_API_DELETE_API_KEY": "delete-key",
+	}, keys)
+	mockClient.AssertExpectations(t)
+}
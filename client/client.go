@@ -0,0 +1,383 @@
+// Package client is the Go SDK of helm-api.
+package client
+
+import (
+	"bytes"
+	"context"
+	crand "crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"helm-api/defaults"
+	"helm-api/idempotencyutils"
+	"helm-api/problemutils"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"helm.sh/helm/v3/pkg/release"
+)
+
+// RetryPolicy controls how failed calls are retried. Calls are retried when the API answers
+// 429, 502, 503 or 504, and GET calls also on transport errors. The attempts of a call that
+// isn't a GET share one Idempotency-Key, so a retry of a change the API already applied gets
+// its first response instead of running it again.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, 1 disables retries.
+	MaxAttempts int
+	MinBackoff  time.Duration
+	MaxBackoff  time.Duration
+}
+
+// DefaultRetryPolicy is used unless WithRetry is given.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	MinBackoff:  200 * time.Millisecond,
+	MaxBackoff:  5 * time.Second,
+}
+
+// Client calls the helm-api endpoints. It is safe for concurrent use.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	apiKey     string
+	retry      RetryPolicy
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithAPIKey sets the key sent in the X-API-Key header.
+func WithAPIKey(apiKey string) Option {
+	return func(c *Client) { c.apiKey = apiKey }
+}
+
+// WithHTTPClient replaces http.DefaultClient.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) { c.httpClient = httpClient }
+}
+
+// WithRetry replaces DefaultRetryPolicy.
+func WithRetry(policy RetryPolicy) Option {
+	return func(c *Client) { c.retry = policy }
+}
+
+// New returns a client of the API served at baseURL.
+func New(baseURL string, opts ...Option) (*Client, error) {
+	parsed, err := url.Parse(baseURL)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+
+		return nil, fmt.Errorf("invalid helm-api URL %q", baseURL)
+	}
+
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: http.DefaultClient,
+		retry:      DefaultRetryPolicy,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.retry.MaxAttempts < 1 {
+		c.retry.MaxAttempts = 1
+	}
+
+	return c, nil
+}
+
+// CreateEnv creates the chart of a new environment from the source chart and installs it.
+func (c *Client) CreateEnv(ctx context.Context, req Request) (*Response, error) {
+	return c.do(ctx, http.MethodPost, "/create-env", req)
+}
+
+// UpdateEnv upgrades the release of an environment.
+func (c *Client) UpdateEnv(ctx context.Context, name string, req Request) (*Response, error) {
+	return c.do(ctx, http.MethodPost, "/update-env/"+url.PathEscape(name), req)
+}
+
+// ScaleEnv scales the pods of an environment up or down and upgrades its release.
+func (c *Client) ScaleEnv(ctx context.Context, name string, action ScaleAction) (*Response, error) {
+	return c.UpdateEnv(ctx, name, Request{Action: &action})
+}
+
+// Render returns the manifests of an environment rendered with values merged over its own,
+// without applying them. Secret data is redacted.
+func (c *Client) Render(ctx context.Context, name string, values map[string]interface{}) (string, error) {
+	resp, err := c.do(ctx, http.MethodPost, "/envs/"+url.PathEscape(name)+"/render", RenderRequest{Values: values})
+	if err != nil {
+
+		return "", err
+	}
+
+	return resp.Manifest, nil
+}
+
+// DeleteEnv uninstalls an environment and removes its chart.
+func (c *Client) DeleteEnv(ctx context.Context, name string) (*Response, error) {
+	return c.do(ctx, http.MethodPost, "/delete-env/"+url.PathEscape(name), nil)
+}
+
+// ListEnvs returns the names of the environments, without the release prefix, so they can be
+// passed to the other methods.
+func (c *Client) ListEnvs(ctx context.Context) ([]string, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/list", nil)
+	if err != nil {
+
+		return nil, err
+	}
+
+	names := make([]string, 0, len(resp.Data))
+	for _, releaseName := range resp.Data {
+		names = append(names, strings.TrimPrefix(releaseName, defaults.EnvPrefix))
+	}
+
+	return names, nil
+}
+
+// GetEnv returns the status of an environment.
+func (c *Client) GetEnv(ctx context.Context, name string) (*EnvStatus, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/envs/"+url.PathEscape(name), nil)
+	if err != nil {
+
+		return nil, err
+	}
+	if resp.Env == nil {
+
+		return nil, fmt.Errorf("helm-api: response has no environment status")
+	}
+
+	return resp.Env, nil
+}
+
+// WaitForReady polls the environment every interval until all its pods are ready. Environments
+// that aren't listed yet are waited for too, so bound ctx. It fails with ErrEnvFailed when the
+// release failed.
+func (c *Client) WaitForReady(ctx context.Context, name string, interval time.Duration) (*EnvStatus, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		status, err := c.GetEnv(ctx, name)
+		switch {
+		case err == nil && status.Ready:
+
+			return status, nil
+		case err == nil && status.Status == release.StatusFailed.String():
+
+			return status, fmt.Errorf("%w: %s", ErrEnvFailed, name)
+		case err != nil && !errors.Is(err, ErrNotFound):
+
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+
+			return status, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// do sends the request, retrying it according to the retry policy, and decodes the response.
+func (c *Client) do(ctx context.Context, method, path string, body interface{}) (*Response, error) {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+
+			return nil, fmt.Errorf("failed to encode request: %w", err)
+		}
+	}
+
+	var idempotencyKey string
+	if method != http.MethodGet {
+		var err error
+		if idempotencyKey, err = newIdempotencyKey(); err != nil {
+
+			return nil, err
+		}
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < c.retry.MaxAttempts; attempt++ {
+		if attempt > 0 {
+			if err := sleep(ctx, c.backoff(attempt, lastErr)); err != nil {
+
+				return nil, lastErr
+			}
+		}
+
+		resp, err := c.send(ctx, method, path, payload, idempotencyKey)
+		if err == nil {
+
+			return resp, nil
+		}
+		lastErr = err
+
+		if !retryable(method, err) || ctx.Err() != nil {
+
+			return nil, err
+		}
+	}
+
+	return nil, lastErr
+}
+
+// newIdempotencyKey returns a random key for the attempts of one call.
+func newIdempotencyKey() (string, error) {
+	key := make([]byte, 16)
+	if _, err := crand.Read(key); err != nil {
+
+		return "", fmt.Errorf("failed to generate idempotency key: %w", err)
+	}
+
+	return hex.EncodeToString(key), nil
+}
+
+func (c *Client) send(ctx context.Context, method, path string, payload []byte, idempotencyKey string) (*Response, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.apiKey != "" {
+		req.Header.Set("X-API-Key", c.apiKey)
+	}
+	if idempotencyKey != "" {
+		req.Header.Set(idempotencyutils.Header, idempotencyKey)
+	}
+
+	httpResp, err := c.httpClient.Do(req)
+	if err != nil {
+
+		return nil, &transportError{err: err}
+	}
+	defer httpResp.Body.Close()
+
+	data, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+
+		return nil, &transportError{err: fmt.Errorf("failed to read response: %w", err)}
+	}
+
+	if httpResp.StatusCode >= http.StatusBadRequest {
+
+		return nil, apiError(httpResp, data)
+	}
+
+	var resp Response
+	if len(bytes.TrimSpace(data)) > 0 {
+		if err := json.Unmarshal(data, &resp); err != nil {
+			resp = Response{Message: strings.TrimSpace(string(data))}
+		}
+	}
+
+	return &resp, nil
+}
+
+// apiError decodes the problem of an error response. Proxies in front of the API may still
+// answer with plain text, which becomes the message.
+func apiError(httpResp *http.Response, data []byte) *APIError {
+	var problem problemutils.Problem
+	if len(bytes.TrimSpace(data)) > 0 {
+		if err := json.Unmarshal(data, &problem); err != nil {
+			problem = problemutils.Problem{Message: strings.TrimSpace(string(data))}
+		}
+	}
+
+	return &APIError{
+		StatusCode: httpResp.StatusCode,
+		Code:       problem.Code,
+		Message:    problem.Message,
+		Detail:     problem.Error,
+		Quota:      problem.Quota,
+		retryAfter: retryAfter(httpResp.Header.Get("Retry-After")),
+	}
+}
+
+// transportError is a failure to reach the API or read its response.
+type transportError struct {
+	err error
+}
+
+func (e *transportError) Error() string {
+	return "helm-api: " + e.err.Error()
+}
+
+func (e *transportError) Unwrap() error {
+	return e.err
+}
+
+// retryable reports whether a failed call may be sent again. Other methods than GET aren't
+// retried on transport errors since the API may have applied them.
+func retryable(method string, err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+
+		return apiErr.StatusCode == http.StatusTooManyRequests ||
+			apiErr.StatusCode == http.StatusBadGateway ||
+			apiErr.StatusCode == http.StatusServiceUnavailable ||
+			apiErr.StatusCode == http.StatusGatewayTimeout
+	}
+
+	var transportErr *transportError
+
+	return method == http.MethodGet && errors.As(err, &transportErr)
+}
+
+// backoff doubles the wait on every attempt with jitter, honouring Retry-After within MaxBackoff.
+func (c *Client) backoff(attempt int, lastErr error) time.Duration {
+	wait := c.retry.MinBackoff << (attempt - 1)
+	if wait <= 0 || wait > c.retry.MaxBackoff {
+		wait = c.retry.MaxBackoff
+	}
+	if wait > 0 {
+		wait = wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+	}
+
+	var apiErr *APIError
+	if errors.As(lastErr, &apiErr) && apiErr.retryAfter > wait {
+		wait = min(apiErr.retryAfter, c.retry.MaxBackoff)
+	}
+
+	return wait
+}
+
+func retryAfter(value string) time.Duration {
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 {
+
+		return 0
+	}
+
+	return time.Duration(seconds) * time.Second
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+
+		return ctx.Err()
+	case <-timer.C:
+
+		return nil
+	}
+}
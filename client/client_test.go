@@ -0,0 +1,302 @@
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"helm-api/client"
+	"helm-api/idempotencyutils"
+	"helm-api/problemutils"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var fastRetry = client.WithRetry(client.RetryPolicy{
+	MaxAttempts: 3,
+	MinBackoff:  time.Millisecond,
+	MaxBackoff:  5 * time.Millisecond,
+})
+
+func writeJSON(w http.ResponseWriter, status int, resp client.Response) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func TestNew(t *testing.T) {
+	_, err := client.New("localhost:8080")
+	assert.Error(t, err)
+
+	_, err = client.New("http://localhost:8080/")
+	assert.NoError(t, err)
+}
+
+func TestHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "secret", r.Header.Get("X-API-Key"))
+		assert.Equal(t, "/delete-env/demo", r.URL.Path)
+
+		writeJSON(w, http.StatusOK, client.Response{Message: "deleted"})
+	}))
+	defer server.Close()
+
+	c, err := client.New(server.URL, client.WithAPIKey("secret"))
+	require.NoError(t, err)
+
+	resp, err := c.DeleteEnv(context.Background(), "demo")
+	require.NoError(t, err)
+	assert.Equal(t, "deleted", resp.Message)
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		is      []error
+		isNot   []error
+		code    problemutils.Code
+		message string
+	}{
+		{
+			name:    "plain text unauthorized",
+			status:  http.StatusUnauthorized,
+			body:    "Unauthorized\n",
+			is:      []error{client.ErrUnauthorized},
+			isNot:   []error{client.ErrForbidden},
+			message: "helm-api: Unauthorized (401)",
+		},
+		{
+			name:    "quota exceeded",
+			status:  http.StatusForbidden,
+			body:    `{"message":"Quota exceeded","error":"team qa exceeded its quota","quota":{"team":"qa","allowed":false}}`,
+			is:      []error{client.ErrForbidden, client.ErrQuotaExceeded},
+			message: "helm-api: Quota exceeded (403): team qa exceeded its quota",
+		},
+		{
+			name:   "already exists",
+			status: http.StatusInternalServerError,
+			body:   `{"message":"Failed to install Helm chart","error":"release for demo already exist please use update-env endpoint"}`,
+			is:     []error{client.ErrAlreadyExists},
+			isNot:  []error{client.ErrUnavailable},
+		},
+		{
+			name:    "problem",
+			status:  http.StatusConflict,
+			body:    `{"type":"urn:helm-api:problem:ENV_ALREADY_EXISTS","title":"Environment already exists","status":409,"code":"ENV_ALREADY_EXISTS","message":"Environment already exists","error":"release for demo already exist"}`,
+			is:      []error{client.ErrAlreadyExists},
+			isNot:   []error{client.ErrNotFound, client.ErrUnavailable, client.ErrLocked},
+			code:    problemutils.CodeEnvAlreadyExists,
+			message: "helm-api: Environment already exists (409): release for demo already exist",
+		},
+		{
+			name:   "locked",
+			status: http.StatusConflict,
+			body:   `{"type":"urn:helm-api:problem:ENV_LOCKED","title":"Environment is busy","status":409,"code":"ENV_LOCKED","message":"Environment is busy","error":"another operation is in progress"}`,
+			is:     []error{client.ErrLocked},
+			isNot:  []error{client.ErrAlreadyExists},
+			code:   problemutils.CodeEnvLocked,
+		},
+		{
+			name:   "not found",
+			status: http.StatusNotFound,
+			body:   `{"message":"Environment not found","error":"no environment named demo"}`,
+			is:     []error{client.ErrNotFound},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			c, err := client.New(server.URL, fastRetry)
+			require.NoError(t, err)
+
+			_, err = c.GetEnv(context.Background(), "demo")
+			require.Error(t, err)
+
+			var apiErr *client.APIError
+			require.True(t, errors.As(err, &apiErr))
+			assert.Equal(t, tt.status, apiErr.StatusCode)
+			assert.Equal(t, tt.code, apiErr.Code)
+			for _, target := range tt.is {
+				assert.ErrorIs(t, err, target)
+			}
+			for _, target := range tt.isNot {
+				assert.NotErrorIs(t, err, target)
+			}
+			if tt.message != "" {
+				assert.Equal(t, tt.message, err.Error())
+			}
+		})
+	}
+}
+
+func TestRetries(t *testing.T) {
+	t.Run("unavailable is retried", func(t *testing.T) {
+		var calls atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) < 3 {
+				writeJSON(w, http.StatusServiceUnavailable, client.Response{Message: "API is not ready"})
+
+				return
+			}
+			writeJSON(w, http.StatusCreated, client.Response{Message: "created"})
+		}))
+		defer server.Close()
+
+		c, err := client.New(server.URL, fastRetry)
+		require.NoError(t, err)
+
+		resp, err := c.CreateEnv(context.Background(), client.Request{})
+		require.NoError(t, err)
+		assert.Equal(t, "created", resp.Message)
+		assert.Equal(t, int32(3), calls.Load())
+	})
+
+	t.Run("attempts of a change share an idempotency key", func(t *testing.T) {
+		var mu sync.Mutex
+		keys := map[string][]string{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			keys[r.Method] = append(keys[r.Method], r.Header.Get(idempotencyutils.Header))
+			attempts := len(keys[r.Method])
+			mu.Unlock()
+
+			if r.Method == http.MethodPost && attempts == 1 {
+				writeJSON(w, http.StatusGatewayTimeout, client.Response{Message: "gateway timeout"})
+
+				return
+			}
+			writeJSON(w, http.StatusOK, client.Response{Message: "done"})
+		}))
+		defer server.Close()
+
+		c, err := client.New(server.URL, fastRetry)
+		require.NoError(t, err)
+
+		_, err = c.CreateEnv(context.Background(), client.Request{})
+		require.NoError(t, err)
+		_, err = c.CreateEnv(context.Background(), client.Request{})
+		require.NoError(t, err)
+		_, err = c.ListEnvs(context.Background())
+		require.NoError(t, err)
+
+		require.Len(t, keys[http.MethodPost], 3)
+		assert.NotEmpty(t, keys[http.MethodPost][0])
+		assert.Equal(t, keys[http.MethodPost][0], keys[http.MethodPost][1])
+		assert.NotEqual(t, keys[http.MethodPost][1], keys[http.MethodPost][2])
+		assert.Equal(t, []string{""}, keys[http.MethodGet])
+	})
+
+	t.Run("attempts are bounded", func(t *testing.T) {
+		var calls atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			writeJSON(w, http.StatusBadGateway, client.Response{Message: "Failed to open port-forward"})
+		}))
+		defer server.Close()
+
+		c, err := client.New(server.URL, fastRetry)
+		require.NoError(t, err)
+
+		_, err = c.ListEnvs(context.Background())
+		assert.ErrorIs(t, err, client.ErrUnavailable)
+		assert.Equal(t, int32(3), calls.Load())
+	})
+
+	t.Run("client errors are not retried", func(t *testing.T) {
+		var calls atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			writeJSON(w, http.StatusBadRequest, client.Response{Message: "Invalid request payload"})
+		}))
+		defer server.Close()
+
+		c, err := client.New(server.URL, fastRetry)
+		require.NoError(t, err)
+
+		_, err = c.CreateEnv(context.Background(), client.Request{})
+		assert.ErrorIs(t, err, client.ErrInvalidRequest)
+		assert.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("transport errors are only retried for reads", func(t *testing.T) {
+		var calls atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			// Drop the connection without answering.
+			conn, _, err := w.(http.Hijacker).Hijack()
+			require.NoError(t, err)
+			conn.Close()
+		}))
+		defer server.Close()
+
+		c, err := client.New(server.URL, fastRetry)
+		require.NoError(t, err)
+
+		_, err = c.DeleteEnv(context.Background(), "demo")
+		assert.Error(t, err)
+		assert.Equal(t, int32(1), calls.Load())
+
+		_, err = c.ListEnvs(context.Background())
+		assert.Error(t, err)
+		assert.Equal(t, int32(4), calls.Load())
+	})
+}
+
+func TestWaitForReady(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch calls.Add(1) {
+		case 1:
+			writeJSON(w, http.StatusNotFound, client.Response{Message: "Environment not found"})
+		case 2:
+			writeJSON(w, http.StatusOK, client.Response{Env: &client.EnvStatus{Name: "demo", Status: "deployed", Pods: 1}})
+		default:
+			writeJSON(w, http.StatusOK, client.Response{Env: &client.EnvStatus{Name: "demo", Status: "deployed", Pods: 1, ReadyPods: 1, Ready: true}})
+		}
+	}))
+	defer server.Close()
+
+	c, err := client.New(server.URL, fastRetry)
+	require.NoError(t, err)
+
+	status, err := c.WaitForReady(context.Background(), "demo", time.Millisecond)
+	require.NoError(t, err)
+	assert.True(t, status.Ready)
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestWaitForReadyFailed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/envs/demo" {
+			writeJSON(w, http.StatusNotFound, client.Response{Message: "Environment not found"})
+
+			return
+		}
+		writeJSON(w, http.StatusOK, client.Response{Env: &client.EnvStatus{Name: "demo", Status: "failed"}})
+	}))
+	defer server.Close()
+
+	c, err := client.New(server.URL, fastRetry)
+	require.NoError(t, err)
+
+	_, err = c.WaitForReady(context.Background(), "demo", time.Millisecond)
+	assert.ErrorIs(t, err, client.ErrEnvFailed)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = c.WaitForReady(ctx, "missing", time.Hour)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
@@ -0,0 +1,95 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"helm-api/problemutils"
+	"helm-api/quotautils"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrUnauthorized is returned when the API key is missing or doesn't grant the endpoint.
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrForbidden is returned when the key is valid but not allowed to perform the action.
+	ErrForbidden = errors.New("forbidden")
+	// ErrQuotaExceeded is returned when the team quota doesn't allow the change.
+	ErrQuotaExceeded = errors.New("quota exceeded")
+	// ErrNotFound is returned when the environment doesn't exist.
+	ErrNotFound = errors.New("not found")
+	// ErrAlreadyExists is returned when creating an environment that already exists.
+	ErrAlreadyExists = errors.New("already exists")
+	// ErrLocked is returned when another operation on the environment is in progress.
+	ErrLocked = errors.New("environment locked")
+	// ErrInvalidRequest is returned when the API rejected the request payload.
+	ErrInvalidRequest = errors.New("invalid request")
+	// ErrUnavailable is returned when the API or one of its dependencies is unavailable.
+	ErrUnavailable = errors.New("unavailable")
+	// ErrEnvFailed is returned by WaitForReady when the release failed.
+	ErrEnvFailed = errors.New("environment failed")
+)
+
+// APIError is an error response of the API. Use errors.Is with the Err* values to check its kind.
+type APIError struct {
+	StatusCode int
+	// Code is the machine-readable code of the problem, empty for responses without one.
+	Code problemutils.Code
+	// Message and Detail are the message and error fields of the response.
+	Message string
+	Detail  string
+	// Quota holds the quota report when the request was rejected by a quota.
+	Quota *quotautils.Report
+
+	retryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	if e.Detail != "" {
+
+		return fmt.Sprintf("helm-api: %s (%d): %s", e.Message, e.StatusCode, e.Detail)
+	}
+
+	return fmt.Sprintf("helm-api: %s (%d)", e.Message, e.StatusCode)
+}
+
+// Is maps the code, status code and message of the response to the Err* values.
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrForbidden:
+
+		return e.StatusCode == http.StatusForbidden
+	case ErrQuotaExceeded:
+
+		return e.Code == problemutils.CodeQuotaExceeded || e.StatusCode == http.StatusForbidden && e.Quota != nil
+	case ErrNotFound:
+
+		return e.StatusCode == http.StatusNotFound
+	case ErrAlreadyExists:
+
+		if e.Code != "" {
+
+			return e.Code == problemutils.CodeEnvAlreadyExists
+		}
+
+		// Servers without error codes reported existing releases as install failures.
+		return e.StatusCode == http.StatusConflict || strings.Contains(e.Detail, "already exist")
+	case ErrLocked:
+
+		return e.Code == problemutils.CodeEnvLocked
+	case ErrInvalidRequest:
+
+		return e.StatusCode == http.StatusBadRequest
+	case ErrUnavailable:
+
+		return e.StatusCode == http.StatusBadGateway ||
+			e.StatusCode == http.StatusServiceUnavailable ||
+			e.StatusCode == http.StatusGatewayTimeout
+	}
+
+	return false
+}
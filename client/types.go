@@ -0,0 +1,97 @@
+package client
+
+import (
+	"helm-api/auditutils"
+	"helm-api/healthutils"
+	"helm-api/kubeutils"
+	"helm-api/quotautils"
+	"helm-api/sqlutils"
+	"time"
+
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+// The API server uses these types for its payloads, so the client can't drift from it.
+
+// Response represents a standard API response.
+type Response struct {
+	Message   string              `json:"message"`
+	Error     string              `json:"error,omitempty"`
+	Data      []string            `json:"data,omitempty"`
+	Quota     *quotautils.Report  `json:"quota,omitempty"`
+	Audit     []auditutils.Entry  `json:"audit,omitempty"`
+	LogLevels map[string]string   `json:"logLevels,omitempty"`
+	Health    *healthutils.Report `json:"health,omitempty"`
+	Events    []kubeutils.Event   `json:"events,omitempty"`
+	Query     *sqlutils.Result    `json:"query,omitempty"`
+	Env       *EnvStatus          `json:"env,omitempty"`
+	Manifest  string              `json:"manifest,omitempty"`
+}
+
+// LogLevelRequest changes the log level of one subsystem, or of all of them when Subsystem is empty.
+type LogLevelRequest struct {
+	Subsystem string `json:"subsystem,omitempty"`
+	Level     string `json:"level"`
+}
+
+// QueryRequest is a single SQL statement to run against an environment database.
+type QueryRequest struct {
+	Query    string `json:"query"`
+	Database string `json:"database,omitempty"`
+	MaxRows  int    `json:"maxRows,omitempty"`
+}
+
+type ScaleAction string
+
+const (
+	ScaleUp   ScaleAction = "up"
+	ScaleDown ScaleAction = "down"
+)
+
+type Request struct {
+	ChartMetadata chart.Metadata `json:"chartMetadata"`
+	Action        *ScaleAction   `json:"action,omitempty"`
+	TTL           string         `json:"ttl,omitempty"`
+	// Values are merged into the environment values on update, e.g. {"image": {"tag": "11.4"}}.
+	Values map[string]interface{} `json:"values,omitempty"`
+}
+
+// UpdateRequest merges values into the values of an environment, e.g. {"image": {"tag": "11.4"}}.
+type UpdateRequest struct {
+	Values map[string]interface{} `json:"values"`
+}
+
+// ScaleRequest scales the pods of an environment up or down.
+type ScaleRequest struct {
+	Action ScaleAction `json:"action"`
+}
+
+// RenderRequest previews the manifests of an environment with values merged over its own.
+type RenderRequest struct {
+	Values map[string]interface{} `json:"values,omitempty"`
+}
+
+// EnvStatus is the state of an environment's release and pods.
+type EnvStatus struct {
+	Name     string    `json:"name"`
+	Release  string    `json:"release"`
+	Status   string    `json:"status"`
+	Revision int       `json:"revision"`
+	Updated  time.Time `json:"updated"`
+	Team     string    `json:"team,omitempty"`
+	Pods     int       `json:"pods"`
+	// ReadyPods counts the running pods passing their readiness probe.
+	ReadyPods int `json:"readyPods"`
+	// Ready is set once the release is deployed and all its pods are ready.
+	Ready bool `json:"ready"`
+	// Lock is the operation in progress on the environment, nil when there is none.
+	Lock *EnvLock `json:"lock,omitempty"`
+}
+
+// EnvLock is the operation holding the lock of an environment. Other changes wait for it.
+type EnvLock struct {
+	Operation string    `json:"operation"`
+	Since     time.Time `json:"since"`
+	// Holder is the replica running the operation, when the locks are shared by the replicas.
+	Holder string `json:"holder,omitempty"`
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"helm-api/client"
+	"io"
+	"time"
+
+	"github.com/spf13/cobra"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/strvals"
+)
+
+func newCreateCmd(o *options) *cobra.Command {
+	var (
+		metadata chart.Metadata
+		ttl      time.Duration
+		wait     bool
+		timeout  time.Duration
+	)
+
+	cmd := &cobra.Command{
+		Use:   "create <env>",
+		Short: "Create an environment from the source chart",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := o.client()
+			if err != nil {
+
+				return err
+			}
+
+			metadata.Name = args[0]
+			req := client.Request{ChartMetadata: metadata}
+			if ttl > 0 {
+				req.TTL = ttl.String()
+			}
+
+			resp, err := c.CreateEnv(cmd.Context(), req)
+			if err != nil {
+
+				return err
+			}
+			if !wait {
+
+				return o.printResponse(resp)
+			}
+
+			return o.waitAndPrint(cmd.Context(), c, args[0], timeout, 5*time.Second)
+		},
+	}
+
+	metadata.APIVersion = chart.APIVersionV2
+	metadata.Type = "application"
+	cmd.Flags().StringVar(&metadata.Version, "version", "0.1.0", "chart version")
+	cmd.Flags().StringVar(&metadata.Description, "description", "", "chart description")
+	cmd.Flags().DurationVar(&ttl, "ttl", 0, "delete the environment after this duration, e.g. 24h")
+	cmd.Flags().BoolVar(&wait, "wait", false, "wait until the environment is ready")
+	cmd.Flags().DurationVar(&timeout, "timeout", 10*time.Minute, "how long --wait waits")
+
+	return cmd
+}
+
+func newUpdateCmd(o *options) *cobra.Command {
+	var set []string
+
+	cmd := &cobra.Command{
+		Use:               "update <env> --set key=value...",
+		Short:             "Change the values of an environment and upgrade it",
+		Example:           "  helm-api-cli update demo --set image.tag=11.4 --set replicas=1",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: o.completeEnvs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			values, err := parseValues(set)
+			if err != nil {
+
+				return err
+			}
+			if len(values) == 0 {
+
+				return fmt.Errorf("nothing to update, pass at least one --set key=value")
+			}
+
+			c, err := o.client()
+			if err != nil {
+
+				return err
+			}
+
+			resp, err := c.UpdateEnv(cmd.Context(), args[0], client.Request{Values: values})
+			if err != nil {
+
+				return err
+			}
+
+			return o.printResponse(resp)
+		},
+	}
+
+	cmd.Flags().StringArrayVar(&set, "set", nil, "value to set, as key=value with dotted keys for nested values")
+
+	return cmd
+}
+
+func newScaleCmd(o *options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "scale up|down <env>",
+		Short: "Scale the pods of an environment up or down",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if err := cobra.ExactArgs(2)(cmd, args); err != nil {
+
+				return err
+			}
+			if args[0] != string(client.ScaleUp) && args[0] != string(client.ScaleDown) {
+
+				return fmt.Errorf("invalid direction %q, use up or down", args[0])
+			}
+
+			return nil
+		},
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) == 0 {
+
+				return []string{string(client.ScaleUp), string(client.ScaleDown)}, cobra.ShellCompDirectiveNoFileComp
+			}
+
+			return o.completeEnvs(cmd, args[1:], toComplete)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := o.client()
+			if err != nil {
+
+				return err
+			}
+
+			resp, err := c.ScaleEnv(cmd.Context(), args[1], client.ScaleAction(args[0]))
+			if err != nil {
+
+				return err
+			}
+
+			return o.printResponse(resp)
+		},
+	}
+}
+
+func newDeleteCmd(o *options) *cobra.Command {
+	return &cobra.Command{
+		Use:               "delete <env>",
+		Short:             "Uninstall an environment and remove its chart",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: o.completeEnvs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := o.client()
+			if err != nil {
+
+				return err
+			}
+
+			resp, err := c.DeleteEnv(cmd.Context(), args[0])
+			if err != nil {
+
+				return err
+			}
+
+			return o.printResponse(resp)
+		},
+	}
+}
+
+func newListCmd(o *options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List the environments",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := o.client()
+			if err != nil {
+
+				return err
+			}
+
+			names, err := c.ListEnvs(cmd.Context())
+			if err != nil {
+
+				return err
+			}
+
+			return printResult(o.out, o.output, names, func(w io.Writer) {
+				fmt.Fprintln(w, "NAME")
+				for _, name := range names {
+					fmt.Fprintln(w, name)
+				}
+			})
+		},
+	}
+}
+
+func newStatusCmd(o *options) *cobra.Command {
+	return &cobra.Command{
+		Use:               "status <env>",
+		Short:             "Show the release status and pod readiness of an environment",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: o.completeEnvs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := o.client()
+			if err != nil {
+
+				return err
+			}
+
+			status, err := c.GetEnv(cmd.Context(), args[0])
+			if err != nil {
+
+				return err
+			}
+
+			return o.printStatus(status)
+		},
+	}
+}
+
+func newWaitCmd(o *options) *cobra.Command {
+	var timeout, interval time.Duration
+
+	cmd := &cobra.Command{
+		Use:               "wait <env>",
+		Short:             "Wait until all the pods of an environment are ready",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: o.completeEnvs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := o.client()
+			if err != nil {
+
+				return err
+			}
+
+			return o.waitAndPrint(cmd.Context(), c, args[0], timeout, interval)
+		},
+	}
+
+	cmd.Flags().DurationVar(&timeout, "timeout", 10*time.Minute, "give up after this duration")
+	cmd.Flags().DurationVar(&interval, "interval", 5*time.Second, "time between status checks")
+
+	return cmd
+}
+
+func newRenderCmd(o *options) *cobra.Command {
+	var set []string
+
+	cmd := &cobra.Command{
+		Use:               "render <env>",
+		Short:             "Print the manifests of an environment, with --set values applied, without changing it",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: o.completeEnvs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			values, err := parseValues(set)
+			if err != nil {
+
+				return err
+			}
+
+			c, err := o.client()
+			if err != nil {
+
+				return err
+			}
+
+			manifest, err := c.Render(cmd.Context(), args[0], values)
+			if err != nil {
+
+				return err
+			}
+
+			// Manifests are YAML already, only JSON wraps them.
+			if o.output == OutputJSON {
+
+				return printResult(o.out, o.output, client.Response{Manifest: manifest}, nil)
+			}
+			_, err = io.WriteString(o.out, manifest)
+
+			return err
+		},
+	}
+
+	cmd.Flags().StringArrayVar(&set, "set", nil, "value to set, as key=value with dotted keys for nested values")
+
+	return cmd
+}
+
+func (o *options) waitAndPrint(ctx context.Context, c *client.Client, name string, timeout, interval time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	status, err := c.WaitForReady(ctx, name, interval)
+	if err != nil {
+		if status != nil {
+			o.printStatus(status)
+		}
+
+		return fmt.Errorf("waiting for %s: %w", name, err)
+	}
+
+	return o.printStatus(status)
+}
+
+func (o *options) printStatus(status *client.EnvStatus) error {
+	return printResult(o.out, o.output, status, func(w io.Writer) {
+		fmt.Fprintln(w, "NAME\tSTATUS\tREVISION\tREADY\tTEAM\tUPDATED")
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d/%d\t%s\t%s\n",
+			status.Name, status.Status, status.Revision, status.ReadyPods, status.Pods, status.Team,
+			status.Updated.Local().Format(time.DateTime))
+	})
+}
+
+func (o *options) printResponse(resp *client.Response) error {
+	return printResult(o.out, o.output, resp, func(w io.Writer) {
+		fmt.Fprintln(w, resp.Message)
+	})
+}
+
+// parseValues parses --set flags the way helm does, e.g. image.tag=11.4 or list={a,b}.
+func parseValues(set []string) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	for _, value := range set {
+		if err := strvals.ParseInto(value, values); err != nil {
+
+			return nil, fmt.Errorf("invalid --set %q: %w", value, err)
+		}
+	}
+
+	return values, nil
+}
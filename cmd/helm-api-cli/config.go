@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Config is the CLI configuration file, flags and environment variables override it.
+type Config struct {
+	Server string `json:"server"`
+	Token  string `json:"token"`
+	Output string `json:"output,omitempty"`
+}
+
+// defaultConfigPath returns $XDG_CONFIG_HOME/helm-api/config.yaml or its platform equivalent.
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+
+		return ""
+	}
+
+	return filepath.Join(dir, "helm-api", "config.yaml")
+}
+
+// loadConfig reads the configuration file. A missing file is an empty configuration.
+func loadConfig(path string) (*Config, error) {
+	config := &Config{}
+	if path == "" {
+
+		return config, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+
+		return config, nil
+	}
+	if err != nil {
+
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	return config, nil
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"helm-api/client"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAPI records the requests it receives and answers with canned responses.
+type fakeAPI struct {
+	requests []*http.Request
+	bodies   []map[string]interface{}
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&body)
+	f.requests = append(f.requests, r)
+	f.bodies = append(f.bodies, body)
+
+	if r.Header.Get("X-API-Key") != "secret" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+
+		return
+	}
+
+	var resp client.Response
+	switch r.URL.Path {
+	case "/list":
+		resp = client.Response{Message: "List:", Data: []string{"test-demo", "test-other"}}
+	case "/envs/demo":
+		resp = client.Response{Env: &client.EnvStatus{
+			Name:      "demo",
+			Release:   "test-demo",
+			Status:    "deployed",
+			Revision:  3,
+			Updated:   time.Date(2024, 11, 2, 10, 1, 12, 0, time.UTC),
+			Team:      "qa",
+			Pods:      1,
+			ReadyPods: 1,
+			Ready:     true,
+		}}
+	case "/envs/demo/render":
+		resp = client.Response{Manifest: "---\n# Source: mariadb/templates/statefulset.yaml\nkind: StatefulSet\n"}
+	case "/update-env/demo":
+		resp = client.Response{Message: "Helm chart successfully updated"}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		resp = client.Response{Message: "Environment not found", Error: "no environment named " + r.URL.Path}
+	}
+
+	json.NewEncoder(w).Encode(resp)
+}
+
+func run(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+
+	var out bytes.Buffer
+	cmd := newRootCmd(&out)
+	cmd.SetErr(&out)
+	cmd.SetArgs(append([]string{"--config", filepath.Join(t.TempDir(), "missing.yaml")}, args...))
+	err := cmd.Execute()
+
+	return out.String(), err
+}
+
+func newFakeAPI(t *testing.T) (*fakeAPI, *httptest.Server) {
+	t.Helper()
+
+	api := &fakeAPI{}
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+
+	return api, server
+}
+
+func TestList(t *testing.T) {
+	_, server := newFakeAPI(t)
+
+	out, err := run(t, "--server", server.URL, "--token", "secret", "list")
+	require.NoError(t, err)
+	assert.Equal(t, "NAME\ndemo\nother\n", out)
+
+	out, err = run(t, "--server", server.URL, "--token", "secret", "list", "-o", "json")
+	require.NoError(t, err)
+	assert.JSONEq(t, `["demo", "other"]`, out)
+}
+
+func TestStatus(t *testing.T) {
+	_, server := newFakeAPI(t)
+	t.Setenv("HELM_API_URL", server.URL)
+	t.Setenv("HELM_API_KEY", "secret")
+
+	out, err := run(t, "status", "demo", "-o", "yaml")
+	require.NoError(t, err)
+	assert.Contains(t, out, "status: deployed\n")
+	assert.Contains(t, out, "readyPods: 1\n")
+
+	out, err = run(t, "status", "demo")
+	require.NoError(t, err)
+	assert.Contains(t, out, "NAME  STATUS    REVISION  READY  TEAM")
+	assert.Contains(t, out, "demo  deployed  3         1/1    qa")
+
+	_, err = run(t, "status", "missing")
+	assert.ErrorIs(t, err, client.ErrNotFound)
+}
+
+func TestUpdateSetsValues(t *testing.T) {
+	api, server := newFakeAPI(t)
+
+	out, err := run(t, "--server", server.URL, "--token", "secret",
+		"update", "demo", "--set", "image.tag=11.4", "--set", "replicas=1")
+	require.NoError(t, err)
+	assert.Equal(t, "Helm chart successfully updated\n", out)
+
+	require.Len(t, api.requests, 1)
+	assert.Equal(t, "secret", api.requests[0].Header.Get("X-API-Key"))
+	assert.Equal(t, map[string]interface{}{
+		"image":    map[string]interface{}{"tag": "11.4"},
+		"replicas": float64(1),
+	}, api.bodies[0]["values"])
+
+	_, err = run(t, "--server", server.URL, "update", "demo")
+	assert.ErrorContains(t, err, "pass at least one --set")
+}
+
+func TestScaleArgs(t *testing.T) {
+	api, server := newFakeAPI(t)
+
+	_, err := run(t, "--server", server.URL, "--token", "secret", "scale", "sideways", "demo")
+	assert.ErrorContains(t, err, `invalid direction "sideways"`)
+
+	_, err = run(t, "--server", server.URL, "--token", "secret", "scale", "down", "demo")
+	require.NoError(t, err)
+	require.Len(t, api.bodies, 1)
+	assert.Equal(t, "down", api.bodies[0]["action"])
+}
+
+func TestRender(t *testing.T) {
+	api, server := newFakeAPI(t)
+
+	out, err := run(t, "--server", server.URL, "--token", "secret", "render", "demo", "--set", "replicas=3")
+	require.NoError(t, err)
+	assert.Equal(t, "---\n# Source: mariadb/templates/statefulset.yaml\nkind: StatefulSet\n", out)
+	assert.Equal(t, map[string]interface{}{"replicas": float64(3)}, api.bodies[0]["values"])
+}
+
+func TestConfigFile(t *testing.T) {
+	_, server := newFakeAPI(t)
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	config := "server: " + server.URL + "\ntoken: secret\noutput: json\n"
+	require.NoError(t, os.WriteFile(path, []byte(config), 0600))
+
+	var out bytes.Buffer
+	cmd := newRootCmd(&out)
+	cmd.SetArgs([]string{"--config", path, "list"})
+	require.NoError(t, cmd.Execute())
+	assert.JSONEq(t, `["demo", "other"]`, out.String())
+
+	// Flags win over the file.
+	_, err := run(t, "--server", server.URL, "--token", "wrong", "list")
+	assert.ErrorIs(t, err, client.ErrUnauthorized)
+
+	require.NoError(t, os.WriteFile(path, []byte("server: x\nunknown: true\n"), 0600))
+	cmd = newRootCmd(&out)
+	cmd.SetArgs([]string{"--config", path, "list"})
+	assert.ErrorContains(t, cmd.Execute(), "failed to parse config file")
+}
+
+func TestMissingServer(t *testing.T) {
+	t.Setenv("HELM_API_URL", "")
+
+	_, err := run(t, "list")
+	assert.ErrorContains(t, err, "no server configured")
+}
+
+func TestCompletion(t *testing.T) {
+	out, err := run(t, "completion", "bash")
+	require.NoError(t, err)
+	assert.Contains(t, out, "bash completion")
+}
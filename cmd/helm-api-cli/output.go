@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	OutputTable = "table"
+	OutputJSON  = "json"
+	OutputYAML  = "yaml"
+)
+
+var outputFormats = []string{OutputTable, OutputJSON, OutputYAML}
+
+// printResult writes v as JSON or YAML, or calls table with a tab separated writer.
+func printResult(out io.Writer, format string, v interface{}, table func(w io.Writer)) error {
+	switch format {
+	case OutputJSON:
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+
+		return encoder.Encode(v)
+	case OutputYAML:
+		data, err := yaml.Marshal(v)
+		if err != nil {
+
+			return fmt.Errorf("failed to encode output: %w", err)
+		}
+		_, err = out.Write(data)
+
+		return err
+	case OutputTable, "":
+		w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		table(w)
+
+		return w.Flush()
+	}
+
+	return fmt.Errorf("unknown output format %q, use one of %v", format, outputFormats)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"helm-api/client"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/spf13/cobra"
+)
+
+// options are the global flags shared by every command.
+type options struct {
+	configPath string
+	server     string
+	token      string
+	output     string
+	out        io.Writer
+}
+
+func newRootCmd(out io.Writer) *cobra.Command {
+	o := &options{out: out}
+
+	cmd := &cobra.Command{
+		Use:           "helm-api-cli",
+		Short:         "Manage helm-api environments",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return o.complete(cmd)
+		},
+	}
+	cmd.SetOut(out)
+
+	flags := cmd.PersistentFlags()
+	flags.StringVar(&o.configPath, "config", defaultConfigPath(), "config file holding server, token and output")
+	flags.StringVar(&o.server, "server", "", "helm-api URL (HELM_API_URL)")
+	flags.StringVar(&o.token, "token", "", "API key (HELM_API_KEY)")
+	flags.StringVarP(&o.output, "output", "o", "", "output format: table, json or yaml")
+	cmd.RegisterFlagCompletionFunc("output", cobra.FixedCompletions(outputFormats, cobra.ShellCompDirectiveNoFileComp))
+
+	cmd.AddCommand(
+		newCreateCmd(o),
+		newUpdateCmd(o),
+		newScaleCmd(o),
+		newDeleteCmd(o),
+		newListCmd(o),
+		newStatusCmd(o),
+		newWaitCmd(o),
+		newRenderCmd(o),
+	)
+
+	return cmd
+}
+
+// complete fills the options that weren't set by flags from the environment, then the config file.
+func (o *options) complete(cmd *cobra.Command) error {
+	config, err := loadConfig(o.configPath)
+	if err != nil {
+
+		return err
+	}
+
+	o.server = firstSet(o.server, os.Getenv("HELM_API_URL"), config.Server)
+	o.token = firstSet(o.token, os.Getenv("HELM_API_KEY"), config.Token)
+	o.output = firstSet(o.output, config.Output, OutputTable)
+
+	if !slices.Contains(outputFormats, o.output) {
+
+		return fmt.Errorf("unknown output format %q, use one of %v", o.output, outputFormats)
+	}
+
+	return nil
+}
+
+// client returns an API client for the configured server.
+func (o *options) client() (*client.Client, error) {
+	if o.server == "" {
+
+		return nil, fmt.Errorf("no server configured, set --server, HELM_API_URL or server in %s", o.configPath)
+	}
+
+	return client.New(o.server, client.WithAPIKey(o.token))
+}
+
+// completeEnvs completes the first argument with the environment names.
+func (o *options) completeEnvs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	if err := o.complete(cmd); err != nil {
+
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	c, err := o.client()
+	if err != nil {
+
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	names, err := c.ListEnvs(cmd.Context())
+	if err != nil {
+
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+func firstSet(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+
+			return value
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"helm-api/defaults"
+	"helm-api/tunnelutils"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// runConnect implements "helm-api connect <env>": it listens on a local port and relays every
+// connection through a tunnel to the environment service.
+func runConnect(args []string) error {
+	flags := flag.NewFlagSet("connect", flag.ContinueOnError)
+	server := flags.String("server", os.Getenv("HELM_API_URL"), "helm-api URL (HELM_API_URL)")
+	apiKey := flags.String("api-key", os.Getenv("HELM_API_KEY"), "connect API key (HELM_API_KEY)")
+	port := flags.String("port", defaults.ConnectPort, "service port name or number in the environment")
+	localAddr := flags.String("local", "127.0.0.1:"+defaults.ConnectPort, "local address to listen on")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: helm-api connect [flags] <env>\n")
+		flags.PrintDefaults()
+	}
+
+	// Flags may follow the environment name.
+	var env string
+	if len(args) > 0 && len(args[0]) > 0 && args[0][0] != '-' {
+		env, args = args[0], args[1:]
+	}
+	if err := flags.Parse(args); err != nil {
+
+		return err
+	}
+	if env == "" && flags.NArg() > 0 {
+		env = flags.Arg(0)
+	}
+	if env == "" {
+		flags.Usage()
+
+		return errors.New("missing environment name")
+	}
+	if *server == "" {
+
+		return errors.New("missing helm-api URL, set --server or HELM_API_URL")
+	}
+
+	listener, err := net.Listen("tcp", *localAddr)
+	if err != nil {
+
+		return fmt.Errorf("failed to listen on %s: %w", *localAddr, err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	fmt.Fprintf(os.Stderr, "Forwarding %s to port %s of %s, press Ctrl+C to stop\n", listener.Addr(), *port, env)
+
+	dial := func() (io.ReadWriteCloser, error) {
+		return tunnelutils.Dial(ctx, http.DefaultClient, *server, env, *port, *apiKey)
+	}
+
+	return tunnelutils.Serve(listener, dial, func(err error) {
+		fmt.Fprintf(os.Stderr, "Tunnel error: %v\n", err)
+	})
+}
@@ -1,7 +1,10 @@
 package defaults
 
+import "time"
+
 var (
 	Port       = "8080"
+	GRPCPort   = "9090"
 	EnvPrefix  = "test-"
 	NameSpace  = "helm-api-pg"
 	OutPutDir  = "charts"
@@ -9,4 +12,30 @@ var (
 	HelmDriver = "secrets"
 	AwsRegion  = "us-east-1"
 	SsmParams  = map[string]string{}
+	AuditFile  = "audit.jsonl"
+
+	SecretSourceEnv            = "env"
+	SecretSourceFile           = "file"
+	SecretSourceSSM            = "ssm"
+	SecretSourceSecretsManager = "secretsmanager"
+
+	ChartStoreLocal     = "local"
+	ChartStoreS3        = "s3"
+	ChartStoreConfigMap = "configmap"
+	ChartStoreSecret    = "secret"
+	ChartStoreRelease   = "release"
+	S3ChartPrefix       = "charts/"
+
+	KeyRefreshInterval = 5 * time.Minute
+	KeyGracePeriod     = 10 * time.Minute
+	ReadinessTimeout   = 5 * time.Second
+	QueryTimeout       = 10 * time.Second
+	QueryMaxRows       = 1000
+	ConnectPort        = "3306"
+	IdempotencyTTL     = 24 * time.Hour
+	ReaperInterval     = time.Minute
+	LockWait           = 30 * time.Second
+	LeaseDuration      = 15 * time.Second
+	LeaseRenewDeadline = 10 * time.Second
+	LeaseRetryPeriod   = 2 * time.Second
 )
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"helm-api/apiutils"
+	"helm-api/envservice"
+	"helm-api/problemutils"
+	"net/http"
+	"time"
+)
+
+// The original routes and the /v1 routes run the same envservice operations and answer their
+// failures with the same problems.
+
+// createSpec validates a create request of either API.
+func createSpec(r *http.Request, req Request) (envservice.Spec, error) {
+	spec := envservice.Spec{
+		Metadata: req.ChartMetadata,
+		Team:     apiutils.CallerTeam(r.Context()),
+	}
+
+	if req.TTL != "" {
+		ttl, err := time.ParseDuration(req.TTL)
+		if err != nil || ttl <= 0 {
+
+			return spec, &envservice.Error{Message: "Invalid ttl in request", Kind: envservice.ErrInvalid, Err: fmt.Errorf("ttl must be a positive duration, got %q", req.TTL)}
+		}
+		spec.TTL = ttl
+	}
+
+	return spec, nil
+}
+
+// envProblem is the problem response of a failed environment operation.
+func envProblem(err error) *problemutils.Problem {
+	var envErr *envservice.Error
+	if !errors.As(err, &envErr) {
+
+		return problemutils.New(envservice.ErrorCode(err), "Request failed", err)
+	}
+
+	problem := problemutils.New(envservice.ErrorCode(err), envErr.Message, envErr.Err)
+	problem.Quota = envErr.Quota
+
+	return problem
+}
@@ -0,0 +1,77 @@
+package envservice
+
+import (
+	"errors"
+	"helm-api/helmutils"
+	"helm-api/kubeutils"
+	"helm-api/problemutils"
+	"helm-api/quotautils"
+	"helm-api/sqlutils"
+)
+
+// The kinds are the helmutils sentinels, so ErrorCode returns the code of every error.
+var (
+	// ErrInvalid is returned when a request fails validation.
+	ErrInvalid = helmutils.ErrInvalid
+	// ErrQuotaExceeded is returned when a change would exceed the team quota.
+	ErrQuotaExceeded = helmutils.ErrQuotaExceeded
+	// ErrNotFound is returned for environments that don't exist.
+	ErrNotFound = helmutils.ErrReleaseNotFound
+	// ErrAlreadyExists is returned when creating an environment that exists.
+	ErrAlreadyExists = helmutils.ErrReleaseExists
+	// ErrLocked is returned when another operation on the environment is in progress.
+	ErrLocked = helmutils.ErrLocked
+	// ErrPortForward is returned when the tunnel to an environment pod can't be opened.
+	ErrPortForward = errors.New("port-forward failed")
+)
+
+// Error is a failed operation. Message summarizes the step that failed, Kind is one of the
+// sentinels above when the failure isn't an internal one.
+type Error struct {
+	Message string
+	Kind    error
+	Err     error
+	// Quota is the evaluated quota when Kind is ErrQuotaExceeded.
+	Quota *quotautils.Report
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// codes maps the helmutils, kubeutils and sqlutils sentinels to the codes the HTTP and gRPC APIs report them with.
+var codes = []struct {
+	kind error
+	code problemutils.Code
+}{
+	{helmutils.ErrReleaseNotFound, problemutils.CodeEnvNotFound},
+	{helmutils.ErrReleaseExists, problemutils.CodeEnvAlreadyExists},
+	{helmutils.ErrInvalid, problemutils.CodeValidationFailed},
+	{helmutils.ErrTimeout, problemutils.CodeHelmTimeout},
+	{helmutils.ErrClusterUnreachable, problemutils.CodeClusterUnreachable},
+	{helmutils.ErrQuotaExceeded, problemutils.CodeQuotaExceeded},
+	{helmutils.ErrLocked, problemutils.CodeEnvLocked},
+	{helmutils.ErrChartNotFound, problemutils.CodeEnvNotFound},
+	{kubeutils.ErrNoPods, problemutils.CodeNotFound},
+	{kubeutils.ErrContainerNotFound, problemutils.CodeNotFound},
+	{kubeutils.ErrServiceNotFound, problemutils.CodeNotFound},
+	{kubeutils.ErrNoReadyPod, problemutils.CodeUnavailable},
+	{sqlutils.ErrNoDatabase, problemutils.CodeNotFound},
+	{ErrPortForward, problemutils.CodeUpstreamFailed},
+}
+
+// ErrorCode returns the code of the sentinel err matches, CodeInternal when it matches none.
+func ErrorCode(err error) problemutils.Code {
+	for _, c := range codes {
+		if errors.Is(err, c.kind) {
+
+			return c.code
+		}
+	}
+
+	return problemutils.CodeInternal
+}
@@ -0,0 +1,58 @@
+package envservice_test
+
+import (
+	"errors"
+	"fmt"
+	"helm-api/envservice"
+	"helm-api/helmutils"
+	"helm-api/kubeutils"
+	"helm-api/problemutils"
+	"helm-api/sqlutils"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestError(t *testing.T) {
+	cause := errors.New("no environment named demo")
+	err := error(&envservice.Error{Message: "Environment not found", Kind: envservice.ErrNotFound, Err: cause})
+
+	assert.EqualError(t, err, "no environment named demo")
+	assert.ErrorIs(t, err, envservice.ErrNotFound)
+	assert.ErrorIs(t, err, helmutils.ErrReleaseNotFound)
+	assert.ErrorIs(t, err, cause)
+	assert.NotErrorIs(t, err, envservice.ErrInvalid)
+
+	// Internal failures have no kind.
+	err = &envservice.Error{Message: "Failed to list environments", Err: cause}
+	assert.NotErrorIs(t, err, envservice.ErrNotFound)
+	assert.ErrorIs(t, err, cause)
+}
+
+func TestErrorCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		code problemutils.Code
+	}{
+		{"not found", fmt.Errorf("failed to update: %w", helmutils.ErrReleaseNotFound), problemutils.CodeEnvNotFound},
+		{"exists", helmutils.ErrReleaseExists, problemutils.CodeEnvAlreadyExists},
+		{"invalid", fmt.Errorf("failed to render values: %w", helmutils.ErrInvalid), problemutils.CodeValidationFailed},
+		{"timeout", helmutils.ErrTimeout, problemutils.CodeHelmTimeout},
+		{"unreachable", helmutils.ErrClusterUnreachable, problemutils.CodeClusterUnreachable},
+		{"quota", helmutils.ErrQuotaExceeded, problemutils.CodeQuotaExceeded},
+		{"locked", fmt.Errorf("failed to upgrade: %w", helmutils.ErrLocked), problemutils.CodeEnvLocked},
+		{"chart missing", fmt.Errorf("failed to load chart: %w", helmutils.ErrChartNotFound), problemutils.CodeEnvNotFound},
+		{"no ready pod", fmt.Errorf("%w: test-demo", kubeutils.ErrNoReadyPod), problemutils.CodeUnavailable},
+		{"no database", sqlutils.ErrNoDatabase, problemutils.CodeNotFound},
+		{"port-forward", &envservice.Error{Kind: envservice.ErrPortForward, Err: errors.New("refused")}, problemutils.CodeUpstreamFailed},
+		{"other", errors.New("boom"), problemutils.CodeInternal},
+		{"nil", nil, problemutils.CodeInternal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.code, envservice.ErrorCode(tt.err))
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package envservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"helm-api/helmutils"
+	"helm-api/kubeutils"
+	"helm-api/sqlutils"
+	"io"
+	"slices"
+)
+
+// EnvironmentInspector reads and reaches into existing environments, for the HTTP routes.
+// Environments are addressed by name, without the release prefix.
+type EnvironmentInspector interface {
+	Logs(ctx context.Context, name string, opts kubeutils.LogOptions) (LogStream, error)
+	Events(ctx context.Context, name string) ([]kubeutils.Event, error)
+	// Render renders the chart of the environment with values merged over its own.
+	Render(ctx context.Context, name string, values map[string]interface{}) (string, error)
+	Database(ctx context.Context, name string) (*sqlutils.Target, error)
+	// Connect opens a connection to a ready pod behind the environment service exposing port,
+	// given as a port name or number.
+	Connect(ctx context.Context, name, port string) (*Tunnel, error)
+}
+
+// LogStream is the logs of the pods of an environment, see kubeutils.LogStream.
+type LogStream interface {
+	Copy(w io.Writer) error
+	Close() error
+}
+
+// Tunnel is an open connection to a pod port.
+type Tunnel struct {
+	Pod  string
+	Port int32
+	Conn io.ReadWriteCloser
+}
+
+// Logs opens the logs of the pods of an environment.
+func (s *Service) Logs(ctx context.Context, name string, opts kubeutils.LogOptions) (LogStream, error) {
+	releaseName, err := s.existing(ctx, name)
+	if err != nil {
+
+		return nil, err
+	}
+
+	stream, err := s.Inspector.OpenLogs(ctx, releaseName, opts)
+	if err != nil {
+
+		return nil, &Error{Message: "Failed to read environment logs", Err: err}
+	}
+
+	return stream, nil
+}
+
+// Events returns the Kubernetes events about the objects of an environment.
+func (s *Service) Events(ctx context.Context, name string) ([]kubeutils.Event, error) {
+	releaseName, err := s.existing(ctx, name)
+	if err != nil {
+
+		return nil, err
+	}
+
+	events, err := s.Inspector.Events(ctx, releaseName)
+	if err != nil {
+
+		return nil, &Error{Message: "Failed to read environment events", Err: err}
+	}
+
+	return events, nil
+}
+
+// Render renders the chart of an environment without applying anything.
+func (s *Service) Render(ctx context.Context, name string, values map[string]interface{}) (string, error) {
+	releaseName, err := s.existing(ctx, name)
+	if err != nil {
+
+		return "", err
+	}
+
+	manifest, err := s.Helm.RenderManifests(ctx, releaseName, releaseName, values)
+	if errors.Is(err, helmutils.ErrChartNotFound) {
+
+		return "", &Error{Message: "Environment chart not found", Kind: ErrNotFound, Err: err}
+	}
+	if err != nil {
+
+		return "", &Error{Message: "Failed to render environment chart", Err: err}
+	}
+
+	return manifest, nil
+}
+
+// Database returns the database of an environment.
+func (s *Service) Database(ctx context.Context, name string) (*sqlutils.Target, error) {
+	releaseName, err := s.existing(ctx, name)
+	if err != nil {
+
+		return nil, err
+	}
+
+	target, err := s.Databases.ResolveTarget(ctx, releaseName)
+	if err != nil {
+
+		return nil, &Error{Message: "Failed to find environment database", Err: err}
+	}
+
+	return target, nil
+}
+
+// Connect port-forwards to a ready pod behind the service of an environment.
+func (s *Service) Connect(ctx context.Context, name, port string) (*Tunnel, error) {
+	releaseName, err := s.existing(ctx, name)
+	if err != nil {
+
+		return nil, err
+	}
+
+	pod, podPort, err := s.Inspector.ServicePod(ctx, releaseName, port)
+	if err != nil {
+
+		return nil, &Error{Message: "Failed to find environment service", Err: err}
+	}
+
+	conn, err := s.Forwarder.Dial(ctx, s.Namespace, pod, podPort)
+	if err != nil {
+
+		return nil, &Error{Message: "Failed to open port-forward", Kind: ErrPortForward, Err: err}
+	}
+
+	return &Tunnel{Pod: pod, Port: podPort, Conn: conn}, nil
+}
+
+// existing returns the release of an environment, ErrNotFound when it isn't installed.
+func (s *Service) existing(ctx context.Context, name string) (string, error) {
+	releaseName := ReleaseName(name)
+
+	chartList, err := s.Helm.ListReleases(ctx)
+	if err != nil {
+
+		return "", &Error{Message: "Failed to list environments", Err: err}
+	}
+	if !slices.Contains(chartList, releaseName) {
+
+		return "", &Error{Message: "Environment not found", Kind: ErrNotFound, Err: fmt.Errorf("no environment named %s", name)}
+	}
+
+	return releaseName, nil
+}
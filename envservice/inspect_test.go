@@ -0,0 +1,59 @@
+package envservice_test
+
+import (
+	"context"
+	"helm-api/envservice"
+	"helm-api/kubeutils"
+	"helm-api/problemutils"
+	"helm-api/quotautils"
+	"helm-api/sqlutils"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+func TestServiceInspect(t *testing.T) {
+	service, _ := newService(t, &quotautils.Config{})
+	ctx := context.Background()
+
+	// Every inspection of a missing environment is ErrNotFound.
+	_, err := service.Logs(ctx, "demo", kubeutils.LogOptions{})
+	assert.ErrorIs(t, err, envservice.ErrNotFound)
+	_, err = service.Events(ctx, "demo")
+	assert.ErrorIs(t, err, envservice.ErrNotFound)
+	_, err = service.Render(ctx, "demo", nil)
+	assert.ErrorIs(t, err, envservice.ErrNotFound)
+	_, err = service.Database(ctx, "demo")
+	assert.ErrorIs(t, err, envservice.ErrNotFound)
+	_, err = service.Connect(ctx, "demo", "mysql")
+	assert.ErrorIs(t, err, envservice.ErrNotFound)
+	assert.Equal(t, problemutils.CodeEnvNotFound, envservice.ErrorCode(err))
+
+	_, err = service.Create(ctx, envservice.Spec{
+		Metadata: chart.Metadata{APIVersion: chart.APIVersionV2, Name: "demo", Version: "0.1.0"},
+	})
+	require.NoError(t, err)
+
+	manifest, err := service.Render(ctx, "demo", map[string]interface{}{"replicas": 0})
+	require.NoError(t, err)
+	assert.Contains(t, manifest, "kind:")
+
+	events, err := service.Events(ctx, "demo")
+	require.NoError(t, err)
+	assert.Empty(t, events)
+
+	// The environment has no pods, services or database in the fake clientset.
+	_, err = service.Logs(ctx, "demo", kubeutils.LogOptions{})
+	assert.ErrorIs(t, err, kubeutils.ErrNoPods)
+	assert.Equal(t, problemutils.CodeNotFound, envservice.ErrorCode(err))
+
+	_, err = service.Database(ctx, "demo")
+	assert.ErrorIs(t, err, sqlutils.ErrNoDatabase)
+	assert.Equal(t, problemutils.CodeNotFound, envservice.ErrorCode(err))
+
+	_, err = service.Connect(ctx, "demo", "mysql")
+	assert.ErrorIs(t, err, kubeutils.ErrServiceNotFound)
+	assert.Equal(t, problemutils.CodeNotFound, envservice.ErrorCode(err))
+}
@@ -0,0 +1,92 @@
+package envservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"helm-api/defaults"
+	"helm-api/logutils"
+	"helm-api/metricsutils"
+	"helm-api/quotautils"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Reaper deletes the environments whose TTL passed, recorded in the quotautils.ExpiresAtLabel
+// release label.
+type Reaper struct {
+	Envs     *Service
+	Interval time.Duration
+	Logger   logutils.Logger
+}
+
+// Run deletes the expired environments every Interval until the context is cancelled. It is a
+// leaseutils.Job, so only the leader reaps when the replicas elect one.
+func (r *Reaper) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+
+	for {
+		deleted, failed, err := r.Envs.DeleteExpired(ctx, time.Now())
+		if ctx.Err() != nil {
+
+			return
+		}
+
+		metricsutils.RecordReaperRun(len(deleted), len(failed), err)
+		for _, name := range deleted {
+			r.Logger.Infof("Deleted expired environment %s", name)
+		}
+		for name, err := range failed {
+			r.Logger.Errorf("Deleting expired environment %s failed: %v", name, err)
+		}
+		if err != nil {
+			r.Logger.Errorf("Listing expired environments failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeleteExpired deletes the environments that expired at now. It returns the names of the
+// deleted ones and goes on past the ones that fail to delete, returned with their error.
+func (s *Service) DeleteExpired(ctx context.Context, now time.Time) ([]string, map[string]error, error) {
+	releases, err := s.Helm.ListReleaseDetails(ctx, quotautils.ExpiresAtLabel)
+	if err != nil {
+
+		return nil, nil, &Error{Message: "Failed to list environments", Err: err}
+	}
+
+	var deleted []string
+	failed := map[string]error{}
+	for _, rel := range releases {
+		name := strings.TrimPrefix(rel.Name, defaults.EnvPrefix)
+
+		expiresAt, err := strconv.ParseInt(rel.Labels[quotautils.ExpiresAtLabel], 10, 64)
+		if err != nil {
+			failed[name] = fmt.Errorf("invalid %s label: %w", quotautils.ExpiresAtLabel, err)
+			continue
+		}
+		if now.Before(time.Unix(expiresAt, 0)) {
+			continue
+		}
+
+		if _, err := s.Delete(ctx, name); err != nil {
+			// Already deleted, by its owner or another replica.
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			failed[name] = err
+			continue
+		}
+		deleted = append(deleted, name)
+	}
+
+	return deleted, failed, nil
+}
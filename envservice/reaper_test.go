@@ -0,0 +1,40 @@
+package envservice_test
+
+import (
+	"context"
+	"helm-api/envservice"
+	"helm-api/quotautils"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+func TestServiceDeleteExpired(t *testing.T) {
+	service, _ := newService(t, &quotautils.Config{})
+	ctx := context.Background()
+
+	for name, ttl := range map[string]time.Duration{"short": time.Hour, "long": 48 * time.Hour, "forever": 0} {
+		_, err := service.Create(ctx, envservice.Spec{
+			Metadata: chart.Metadata{APIVersion: chart.APIVersionV2, Name: name, Version: "0.1.0"},
+			TTL:      ttl,
+		})
+		require.NoError(t, err)
+	}
+
+	deleted, failed, err := service.DeleteExpired(ctx, time.Now())
+	require.NoError(t, err)
+	assert.Empty(t, deleted)
+	assert.Empty(t, failed)
+
+	deleted, failed, err = service.DeleteExpired(ctx, time.Now().Add(2*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"short"}, deleted)
+	assert.Empty(t, failed)
+
+	names, err := service.List(ctx)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"long", "forever"}, names)
+}
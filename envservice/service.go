@@ -0,0 +1,413 @@
+package envservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"helm-api/client"
+	"helm-api/defaults"
+	"helm-api/helmutils"
+	"helm-api/kubeutils"
+	"helm-api/quotautils"
+	"helm-api/sqlutils"
+	"helm-api/tunnelutils"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/release"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// EnvironmentService is the environment lifecycle shared by the HTTP routes and the other
+// front ends. Environments are addressed by name, without the release prefix.
+type EnvironmentService interface {
+	Create(ctx context.Context, spec Spec) (*Result, error)
+	// Update merges values into the values of the environment and upgrades it, within the quota
+	// of the team owning the environment.
+	Update(ctx context.Context, name string, values map[string]interface{}) (*Result, error)
+	Scale(ctx context.Context, name string, action client.ScaleAction) (*Result, error)
+	Delete(ctx context.Context, name string) (*Result, error)
+	Get(ctx context.Context, name string) (*client.EnvStatus, error)
+	List(ctx context.Context) ([]string, error)
+}
+
+// Spec describes a new environment.
+type Spec struct {
+	Metadata chart.Metadata
+	// Team owns the environment, it's the team of the API key of the caller.
+	Team string
+	// TTL deletes the environment after this duration when set.
+	TTL time.Duration
+}
+
+// Result is the release revision an operation produced.
+type Result struct {
+	Name     string
+	Release  string
+	Revision int
+}
+
+// replicas is the replica count of each scale action.
+var replicas = map[client.ScaleAction]int{
+	client.ScaleUp:   1,
+	client.ScaleDown: 0,
+}
+
+// QuotaLock returns the lock serializing the quota checks of a team with the changes they allow.
+// Release names start with the environment prefix, so it never names a release.
+func QuotaLock(team string) string {
+	return "quota." + team
+}
+
+// ReleaseName returns the Helm release of an environment.
+func ReleaseName(name string) string {
+	return defaults.EnvPrefix + name
+}
+
+// Replicas returns the replica count of a scale action.
+func Replicas(action client.ScaleAction) (int, bool) {
+	count, exists := replicas[action]
+
+	return count, exists
+}
+
+// Releases runs the Helm actions of the environments, see helmutils.RealClient.
+type Releases interface {
+	ListReleases(ctx context.Context) ([]string, error)
+	ListReleaseDetails(ctx context.Context, selector string) ([]*release.Release, error)
+	HasChart(ctx context.Context, releaseName string) (bool, error)
+	CreateHelmChartFromSource(ctx context.Context, options chart.Metadata) (string, error)
+	InstallRelease(ctx context.Context, chartName, releaseName string, labels map[string]string) (*release.Release, error)
+	UpdateValues(ctx context.Context, releaseName string, values map[string]interface{}) error
+	UpgradeRelease(ctx context.Context, releaseName string) (*release.Release, error)
+	UninstallRelease(ctx context.Context, releaseName string) (*release.UninstallReleaseResponse, error)
+	RenderManifests(ctx context.Context, chartName, releaseName string, values map[string]interface{}) (string, error)
+	Lock(ctx context.Context, releaseName, operation string) (context.Context, func(), error)
+	LockHolder(ctx context.Context, releaseName string) (*helmutils.LockInfo, error)
+}
+
+// Quotas checks the changes of a team against its policy, see quotautils.Enforcer.
+type Quotas interface {
+	PolicyFor(team string) quotautils.Policy
+	Check(ctx context.Context, team, chartName, releaseName string, values map[string]interface{}, newEnv bool, ttl time.Duration) (*quotautils.Report, error)
+}
+
+// Inspector reads the Kubernetes objects of the environments, see kubeutils.Inspector.
+type Inspector interface {
+	Pods(ctx context.Context, releaseName string) ([]corev1.Pod, error)
+	OpenLogs(ctx context.Context, releaseName string, opts kubeutils.LogOptions) (*kubeutils.LogStream, error)
+	Events(ctx context.Context, releaseName string) ([]kubeutils.Event, error)
+	ServicePod(ctx context.Context, releaseName, port string) (string, int32, error)
+}
+
+// Databases finds the database of the environments, see sqlutils.Resolver.
+type Databases interface {
+	ResolveTarget(ctx context.Context, releaseName string) (*sqlutils.Target, error)
+}
+
+// Service implements EnvironmentService with Helm releases checked against the team quotas.
+type Service struct {
+	Helm      Releases
+	Quotas    Quotas
+	Inspector Inspector
+	Databases Databases
+	// Forwarder opens the tunnels to the pods in Namespace.
+	Forwarder tunnelutils.Forwarder
+	Namespace string
+}
+
+var (
+	_ EnvironmentService   = (*Service)(nil)
+	_ EnvironmentInspector = (*Service)(nil)
+)
+
+// Create creates the chart of a new environment from the source chart and installs it.
+func (s *Service) Create(ctx context.Context, spec Spec) (*Result, error) {
+	name := spec.Metadata.Name
+	if name == "" {
+
+		return nil, &Error{Message: "Missing required fields in request", Kind: ErrInvalid, Err: errors.New("chartMetadata.name is required")}
+	}
+	if spec.TTL < 0 {
+
+		return nil, &Error{Message: "Invalid ttl in request", Kind: ErrInvalid, Err: fmt.Errorf("ttl must be positive, got %s", spec.TTL)}
+	}
+
+	releaseName := ReleaseName(name)
+
+	ctx, unlock, err := s.lock(ctx, releaseName, "create")
+	if err != nil {
+
+		return nil, err
+	}
+	defer unlock()
+
+	// Refuse before the chart of the existing environment gets overwritten.
+	chartList, err := s.Helm.ListReleases(ctx)
+	if err != nil {
+
+		return nil, &Error{Message: "Failed to list environments", Err: err}
+	}
+	if slices.Contains(chartList, releaseName) {
+
+		return nil, &Error{Message: "Environment already exists", Kind: ErrAlreadyExists, Err: fmt.Errorf("release for %s already exist please use update-env endpoint", name)}
+	}
+
+	// The quota is checked and the environment installed under the quota lock, so concurrent
+	// creates of the team can't both fit in the same remaining quota.
+	ctx, unlockQuota, err := s.lockQuota(ctx, spec.Team, "create")
+	if err != nil {
+
+		return nil, err
+	}
+	defer unlockQuota()
+
+	// Check the team quota against the rendered source chart.
+	report, err := s.Quotas.Check(ctx, spec.Team, helmutils.SourceChart, releaseName, nil, true, spec.TTL)
+	if err != nil {
+
+		return nil, &Error{Message: "Failed to evaluate quota", Err: err}
+	}
+	if !report.Allowed {
+
+		return nil, &Error{Message: "Quota exceeded", Kind: ErrQuotaExceeded, Err: fmt.Errorf("team %s exceeded its quota", spec.Team), Quota: report}
+	}
+
+	labels := map[string]string{
+		quotautils.TeamLabel: spec.Team,
+	}
+	if spec.TTL > 0 {
+		labels[quotautils.ExpiresAtLabel] = strconv.FormatInt(time.Now().Add(spec.TTL).Unix(), 10)
+	}
+
+	chartName, err := s.Helm.CreateHelmChartFromSource(ctx, spec.Metadata)
+	if err != nil {
+
+		return nil, &Error{Message: "Failed to create Helm chart", Err: err}
+	}
+
+	rel, err := s.Helm.InstallRelease(ctx, chartName, name, labels)
+	if err != nil {
+
+		return nil, &Error{Message: "Failed to install Helm chart", Err: err}
+	}
+
+	return result(name, rel), nil
+}
+
+// Update merges values into the values of an environment, within the team quota, and upgrades
+// it. The environment is upgraded with its current values when values is empty.
+func (s *Service) Update(ctx context.Context, name string, values map[string]interface{}) (*Result, error) {
+	releaseName := ReleaseName(name)
+
+	// The values are read, merged and upgraded under one lock.
+	ctx, unlock, err := s.lock(ctx, releaseName, "update")
+	if err != nil {
+
+		return nil, err
+	}
+	defer unlock()
+
+	// Check if helm-chart exists
+	exists, err := s.Helm.HasChart(ctx, releaseName)
+	if err != nil {
+
+		return nil, &Error{Message: "Failed to read Helm chart", Err: err}
+	}
+	if !exists {
+
+		return nil, &Error{Message: "Environment not found", Kind: ErrNotFound, Err: errors.New("env doesn't exists,please use creata-env endpoint for brand new env")}
+	}
+
+	if len(values) > 0 {
+		// The values count towards the quota of the team owning the environment.
+		team, err := s.team(ctx, releaseName)
+		if err != nil {
+
+			return nil, err
+		}
+
+		ctx, unlockQuota, err := s.lockQuota(ctx, team, "update")
+		if err != nil {
+
+			return nil, err
+		}
+		defer unlockQuota()
+
+		report, err := s.Quotas.Check(ctx, team, releaseName, releaseName, values, false, 0)
+		if err != nil {
+
+			return nil, &Error{Message: "Failed to evaluate quota", Err: err}
+		}
+		if !report.Allowed {
+
+			return nil, &Error{Message: "Quota exceeded", Kind: ErrQuotaExceeded, Err: fmt.Errorf("team %s exceeded its quota", team), Quota: report}
+		}
+
+		if err := s.Helm.UpdateValues(ctx, releaseName, values); err != nil {
+
+			return nil, &Error{Message: "Updating values.yaml failed", Err: err}
+		}
+	}
+
+	rel, err := s.Helm.UpgradeRelease(ctx, releaseName)
+	if err != nil {
+
+		return nil, &Error{Message: "Failed to update Helm chart", Err: err}
+	}
+
+	return result(name, rel), nil
+}
+
+// Scale sets the replica count of an environment for the scale action.
+func (s *Service) Scale(ctx context.Context, name string, action client.ScaleAction) (*Result, error) {
+	count, exists := Replicas(action)
+	if !exists {
+
+		return nil, &Error{Message: "Invalid scale action", Kind: ErrInvalid, Err: fmt.Errorf("action must be %s or %s, got %q", client.ScaleUp, client.ScaleDown, action)}
+	}
+
+	return s.Update(ctx, name, map[string]interface{}{"replicas": count})
+}
+
+// Delete uninstalls an environment and removes its chart.
+func (s *Service) Delete(ctx context.Context, name string) (*Result, error) {
+	resp, err := s.Helm.UninstallRelease(ctx, ReleaseName(name))
+	if err != nil {
+
+		return nil, &Error{Message: "Failed to uninstall Helm chart", Err: err}
+	}
+
+	return result(name, resp.Release), nil
+}
+
+// Get reports the release status of an environment and how many of its pods are ready.
+func (s *Service) Get(ctx context.Context, name string) (*client.EnvStatus, error) {
+	releaseName := ReleaseName(name)
+
+	releases, err := s.Helm.ListReleaseDetails(ctx, "")
+	if err != nil {
+
+		return nil, &Error{Message: "Failed to list environments", Err: err}
+	}
+
+	var status *client.EnvStatus
+	for _, rel := range releases {
+		if rel.Name != releaseName {
+			continue
+		}
+
+		status = &client.EnvStatus{
+			Name:     name,
+			Release:  rel.Name,
+			Status:   release.StatusUnknown.String(),
+			Revision: rel.Version,
+			Team:     rel.Labels[quotautils.TeamLabel],
+		}
+		if rel.Info != nil {
+			status.Status = rel.Info.Status.String()
+			status.Updated = rel.Info.LastDeployed.Time
+		}
+	}
+
+	if status == nil {
+
+		return nil, &Error{Message: "Environment not found", Kind: ErrNotFound, Err: fmt.Errorf("no environment named %s", name)}
+	}
+
+	pods, err := s.Inspector.Pods(ctx, releaseName)
+	if err != nil {
+
+		return nil, &Error{Message: "Failed to list environment pods", Err: err}
+	}
+
+	status.Pods = len(pods)
+	for _, pod := range pods {
+		if kubeutils.PodReady(pod) {
+			status.ReadyPods++
+		}
+	}
+	status.Ready = status.Status == release.StatusDeployed.String() && status.ReadyPods == status.Pods
+
+	holder, err := s.Helm.LockHolder(ctx, releaseName)
+	if err != nil {
+
+		return nil, &Error{Message: "Failed to read environment lock", Err: err}
+	}
+	if holder != nil {
+		status.Lock = &client.EnvLock{Operation: holder.Operation, Since: holder.Since, Holder: holder.Holder}
+	}
+
+	return status, nil
+}
+
+// List returns the names of the environments.
+func (s *Service) List(ctx context.Context) ([]string, error) {
+	chartList, err := s.Helm.ListReleases(ctx)
+	if err != nil {
+
+		return nil, &Error{Message: "Failed to list environments", Err: err}
+	}
+
+	names := make([]string, 0, len(chartList))
+	for _, releaseName := range chartList {
+		names = append(names, strings.TrimPrefix(releaseName, defaults.EnvPrefix))
+	}
+
+	return names, nil
+}
+
+// lock holds the lock of the release for the operation, so the client methods it calls don't
+// interleave with other operations.
+func (s *Service) lock(ctx context.Context, releaseName, operation string) (context.Context, func(), error) {
+	ctx, unlock, err := s.Helm.Lock(ctx, releaseName, operation)
+	if err != nil {
+
+		return nil, nil, &Error{Message: "Environment is busy", Err: err}
+	}
+
+	return ctx, unlock, nil
+}
+
+// lockQuota holds the quota lock of the team when its policy has limits.
+func (s *Service) lockQuota(ctx context.Context, team, operation string) (context.Context, func(), error) {
+	if s.Quotas.PolicyFor(team) == (quotautils.Policy{}) {
+
+		return ctx, func() {}, nil
+	}
+
+	return s.lock(ctx, QuotaLock(team), operation)
+}
+
+// team returns the team owning the release, the default team for releases created without one.
+func (s *Service) team(ctx context.Context, releaseName string) (string, error) {
+	releases, err := s.Helm.ListReleaseDetails(ctx, "")
+	if err != nil {
+
+		return "", &Error{Message: "Failed to list environments", Err: err}
+	}
+
+	for _, rel := range releases {
+		if rel.Name == releaseName && rel.Labels[quotautils.TeamLabel] != "" {
+
+			return rel.Labels[quotautils.TeamLabel], nil
+		}
+	}
+
+	return quotautils.DefaultTeam, nil
+}
+
+func result(name string, rel *release.Release) *Result {
+	res := &Result{
+		Name:    name,
+		Release: ReleaseName(name),
+	}
+	if rel != nil {
+		res.Revision = rel.Version
+	}
+
+	return res
+}
@@ -0,0 +1,280 @@
+package envservice_test
+
+import (
+	"context"
+	"helm-api/client"
+	"helm-api/defaults"
+	"helm-api/envservice"
+	"helm-api/helmutils"
+	"helm-api/kubeutils"
+	"helm-api/logutils"
+	"helm-api/problemutils"
+	"helm-api/quotautils"
+	"helm-api/sqlutils"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	kubefake "helm.sh/helm/v3/pkg/kube/fake"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// newService returns a service on top of in-memory Helm storage and a fake clientset.
+func newService(t *testing.T, quotaConfig *quotautils.Config) (*envservice.Service, *fake.Clientset) {
+	t.Helper()
+
+	base := logrus.New()
+	base.SetOutput(io.Discard)
+
+	helmClient := &helmutils.RealClient{
+		ActionConfig: &action.Configuration{
+			Releases:     storage.Init(driver.NewMemory()),
+			KubeClient:   &kubefake.PrintingKubeClient{Out: io.Discard},
+			Capabilities: chartutil.DefaultCapabilities,
+			Log:          func(format string, v ...interface{}) {},
+		},
+		Logger:      logutils.NewLogrus(base),
+		Actioner:    &helmutils.RealHelmActioner{},
+		ChartLoader: &helmutils.RealChartLoader{},
+		Charts:      &helmutils.MemoryChartStore{},
+		Locks:       &helmutils.LockManager{},
+		Default: helmutils.Value{
+			Namespace: defaults.NameSpace,
+			SourceDir: filepath.Join("..", defaults.SourceDir),
+		},
+	}
+
+	kubeClient := fake.NewSimpleClientset()
+
+	return &envservice.Service{
+		Helm:      helmClient,
+		Quotas:    &quotautils.Enforcer{Config: quotaConfig, Source: helmClient},
+		Inspector: &kubeutils.Inspector{Client: kubeClient, Namespace: defaults.NameSpace},
+		Databases: &sqlutils.Resolver{Client: kubeClient, Namespace: defaults.NameSpace},
+		Namespace: defaults.NameSpace,
+	}, kubeClient
+}
+
+func TestService(t *testing.T) {
+	service, kubeClient := newService(t, &quotautils.Config{
+		Default: quotautils.Policy{MaxEnvironments: 1},
+	})
+	ctx := context.Background()
+
+	spec := envservice.Spec{
+		Metadata: chart.Metadata{APIVersion: chart.APIVersionV2, Name: "demo", Version: "0.1.0"},
+		Team:     "qa",
+		TTL:      time.Hour,
+	}
+
+	result, err := service.Create(ctx, spec)
+	require.NoError(t, err)
+	assert.Equal(t, &envservice.Result{Name: "demo", Release: "test-demo", Revision: 1}, result)
+
+	_, err = service.Create(ctx, spec)
+	assert.ErrorIs(t, err, envservice.ErrAlreadyExists)
+
+	spec.Metadata.Name = "other"
+	_, err = service.Create(ctx, spec)
+	assert.ErrorIs(t, err, envservice.ErrQuotaExceeded)
+	var envErr *envservice.Error
+	require.ErrorAs(t, err, &envErr)
+	assert.False(t, envErr.Quota.Allowed)
+
+	spec.Metadata.Name = ""
+	_, err = service.Create(ctx, spec)
+	assert.ErrorIs(t, err, envservice.ErrInvalid)
+
+	names, err := service.List(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"demo"}, names)
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "test-demo-0",
+			Labels: map[string]string{kubeutils.InstanceLabel: "test-demo"},
+		},
+		Status: corev1.PodStatus{
+			Phase:      corev1.PodRunning,
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
+		},
+	}
+	_, err = kubeClient.CoreV1().Pods(defaults.NameSpace).Create(ctx, pod, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	status, err := service.Get(ctx, "demo")
+	require.NoError(t, err)
+	assert.Equal(t, "deployed", status.Status)
+	assert.Equal(t, "qa", status.Team)
+	assert.Equal(t, 1, status.ReadyPods)
+	assert.True(t, status.Ready)
+
+	_, err = service.Get(ctx, "missing")
+	assert.ErrorIs(t, err, envservice.ErrNotFound)
+
+	result, err = service.Scale(ctx, "demo", client.ScaleDown)
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Revision)
+
+	_, err = service.Scale(ctx, "demo", client.ScaleAction("sideways"))
+	assert.ErrorIs(t, err, envservice.ErrInvalid)
+
+	result, err = service.Update(ctx, "demo", map[string]interface{}{"replicas": 2})
+	require.NoError(t, err)
+	assert.Equal(t, 3, result.Revision)
+
+	_, err = service.Update(ctx, "missing", map[string]interface{}{"replicas": 2})
+	assert.ErrorIs(t, err, envservice.ErrNotFound)
+
+	result, err = service.Delete(ctx, "demo")
+	require.NoError(t, err)
+	assert.Equal(t, "test-demo", result.Release)
+
+	_, err = service.Delete(ctx, "demo")
+	assert.ErrorIs(t, err, envservice.ErrNotFound)
+
+	names, err = service.List(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, names)
+}
+
+func TestServiceLocks(t *testing.T) {
+	service, _ := newService(t, &quotautils.Config{})
+	ctx := context.Background()
+
+	_, err := service.Create(ctx, envservice.Spec{Metadata: chart.Metadata{APIVersion: chart.APIVersionV2, Name: "demo", Version: "0.1.0"}})
+	require.NoError(t, err)
+
+	_, unlock, err := service.Helm.Lock(ctx, "test-demo", "upgrade")
+	require.NoError(t, err)
+
+	status, err := service.Get(ctx, "demo")
+	require.NoError(t, err)
+	require.NotNil(t, status.Lock)
+	assert.Equal(t, "upgrade", status.Lock.Operation)
+
+	_, err = service.Scale(ctx, "demo", client.ScaleDown)
+	assert.ErrorIs(t, err, envservice.ErrLocked)
+	assert.Equal(t, problemutils.CodeEnvLocked, envservice.ErrorCode(err))
+
+	_, err = service.Update(ctx, "demo", map[string]interface{}{"replicas": 2})
+	assert.ErrorIs(t, err, envservice.ErrLocked)
+
+	_, err = service.Delete(ctx, "demo")
+	assert.ErrorIs(t, err, envservice.ErrLocked)
+
+	unlock()
+
+	status, err = service.Get(ctx, "demo")
+	require.NoError(t, err)
+	assert.Nil(t, status.Lock)
+
+	_, err = service.Delete(ctx, "demo")
+	assert.NoError(t, err)
+}
+
+func TestServiceQuotaLock(t *testing.T) {
+	service, _ := newService(t, &quotautils.Config{
+		Teams: map[string]quotautils.Policy{"qa": {MaxEnvironments: 2}},
+	})
+	ctx := context.Background()
+	spec := envservice.Spec{
+		Metadata: chart.Metadata{APIVersion: chart.APIVersionV2, Name: "demo", Version: "0.1.0"},
+		Team:     "qa",
+	}
+
+	// Another change of the team holds its quota.
+	_, unlock, err := service.Helm.Lock(ctx, envservice.QuotaLock("qa"), "create")
+	require.NoError(t, err)
+
+	_, err = service.Create(ctx, spec)
+	assert.ErrorIs(t, err, envservice.ErrLocked)
+
+	// Teams without limits don't wait for each other.
+	spec.Team = "dev"
+	_, err = service.Create(ctx, spec)
+	require.NoError(t, err)
+
+	_, err = service.Update(ctx, "demo", map[string]interface{}{"replicas": 2})
+	require.NoError(t, err)
+
+	unlock()
+
+	spec.Metadata.Name = "other"
+	spec.Team = "qa"
+	_, err = service.Create(ctx, spec)
+	require.NoError(t, err)
+
+	// The values of an update are checked against the quota of the team owning the environment.
+	_, unlock, err = service.Helm.Lock(ctx, envservice.QuotaLock("qa"), "update")
+	require.NoError(t, err)
+	defer unlock()
+
+	_, err = service.Update(ctx, "other", map[string]interface{}{"replicas": 2})
+	assert.ErrorIs(t, err, envservice.ErrLocked)
+}
+
+func TestReplicas(t *testing.T) {
+	count, exists := envservice.Replicas(client.ScaleUp)
+	assert.True(t, exists)
+	assert.Equal(t, 1, count)
+
+	count, exists = envservice.Replicas(client.ScaleDown)
+	assert.True(t, exists)
+	assert.Equal(t, 0, count)
+
+	_, exists = envservice.Replicas("sideways")
+	assert.False(t, exists)
+
+	assert.Equal(t, defaults.EnvPrefix+"demo", envservice.ReleaseName("demo"))
+}
+
+func TestServiceFailedReleases(t *testing.T) {
+	service, _ := newService(t, &quotautils.Config{
+		Default: quotautils.Policy{MaxEnvironments: 1},
+	})
+	ctx := context.Background()
+
+	// An install that never completed leaves a pending release behind.
+	releases := service.Helm.(*helmutils.RealClient).ActionConfig.Releases
+	require.NoError(t, releases.Create(&release.Release{
+		Name:      "test-stuck",
+		Namespace: defaults.NameSpace,
+		Version:   1,
+		Info:      &release.Info{Status: release.StatusPendingInstall},
+		Labels:    map[string]string{quotautils.TeamLabel: quotautils.DefaultTeam},
+		Chart:     &chart.Chart{Metadata: &chart.Metadata{APIVersion: chart.APIVersionV2, Name: "test-stuck", Version: "0.1.0"}},
+	}))
+
+	names, err := service.List(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"stuck"}, names)
+
+	// It counts against the quota and can be inspected and deleted.
+	_, err = service.Create(ctx, envservice.Spec{
+		Metadata: chart.Metadata{APIVersion: chart.APIVersionV2, Name: "demo", Version: "0.1.0"},
+		Team:     quotautils.DefaultTeam,
+	})
+	assert.ErrorIs(t, err, envservice.ErrQuotaExceeded)
+
+	_, err = service.Events(ctx, "stuck")
+	require.NoError(t, err)
+
+	_, err = service.Delete(ctx, "stuck")
+	require.NoError(t, err)
+	names, err = service.List(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, names)
+}
@@ -0,0 +1,110 @@
+package grpcutils
+
+import (
+	"context"
+	"helm-api/apiutils"
+	"helm-api/grpcutils/envpb"
+	"helm-api/problemutils"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// APIKeyMetadata carries the API key of a call, like the X-API-Key header of the HTTP API.
+const APIKeyMetadata = "x-api-key"
+
+// route is the /v1 route whose API key rule a method is authorized with.
+type route struct {
+	method string
+	path   string
+}
+
+// routes maps every method to its /v1 route, so both APIs accept the same keys. Methods
+// missing from the map are rejected.
+var routes = map[string]route{
+	envpb.EnvironmentService_CreateEnvironment_FullMethodName: {http.MethodPost, "/v1/envs"},
+	envpb.EnvironmentService_UpdateEnvironment_FullMethodName: {http.MethodPatch, "/v1/envs/{name}"},
+	envpb.EnvironmentService_ScaleEnvironment_FullMethodName:  {http.MethodPost, "/v1/envs/{name}:scale"},
+	envpb.EnvironmentService_DeleteEnvironment_FullMethodName: {http.MethodDelete, "/v1/envs/{name}"},
+	envpb.EnvironmentService_GetEnvironment_FullMethodName:    {http.MethodGet, "/v1/envs/{name}"},
+	envpb.EnvironmentService_ListEnvironments_FullMethodName:  {http.MethodGet, "/v1/envs"},
+	envpb.EnvironmentService_WatchEnvironment_FullMethodName:  {http.MethodGet, "/v1/envs/{name}"},
+}
+
+// APIKey returns the key sent as x-api-key metadata, or as an authorization bearer token.
+func APIKey(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+
+		return ""
+	}
+
+	if keys := md.Get(APIKeyMetadata); len(keys) > 0 {
+
+		return keys[0]
+	}
+
+	for _, value := range md.Get("authorization") {
+		scheme, token, found := strings.Cut(value, " ")
+		if found && strings.EqualFold(scheme, "bearer") {
+
+			return strings.TrimSpace(token)
+		}
+	}
+
+	return ""
+}
+
+// Authorize checks the API key of a call against the rule of the method's /v1 route. The
+// returned context carries the name of the key, see apiutils.Caller.
+func Authorize(ctx context.Context, fullMethod string) (context.Context, error) {
+	rt, exists := routes[fullMethod]
+	if !exists {
+
+		return nil, withReason(status.New(codes.Unauthenticated, "Unauthorized"), problemutils.CodeUnauthorized)
+	}
+
+	name, valid := apiutils.AuthorizeRequest(rt.method, rt.path, APIKey(ctx))
+	if !valid {
+
+		return nil, withReason(status.New(codes.Unauthenticated, "Unauthorized"), problemutils.CodeUnauthorized)
+	}
+
+	return apiutils.WithCaller(ctx, name), nil
+}
+
+// UnaryAuthInterceptor rejects unary calls without a valid API key.
+func UnaryAuthInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := Authorize(ctx, info.FullMethod)
+	if err != nil {
+
+		return nil, err
+	}
+
+	return handler(ctx, req)
+}
+
+// StreamAuthInterceptor rejects streaming calls without a valid API key.
+func StreamAuthInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := Authorize(ss.Context(), info.FullMethod)
+	if err != nil {
+
+		return err
+	}
+
+	return handler(srv, &authorizedStream{ServerStream: ss, ctx: ctx})
+}
+
+// authorizedStream is a stream whose context carries the name of its API key.
+type authorizedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authorizedStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,71 @@
+package grpcutils_test
+
+import (
+	"context"
+	"helm-api/grpcutils"
+	"helm-api/grpcutils/envpb"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestAPIKey(t *testing.T) {
+	tests := []struct {
+		name string
+		md   metadata.MD
+		key  string
+	}{
+		{"api key", metadata.Pairs(grpcutils.APIKeyMetadata, "read-key"), "read-key"},
+		{"bearer", metadata.Pairs("authorization", "Bearer read-key"), "read-key"},
+		{"lowercase bearer", metadata.Pairs("authorization", "bearer read-key"), "read-key"},
+		{"api key first", metadata.Pairs(grpcutils.APIKeyMetadata, "read-key", "authorization", "Bearer other"), "read-key"},
+		{"basic auth", metadata.Pairs("authorization", "Basic cmVhZDprZXk="), ""},
+		{"none", metadata.MD{}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := metadata.NewIncomingContext(context.Background(), tt.md)
+			assert.Equal(t, tt.key, grpcutils.APIKey(ctx))
+		})
+	}
+
+	assert.Empty(t, grpcutils.APIKey(context.Background()))
+}
+
+func TestAuthorize(t *testing.T) {
+	t.Setenv("HELM_API_CREATE_API_KEY", "create-key")
+	t.Setenv("HELM_API_UPDATE_API_KEY", "update-key")
+	t.Setenv("HELM_API_DELETE_API_KEY", "delete-key")
+	t.Setenv("HELM_API_READ_API_KEY", "read-key")
+
+	tests := []struct {
+		method string
+		key    string
+		code   codes.Code
+	}{
+		{envpb.EnvironmentService_CreateEnvironment_FullMethodName, "create-key", codes.OK},
+		{envpb.EnvironmentService_CreateEnvironment_FullMethodName, "update-key", codes.Unauthenticated},
+		{envpb.EnvironmentService_UpdateEnvironment_FullMethodName, "update-key", codes.OK},
+		{envpb.EnvironmentService_ScaleEnvironment_FullMethodName, "update-key", codes.OK},
+		{envpb.EnvironmentService_ScaleEnvironment_FullMethodName, "read-key", codes.Unauthenticated},
+		{envpb.EnvironmentService_DeleteEnvironment_FullMethodName, "delete-key", codes.OK},
+		{envpb.EnvironmentService_DeleteEnvironment_FullMethodName, "create-key", codes.Unauthenticated},
+		{envpb.EnvironmentService_GetEnvironment_FullMethodName, "read-key", codes.OK},
+		{envpb.EnvironmentService_ListEnvironments_FullMethodName, "read-key", codes.OK},
+		{envpb.EnvironmentService_WatchEnvironment_FullMethodName, "read-key", codes.OK},
+		{envpb.EnvironmentService_WatchEnvironment_FullMethodName, "", codes.Unauthenticated},
+		{"/grpc.health.v1.Health/Check", "read-key", codes.Unauthenticated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.key, func(t *testing.T) {
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(grpcutils.APIKeyMetadata, tt.key))
+			_, err := grpcutils.Authorize(ctx, tt.method)
+			assert.Equal(t, tt.code, status.Code(err))
+		})
+	}
+}
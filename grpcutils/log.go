@@ -0,0 +1,75 @@
+package grpcutils
+
+import (
+	"context"
+	"helm-api/apiutils"
+	"helm-api/logutils"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryLogInterceptor attaches a call-scoped logger to the context of unary calls and logs
+// every completed call under the grpc subsystem.
+func UnaryLogInterceptor(logger logutils.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		callLogger := callLogger(ctx, logger, info.FullMethod)
+
+		resp, err := handler(logutils.NewContext(ctx, callLogger), req)
+		logCall(callLogger, start, err)
+
+		return resp, err
+	}
+}
+
+// StreamLogInterceptor is UnaryLogInterceptor for streaming calls.
+func StreamLogInterceptor(logger logutils.Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		callLogger := callLogger(ss.Context(), logger, info.FullMethod)
+
+		err := handler(srv, &loggedStream{ServerStream: ss, ctx: logutils.NewContext(ss.Context(), callLogger)})
+		logCall(callLogger, start, err)
+
+		return err
+	}
+}
+
+// loggedStream is a server stream whose context carries the call logger.
+type loggedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *loggedStream) Context() context.Context {
+	return s.ctx
+}
+
+func callLogger(ctx context.Context, logger logutils.Logger, method string) logutils.Logger {
+	fields := logutils.Fields{
+		"grpc_method": method,
+	}
+	if keyID := apiutils.KeyID(APIKey(ctx)); keyID != "" {
+		fields["key_id"] = keyID
+	}
+
+	return logger.WithFields(fields)
+}
+
+func logCall(logger logutils.Logger, start time.Time, err error) {
+	code := status.Code(err)
+	grpcLogger := logutils.ForSubsystem(logger, logutils.SubsystemGRPC).WithFields(logutils.Fields{
+		"code":        code.String(),
+		"duration_ms": time.Since(start).Milliseconds(),
+	})
+
+	switch code {
+	case codes.OK, codes.Canceled, codes.InvalidArgument, codes.NotFound, codes.AlreadyExists, codes.ResourceExhausted, codes.Unauthenticated:
+		grpcLogger.Info("Call completed")
+	default:
+		grpcLogger.Errorf("Call failed: %v", err)
+	}
+}
@@ -0,0 +1,49 @@
+package grpcutils
+
+import (
+	"context"
+	"helm-api/logutils"
+	"helm-api/problemutils"
+	"runtime/debug"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryRecoverInterceptor turns a panic of a unary call into an Internal status, so one
+// failing call doesn't take the whole server down.
+func UnaryRecoverInterceptor(logger logutils.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				err = recovery(ctx, logger, recovered)
+			}
+		}()
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamRecoverInterceptor is UnaryRecoverInterceptor for streaming calls.
+func StreamRecoverInterceptor(logger logutils.Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				err = recovery(ss.Context(), logger, recovered)
+			}
+		}()
+
+		return handler(srv, ss)
+	}
+}
+
+// recovery logs the panic with its stack and returns the status sent to the caller, which
+// doesn't carry the panic value.
+func recovery(ctx context.Context, logger logutils.Logger, recovered interface{}) error {
+	logutils.ForSubsystem(logutils.FromContext(ctx, logger), logutils.SubsystemGRPC).WithFields(logutils.Fields{
+		"stack": string(debug.Stack()),
+	}).Errorf("Call panicked: %v", recovered)
+
+	return withReason(status.New(codes.Internal, "Internal error"), problemutils.CodeInternal)
+}
@@ -0,0 +1,88 @@
+package grpcutils_test
+
+import (
+	"bytes"
+	"context"
+	"helm-api/grpcutils"
+	"helm-api/grpcutils/envpb"
+	"helm-api/logutils"
+	"helm-api/problemutils"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestServerRecovers(t *testing.T) {
+	envs := &fakeEnvService{panics: true}
+	envClient := newTestClient(t, envs)
+
+	_, err := envClient.ListEnvironments(withKey("read-key"), &envpb.ListEnvironmentsRequest{})
+	assertInternal(t, err)
+
+	stream, err := envClient.WatchEnvironment(withKey("read-key"), &envpb.WatchEnvironmentRequest{Name: "demo"})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	assertInternal(t, err)
+
+	// The server keeps serving the calls after the panics
+	envs.mu.Lock()
+	envs.panics = false
+	envs.mu.Unlock()
+	list, err := envClient.ListEnvironments(withKey("read-key"), &envpb.ListEnvironmentsRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"demo"}, list.Names)
+}
+
+func TestRecoverInterceptorsLogPanics(t *testing.T) {
+	var output bytes.Buffer
+	base := logrus.New()
+	base.SetOutput(&output)
+	logger := logutils.NewLogrus(base)
+
+	_, err := grpcutils.UnaryRecoverInterceptor(logger)(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/test/Unary"},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			panic("unary boom")
+		})
+	assertInternal(t, err)
+	assert.Contains(t, output.String(), "Call panicked: unary boom")
+	assert.Contains(t, output.String(), "stack=")
+
+	err = grpcutils.StreamRecoverInterceptor(logger)(nil, &contextStream{ctx: context.Background()}, &grpc.StreamServerInfo{FullMethod: "/test/Stream"},
+		func(srv interface{}, stream grpc.ServerStream) error {
+			panic("stream boom")
+		})
+	assertInternal(t, err)
+	assert.Contains(t, output.String(), "Call panicked: stream boom")
+}
+
+// contextStream is a server stream only answering its context.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+// assertInternal checks the status of a recovered call, which must not leak the panic value.
+func assertInternal(t *testing.T, err error) {
+	t.Helper()
+
+	st := status.Convert(err)
+	assert.Equal(t, codes.Internal, st.Code())
+	assert.NotContains(t, st.Message(), "boom")
+	assert.NotContains(t, st.Message(), "broken")
+
+	details := st.Details()
+	require.Len(t, details, 1)
+	info, ok := details[0].(*errdetails.ErrorInfo)
+	require.True(t, ok)
+	assert.Equal(t, string(problemutils.CodeInternal), info.Reason)
+}
@@ -0,0 +1,298 @@
+package grpcutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"helm-api/apiutils"
+	"helm-api/client"
+	"helm-api/envservice"
+	"helm-api/grpcutils/envpb"
+	"helm-api/logutils"
+	"helm-api/problemutils"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+// DefaultWatchInterval is how often WatchEnvironment polls an environment when the call
+// doesn't set an interval.
+const DefaultWatchInterval = 2 * time.Second
+
+// minWatchInterval keeps watchers from polling the cluster in a tight loop.
+const minWatchInterval = 500 * time.Millisecond
+
+// scaleActions maps the protobuf scale actions to the ones of the service.
+var scaleActions = map[envpb.ScaleAction]client.ScaleAction{
+	envpb.ScaleAction_SCALE_ACTION_UP:   client.ScaleUp,
+	envpb.ScaleAction_SCALE_ACTION_DOWN: client.ScaleDown,
+}
+
+// Server serves the environment lifecycle of an EnvironmentService over gRPC.
+type Server struct {
+	envpb.UnimplementedEnvironmentServiceServer
+
+	Envs envservice.EnvironmentService
+	// WatchInterval is the default poll interval of WatchEnvironment, DefaultWatchInterval when zero.
+	WatchInterval time.Duration
+}
+
+// NewServer returns a gRPC server exposing srv, with calls logged, recovered from panics and
+// authorized with the API keys.
+func NewServer(srv *Server, logger logutils.Logger) *grpc.Server {
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(UnaryLogInterceptor(logger), UnaryRecoverInterceptor(logger), UnaryAuthInterceptor),
+		grpc.ChainStreamInterceptor(StreamLogInterceptor(logger), StreamRecoverInterceptor(logger), StreamAuthInterceptor),
+	)
+	envpb.RegisterEnvironmentServiceServer(server, srv)
+
+	return server
+}
+
+func (s *Server) CreateEnvironment(ctx context.Context, req *envpb.CreateEnvironmentRequest) (*envpb.OperationResult, error) {
+	meta := req.GetChart()
+	spec := envservice.Spec{
+		Metadata: chart.Metadata{
+			APIVersion:  meta.GetApiVersion(),
+			Name:        meta.GetName(),
+			Version:     meta.GetVersion(),
+			AppVersion:  meta.GetAppVersion(),
+			Description: meta.GetDescription(),
+		},
+		Team: apiutils.CallerTeam(ctx),
+	}
+	if spec.Metadata.APIVersion == "" {
+		spec.Metadata.APIVersion = chart.APIVersionV2
+	}
+
+	if req.Ttl != nil {
+		if err := req.Ttl.CheckValid(); err != nil || req.Ttl.AsDuration() <= 0 {
+
+			return nil, invalid("Invalid ttl in request", fmt.Errorf("ttl must be a positive duration, got %s", req.Ttl.AsDuration()))
+		}
+		spec.TTL = req.Ttl.AsDuration()
+	}
+
+	result, err := s.Envs.Create(ctx, spec)
+	if err != nil {
+
+		return nil, Status(err)
+	}
+
+	return operationResult(result), nil
+}
+
+func (s *Server) UpdateEnvironment(ctx context.Context, req *envpb.UpdateEnvironmentRequest) (*envpb.OperationResult, error) {
+	values := req.GetValues().AsMap()
+	if len(values) == 0 {
+
+		return nil, invalid("Missing required fields in request", errors.New("values must not be empty"))
+	}
+
+	result, err := s.Envs.Update(ctx, req.GetName(), values)
+	if err != nil {
+
+		return nil, Status(err)
+	}
+
+	return operationResult(result), nil
+}
+
+func (s *Server) ScaleEnvironment(ctx context.Context, req *envpb.ScaleEnvironmentRequest) (*envpb.OperationResult, error) {
+	action, exists := scaleActions[req.GetAction()]
+	if !exists {
+
+		return nil, invalid("Invalid scale action", fmt.Errorf("action must be %s or %s, got %s", envpb.ScaleAction_SCALE_ACTION_UP, envpb.ScaleAction_SCALE_ACTION_DOWN, req.GetAction()))
+	}
+
+	result, err := s.Envs.Scale(ctx, req.GetName(), action)
+	if err != nil {
+
+		return nil, Status(err)
+	}
+
+	return operationResult(result), nil
+}
+
+func (s *Server) DeleteEnvironment(ctx context.Context, req *envpb.DeleteEnvironmentRequest) (*envpb.OperationResult, error) {
+	result, err := s.Envs.Delete(ctx, req.GetName())
+	if err != nil {
+
+		return nil, Status(err)
+	}
+
+	return operationResult(result), nil
+}
+
+func (s *Server) GetEnvironment(ctx context.Context, req *envpb.GetEnvironmentRequest) (*envpb.Environment, error) {
+	env, err := s.Envs.Get(ctx, req.GetName())
+	if err != nil {
+
+		return nil, Status(err)
+	}
+
+	return environment(env), nil
+}
+
+func (s *Server) ListEnvironments(ctx context.Context, req *envpb.ListEnvironmentsRequest) (*envpb.ListEnvironmentsResponse, error) {
+	names, err := s.Envs.List(ctx)
+	if err != nil {
+
+		return nil, Status(err)
+	}
+
+	return &envpb.ListEnvironmentsResponse{Names: names}, nil
+}
+
+// WatchEnvironment polls the environment and sends its state whenever it changes. Once the
+// environment is gone a last message with the uninstalled status is sent and the stream ends.
+func (s *Server) WatchEnvironment(req *envpb.WatchEnvironmentRequest, stream envpb.EnvironmentService_WatchEnvironmentServer) error {
+	ctx := stream.Context()
+
+	interval := s.WatchInterval
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	if req.Interval != nil {
+		if err := req.Interval.CheckValid(); err != nil {
+
+			return invalid("Invalid interval in request", err)
+		}
+		interval = max(req.Interval.AsDuration(), minWatchInterval)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last *envpb.Environment
+	for {
+		env, err := s.Envs.Get(ctx, req.GetName())
+		switch {
+		case errors.Is(err, envservice.ErrNotFound) && last != nil:
+			gone := &envpb.Environment{
+				Name:    last.Name,
+				Release: last.Release,
+				Status:  release.StatusUninstalled.String(),
+				Team:    last.Team,
+			}
+
+			return stream.Send(gone)
+		case err != nil:
+
+			return Status(err)
+		}
+
+		current := environment(env)
+		if last == nil || !sameState(last, current) {
+			if err := stream.Send(current); err != nil {
+
+				return err
+			}
+			last = current
+		}
+
+		select {
+		case <-ctx.Done():
+
+			return status.FromContextError(ctx.Err()).Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// statusCodes maps the error codes of the service to gRPC status codes.
+var statusCodes = map[problemutils.Code]codes.Code{
+	problemutils.CodeEnvNotFound:        codes.NotFound,
+	problemutils.CodeEnvAlreadyExists:   codes.AlreadyExists,
+	problemutils.CodeValidationFailed:   codes.InvalidArgument,
+	problemutils.CodeHelmTimeout:        codes.DeadlineExceeded,
+	problemutils.CodeClusterUnreachable: codes.Unavailable,
+	problemutils.CodeQuotaExceeded:      codes.ResourceExhausted,
+	problemutils.CodeEnvLocked:          codes.Aborted,
+}
+
+// ErrorDomain is the domain of the ErrorInfo detail carrying the error code of a failed call.
+const ErrorDomain = "helm-api"
+
+// Status converts an error of the service to a gRPC status error. The error code of the HTTP
+// API is attached as the reason of an ErrorInfo detail.
+func Status(err error) error {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+
+		return status.FromContextError(err).Err()
+	}
+
+	errorCode := envservice.ErrorCode(err)
+	code, exists := statusCodes[errorCode]
+	if !exists {
+		code = codes.Internal
+	}
+
+	message := err.Error()
+	var envErr *envservice.Error
+	if errors.As(err, &envErr) {
+		message = fmt.Sprintf("%s: %s", envErr.Message, envErr.Err)
+	}
+
+	return withReason(status.New(code, message), errorCode)
+}
+
+// withReason attaches the error code to the status as the reason of an ErrorInfo detail.
+func withReason(st *status.Status, errorCode problemutils.Code) error {
+	detailed, err := st.WithDetails(&errdetails.ErrorInfo{
+		Reason: string(errorCode),
+		Domain: ErrorDomain,
+	})
+	if err != nil {
+
+		return st.Err()
+	}
+
+	return detailed.Err()
+}
+
+// invalid is the status of a request failing validation.
+func invalid(message string, err error) error {
+	return Status(&envservice.Error{Message: message, Kind: envservice.ErrInvalid, Err: err})
+}
+
+func operationResult(result *envservice.Result) *envpb.OperationResult {
+	return &envpb.OperationResult{
+		Name:     result.Name,
+		Release:  result.Release,
+		Revision: int32(result.Revision),
+	}
+}
+
+func environment(env *client.EnvStatus) *envpb.Environment {
+	pb := &envpb.Environment{
+		Name:      env.Name,
+		Release:   env.Release,
+		Status:    env.Status,
+		Revision:  int32(env.Revision),
+		Team:      env.Team,
+		Pods:      int32(env.Pods),
+		ReadyPods: int32(env.ReadyPods),
+		Ready:     env.Ready,
+	}
+	if !env.Updated.IsZero() {
+		pb.Updated = timestamppb.New(env.Updated)
+	}
+
+	return pb
+}
+
+// sameState reports whether a watcher has already seen the state of current.
+func sameState(last, current *envpb.Environment) bool {
+	return last.Status == current.Status &&
+		last.Revision == current.Revision &&
+		last.Pods == current.Pods &&
+		last.ReadyPods == current.ReadyPods &&
+		last.Ready == current.Ready
+}
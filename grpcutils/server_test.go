@@ -0,0 +1,299 @@
+package grpcutils_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"helm-api/apiutils"
+	"helm-api/client"
+	"helm-api/envservice"
+	"helm-api/grpcutils"
+	"helm-api/grpcutils/envpb"
+	"helm-api/helmutils"
+	"helm-api/logutils"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// fakeEnvService records the calls of the server and answers Get with the next of states.
+type fakeEnvService struct {
+	mu     sync.Mutex
+	err    error
+	panics bool
+	specs  []envservice.Spec
+	values []map[string]interface{}
+	states []*client.EnvStatus
+}
+
+func (f *fakeEnvService) Create(ctx context.Context, spec envservice.Spec) (*envservice.Result, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.specs = append(f.specs, spec)
+
+	return f.result(spec.Metadata.Name)
+}
+
+func (f *fakeEnvService) Update(ctx context.Context, name string, values map[string]interface{}) (*envservice.Result, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.values = append(f.values, values)
+
+	return f.result(name)
+}
+
+func (f *fakeEnvService) Scale(ctx context.Context, name string, action client.ScaleAction) (*envservice.Result, error) {
+	return f.result(name)
+}
+
+func (f *fakeEnvService) Delete(ctx context.Context, name string) (*envservice.Result, error) {
+	return f.result(name)
+}
+
+// Get returns the states in order and reports the environment as gone after the last one.
+func (f *fakeEnvService) Get(ctx context.Context, name string) (*client.EnvStatus, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.panics {
+		panic("state of " + name + " is nil")
+	}
+	if f.err != nil {
+
+		return nil, f.err
+	}
+	if len(f.states) == 0 {
+
+		return nil, &envservice.Error{Message: "Environment not found", Kind: envservice.ErrNotFound, Err: errors.New("no environment named " + name)}
+	}
+
+	state := f.states[0]
+	f.states = f.states[1:]
+
+	return state, nil
+}
+
+func (f *fakeEnvService) List(ctx context.Context) ([]string, error) {
+	if f.panics {
+		panic("listing is broken")
+	}
+	if f.err != nil {
+
+		return nil, f.err
+	}
+
+	return []string{"demo"}, nil
+}
+
+func (f *fakeEnvService) result(name string) (*envservice.Result, error) {
+	if f.err != nil {
+
+		return nil, f.err
+	}
+
+	return &envservice.Result{Name: name, Release: envservice.ReleaseName(name), Revision: 2}, nil
+}
+
+// newTestClient serves the fake over an in-memory connection.
+func newTestClient(t *testing.T, envs *fakeEnvService) envpb.EnvironmentServiceClient {
+	t.Helper()
+
+	keys := apiutils.Keys
+	apiutils.Keys = apiutils.NewKeyStore()
+	apiutils.Keys.Rotate(map[string]string{
+		"HELM_API_CREATE_API_KEY":    "create-key",
+		"HELM_API_CREATE_API_KEY@qa": "qa-create-key",
+		"HELM_API_UPDATE_API_KEY":    "update-key",
+		"HELM_API_DELETE_API_KEY":    "delete-key",
+		"HELM_API_READ_API_KEY":      "read-key",
+	}, 0)
+	t.Cleanup(func() { apiutils.Keys = keys })
+
+	base := logrus.New()
+	base.SetOutput(io.Discard)
+
+	listener := bufconn.Listen(1 << 20)
+	server := grpcutils.NewServer(&grpcutils.Server{Envs: envs, WatchInterval: 10 * time.Millisecond}, logutils.NewLogrus(base))
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return envpb.NewEnvironmentServiceClient(conn)
+}
+
+// withKey returns a context sending the key as call metadata.
+func withKey(key string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), grpcutils.APIKeyMetadata, key)
+}
+
+func TestServerLifecycle(t *testing.T) {
+	envs := &fakeEnvService{}
+	envClient := newTestClient(t, envs)
+
+	created, err := envClient.CreateEnvironment(withKey("qa-create-key"), &envpb.CreateEnvironmentRequest{
+		Chart: &envpb.ChartMetadata{Name: "demo", Version: "0.1.0"},
+		Ttl:   durationpb.New(24 * time.Hour),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "test-demo", created.Release)
+	require.Len(t, envs.specs, 1)
+	assert.Equal(t, "demo", envs.specs[0].Metadata.Name)
+	assert.Equal(t, "v2", envs.specs[0].Metadata.APIVersion)
+	assert.Equal(t, "qa", envs.specs[0].Team)
+	assert.Equal(t, 24*time.Hour, envs.specs[0].TTL)
+
+	values, err := structpb.NewStruct(map[string]interface{}{"image": map[string]interface{}{"tag": "11.4"}})
+	require.NoError(t, err)
+	updated, err := envClient.UpdateEnvironment(withKey("update-key"), &envpb.UpdateEnvironmentRequest{Name: "demo", Values: values})
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), updated.Revision)
+	assert.Equal(t, map[string]interface{}{"tag": "11.4"}, envs.values[0]["image"])
+
+	_, err = envClient.ScaleEnvironment(withKey("update-key"), &envpb.ScaleEnvironmentRequest{Name: "demo", Action: envpb.ScaleAction_SCALE_ACTION_DOWN})
+	require.NoError(t, err)
+
+	list, err := envClient.ListEnvironments(withKey("read-key"), &envpb.ListEnvironmentsRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"demo"}, list.Names)
+
+	_, err = envClient.DeleteEnvironment(withKey("delete-key"), &envpb.DeleteEnvironmentRequest{Name: "demo"})
+	require.NoError(t, err)
+}
+
+func TestServerValidation(t *testing.T) {
+	envClient := newTestClient(t, &fakeEnvService{})
+
+	_, err := envClient.CreateEnvironment(withKey("create-key"), &envpb.CreateEnvironmentRequest{
+		Chart: &envpb.ChartMetadata{Name: "demo"},
+		Ttl:   durationpb.New(-time.Hour),
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = envClient.UpdateEnvironment(withKey("update-key"), &envpb.UpdateEnvironmentRequest{Name: "demo"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = envClient.ScaleEnvironment(withKey("update-key"), &envpb.ScaleEnvironmentRequest{Name: "demo"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServerAuth(t *testing.T) {
+	envClient := newTestClient(t, &fakeEnvService{})
+
+	// The read key can't create, like on the HTTP API.
+	_, err := envClient.CreateEnvironment(withKey("read-key"), &envpb.CreateEnvironmentRequest{Chart: &envpb.ChartMetadata{Name: "demo"}})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = envClient.DeleteEnvironment(withKey("update-key"), &envpb.DeleteEnvironmentRequest{Name: "demo"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = envClient.ListEnvironments(context.Background(), &envpb.ListEnvironmentsRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// Keys are accepted as bearer tokens as well.
+	bearer := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer read-key")
+	_, err = envClient.ListEnvironments(bearer, &envpb.ListEnvironmentsRequest{})
+	assert.NoError(t, err)
+
+	stream, err := envClient.WatchEnvironment(withKey("create-key"), &envpb.WatchEnvironmentRequest{Name: "demo"})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestServerErrorCodes(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		code codes.Code
+	}{
+		{"not found", &envservice.Error{Message: "Environment not found", Kind: envservice.ErrNotFound, Err: errors.New("no environment named demo")}, codes.NotFound},
+		{"exists", &envservice.Error{Message: "Environment already exists", Kind: envservice.ErrAlreadyExists, Err: errors.New("release for demo already exist")}, codes.AlreadyExists},
+		{"quota", &envservice.Error{Message: "Quota exceeded", Kind: envservice.ErrQuotaExceeded, Err: errors.New("team qa exceeded its quota")}, codes.ResourceExhausted},
+		{"invalid", &envservice.Error{Message: "Invalid scale action", Kind: envservice.ErrInvalid, Err: errors.New("bad action")}, codes.InvalidArgument},
+		{"timeout", &envservice.Error{Message: "Failed to install Helm chart", Kind: helmutils.ErrTimeout, Err: errors.New("timed out waiting for the condition")}, codes.DeadlineExceeded},
+		{"locked", &envservice.Error{Message: "Environment is busy", Err: fmt.Errorf("%w: test-demo is running upgrade", envservice.ErrLocked)}, codes.Aborted},
+		{"internal", &envservice.Error{Message: "Failed to list environments", Err: errors.New("cluster unreachable")}, codes.Internal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			envClient := newTestClient(t, &fakeEnvService{err: tt.err})
+
+			_, err := envClient.GetEnvironment(withKey("read-key"), &envpb.GetEnvironmentRequest{Name: "demo"})
+			assert.Equal(t, tt.code, status.Code(err))
+
+			var envErr *envservice.Error
+			require.True(t, errors.As(tt.err, &envErr))
+			assert.Equal(t, envErr.Message+": "+envErr.Err.Error(), status.Convert(err).Message())
+
+			details := status.Convert(err).Details()
+			require.Len(t, details, 1)
+			info, ok := details[0].(*errdetails.ErrorInfo)
+			require.True(t, ok)
+			assert.Equal(t, string(envservice.ErrorCode(tt.err)), info.Reason)
+			assert.Equal(t, grpcutils.ErrorDomain, info.Domain)
+		})
+	}
+}
+
+func TestWatchEnvironment(t *testing.T) {
+	updated := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	envs := &fakeEnvService{states: []*client.EnvStatus{
+		{Name: "demo", Release: "test-demo", Status: "pending-install", Revision: 1, Pods: 1},
+		{Name: "demo", Release: "test-demo", Status: "pending-install", Revision: 1, Pods: 1},
+		{Name: "demo", Release: "test-demo", Status: "deployed", Revision: 1, Pods: 1, Updated: updated},
+		{Name: "demo", Release: "test-demo", Status: "deployed", Revision: 1, Pods: 1, ReadyPods: 1, Ready: true, Updated: updated},
+	}}
+	envClient := newTestClient(t, envs)
+
+	stream, err := envClient.WatchEnvironment(withKey("read-key"), &envpb.WatchEnvironmentRequest{Name: "demo"})
+	require.NoError(t, err)
+
+	var received []*envpb.Environment
+	for {
+		env, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		received = append(received, env)
+	}
+
+	// Unchanged states are skipped and the stream ends once the environment is gone.
+	require.Len(t, received, 4)
+	assert.Equal(t, "pending-install", received[0].Status)
+	assert.Nil(t, received[0].Updated)
+	assert.Equal(t, "deployed", received[1].Status)
+	assert.Equal(t, updated, received[1].Updated.AsTime())
+	assert.True(t, received[2].Ready)
+	assert.Equal(t, "uninstalled", received[3].Status)
+	assert.Equal(t, "test-demo", received[3].Release)
+
+	// Watching an environment that doesn't exist fails right away.
+	stream, err = envClient.WatchEnvironment(withKey("read-key"), &envpb.WatchEnvironmentRequest{Name: "missing"})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
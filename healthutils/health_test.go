@@ -0,0 +1,58 @@
+package healthutils_test
+
+import (
+	"context"
+	"errors"
+	"helm-api/healthutils"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+
+	checks := []healthutils.Check{
+		{Name: "ok", Run: func(ctx context.Context) error { return nil }},
+		{Name: "failing", Run: func(ctx context.Context) error { return errors.New("storage unavailable") }},
+		// Ignores its context, like checks wrapping blocking client calls.
+		{Name: "stuck", Run: func(ctx context.Context) error { <-block; return nil }},
+		{Name: "panicking", Run: func(ctx context.Context) error { panic("boom") }},
+	}
+
+	start := time.Now()
+	report := healthutils.Run(context.Background(), checks, 50*time.Millisecond)
+
+	assert.Less(t, time.Since(start), time.Second)
+	assert.False(t, report.Healthy())
+	assert.Equal(t, healthutils.StatusFailed, report.Status)
+
+	expected := []struct {
+		name   string
+		status string
+		err    string
+	}{
+		{"ok", healthutils.StatusOK, ""},
+		{"failing", healthutils.StatusFailed, "storage unavailable"},
+		{"stuck", healthutils.StatusFailed, "check timed out after 50ms"},
+		{"panicking", healthutils.StatusFailed, "check panicked: boom"},
+	}
+	if assert.Len(t, report.Checks, len(expected)) {
+		for i, want := range expected {
+			assert.Equal(t, want.name, report.Checks[i].Name)
+			assert.Equal(t, want.status, report.Checks[i].Status, want.name)
+			assert.Equal(t, want.err, report.Checks[i].Error, want.name)
+		}
+	}
+}
+
+func TestRunHealthy(t *testing.T) {
+	report := healthutils.Run(context.Background(), []healthutils.Check{
+		{Name: "ok", Run: func(ctx context.Context) error { return nil }},
+	}, time.Second)
+
+	assert.True(t, report.Healthy())
+	assert.Equal(t, healthutils.StatusOK, report.Checks[0].Status)
+}
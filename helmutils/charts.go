@@ -0,0 +1,285 @@
+package helmutils
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"helm.sh/helm/v3/pkg/chart/loader"
+)
+
+// ChartFile is a file of a chart directory, named by its slash separated path in the directory.
+type ChartFile = loader.BufferedFile
+
+// ChartStore keeps the chart directory of each release, addressed by the release name.
+type ChartStore interface {
+	// Put stores the files of the chart, replacing the stored chart.
+	Put(ctx context.Context, name string, files []*ChartFile) error
+	// Get returns the files of the chart, ErrChartNotFound when it's missing.
+	Get(ctx context.Context, name string) ([]*ChartFile, error)
+	// List returns the names of the stored charts, sorted.
+	List(ctx context.Context) ([]string, error)
+	// Delete removes the chart, missing charts are ignored.
+	Delete(ctx context.Context, name string) error
+}
+
+// LocalChartStore keeps the charts in the subfolders of a local directory.
+type LocalChartStore struct {
+	Dir string
+}
+
+var _ ChartStore = (*LocalChartStore)(nil)
+
+// Put writes the chart next to its folder and swaps it in, so readers never see half of it.
+func (s *LocalChartStore) Put(ctx context.Context, name string, files []*ChartFile) error {
+	if _, err := os.Stat(s.Dir); err != nil {
+
+		return fmt.Errorf("output directory does not exist: %s", s.Dir)
+	}
+
+	staging, err := os.MkdirTemp(s.Dir, "."+name+"-*")
+	if err != nil {
+
+		return fmt.Errorf("failed to stage chart %s: %w", name, err)
+	}
+	defer os.RemoveAll(staging)
+
+	if err := WriteChartDir(staging, files); err != nil {
+
+		return err
+	}
+	if err := os.Chmod(staging, 0755); err != nil {
+
+		return fmt.Errorf("failed to stage chart %s: %w", name, err)
+	}
+
+	chartDir := filepath.Join(s.Dir, name)
+	if err := os.RemoveAll(chartDir); err != nil {
+
+		return fmt.Errorf("failed to replace chart %s: %w", name, err)
+	}
+
+	return os.Rename(staging, chartDir)
+}
+
+// Get reads the files of the chart folder.
+func (s *LocalChartStore) Get(ctx context.Context, name string) ([]*ChartFile, error) {
+	chartDir := filepath.Join(s.Dir, name)
+	if _, err := os.Stat(chartDir); os.IsNotExist(err) {
+
+		return nil, fmt.Errorf("%w: %s", ErrChartNotFound, name)
+	}
+
+	return ReadChartDir(chartDir)
+}
+
+// List returns the chart folders, skipping the hidden ones being staged.
+func (s *LocalChartStore) List(ctx context.Context) ([]string, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+
+		return nil, fmt.Errorf("failed to list charts: %w", err)
+	}
+
+	names := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+			names = append(names, entry.Name())
+		}
+	}
+
+	return names, nil
+}
+
+// Delete removes the chart folder.
+func (s *LocalChartStore) Delete(ctx context.Context, name string) error {
+	return os.RemoveAll(filepath.Join(s.Dir, name))
+}
+
+// MemoryChartStore keeps the charts in memory, for tests and single replica trials.
+type MemoryChartStore struct {
+	mu     sync.Mutex
+	charts map[string][]*ChartFile
+}
+
+var _ ChartStore = (*MemoryChartStore)(nil)
+
+func (s *MemoryChartStore) Put(ctx context.Context, name string, files []*ChartFile) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.charts == nil {
+		s.charts = map[string][]*ChartFile{}
+	}
+	s.charts[name] = copyChartFiles(files)
+
+	return nil
+}
+
+func (s *MemoryChartStore) Get(ctx context.Context, name string) ([]*ChartFile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files, exists := s.charts[name]
+	if !exists {
+
+		return nil, fmt.Errorf("%w: %s", ErrChartNotFound, name)
+	}
+
+	return copyChartFiles(files), nil
+}
+
+func (s *MemoryChartStore) List(ctx context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := []string{}
+	for name := range s.charts {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	return names, nil
+}
+
+func (s *MemoryChartStore) Delete(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.charts, name)
+
+	return nil
+}
+
+func copyChartFiles(files []*ChartFile) []*ChartFile {
+	copied := make([]*ChartFile, 0, len(files))
+	for _, file := range files {
+		copied = append(copied, &ChartFile{Name: file.Name, Data: slices.Clone(file.Data)})
+	}
+
+	return copied
+}
+
+// ReadChartDir returns the files of a chart directory.
+func ReadChartDir(dir string) ([]*ChartFile, error) {
+	files := []*ChartFile{}
+	err := filepath.WalkDir(dir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+
+			return err
+		}
+
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+
+			return err
+		}
+		name, err := filepath.Rel(dir, filePath)
+		if err != nil {
+
+			return err
+		}
+		files = append(files, &ChartFile{Name: filepath.ToSlash(name), Data: data})
+
+		return nil
+	})
+	if err != nil {
+
+		return nil, fmt.Errorf("failed to read chart %s: %w", dir, err)
+	}
+
+	return files, nil
+}
+
+// WriteChartDir writes the files of a chart into dir.
+func WriteChartDir(dir string, files []*ChartFile) error {
+	for _, file := range files {
+		filePath, err := chartFilePath(dir, file.Name)
+		if err != nil {
+
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+
+			return fmt.Errorf("failed to write chart file %s: %w", file.Name, err)
+		}
+		if err := os.WriteFile(filePath, file.Data, 0644); err != nil {
+
+			return fmt.Errorf("failed to write chart file %s: %w", file.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// chartFilePath returns the path of a chart file in dir, refusing the names escaping it.
+func chartFilePath(dir, name string) (string, error) {
+	cleaned := path.Clean(name)
+	if path.IsAbs(cleaned) || cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+
+		return "", fmt.Errorf("invalid chart file name %q", name)
+	}
+
+	return filepath.Join(dir, filepath.FromSlash(cleaned)), nil
+}
+
+// ArchiveChart packs the files of a chart into a gzipped tarball, the format of `helm package`,
+// for the stores keeping a chart in a single object.
+func ArchiveChart(name string, files []*ChartFile) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	archive := tar.NewWriter(gz)
+
+	for _, file := range files {
+		if _, err := chartFilePath(name, file.Name); err != nil {
+
+			return nil, err
+		}
+
+		header := &tar.Header{
+			Name:     path.Join(name, path.Clean(file.Name)),
+			Mode:     0644,
+			Size:     int64(len(file.Data)),
+			Typeflag: tar.TypeReg,
+		}
+		if err := archive.WriteHeader(header); err != nil {
+
+			return nil, fmt.Errorf("failed to archive chart %s: %w", name, err)
+		}
+		if _, err := archive.Write(file.Data); err != nil {
+
+			return nil, fmt.Errorf("failed to archive chart %s: %w", name, err)
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+
+		return nil, fmt.Errorf("failed to archive chart %s: %w", name, err)
+	}
+	if err := gz.Close(); err != nil {
+
+		return nil, fmt.Errorf("failed to archive chart %s: %w", name, err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// UnarchiveChart returns the files of a chart packed by ArchiveChart.
+func UnarchiveChart(data []byte) ([]*ChartFile, error) {
+	files, err := loader.LoadArchiveFiles(bytes.NewReader(data))
+	if err != nil {
+
+		return nil, fmt.Errorf("failed to unpack chart: %w", err)
+	}
+
+	return files, nil
+}
@@ -0,0 +1,98 @@
+package helmutils_test
+
+import (
+	"context"
+	"helm-api/helmutils"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func chartFiles(name string) []*helmutils.ChartFile {
+	return []*helmutils.ChartFile{
+		{Name: "Chart.yaml", Data: []byte("apiVersion: v2\nname: " + name + "\nversion: 0.1.0\n")},
+		{Name: "values.yaml", Data: []byte("replicas: 1\n")},
+		{Name: "templates/statefulset.yaml", Data: []byte("kind: StatefulSet\n")},
+	}
+}
+
+func fileNames(files []*helmutils.ChartFile) []string {
+	names := []string{}
+	for _, file := range files {
+		names = append(names, file.Name)
+	}
+
+	return names
+}
+
+func TestChartStores(t *testing.T) {
+	stores := map[string]func(t *testing.T) helmutils.ChartStore{
+		"local":  func(t *testing.T) helmutils.ChartStore { return &helmutils.LocalChartStore{Dir: t.TempDir()} },
+		"memory": func(t *testing.T) helmutils.ChartStore { return &helmutils.MemoryChartStore{} },
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			ctx := context.Background()
+
+			_, err := store.Get(ctx, "test-demo")
+			assert.ErrorIs(t, err, helmutils.ErrChartNotFound)
+
+			require.NoError(t, store.Put(ctx, "test-demo", chartFiles("test-demo")))
+			require.NoError(t, store.Put(ctx, "test-other", chartFiles("test-other")))
+
+			files, err := store.Get(ctx, "test-demo")
+			require.NoError(t, err)
+			assert.ElementsMatch(t, []string{"Chart.yaml", "values.yaml", "templates/statefulset.yaml"}, fileNames(files))
+
+			names, err := store.List(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"test-demo", "test-other"}, names)
+
+			// Put replaces the whole chart.
+			require.NoError(t, store.Put(ctx, "test-demo", chartFiles("test-demo")[:2]))
+			files, err = store.Get(ctx, "test-demo")
+			require.NoError(t, err)
+			assert.ElementsMatch(t, []string{"Chart.yaml", "values.yaml"}, fileNames(files))
+
+			require.NoError(t, store.Delete(ctx, "test-demo"))
+			require.NoError(t, store.Delete(ctx, "test-demo"))
+			_, err = store.Get(ctx, "test-demo")
+			assert.ErrorIs(t, err, helmutils.ErrChartNotFound)
+		})
+	}
+}
+
+func TestLocalChartStoreLayout(t *testing.T) {
+	dir := t.TempDir()
+	store := &helmutils.LocalChartStore{Dir: dir}
+
+	require.NoError(t, store.Put(context.Background(), "test-demo", chartFiles("test-demo")))
+
+	// Charts are plain folders, as written by earlier versions.
+	data, err := os.ReadFile(filepath.Join(dir, "test-demo", "templates", "statefulset.yaml"))
+	require.NoError(t, err)
+	assert.Equal(t, "kind: StatefulSet\n", string(data))
+
+	err = store.Put(context.Background(), "test-evil", []*helmutils.ChartFile{{Name: "../escaped.yaml"}})
+	assert.ErrorContains(t, err, "invalid chart file name")
+
+	missing := &helmutils.LocalChartStore{Dir: filepath.Join(dir, "missing")}
+	assert.ErrorContains(t, missing.Put(context.Background(), "test-demo", chartFiles("test-demo")), "output directory does not exist")
+}
+
+func TestArchiveChart(t *testing.T) {
+	data, err := helmutils.ArchiveChart("test-demo", chartFiles("test-demo"))
+	require.NoError(t, err)
+
+	files, err := helmutils.UnarchiveChart(data)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, chartFiles("test-demo"), files)
+
+	_, err = helmutils.ArchiveChart("test-demo", []*helmutils.ChartFile{{Name: "/etc/passwd"}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,137 @@
+package helmutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+var (
+	// ErrReleaseExists is returned when installing an environment that is already installed.
+	ErrReleaseExists = errors.New("release already exists")
+	// ErrReleaseNotFound is returned when changing an environment that isn't installed.
+	ErrReleaseNotFound = errors.New("release not found")
+	// ErrInvalid is returned when a request, or the chart values it sets, are invalid.
+	ErrInvalid = errors.New("validation failed")
+	// ErrTimeout is returned when a Helm action didn't complete in time, e.g. pods that never got ready.
+	ErrTimeout = errors.New("helm action timed out")
+	// ErrClusterUnreachable is returned when the Kubernetes API can't be reached.
+	ErrClusterUnreachable = errors.New("kubernetes cluster unreachable")
+	// ErrQuotaExceeded is returned when a change would exceed the team quota.
+	ErrQuotaExceeded = errors.New("quota exceeded")
+	// ErrLocked is returned when another operation on the release holds its lock.
+	ErrLocked = errors.New("another operation is in progress")
+	// ErrChartNotFound is returned when the chart store has no chart of that name.
+	ErrChartNotFound = errors.New("chart not found")
+)
+
+// kinds are the sentinels above, the APIs map each of them to their own code.
+var kinds = []error{
+	ErrReleaseExists,
+	ErrReleaseNotFound,
+	ErrInvalid,
+	ErrTimeout,
+	ErrClusterUnreachable,
+	ErrQuotaExceeded,
+	ErrLocked,
+	ErrChartNotFound,
+}
+
+// hasKind reports whether err matches one of the sentinels.
+func hasKind(err error) bool {
+	for _, kind := range kinds {
+		if errors.Is(err, kind) {
+
+			return true
+		}
+	}
+
+	return false
+}
+
+// releaseError keeps the message users have always seen while matching a sentinel with errors.Is.
+type releaseError struct {
+	message string
+	kind    error
+}
+
+func (e *releaseError) Error() string {
+	return e.message
+}
+
+func (e *releaseError) Unwrap() error {
+	return e.kind
+}
+
+func releaseExists(releaseName string) error {
+	return &releaseError{
+		message: fmt.Sprintf("release for %s already exist please use update-env endpoint", releaseName),
+		kind:    ErrReleaseExists,
+	}
+}
+
+func releaseNotFound(releaseName string) error {
+	return &releaseError{
+		message: fmt.Sprintf("release name doesn't match any of helm-api related environments, please use correct release name: %s", releaseName),
+		kind:    ErrReleaseNotFound,
+	}
+}
+
+// kindError tags an error with a sentinel, keeping its message and chain.
+type kindError struct {
+	err  error
+	kind error
+}
+
+func (e *kindError) Error() string {
+	return e.err.Error()
+}
+
+func (e *kindError) Unwrap() []error {
+	return []error{e.kind, e.err}
+}
+
+// classify tags the error of a Helm action with the sentinel of its failure, when it's one
+// the APIs report with their own code.
+func classify(err error) error {
+	if err == nil || hasKind(err) {
+
+		return err
+	}
+
+	switch {
+	case isTimeout(err):
+
+		return &kindError{err: err, kind: ErrTimeout}
+	case isUnreachable(err):
+
+		return &kindError{err: err, kind: ErrClusterUnreachable}
+	}
+
+	return err
+}
+
+// invalid tags an error caused by the values or chart of a request.
+func invalid(err error) error {
+	return &kindError{err: err, kind: ErrInvalid}
+}
+
+func isTimeout(err error) bool {
+	// Helm wraps the wait errors of the Kubernetes client into messages.
+	return errors.Is(err, context.DeadlineExceeded) ||
+		wait.Interrupted(err) ||
+		strings.Contains(err.Error(), "timed out waiting for the condition")
+}
+
+func isUnreachable(err error) bool {
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+
+	return errors.As(err, &opErr) ||
+		errors.As(err, &dnsErr) ||
+		strings.Contains(err.Error(), "Kubernetes cluster unreachable")
+}
@@ -0,0 +1,81 @@
+package helmutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"helm-api/healthutils"
+	"os"
+)
+
+// ReadinessChecks returns the checks that must pass before the client can serve requests.
+func (hc *RealClient) ReadinessChecks() []healthutils.Check {
+	return []healthutils.Check{
+		{Name: "kubernetes", Run: hc.checkKubernetes},
+		{Name: "helmStorage", Run: hc.checkStorage},
+		{Name: "sourceChart", Run: hc.checkSourceChart},
+		{Name: "chartStore", Run: hc.checkChartStore},
+	}
+}
+
+// checkKubernetes verifies the cluster API is reachable with the client's credentials.
+func (hc *RealClient) checkKubernetes(ctx context.Context) error {
+	if hc.ActionConfig == nil || hc.ActionConfig.KubeClient == nil {
+
+		return errors.New("kubernetes client is not configured")
+	}
+
+	if err := hc.ActionConfig.KubeClient.IsReachable(); err != nil {
+
+		return fmt.Errorf("kubernetes API unreachable: %w", err)
+	}
+
+	return nil
+}
+
+// checkStorage verifies the Helm storage driver can list releases.
+func (hc *RealClient) checkStorage(ctx context.Context) error {
+	if hc.ActionConfig == nil || hc.ActionConfig.Releases == nil {
+
+		return errors.New("helm storage is not configured")
+	}
+
+	if _, err := hc.ActionConfig.Releases.ListReleases(); err != nil {
+
+		return fmt.Errorf("failed to list releases: %w", err)
+	}
+
+	return nil
+}
+
+// checkSourceChart verifies the source chart new environments are created from loads.
+func (hc *RealClient) checkSourceChart(ctx context.Context) error {
+	if _, err := hc.loadSourceChart(ctx); err != nil {
+
+		return fmt.Errorf("failed to load source chart %s: %w", hc.Default.SourceDir, err)
+	}
+
+	return nil
+}
+
+// checkChartStore verifies the charts can be listed, and written to the local directory.
+func (hc *RealClient) checkChartStore(ctx context.Context) error {
+	store := hc.charts()
+	if local, ok := store.(*LocalChartStore); ok {
+		file, err := os.CreateTemp(local.Dir, ".readyz-*")
+		if err != nil {
+
+			return fmt.Errorf("output directory %s is not writable: %w", local.Dir, err)
+		}
+		file.Close()
+
+		return os.Remove(file.Name())
+	}
+
+	if _, err := store.List(ctx); err != nil {
+
+		return fmt.Errorf("chart store unavailable: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+package helmutils_test
+
+import (
+	"context"
+	"errors"
+	"helm-api/healthutils"
+	"helm-api/helmutils"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	kubefake "helm.sh/helm/v3/pkg/kube/fake"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+)
+
+// unreachableKubeClient simulates a cluster whose API server can't be reached.
+type unreachableKubeClient struct {
+	kubefake.PrintingKubeClient
+}
+
+func (c *unreachableKubeClient) IsReachable() error {
+	return errors.New("connection refused")
+}
+
+func TestReadinessChecks(t *testing.T) {
+	tests := []struct {
+		name       string
+		kubeClient bool
+		reachable  bool
+		storage    bool
+		chartErr   error
+		outputDir  func(t *testing.T) string
+		failed     map[string]bool
+	}{
+		{
+			name:       "all ready",
+			kubeClient: true,
+			reachable:  true,
+			storage:    true,
+			outputDir:  func(t *testing.T) string { return t.TempDir() },
+			failed:     map[string]bool{},
+		},
+		{
+			name:       "cluster unreachable and chart broken",
+			kubeClient: true,
+			reachable:  false,
+			storage:    true,
+			chartErr:   errors.New("Chart.yaml file is missing"),
+			outputDir:  func(t *testing.T) string { return t.TempDir() },
+			failed:     map[string]bool{"kubernetes": true, "sourceChart": true},
+		},
+		{
+			name:      "not configured and missing output dir",
+			outputDir: func(t *testing.T) string { return filepath.Join(t.TempDir(), "missing") },
+			failed:    map[string]bool{"kubernetes": true, "helmStorage": true, "chartStore": true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := new(action.Configuration)
+			if tt.kubeClient {
+				if tt.reachable {
+					config.KubeClient = &kubefake.PrintingKubeClient{Out: io.Discard}
+				} else {
+					config.KubeClient = &unreachableKubeClient{kubefake.PrintingKubeClient{Out: io.Discard}}
+				}
+			}
+			if tt.storage {
+				config.Releases = storage.Init(driver.NewMemory())
+			}
+
+			mockChartLoader := new(MockChartLoader)
+			mockChartLoader.On("Load", "source").Return(&chart.Chart{}, tt.chartErr)
+
+			client := &helmutils.RealClient{
+				ActionConfig: config,
+				ChartLoader:  mockChartLoader,
+				Default: helmutils.Value{
+					SourceDir: "source",
+					OutputDir: tt.outputDir(t),
+				},
+			}
+
+			report := healthutils.Run(context.Background(), client.ReadinessChecks(), time.Second)
+
+			assert.Equal(t, len(tt.failed) == 0, report.Healthy())
+			for _, result := range report.Checks {
+				assert.Equal(t, tt.failed[result.Name], result.Status == healthutils.StatusFailed, result.Name)
+			}
+		})
+	}
+}
@@ -2,20 +2,29 @@
 package helmutils
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"helm-api/defaults"
+	"helm-api/logutils"
+	"helm-api/metricsutils"
+	"helm-api/tracingutils"
 	"helm-api/utils"
 	"os"
 	"path/filepath"
 	"slices"
+	"strings"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
 	"gopkg.in/yaml.v2"
 	"helm.sh/helm/v3/pkg/action"
 	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
 	"helm.sh/helm/v3/pkg/chartutil"
 	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/engine"
 	"helm.sh/helm/v3/pkg/release"
 )
 
@@ -34,6 +43,16 @@ func loadConfig() (*Config, error) {
 		OutputDir:  utils.GetEnvOrValue("HELM_API_HELM_OUT_DIR", *outputDir),
 		SourceDir:  utils.GetEnvOrValue("HELM_API_HELM_SOURCE_DIR", *sourceDir),
 		HelmDriver: utils.GetEnvOrValue("HELM_DRIVER", *helmDriver),
+		LockWait:   defaults.LockWait,
+	}
+
+	if value := os.Getenv("HELM_API_LOCK_WAIT"); value != "" {
+		wait, err := time.ParseDuration(value)
+		if err != nil || wait < 0 {
+
+			return nil, fmt.Errorf("invalid HELM_API_LOCK_WAIT %q", value)
+		}
+		config.LockWait = wait
 	}
 
 	return config, nil
@@ -50,11 +69,6 @@ func NewRealClient(logger Logger) (*RealClient, error) {
 		return nil, fmt.Errorf("failed to load configuration: %w", err)
 	}
 
-	// Validate API keys
-	if err := utils.ValidateAPIKeys(); err != nil {
-		return nil, err
-	}
-
 	// Initialize Helm configuration
 	settings := cli.New()
 	actionConfig := new(action.Configuration)
@@ -73,62 +87,123 @@ func NewRealClient(logger Logger) (*RealClient, error) {
 	return &RealClient{
 		ActionConfig: actionConfig,
 		Logger:       logger,
+		Actioner:     &RealHelmActioner{},
+		ChartLoader:  &RealChartLoader{},
+		Charts:       &LocalChartStore{Dir: config.OutputDir},
+		Locks:        &LockManager{Wait: config.LockWait},
 		Default: Value{
 			Namespace: config.Namespace,
 			OutputDir: config.OutputDir,
 			SourceDir: config.SourceDir,
+			LockWait:  config.LockWait,
 		},
 	}, nil
 }
 
-func (hc *RealClient) CreateHelmChartFromSource(options chart.Metadata) (chartPath string, err error) {
+// SourceChart names the source chart in RenderManifests, the other names are charts of the store.
+const SourceChart = "@source"
+
+// charts returns the store of the release charts.
+func (hc *RealClient) charts() ChartStore {
+	if hc.Charts == nil {
+
+		return &LocalChartStore{Dir: hc.Default.OutputDir}
+	}
+
+	return hc.Charts
+}
+
+// CreateHelmChartFromSource stores a new chart generated from the source chart and returns its
+// name in the store. An existing chart is kept as is.
+func (hc *RealClient) CreateHelmChartFromSource(ctx context.Context, options chart.Metadata) (chartName string, err error) {
+	ctx, span := tracingutils.Start(ctx, "helm.CreateHelmChartFromSource", attribute.String("helm.chart", options.Name))
+	defer func() { tracingutils.End(span, err) }()
+
+	log := hc.logger(ctx, "create", defaults.EnvPrefix+options.Name)
+
+	_, unlock, err := hc.Lock(ctx, defaults.EnvPrefix+options.Name, "create")
+	if err != nil {
+
+		return "", err
+	}
+	defer unlock()
+
 	// Validate source path existence.
-	hc.Logger.Debug("CreateHelmChartFromSource:sourceDir:%s\n", hc.Default.SourceDir)
+	log.Debug("CreateHelmChartFromSource:sourceDir:", hc.Default.SourceDir)
 	if _, err := os.Stat(hc.Default.SourceDir); os.IsNotExist(err) {
 
 		return "", fmt.Errorf("source chart path does not exist: %s", hc.Default.SourceDir)
 	}
 
-	// Validate output directory existence.
-	if _, err := os.Stat(hc.Default.OutputDir); os.IsNotExist(err) {
+	options.Name = defaults.EnvPrefix + options.Name
+
+	_, err = hc.charts().Get(ctx, options.Name)
+	if err == nil {
+		log.Infof("Helm chart already exist for %v ", options.Name)
+		log.Info("Skipping helm chart creation.")
 
-		return "", fmt.Errorf("output directory does not exist: %s", hc.Default.OutputDir)
+		return options.Name, nil
 	}
+	if !errors.Is(err, ErrChartNotFound) {
 
-	options.Name = defaults.EnvPrefix + options.Name
+		return "", fmt.Errorf("failed to read chart: %w", err)
+	}
+
+	// Generate the new chart from the source chart in a scratch directory.
+	scratch, err := os.MkdirTemp("", "helm-api-chart-*")
+	if err != nil {
 
-	chartPath = hc.Default.OutputDir + "/" + options.Name
+		return "", fmt.Errorf("failed to create chart from source: %w", err)
+	}
+	defer os.RemoveAll(scratch)
 
-	if _, err := os.Stat(chartPath); err == nil {
-		hc.Logger.Infof("Helm chart already exist for %v ", options.Name)
-		hc.Logger.Info("Skipping helm chart creation.")
+	if err = chartutil.CreateFrom(&options, scratch, hc.Default.SourceDir); err != nil {
 
-		return chartPath, nil
+		return "", fmt.Errorf("failed to create chart from source: %w", err)
 	}
 
-	// Create the new chart from the source chart.
-	hc.Logger.Infof("Creating new Helm chart '%s' from source '%s' into destination '%s'", options.Name, hc.Default.SourceDir, hc.Default.OutputDir)
-	if err = chartutil.CreateFrom(&options, hc.Default.OutputDir, hc.Default.SourceDir); err != nil {
+	files, err := ReadChartDir(filepath.Join(scratch, options.Name))
+	if err != nil {
 
 		return "", fmt.Errorf("failed to create chart from source: %w", err)
 	}
 
-	hc.Logger.Infof("Successfully created Helm chart '%s' at '%s'", options.Name, hc.Default.OutputDir)
+	if err := hc.charts().Put(ctx, options.Name, files); err != nil {
 
-	return chartPath, nil
+		return "", fmt.Errorf("failed to store chart: %w", err)
+	}
+
+	log.Infof("Successfully created Helm chart '%s' from source '%s'", options.Name, hc.Default.SourceDir)
+
+	return options.Name, nil
 }
 
-func (hc *RealClient) InstallRelease(chartPath, releaseName string) (*release.Release, error) {
+// InstallRelease installs the stored chart chartName as the release.
+func (hc *RealClient) InstallRelease(ctx context.Context, chartName, releaseName string, labels map[string]string) (rel *release.Release, err error) {
+	done := metricsutils.TrackHelmAction("install")
+	defer func() { done(err) }()
+
+	ctx, span := tracingutils.Start(ctx, "helm.InstallRelease", attribute.String("helm.release", releaseName))
+	defer func() { tracingutils.End(span, err) }()
+
+	log := hc.logger(ctx, "install", defaults.EnvPrefix+releaseName)
+
+	ctx, unlock, err := hc.Lock(ctx, defaults.EnvPrefix+releaseName, "install")
+	if err != nil {
+
+		return nil, err
+	}
+	defer unlock()
 
 	// Get all helm-api related helm releases.
-	chartList, err := hc.ListReleases()
+	chartList, err := hc.ListReleases(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("%w", err)
 	}
 
 	// Make sure don't try to install already existing  helm-api release.
-	if slices.Contains(chartList, releaseName) {
-		return nil, fmt.Errorf("release for %s already exist please use update-env endpoint", releaseName)
+	if slices.Contains(chartList, defaults.EnvPrefix+releaseName) {
+		return nil, releaseExists(releaseName)
 	}
 
 	var values map[string]interface{}
@@ -144,32 +219,48 @@ func (hc *RealClient) InstallRelease(chartPath, releaseName string) (*release.Re
 		ic.Wait = true
 		ic.Timeout = 300 * time.Second
 		ic.DryRun = false
+		ic.Labels = labels
 	}
 
-	chart, err := hc.ChartLoader.Load(chartPath)
+	chart, err := hc.loadChart(ctx, chartName)
 	if err != nil {
 
 		return nil, fmt.Errorf("failed to load chart: %w", err)
 	}
 
-	rel, err := installClient.Run(chart, values)
+	rel, err = installClient.Run(chart, values)
 	if err != nil {
 
-		return nil, fmt.Errorf("%w", err)
+		return nil, classify(err)
 	}
 
-	// Log the installed manifests
-	hc.Logger.Debug("Installed Release Manifests:")
-	hc.Logger.Debug("----------------------------")
-	hc.Logger.Debug(rel.Manifest)
-	hc.Logger.Debug("----------------------------")
+	// Log the installed manifests, without the contents of secrets.
+	log.Debug("Installed Release Manifests:")
+	log.Debug("----------------------------")
+	log.Debug(logutils.RedactManifest(rel.Manifest))
+	log.Debug("----------------------------")
 
 	return rel, nil
 }
 
-func (hc *RealClient) UpgradeRelease(releaseName string) (*release.Release, error) {
+func (hc *RealClient) UpgradeRelease(ctx context.Context, releaseName string) (rel *release.Release, err error) {
+	done := metricsutils.TrackHelmAction("upgrade")
+	defer func() { done(err) }()
+
+	ctx, span := tracingutils.Start(ctx, "helm.UpgradeRelease", attribute.String("helm.release", releaseName))
+	defer func() { tracingutils.End(span, err) }()
+
+	log := hc.logger(ctx, "upgrade", releaseName)
+
+	ctx, unlock, err := hc.Lock(ctx, releaseName, "upgrade")
+	if err != nil {
+
+		return nil, err
+	}
+	defer unlock()
+
 	// Get all helm-api related helm releases
-	chartList, err := hc.ListReleases()
+	chartList, err := hc.ListReleases(ctx)
 	if err != nil {
 
 		return nil, fmt.Errorf("%w", err)
@@ -177,10 +268,9 @@ func (hc *RealClient) UpgradeRelease(releaseName string) (*release.Release, erro
 
 	if !slices.Contains(chartList, releaseName) {
 
-		return nil, fmt.Errorf("release name doesn't match any of helm-api related environments, please use correct release name: %s", releaseName)
+		return nil, releaseNotFound(releaseName)
 	}
 
-	chartPath := filepath.Join(hc.Default.OutputDir, releaseName)
 	var values map[string]interface{}
 
 	upgradeClient := hc.Actioner.NewUpgrade(hc.ActionConfig)
@@ -195,28 +285,43 @@ func (hc *RealClient) UpgradeRelease(releaseName string) (*release.Release, erro
 		uc.Force = true
 	}
 
-	chart, err := hc.ChartLoader.Load(chartPath)
+	chart, err := hc.loadChart(ctx, releaseName)
 	if err != nil {
 
 		return nil, fmt.Errorf("failed to load chart: %w", err)
 	}
 
-	rel, err := upgradeClient.Run(releaseName, chart, values)
+	rel, err = upgradeClient.Run(releaseName, chart, values)
 	if err != nil {
 
-		return nil, fmt.Errorf("%w", err)
+		return nil, classify(err)
 	}
 
-	hc.Logger.Debug("Updated Release Manifests:")
-	hc.Logger.Debug("----------------------------")
-	hc.Logger.Debug(rel.Manifest)
-	hc.Logger.Debug("----------------------------")
+	log.Debug("Updated Release Manifests:")
+	log.Debug("----------------------------")
+	log.Debug(logutils.RedactManifest(rel.Manifest))
+	log.Debug("----------------------------")
 
 	return rel, nil
 }
 
-func (hc *RealClient) UninstallRelease(releaseName string) (*release.UninstallReleaseResponse, error) {
-	chartList, err := hc.ListReleases()
+func (hc *RealClient) UninstallRelease(ctx context.Context, releaseName string) (rel *release.UninstallReleaseResponse, err error) {
+	done := metricsutils.TrackHelmAction("uninstall")
+	defer func() { done(err) }()
+
+	ctx, span := tracingutils.Start(ctx, "helm.UninstallRelease", attribute.String("helm.release", releaseName))
+	defer func() { tracingutils.End(span, err) }()
+
+	log := hc.logger(ctx, "uninstall", releaseName)
+
+	ctx, unlock, err := hc.Lock(ctx, releaseName, "uninstall")
+	if err != nil {
+
+		return nil, err
+	}
+	defer unlock()
+
+	chartList, err := hc.ListReleases(ctx)
 	if err != nil {
 
 		return nil, fmt.Errorf("%w", err)
@@ -224,7 +329,7 @@ func (hc *RealClient) UninstallRelease(releaseName string) (*release.UninstallRe
 
 	if !slices.Contains(chartList, releaseName) {
 
-		return nil, fmt.Errorf("release name doesn't match any of helm-api related environments, please use correct release name: %s", releaseName)
+		return nil, releaseNotFound(releaseName)
 	}
 
 	uninstallClient := hc.Actioner.NewUninstall(hc.ActionConfig)
@@ -237,42 +342,49 @@ func (hc *RealClient) UninstallRelease(releaseName string) (*release.UninstallRe
 		uc.IgnoreNotFound = false
 	}
 
-	hc.Logger.Infof("Uninstall helm chart for '%s'", releaseName)
-	rel, err := uninstallClient.Run(releaseName)
+	log.Infof("Uninstall helm chart for '%s'", releaseName)
+	rel, err = uninstallClient.Run(releaseName)
 	if err != nil {
 
-		return nil, fmt.Errorf("%w", err)
+		return nil, classify(err)
 	}
 
-	hc.Logger.Debug("Removed release info:")
-	hc.Logger.Debug("----------------------------")
-	hc.Logger.Debug(rel.Release.Info)
-	hc.Logger.Debug("----------------------------")
+	log.Debug("Removed release info:")
+	log.Debug("----------------------------")
+	log.Debug(rel.Release.Info)
+	log.Debug("----------------------------")
 
-	hc.Logger.Infof("Chart files removed from the storage")
-	chartPath := filepath.Join(hc.Default.OutputDir, releaseName)
-	if err := hc.Filesystem.DeleteSubfolder(chartPath); err != nil {
+	log.Infof("Chart files removed from the storage")
+	if err := hc.charts().Delete(ctx, releaseName); err != nil {
 		return nil, fmt.Errorf("failed to delete chart files: %w", err)
 	}
 
 	return rel, nil
 }
 
-func (hc *RealClient) ListReleases() (chartList []string, err error) {
+func (hc *RealClient) ListReleases(ctx context.Context) (chartList []string, err error) {
+	done := metricsutils.TrackHelmAction("list")
+	defer func() { done(err) }()
+
+	_, span := tracingutils.Start(ctx, "helm.ListReleases")
+	defer func() { tracingutils.End(span, err) }()
+
 	listClient := hc.Actioner.NewList(hc.ActionConfig)
 
 	// Type assert to set specific fields if needed
 	if lc, ok := listClient.(*action.List); ok {
 		lc.AllNamespaces = false
 		lc.Filter = defaults.EnvPrefix
+		// Failed and pending releases are environments too.
+		lc.All = true
 		lc.SetStateMask()
 	}
 
-	hc.Logger.Infof("List helm chart for namespace: '%s'", hc.Default.Namespace)
+	hc.logger(ctx, "list", "").Infof("List helm chart for namespace: '%s'", hc.Default.Namespace)
 
 	rel, err := listClient.Run()
 	if err != nil {
-		return nil, fmt.Errorf("failed to run list: %w", err)
+		return nil, classify(fmt.Errorf("failed to run list: %w", err))
 	}
 
 	for _, v := range rel {
@@ -282,27 +394,175 @@ func (hc *RealClient) ListReleases() (chartList []string, err error) {
 	return chartList, nil
 }
 
-func (hc *RealClient) UpdateValuesFile(releaseName string, replicaCount int) error {
+// ListReleaseDetails returns the helm-api releases matching the given label selector.
+func (hc *RealClient) ListReleaseDetails(ctx context.Context, selector string) (rel []*release.Release, err error) {
+	done := metricsutils.TrackHelmAction("list")
+	defer func() { done(err) }()
+
+	_, span := tracingutils.Start(ctx, "helm.ListReleaseDetails", attribute.String("helm.selector", selector))
+	defer func() { tracingutils.End(span, err) }()
+
+	listClient := hc.Actioner.NewList(hc.ActionConfig)
+
+	if lc, ok := listClient.(*action.List); ok {
+		lc.AllNamespaces = false
+		lc.Filter = defaults.EnvPrefix
+		lc.Selector = selector
+		// Without All, only deployed and failed releases are listed.
+		lc.All = true
+		lc.SetStateMask()
+	}
+
+	rel, err = listClient.Run()
+	if err != nil {
+		return nil, classify(fmt.Errorf("failed to run list: %w", err))
+	}
+
+	return rel, nil
+}
+
+// RenderManifests renders the stored chart chartName, or the source chart for SourceChart,
+// locally, merging values over the chart defaults.
+func (hc *RealClient) RenderManifests(ctx context.Context, chartName, releaseName string, values map[string]interface{}) (manifest string, err error) {
+	ctx, span := tracingutils.Start(ctx, "helm.RenderManifests", attribute.String("helm.release", releaseName))
+	defer func() { tracingutils.End(span, err) }()
+
+	var chart *chart.Chart
+	if chartName == SourceChart {
+		chart, err = hc.loadSourceChart(ctx)
+	} else {
+		chart, err = hc.loadChart(ctx, chartName)
+	}
+	if err != nil {
+
+		return "", fmt.Errorf("failed to load chart: %w", err)
+	}
+
+	options := chartutil.ReleaseOptions{
+		Name:      releaseName,
+		Namespace: hc.Default.Namespace,
+		IsInstall: true,
+	}
+
+	renderValues, err := chartutil.ToRenderValues(chart, values, options, chartutil.DefaultCapabilities)
+	if err != nil {
+
+		return "", invalid(fmt.Errorf("failed to compute render values: %w", err))
+	}
+
+	files, err := engine.Render(chart, renderValues)
+	if err != nil {
+
+		return "", invalid(fmt.Errorf("failed to render chart: %w", err))
+	}
+
+	// Sort file names so the output is stable.
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var builder strings.Builder
+	for _, name := range names {
+		if filepath.Ext(name) != ".yaml" || strings.TrimSpace(files[name]) == "" {
+			continue
+		}
+		builder.WriteString("---\n# Source: " + name + "\n" + files[name] + "\n")
+	}
+
+	return builder.String(), nil
+}
 
-	chartPath := hc.Default.OutputDir + "/" + releaseName + "/values.yaml"
+// loadChart loads a chart of the store in its own span.
+func (hc *RealClient) loadChart(ctx context.Context, chartName string) (loaded *chart.Chart, err error) {
+	ctx, span := tracingutils.Start(ctx, "helm.ChartStore.Get", attribute.String("helm.chart", chartName))
+	defer func() { tracingutils.End(span, err) }()
+
+	files, err := hc.charts().Get(ctx, chartName)
+	if err != nil {
+
+		return nil, err
+	}
+
+	return loader.LoadFiles(files)
+}
+
+// loadSourceChart loads the source chart through the ChartLoader in its own span.
+func (hc *RealClient) loadSourceChart(ctx context.Context) (loaded *chart.Chart, err error) {
+	_, span := tracingutils.Start(ctx, "helm.ChartLoader.Load", attribute.String("helm.chart_path", hc.Default.SourceDir))
+	defer func() { tracingutils.End(span, err) }()
+
+	return hc.ChartLoader.Load(hc.Default.SourceDir)
+}
+
+// HasChart reports whether the store has the chart of the release.
+func (hc *RealClient) HasChart(ctx context.Context, releaseName string) (bool, error) {
+	_, err := hc.charts().Get(ctx, releaseName)
+	if errors.Is(err, ErrChartNotFound) {
+
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func (hc *RealClient) UpdateValuesFile(ctx context.Context, releaseName string, replicaCount int) error {
+
+	return hc.UpdateValues(ctx, releaseName, map[string]interface{}{"replicas": replicaCount})
+}
+
+// UpdateValues merges values into the values.yaml of the release chart. Nested maps are merged
+// key by key, other values replace the existing ones.
+func (hc *RealClient) UpdateValues(ctx context.Context, releaseName string, values map[string]interface{}) error {
+	_, unlock, err := hc.Lock(ctx, releaseName, "update values")
+	if err != nil {
+
+		return err
+	}
+	defer unlock()
+
+	files, err := hc.charts().Get(ctx, releaseName)
+	if err != nil {
+
+		return fmt.Errorf("failed to read values file: %w", err)
+	}
 
 	// Read existing values.
-	values, err := chartutil.ReadValuesFile(chartPath)
+	index := slices.IndexFunc(files, func(file *ChartFile) bool { return file.Name == chartutil.ValuesfileName })
+	if index < 0 {
+		index = len(files)
+		files = append(files, &ChartFile{Name: chartutil.ValuesfileName})
+	}
+	existing, err := chartutil.ReadValues(files[index].Data)
 	if err != nil {
 
 		return fmt.Errorf("failed to read values file: %w", err)
 	}
 
 	// Modify values.
-	valuesMap := values.AsMap()
-	valuesMap["replicas"] = replicaCount
+	valuesMap := chartutil.MergeTables(copyValues(values), existing.AsMap())
 
-	// Write back to file
+	// Write back to the store
 	data, err := yaml.Marshal(valuesMap)
 	if err != nil {
 
 		return fmt.Errorf("failed to marshal values: %w", err)
 	}
+	files[index].Data = data
+
+	return hc.charts().Put(ctx, releaseName, files)
+}
+
+// copyValues deep copies the nested maps of values, so merging doesn't change the caller's map.
+func copyValues(values map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(values))
+	for key, value := range values {
+		if nested, ok := value.(map[string]interface{}); ok {
+			value = copyValues(nested)
+		}
+		copied[key] = value
+	}
 
-	return os.WriteFile(chartPath, data, 0644)
+	return copied
 }
@@ -1,9 +1,11 @@
 package helmutils_test
 
 import (
+	"context"
 	"flag"
 	"helm-api/defaults"
 	"helm-api/helmutils"
+	"helm-api/logutils"
 	"helm-api/utils"
 	"os"
 	"path/filepath"
@@ -11,6 +13,10 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 	"gopkg.in/yaml.v2"
 	"helm.sh/helm/v3/pkg/action"
 	"helm.sh/helm/v3/pkg/chart"
@@ -48,6 +54,11 @@ func (m *MockLogger) Fatalf(format string, args ...interface{}) {
 	m.Called(args...)
 }
 
+// WithFields returns the mock itself so calls on derived loggers are recorded too.
+func (m *MockLogger) WithFields(fields logutils.Fields) logutils.Logger {
+	return m
+}
+
 // mock_helm.go
 type MockInstallAction struct {
 	mock.Mock
@@ -119,25 +130,46 @@ func (m *MockUninstallAction) Run(name string) (*release.UninstallReleaseRespons
 	return args.Get(0).(*release.UninstallReleaseResponse), args.Error(1)
 }
 
-type MockFileSystem struct {
+type MockChartStore struct {
 	mock.Mock
 }
 
-func (m *MockFileSystem) DeleteSubfolder(path string) error {
-	args := m.Called(path)
+func (m *MockChartStore) Put(ctx context.Context, name string, files []*helmutils.ChartFile) error {
+	args := m.Called(name, files)
 	return args.Error(0)
 }
 
-func (m *MockFileSystem) ReadValuesFile(path string) (*helmutils.Values, error) {
-	args := m.Called(path)
-	return args.Get(0).(*helmutils.Values), args.Error(1)
+func (m *MockChartStore) Get(ctx context.Context, name string) ([]*helmutils.ChartFile, error) {
+	args := m.Called(name)
+	return args.Get(0).([]*helmutils.ChartFile), args.Error(1)
+}
+
+func (m *MockChartStore) List(ctx context.Context) ([]string, error) {
+	args := m.Called()
+	return args.Get(0).([]string), args.Error(1)
 }
 
-func (m *MockFileSystem) WriteFile(path string, data []byte, perm os.FileMode) error {
-	args := m.Called(path, data, perm)
+func (m *MockChartStore) Delete(ctx context.Context, name string) error {
+	args := m.Called(name)
 	return args.Error(0)
 }
 
+// storeWithChart returns a store holding a minimal chart of that name.
+func storeWithChart(t *testing.T, name string) *helmutils.MemoryChartStore {
+	store := &helmutils.MemoryChartStore{}
+	require.NoError(t, store.Put(context.Background(), name, []*helmutils.ChartFile{
+		{Name: "Chart.yaml", Data: []byte("apiVersion: v2\nname: " + name + "\nversion: 0.1.0\n")},
+		{Name: "values.yaml", Data: []byte("replicas: 1\n")},
+	}))
+
+	return store
+}
+
+// chartNamed matches the chart loaded from the store.
+func chartNamed(name string) interface{} {
+	return mock.MatchedBy(func(c *chart.Chart) bool { return c.Name() == name })
+}
+
 func TestCreateHelmChartFromSource_Success(t *testing.T) {
 	t.Parallel()
 	// Initialize Helm settings
@@ -232,7 +264,7 @@ spec:
 	}
 
 	// Call the function
-	chartPathStr, err := helmClient.CreateHelmChartFromSource(options)
+	chartPathStr, err := helmClient.CreateHelmChartFromSource(context.Background(), options)
 	if err != nil {
 		t.Fatalf("CreateHelmChartFromSource: %v", err)
 	}
@@ -321,7 +353,7 @@ func TestCreateHelmChartFromSource_InvalidSource(t *testing.T) {
 		Description: "A new Helm chart created from source-chart",
 	}
 
-	_, err = helmClient.CreateHelmChartFromSource(options)
+	_, err = helmClient.CreateHelmChartFromSource(context.Background(), options)
 	if err == nil {
 		t.Fatalf("Expected error when source path is invalid, but got none")
 	}
@@ -384,7 +416,7 @@ version: 0.1.0
 		Description: "A new Helm chart created from source-chart",
 	}
 
-	_, err = helmClient.CreateHelmChartFromSource(options)
+	_, err = helmClient.CreateHelmChartFromSource(context.Background(), options)
 	if err == nil {
 		t.Fatalf("Expected error when destination path is invalid, but got none")
 	}
@@ -416,7 +448,7 @@ func TestListReleases(t *testing.T) {
 	}, nil)
 
 	// Test
-	releases, err := client.ListReleases()
+	releases, err := client.ListReleases(context.Background())
 
 	// Assert
 	assert.NoError(t, err)
@@ -431,8 +463,6 @@ func TestInstallRelease(t *testing.T) {
 	mockActioner := &MockHelmActioner{}
 	mockLogger := new(MockLogger)
 	mockList := &MockListAction{}
-	mockChart := &chart.Chart{}
-	mockChartLoader := new(MockChartLoader) // Create instance
 
 	actionConfig := new(action.Configuration)
 
@@ -440,7 +470,7 @@ func TestInstallRelease(t *testing.T) {
 		ActionConfig: actionConfig,
 		Logger:       mockLogger,
 		Actioner:     mockActioner,
-		ChartLoader:  mockChartLoader,
+		Charts:       storeWithChart(t, "test-chart"),
 	}
 
 	// Setup mock expectations
@@ -451,22 +481,47 @@ func TestInstallRelease(t *testing.T) {
 	mockActioner.On("NewList", actionConfig).Return(mockList)
 	mockList.On("Run").Return([]*release.Release{}, nil)
 
-	mockChartLoader.On("Load", "test-chart").Return(mockChart, nil)
-
 	// Mock install
 	mockActioner.On("NewInstall", actionConfig).Return(mockInstall)
-	mockInstall.On("Run", mockChart, mock.Anything).Return(&release.Release{}, nil)
+	mockInstall.On("Run", chartNamed("test-chart"), mock.Anything).Return(&release.Release{}, nil)
 
 	// Test
-	_, err := client.InstallRelease("test-chart", "test-release")
+	_, err := client.InstallRelease(context.Background(), "test-chart", "test-release", nil)
 
 	// Assertions
 	assert.NoError(t, err)
 	mockActioner.AssertExpectations(t)
 	mockInstall.AssertExpectations(t)
 	mockList.AssertExpectations(t)
-	mockChartLoader.AssertExpectations(t)
+}
+
+func TestReleaseErrors(t *testing.T) {
+	mockActioner := &MockHelmActioner{}
+	mockLogger := new(MockLogger)
+	mockList := &MockListAction{}
+
+	client := &helmutils.RealClient{
+		ActionConfig: new(action.Configuration),
+		Logger:       mockLogger,
+		Actioner:     mockActioner,
+	}
 
+	mockLogger.On("Infof", mock.Anything, mock.Anything, mock.Anything).Return()
+	mockActioner.On("NewList", mock.Anything).Return(mockList)
+	mockList.On("Run").Return([]*release.Release{
+		{Name: "test-existing"},
+	}, nil)
+
+	_, err := client.InstallRelease(context.Background(), "test-chart", "existing", nil)
+	assert.ErrorIs(t, err, helmutils.ErrReleaseExists)
+	assert.EqualError(t, err, "release for existing already exist please use update-env endpoint")
+
+	_, err = client.UpgradeRelease(context.Background(), "test-missing")
+	assert.ErrorIs(t, err, helmutils.ErrReleaseNotFound)
+
+	_, err = client.UninstallRelease(context.Background(), "test-missing")
+	assert.ErrorIs(t, err, helmutils.ErrReleaseNotFound)
+	assert.NotErrorIs(t, err, helmutils.ErrReleaseExists)
 }
 
 func TestUpgradeRelease(t *testing.T) {
@@ -475,19 +530,15 @@ func TestUpgradeRelease(t *testing.T) {
 	mockLogger := new(MockLogger)
 	mockList := &MockListAction{}
 	mockUpgrade := &MockUpgradeAction{}
-	mockChartLoader := new(MockChartLoader)
-	mockChart := &chart.Chart{}
+	releaseName := "test-release"
 
 	client := &helmutils.RealClient{
 		ActionConfig: new(action.Configuration),
 		Logger:       mockLogger,
 		Actioner:     mockActioner,
-		ChartLoader:  mockChartLoader,
+		Charts:       storeWithChart(t, releaseName),
 	}
 
-	releaseName := "test-release"
-	chartPath := filepath.Join(client.Default.OutputDir, releaseName)
-
 	// Mock expectations
 	mockLogger.On("Debug", mock.Anything, mock.Anything).Return()
 	mockLogger.On("Infof", mock.Anything, mock.Anything, mock.Anything).Return()
@@ -497,20 +548,17 @@ func TestUpgradeRelease(t *testing.T) {
 		{Name: releaseName},
 	}, nil)
 
-	mockChartLoader.On("Load", chartPath).Return(mockChart, nil)
-
 	mockActioner.On("NewUpgrade", mock.Anything).Return(mockUpgrade)
-	mockUpgrade.On("Run", releaseName, mockChart, mock.Anything).Return(&release.Release{}, nil)
+	mockUpgrade.On("Run", releaseName, chartNamed(releaseName), mock.Anything).Return(&release.Release{}, nil)
 
 	// Test
-	_, err := client.UpgradeRelease(releaseName)
+	_, err := client.UpgradeRelease(context.Background(), releaseName)
 
 	// Assert
 	assert.NoError(t, err)
 	mockActioner.AssertExpectations(t)
 	mockUpgrade.AssertExpectations(t)
 	mockList.AssertExpectations(t)
-	mockChartLoader.AssertExpectations(t)
 }
 
 func TestUninstallRelease(t *testing.T) {
@@ -519,17 +567,16 @@ func TestUninstallRelease(t *testing.T) {
 	mockLogger := new(MockLogger)
 	mockList := &MockListAction{}
 	mockUninstall := &MockUninstallAction{}
-	mockFS := new(MockFileSystem)
+	mockCharts := new(MockChartStore)
 
 	client := &helmutils.RealClient{
 		ActionConfig: new(action.Configuration),
 		Logger:       mockLogger,
 		Actioner:     mockActioner,
-		Filesystem:   mockFS,
+		Charts:       mockCharts,
 	}
 
 	releaseName := "test-release"
-	chartPath := filepath.Join(client.Default.OutputDir, releaseName)
 
 	// Mock expectations
 	mockLogger.On("Debug", mock.Anything, mock.Anything).Return()
@@ -545,17 +592,17 @@ func TestUninstallRelease(t *testing.T) {
 		Release: &release.Release{},
 	}, nil)
 
-	mockFS.On("DeleteSubfolder", chartPath).Return(nil)
+	mockCharts.On("Delete", releaseName).Return(nil)
 
 	// Test
-	_, err := client.UninstallRelease(releaseName)
+	_, err := client.UninstallRelease(context.Background(), releaseName)
 
 	// Assert
 	assert.NoError(t, err)
 	mockActioner.AssertExpectations(t)
 	mockUninstall.AssertExpectations(t)
 	mockList.AssertExpectations(t)
-	mockFS.AssertExpectations(t)
+	mockCharts.AssertExpectations(t)
 }
 
 func TestUpdateValuesFile(t *testing.T) {
@@ -593,7 +640,7 @@ func TestUpdateValuesFile(t *testing.T) {
 	}
 
 	// Run the update
-	err = client.UpdateValuesFile(releaseName, replicaCount)
+	err = client.UpdateValuesFile(context.Background(), releaseName, replicaCount)
 	assert.NoError(t, err)
 
 	// Verify the changes
@@ -653,13 +700,14 @@ func TestNewRealClient(t *testing.T) {
 			wantError: false,
 		},
 		{
+			// The keys are checked at startup by apiutils.KeyStore.Require.
 			name: "missing create API key",
 			envVars: map[string]string{
 				"HELM_API_DELETE_API_KEY": "delete-key",
 				"HELM_API_UPDATE_API_KEY": "update-key",
 			},
 			logger:    &MockLogger{},
-			wantError: true,
+			wantError: false,
 		},
 		{
 			name: "nil logger should use default",
@@ -710,3 +758,138 @@ func TestNewRealClient(t *testing.T) {
 		})
 	}
 }
+
+func TestRenderManifests(t *testing.T) {
+	chartDir := t.TempDir()
+
+	chartYamlContent := `apiVersion: v2
+name: source-chart
+version: 0.1.0`
+	err := os.WriteFile(filepath.Join(chartDir, "Chart.yaml"), []byte(chartYamlContent), 0644)
+	assert.NoError(t, err)
+
+	err = os.WriteFile(filepath.Join(chartDir, "values.yaml"), []byte("replicas: 1\n"), 0644)
+	assert.NoError(t, err)
+
+	err = os.MkdirAll(filepath.Join(chartDir, "templates"), 0755)
+	assert.NoError(t, err)
+
+	statefulSet := `apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: {{ .Release.Name }}
+spec:
+  replicas: {{ .Values.replicas }}
+`
+	err = os.WriteFile(filepath.Join(chartDir, "templates", "statefulset.yaml"), []byte(statefulSet), 0644)
+	assert.NoError(t, err)
+
+	files, err := helmutils.ReadChartDir(chartDir)
+	require.NoError(t, err)
+	store := &helmutils.MemoryChartStore{}
+	require.NoError(t, store.Put(context.Background(), "test-release", files))
+
+	client := &helmutils.RealClient{
+		ChartLoader: &helmutils.RealChartLoader{},
+		Charts:      store,
+		Default: helmutils.Value{
+			Namespace: "default",
+			SourceDir: chartDir,
+		},
+	}
+
+	manifest, err := client.RenderManifests(context.Background(), "test-release", "test-release", map[string]interface{}{"replicas": 3})
+	assert.NoError(t, err)
+	assert.Contains(t, manifest, "name: test-release")
+	assert.Contains(t, manifest, "replicas: 3")
+
+	// The source chart is rendered from SourceDir.
+	manifest, err = client.RenderManifests(context.Background(), helmutils.SourceChart, "test-new", nil)
+	assert.NoError(t, err)
+	assert.Contains(t, manifest, "name: test-new")
+	assert.Contains(t, manifest, "replicas: 1")
+
+	_, err = client.RenderManifests(context.Background(), "test-missing", "test-missing", nil)
+	assert.ErrorIs(t, err, helmutils.ErrChartNotFound)
+}
+
+func TestInstallReleaseSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	mockInstall := &MockInstallAction{}
+	mockActioner := &MockHelmActioner{}
+	mockLogger := new(MockLogger)
+	mockList := &MockListAction{}
+
+	client := &helmutils.RealClient{
+		ActionConfig: new(action.Configuration),
+		Logger:       mockLogger,
+		Actioner:     mockActioner,
+		Charts:       storeWithChart(t, "span-chart"),
+	}
+
+	mockLogger.On("Debug", mock.Anything, mock.Anything).Return()
+	mockLogger.On("Infof", mock.Anything, mock.Anything, mock.Anything).Return()
+	mockActioner.On("NewList", mock.Anything).Return(mockList)
+	mockList.On("Run").Return([]*release.Release{}, nil)
+	mockActioner.On("NewInstall", mock.Anything).Return(mockInstall)
+	mockInstall.On("Run", chartNamed("span-chart"), mock.Anything).Return(&release.Release{}, nil)
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "POST /create-env")
+	_, err := client.InstallRelease(ctx, "span-chart", "span-release", nil)
+	parent.End()
+	assert.NoError(t, err)
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+
+	install := spans["helm.InstallRelease"]
+	if assert.NotNil(t, install) {
+		assert.Equal(t, parent.SpanContext().SpanID(), install.Parent().SpanID())
+	}
+	for _, name := range []string{"helm.ListReleases", "helm.ChartStore.Get"} {
+		if assert.NotNil(t, spans[name], name) {
+			assert.Equal(t, install.SpanContext().SpanID(), spans[name].Parent().SpanID(), name)
+		}
+	}
+}
+
+func TestUpdateValues(t *testing.T) {
+	tmpDir := t.TempDir()
+	releaseName := "test-release"
+
+	releasePath := filepath.Join(tmpDir, releaseName)
+	require.NoError(t, os.MkdirAll(releasePath, 0755))
+
+	valuesFile := filepath.Join(releasePath, "values.yaml")
+	initial := "replicas: 1\nimage:\n  repository: mariadb\n  tag: \"11.4\"\n"
+	require.NoError(t, os.WriteFile(valuesFile, []byte(initial), 0644))
+
+	client := &helmutils.RealClient{
+		Default: helmutils.Value{
+			Namespace: "default",
+			OutputDir: tmpDir,
+		},
+	}
+
+	overrides := map[string]interface{}{
+		"image":     map[string]interface{}{"tag": "11.5"},
+		"resources": map[string]interface{}{"limits": map[string]interface{}{"memory": "1Gi"}},
+	}
+	require.NoError(t, client.UpdateValues(context.Background(), releaseName, overrides))
+
+	updatedBytes, err := os.ReadFile(valuesFile)
+	require.NoError(t, err)
+
+	var updated map[string]interface{}
+	require.NoError(t, yaml.Unmarshal(updatedBytes, &updated))
+
+	assert.Equal(t, 1, updated["replicas"])
+	assert.Equal(t, map[interface{}]interface{}{"repository": "mariadb", "tag": "11.5"}, updated["image"])
+	assert.Equal(t, map[interface{}]interface{}{"limits": map[interface{}]interface{}{"memory": "1Gi"}}, updated["resources"])
+	// The overrides passed in are left untouched.
+	assert.Equal(t, map[string]interface{}{"tag": "11.5"}, overrides["image"])
+}
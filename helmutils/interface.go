@@ -1,21 +1,17 @@
 package helmutils
 
 import (
-	"os"
+	"helm-api/logutils"
+	"time"
 
 	"helm.sh/helm/v3/pkg/action"
 	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
 	"helm.sh/helm/v3/pkg/release"
 )
 
 // Logger is an interface that abstracts the logging mechanism.
-type Logger interface {
-	Info(args ...interface{})
-	Infof(format string, args ...interface{})
-	Error(args ...interface{})
-	Errorf(format string, args ...interface{})
-	Debug(args ...interface{})
-}
+type Logger = logutils.Logger
 
 type InstallAction interface {
 	Run(chart *chart.Chart, values map[string]interface{}) (*release.Release, error)
@@ -37,16 +33,6 @@ type ChartLoader interface {
 	Load(path string) (*chart.Chart, error)
 }
 
-type Values struct {
-	Data map[string]interface{}
-}
-
-type FileSystem interface {
-	DeleteSubfolder(path string) error
-	ReadValuesFile(path string) (*Values, error)
-	WriteFile(path string, data []byte, perm os.FileMode) error
-}
-
 type HelmActioner interface {
 	NewInstall(config *action.Configuration) InstallAction
 	NewList(config *action.Configuration) ListAction
@@ -60,14 +46,31 @@ func (h *RealHelmActioner) NewInstall(config *action.Configuration) InstallActio
 	return action.NewInstall(config)
 }
 
+func (h *RealHelmActioner) NewList(config *action.Configuration) ListAction {
+	return action.NewList(config)
+}
+
+func (h *RealHelmActioner) NewUpgrade(config *action.Configuration) UpgradeAction {
+	return action.NewUpgrade(config)
+}
+
 func (h *RealHelmActioner) NewUninstall(config *action.Configuration) UninstallAction {
 	return action.NewUninstall(config)
 }
 
+// RealChartLoader loads charts from disk using the Helm loader.
+type RealChartLoader struct{}
+
+func (l *RealChartLoader) Load(path string) (*chart.Chart, error) {
+	return loader.Load(path)
+}
+
 type Value struct {
 	Namespace string
 	OutputDir string
 	SourceDir string
+	// LockWait is how long a change waits for another one on the same release.
+	LockWait time.Duration
 }
 
 // RealClient is the real implementation of HelmClient using Helm Go SDK.
@@ -77,7 +80,10 @@ type RealClient struct {
 	Default      Value
 	Actioner     HelmActioner
 	ChartLoader  ChartLoader
-	Filesystem   FileSystem
+	// Charts keeps the chart of each release, in Default.OutputDir when nil.
+	Charts ChartStore
+	// Locks serializes the changes of each release, they aren't serialized when nil.
+	Locks Locker
 }
 
 // Configuration struct to hold settings
@@ -86,4 +92,6 @@ type Config struct {
 	OutputDir  string
 	SourceDir  string
 	HelmDriver string
+	// LockWait is how long a change waits for another one on the same release.
+	LockWait time.Duration
 }
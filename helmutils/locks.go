@@ -0,0 +1,144 @@
+package helmutils
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// LockInfo describes the operation holding the lock of a release.
+type LockInfo struct {
+	Operation string
+	Since     time.Time
+	// Holder is the replica running the operation, empty for the locks of this process.
+	Holder string
+}
+
+// Locker serializes the operations on a release.
+type Locker interface {
+	// Lock acquires the lock of the release for the operation and returns the function
+	// releasing it. It fails with ErrLocked when the lock isn't released in time.
+	Lock(ctx context.Context, releaseName, operation string) (unlock func(), err error)
+	// Holder returns the operation holding the lock of the release, nil when it's free.
+	Holder(ctx context.Context, releaseName string) (*LockInfo, error)
+}
+
+// releaseLock is a held lock, released is closed when it's released.
+type releaseLock struct {
+	info     LockInfo
+	released chan struct{}
+}
+
+// LockManager is a Locker for the operations of this process.
+type LockManager struct {
+	// Wait is how long an operation waits for the lock before failing, zero fails right away.
+	Wait time.Duration
+
+	mu    sync.Mutex
+	locks map[string]*releaseLock
+}
+
+var _ Locker = (*LockManager)(nil)
+
+// Lock waits up to Wait for the lock of the release.
+func (m *LockManager) Lock(ctx context.Context, releaseName, operation string) (func(), error) {
+	deadline := time.NewTimer(m.Wait)
+	defer deadline.Stop()
+
+	for {
+		m.mu.Lock()
+		if m.locks == nil {
+			m.locks = map[string]*releaseLock{}
+		}
+
+		held, exists := m.locks[releaseName]
+		if !exists {
+			lock := &releaseLock{
+				info:     LockInfo{Operation: operation, Since: time.Now().UTC()},
+				released: make(chan struct{}),
+			}
+			m.locks[releaseName] = lock
+			m.mu.Unlock()
+
+			return func() { m.unlock(releaseName, lock) }, nil
+		}
+		m.mu.Unlock()
+
+		select {
+		case <-held.released:
+		case <-deadline.C:
+
+			return nil, LockedError(releaseName, &held.info)
+		case <-ctx.Done():
+
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (m *LockManager) unlock(releaseName string, lock *releaseLock) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.locks[releaseName] == lock {
+		delete(m.locks, releaseName)
+		close(lock.released)
+	}
+}
+
+// Holder returns the operation holding the lock of the release.
+func (m *LockManager) Holder(ctx context.Context, releaseName string) (*LockInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if held, exists := m.locks[releaseName]; exists {
+		info := held.info
+
+		return &info, nil
+	}
+
+	return nil, nil
+}
+
+// LockedError returns the ErrLocked failure of an operation waiting for the holder.
+func LockedError(releaseName string, holder *LockInfo) error {
+	running := holder.Operation
+	if holder.Holder != "" {
+		running += " on " + holder.Holder
+	}
+
+	return fmt.Errorf("%w: %s is running %s since %s", ErrLocked, releaseName, running, holder.Since.Format(time.RFC3339))
+}
+
+type heldLocksKey struct{}
+
+// Lock acquires the lock of the release for the operation, unless ctx already holds it. The
+// returned context holds the lock, so the client methods called with it don't wait for it.
+// Without a Locker, operations aren't serialized.
+func (hc *RealClient) Lock(ctx context.Context, releaseName, operation string) (context.Context, func(), error) {
+	held, _ := ctx.Value(heldLocksKey{}).([]string)
+	if hc.Locks == nil || slices.Contains(held, releaseName) {
+
+		return ctx, func() {}, nil
+	}
+
+	unlock, err := hc.Locks.Lock(ctx, releaseName, operation)
+	if err != nil {
+
+		return ctx, nil, err
+	}
+
+	return context.WithValue(ctx, heldLocksKey{}, append(slices.Clip(held), releaseName)), unlock, nil
+}
+
+// LockHolder returns the operation holding the lock of the release, nil when it's free.
+func (hc *RealClient) LockHolder(ctx context.Context, releaseName string) (*LockInfo, error) {
+	if hc.Locks == nil {
+
+		return nil, nil
+	}
+
+	return hc.Locks.Holder(ctx, releaseName)
+}
@@ -0,0 +1,142 @@
+package helmutils_test
+
+import (
+	"context"
+	"fmt"
+	"helm-api/helmutils"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestLockManager(t *testing.T) {
+	locks := &helmutils.LockManager{}
+	ctx := context.Background()
+
+	holder, err := locks.Holder(ctx, "test-demo")
+	require.NoError(t, err)
+	assert.Nil(t, holder)
+
+	unlock, err := locks.Lock(ctx, "test-demo", "upgrade")
+	require.NoError(t, err)
+
+	holder, err = locks.Holder(ctx, "test-demo")
+	require.NoError(t, err)
+	require.NotNil(t, holder)
+	assert.Equal(t, "upgrade", holder.Operation)
+	assert.WithinDuration(t, time.Now(), holder.Since, time.Minute)
+
+	// Without a wait, concurrent operations are rejected right away.
+	_, err = locks.Lock(ctx, "test-demo", "uninstall")
+	assert.ErrorIs(t, err, helmutils.ErrLocked)
+	assert.Contains(t, err.Error(), "test-demo is running upgrade")
+
+	// Other releases aren't affected.
+	unlockOther, err := locks.Lock(ctx, "test-other", "install")
+	require.NoError(t, err)
+	unlockOther()
+
+	unlock()
+	// Releasing twice is harmless.
+	unlock()
+
+	holder, err = locks.Holder(ctx, "test-demo")
+	require.NoError(t, err)
+	assert.Nil(t, holder)
+
+	unlock, err = locks.Lock(ctx, "test-demo", "uninstall")
+	require.NoError(t, err)
+	unlock()
+}
+
+func TestLockManagerQueues(t *testing.T) {
+	locks := &helmutils.LockManager{Wait: time.Second}
+	ctx := context.Background()
+
+	unlock, err := locks.Lock(ctx, "test-demo", "upgrade")
+	require.NoError(t, err)
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		unlock()
+	}()
+
+	start := time.Now()
+	unlockNext, err := locks.Lock(ctx, "test-demo", "uninstall")
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+	unlockNext()
+}
+
+func TestLockManagerCancel(t *testing.T) {
+	locks := &helmutils.LockManager{Wait: time.Minute}
+
+	unlock, err := locks.Lock(context.Background(), "test-demo", "upgrade")
+	require.NoError(t, err)
+	defer unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = locks.Lock(ctx, "test-demo", "uninstall")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestClientLockIsReentrant(t *testing.T) {
+	client := &helmutils.RealClient{Locks: &helmutils.LockManager{}}
+
+	ctx, unlock, err := client.Lock(context.Background(), "test-demo", "update")
+	require.NoError(t, err)
+
+	// The context holding the lock gets it again, others don't.
+	_, unlockAgain, err := client.Lock(ctx, "test-demo", "update values")
+	require.NoError(t, err)
+	unlockAgain()
+
+	_, _, err = client.Lock(context.Background(), "test-demo", "uninstall")
+	assert.ErrorIs(t, err, helmutils.ErrLocked)
+
+	holder, err := client.LockHolder(ctx, "test-demo")
+	require.NoError(t, err)
+	assert.Equal(t, "update", holder.Operation, "the inner release doesn't free the lock")
+
+	unlock()
+	holder, err = client.LockHolder(ctx, "test-demo")
+	require.NoError(t, err)
+	assert.Nil(t, holder)
+}
+
+func TestUpdateValuesConcurrently(t *testing.T) {
+	tmpDir := t.TempDir()
+	releaseName := "test-release"
+	require.NoError(t, os.MkdirAll(filepath.Join(tmpDir, releaseName), 0755))
+	valuesFile := filepath.Join(tmpDir, releaseName, "values.yaml")
+	require.NoError(t, os.WriteFile(valuesFile, []byte("replicas: 1\n"), 0644))
+
+	client := &helmutils.RealClient{
+		Default: helmutils.Value{OutputDir: tmpDir},
+		Locks:   &helmutils.LockManager{Wait: 10 * time.Second},
+	}
+
+	// Every read-modify-write runs alone, so no update is lost.
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, client.UpdateValues(context.Background(), releaseName, map[string]interface{}{fmt.Sprintf("key%d", i): i}))
+		}()
+	}
+	wg.Wait()
+
+	data, err := os.ReadFile(valuesFile)
+	require.NoError(t, err)
+	var values map[string]interface{}
+	require.NoError(t, yaml.Unmarshal(data, &values))
+	assert.Len(t, values, 21)
+}
@@ -1,8 +1,10 @@
 package helmutils
 
 import (
-	"os"
-	"time"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"helm-api/logutils"
 
 	"github.com/sirupsen/logrus"
 )
@@ -13,23 +15,35 @@ func setupLogger(logger Logger) Logger {
 		return logger
 	}
 
+	// Levels are applied per subsystem by logutils.Levels, so let everything through here.
 	defaultLogger := logrus.New()
-	defaultLogger.SetLevel(logrus.InfoLevel)
+	defaultLogger.SetLevel(logrus.DebugLevel)
 	defaultLogger.SetFormatter(&logrus.TextFormatter{
 		FullTimestamp: true,
 	})
 
-	// Start log level monitoring
-	go monitorLogLevel(defaultLogger)
+	return logutils.NewLogrus(defaultLogger)
+}
+
+// logger returns the request-scoped logger of ctx, tagged with the Helm operation it runs.
+func (hc *RealClient) logger(ctx context.Context, operation, releaseName string) Logger {
+	fields := logutils.Fields{
+		"operation":    operation,
+		"operation_id": newOperationID(),
+	}
+	if releaseName != "" {
+		fields["release"] = releaseName
+	}
 
-	return defaultLogger
+	return logutils.ForSubsystem(logutils.FromContext(ctx, hc.Logger), logutils.SubsystemHelm).WithFields(fields)
 }
 
-func monitorLogLevel(logger *logrus.Logger) {
-	for {
-		if level, err := logrus.ParseLevel(os.Getenv("HELM_API_LOG_LEVEL")); err == nil {
-			logger.SetLevel(level)
-		}
-		time.Sleep(time.Second * 30)
+func newOperationID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+
+		return ""
 	}
+
+	return hex.EncodeToString(id)
 }
@@ -0,0 +1,219 @@
+package helmutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	sigyaml "sigs.k8s.io/yaml"
+)
+
+// ReleaseChartStore rebuilds the chart of a release from its latest revision in the Helm release
+// storage, which already keeps the chart and values of every revision, so no copy of the chart is
+// kept. A chart put before an install or upgrade is kept in memory until the release moves to
+// another revision. Subcharts aren't kept by Helm, so charts with dependencies are rejected.
+type ReleaseChartStore struct {
+	ActionConfig *action.Configuration
+
+	mu      sync.Mutex
+	pending map[string]pendingChart
+}
+
+var _ ChartStore = (*ReleaseChartStore)(nil)
+
+// pendingChart is a chart put on top of the release revision, 0 when the release doesn't exist.
+type pendingChart struct {
+	revision int
+	files    []*ChartFile
+}
+
+// Put keeps the chart for the next install or upgrade of the release. Charts with dependencies
+// fail with ErrInvalid.
+func (s *ReleaseChartStore) Put(ctx context.Context, name string, files []*ChartFile) error {
+	if err := noDependencies(files); err != nil {
+
+		return fmt.Errorf("%w: chart of %s can't be kept in its release: %w", ErrInvalid, name, err)
+	}
+
+	rel, err := s.latest(name)
+	if err != nil {
+
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.pending == nil {
+		s.pending = map[string]pendingChart{}
+	}
+	s.pending[name] = pendingChart{revision: revision(rel), files: copyChartFiles(files)}
+
+	return nil
+}
+
+// Get returns the chart put since the latest revision, or the chart of the latest revision with
+// its values.
+func (s *ReleaseChartStore) Get(ctx context.Context, name string) ([]*ChartFile, error) {
+	rel, err := s.latest(name)
+	if err != nil {
+
+		return nil, err
+	}
+
+	s.mu.Lock()
+	chart, exists := s.pending[name]
+	if exists && chart.revision != revision(rel) {
+		// The release was installed or upgraded since.
+		delete(s.pending, name)
+		exists = false
+	}
+	s.mu.Unlock()
+
+	if exists {
+
+		return copyChartFiles(chart.files), nil
+	}
+	if rel == nil || rel.Chart == nil {
+
+		return nil, fmt.Errorf("%w: %s", ErrChartNotFound, name)
+	}
+
+	return releaseChartFiles(rel)
+}
+
+// List returns the releases and the charts waiting for their install.
+func (s *ReleaseChartStore) List(ctx context.Context) ([]string, error) {
+	listClient := action.NewList(s.ActionConfig)
+	listClient.All = true
+	listClient.SetStateMask()
+
+	releases, err := listClient.Run()
+	if err != nil {
+
+		return nil, fmt.Errorf("failed to list charts: %w", err)
+	}
+
+	names := []string{}
+	for _, rel := range releases {
+		names = append(names, rel.Name)
+	}
+
+	s.mu.Lock()
+	for name := range s.pending {
+		names = append(names, name)
+	}
+	s.mu.Unlock()
+
+	slices.Sort(names)
+
+	return slices.Compact(names), nil
+}
+
+// Delete drops the chart waiting for the release, the chart of the release goes with its
+// uninstall.
+func (s *ReleaseChartStore) Delete(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.pending, name)
+
+	return nil
+}
+
+// latest returns the latest revision of the release, nil when it doesn't exist.
+func (s *ReleaseChartStore) latest(name string) (*release.Release, error) {
+	rel, err := action.NewGet(s.ActionConfig).Run(name)
+	if errors.Is(err, driver.ErrReleaseNotFound) || (err != nil && strings.Contains(err.Error(), "no revision for release")) {
+
+		return nil, nil
+	}
+	if err != nil {
+
+		return nil, classify(fmt.Errorf("failed to get release %s: %w", name, err))
+	}
+
+	return rel, nil
+}
+
+// noDependencies fails when the chart vendors subcharts or declares dependencies in Chart.yaml.
+func noDependencies(files []*ChartFile) error {
+	for _, file := range files {
+		if strings.HasPrefix(file.Name, "charts/") {
+
+			return fmt.Errorf("subchart %s isn't supported", file.Name)
+		}
+		if file.Name != chartutil.ChartfileName {
+			continue
+		}
+
+		var metadata chart.Metadata
+		if err := sigyaml.Unmarshal(file.Data, &metadata); err != nil {
+
+			return fmt.Errorf("failed to read %s: %w", file.Name, err)
+		}
+		if len(metadata.Dependencies) > 0 {
+
+			return fmt.Errorf("dependency %s isn't supported", metadata.Dependencies[0].Name)
+		}
+	}
+
+	return nil
+}
+
+func revision(rel *release.Release) int {
+	if rel == nil {
+
+		return 0
+	}
+
+	return rel.Version
+}
+
+// releaseChartFiles returns the files of the release chart, with the values of the release
+// merged into values.yaml.
+func releaseChartFiles(rel *release.Release) ([]*ChartFile, error) {
+	metadata, err := sigyaml.Marshal(rel.Chart.Metadata)
+	if err != nil {
+
+		return nil, fmt.Errorf("failed to write Chart.yaml of %s: %w", rel.Name, err)
+	}
+
+	values, err := yaml.Marshal(chartutil.MergeTables(copyValues(rel.Config), rel.Chart.Values))
+	if err != nil {
+
+		return nil, fmt.Errorf("failed to marshal values: %w", err)
+	}
+
+	files := []*ChartFile{
+		{Name: chartutil.ChartfileName, Data: metadata},
+		{Name: chartutil.ValuesfileName, Data: values},
+	}
+
+	if rel.Chart.Lock != nil {
+		lock, err := sigyaml.Marshal(rel.Chart.Lock)
+		if err != nil {
+
+			return nil, fmt.Errorf("failed to write Chart.lock of %s: %w", rel.Name, err)
+		}
+		files = append(files, &ChartFile{Name: "Chart.lock", Data: lock})
+	}
+	if len(rel.Chart.Schema) > 0 {
+		files = append(files, &ChartFile{Name: chartutil.SchemafileName, Data: slices.Clone(rel.Chart.Schema)})
+	}
+
+	for _, file := range append(slices.Clone(rel.Chart.Templates), rel.Chart.Files...) {
+		files = append(files, &ChartFile{Name: file.Name, Data: slices.Clone(file.Data)})
+	}
+
+	return files, nil
+}
@@ -0,0 +1,109 @@
+package helmutils_test
+
+import (
+	"context"
+	"helm-api/defaults"
+	"helm-api/helmutils"
+	"helm-api/logutils"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	kubefake "helm.sh/helm/v3/pkg/kube/fake"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+)
+
+func TestReleaseChartStore(t *testing.T) {
+	base := logrus.New()
+	base.SetOutput(io.Discard)
+
+	actionConfig := &action.Configuration{
+		Releases:     storage.Init(driver.NewMemory()),
+		KubeClient:   &kubefake.PrintingKubeClient{Out: io.Discard},
+		Capabilities: chartutil.DefaultCapabilities,
+		Log:          func(format string, v ...interface{}) {},
+	}
+	store := &helmutils.ReleaseChartStore{ActionConfig: actionConfig}
+	hc := &helmutils.RealClient{
+		ActionConfig: actionConfig,
+		Logger:       logutils.NewLogrus(base),
+		Actioner:     &helmutils.RealHelmActioner{},
+		ChartLoader:  &helmutils.RealChartLoader{},
+		Charts:       store,
+		Default: helmutils.Value{
+			Namespace: defaults.NameSpace,
+			SourceDir: filepath.Join("..", defaults.SourceDir),
+		},
+	}
+	ctx := context.Background()
+
+	_, err := store.Get(ctx, "test-demo")
+	assert.ErrorIs(t, err, helmutils.ErrChartNotFound)
+
+	// The created chart waits in memory for the install.
+	chartName, err := hc.CreateHelmChartFromSource(ctx, chart.Metadata{APIVersion: chart.APIVersionV2, Name: "demo", Version: "0.1.0"})
+	require.NoError(t, err)
+	names, err := store.List(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"test-demo"}, names)
+
+	_, err = hc.InstallRelease(ctx, chartName, "demo", nil)
+	require.NoError(t, err)
+
+	// After the install, the chart comes back from the release.
+	files, err := store.Get(ctx, "test-demo")
+	require.NoError(t, err)
+	loaded, err := loader.LoadFiles(files)
+	require.NoError(t, err)
+	assert.Equal(t, "test-demo", loaded.Name())
+	assert.NotEmpty(t, loaded.Templates)
+
+	// Updated values wait for the upgrade, then are kept by the new revision.
+	require.NoError(t, hc.UpdateValues(ctx, "test-demo", map[string]interface{}{"replicas": 0}))
+	rel, err := hc.UpgradeRelease(ctx, "test-demo")
+	require.NoError(t, err)
+	assert.Equal(t, 2, rel.Version)
+
+	files, err = store.Get(ctx, "test-demo")
+	require.NoError(t, err)
+	loaded, err = loader.LoadFiles(files)
+	require.NoError(t, err)
+	assert.EqualValues(t, 0, loaded.Values["replicas"])
+
+	// A chart put for a revision that's no longer the latest, upgraded by another replica, is
+	// dropped.
+	require.NoError(t, store.Put(ctx, "test-demo", files[:2]))
+	replica := *hc
+	replica.Charts = &helmutils.ReleaseChartStore{ActionConfig: actionConfig}
+	rel, err = replica.UpgradeRelease(ctx, "test-demo")
+	require.NoError(t, err)
+	assert.Equal(t, 3, rel.Version)
+	files, err = store.Get(ctx, "test-demo")
+	require.NoError(t, err)
+	assert.Greater(t, len(files), 2)
+
+	// Subcharts and dependencies aren't kept by Helm, so charts with any are rejected.
+	err = store.Put(ctx, "test-demo", append(files, &helmutils.ChartFile{Name: "charts/mariadb/Chart.yaml", Data: []byte("name: mariadb")}))
+	assert.ErrorIs(t, err, helmutils.ErrInvalid)
+	assert.ErrorContains(t, err, "charts/mariadb/Chart.yaml")
+	err = store.Put(ctx, "test-demo", []*helmutils.ChartFile{{
+		Name: chartutil.ChartfileName,
+		Data: []byte("apiVersion: v2\nname: test-demo\nversion: 0.1.0\ndependencies:\n- name: mariadb\n  version: 1.0.0\n"),
+	}})
+	assert.ErrorIs(t, err, helmutils.ErrInvalid)
+	assert.ErrorContains(t, err, "dependency mariadb")
+
+	_, err = hc.UninstallRelease(ctx, "test-demo")
+	require.NoError(t, err)
+	has, err := hc.HasChart(ctx, "test-demo")
+	require.NoError(t, err)
+	assert.False(t, has)
+}
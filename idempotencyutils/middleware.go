@@ -0,0 +1,137 @@
+package idempotencyutils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"helm-api/problemutils"
+	"io"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// Header carries the key a client picks for a request it may retry.
+const Header = "Idempotency-Key"
+
+// ReplayedHeader is set on responses answered from an earlier request with the same key.
+const ReplayedHeader = "Idempotent-Replayed"
+
+// MaxKeyLength is the longest key accepted.
+const MaxKeyLength = 255
+
+// MaxBodySize is the largest body, in bytes, of the requests sent with a key.
+const MaxBodySize = 1 << 20
+
+// replayedHeaders are the response headers kept with the response.
+var replayedHeaders = []string{"Content-Type", "Location"}
+
+// ScopeFunc returns the owner of the keys of a request, so clients can't replay each other's responses.
+type ScopeFunc func(r *http.Request) string
+
+// Middleware answers requests sent again with the same Idempotency-Key header with the response
+// of the first one, waiting for it while it is in flight. Requests without the header are
+// passed through.
+func Middleware(store *Store, scope ScopeFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(Header)
+			if key == "" {
+				next.ServeHTTP(w, r)
+
+				return
+			}
+
+			if len(key) > MaxKeyLength {
+				problemutils.Write(w, r, problemutils.New(problemutils.CodeValidationFailed, "Invalid "+Header+" header", fmt.Errorf("the key is longer than %d characters", MaxKeyLength)))
+
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxBodySize))
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				problemutils.Write(w, r, problemutils.New(problemutils.CodeValidationFailed, "Request body too large", fmt.Errorf("the body is larger than %d bytes", MaxBodySize)))
+
+				return
+			}
+			if err != nil {
+				problemutils.Write(w, r, problemutils.New(problemutils.CodeValidationFailed, "Failed to read request body", err))
+
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			scopedKey := scope(r) + "/" + key
+			e, owner, err := store.begin(scopedKey, requestHash(r, body))
+			if err != nil {
+				problemutils.Write(w, r, problemutils.New(problemutils.CodeIdempotencyKeyMismatch, "Idempotency key reused", err))
+
+				return
+			}
+
+			if !owner {
+				select {
+				case <-e.done:
+					replay(w, e.response)
+				case <-r.Context().Done():
+					problemutils.Write(w, r, problemutils.New(problemutils.CodeTimeout, "Request cancelled", fmt.Errorf("the first request with this idempotency key is still running: %w", r.Context().Err())))
+				}
+
+				return
+			}
+
+			// The failure is kept when the handler panics, so waiting requests still get an answer.
+			response := failure(r)
+			defer func() { store.finish(scopedKey, e, response) }()
+
+			var buf bytes.Buffer
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			ww.Tee(&buf)
+			next.ServeHTTP(ww, r)
+
+			response = &Response{Status: ww.Status(), Header: http.Header{}, Body: buf.Bytes()}
+			if response.Status == 0 {
+				response.Status = http.StatusOK
+			}
+			for _, name := range replayedHeaders {
+				if value := ww.Header().Get(name); value != "" {
+					response.Header.Set(name, value)
+				}
+			}
+		})
+	}
+}
+
+// requestHash identifies the method, path and body of a request.
+func requestHash(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s %s\n", r.Method, r.URL.Path)
+	hash.Write(body)
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func replay(w http.ResponseWriter, response *Response) {
+	for name, values := range response.Header {
+		w.Header()[name] = values
+	}
+	w.Header().Set(ReplayedHeader, "true")
+	w.WriteHeader(response.Status)
+	_, _ = w.Write(response.Body)
+}
+
+func failure(r *http.Request) *Response {
+	problem := problemutils.New(problemutils.CodeInternal, "Request failed", errors.New("the first request with this idempotency key failed"))
+	problem.Instance = r.URL.Path
+	body, _ := json.Marshal(problem)
+
+	return &Response{
+		Status: problem.Status,
+		Header: http.Header{"Content-Type": {problemutils.ContentType}},
+		Body:   body,
+	}
+}
@@ -0,0 +1,270 @@
+package idempotencyutils_test
+
+import (
+	"context"
+	"encoding/json"
+	"helm-api/idempotencyutils"
+	"helm-api/problemutils"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingHandler answers with the status or problem of the call it is on and counts its calls.
+type countingHandler struct {
+	calls    atomic.Int32
+	statuses []int
+	problems []problemutils.Code
+	release  chan struct{}
+}
+
+func (h *countingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	call := int(h.calls.Add(1))
+	if h.release != nil {
+		<-h.release
+	}
+
+	if call <= len(h.problems) {
+		problemutils.Write(w, r, problemutils.New(h.problems[call-1], "Request failed", nil))
+
+		return
+	}
+
+	status := http.StatusCreated
+	if call <= len(h.statuses) {
+		status = h.statuses[call-1]
+	}
+	w.Header().Set("Location", "/v1/envs/demo")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]int{"call": call})
+}
+
+func scopeFromHeader(r *http.Request) string {
+	return r.Header.Get("X-Scope")
+}
+
+func send(handler http.Handler, key, scope, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/v1/envs", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(idempotencyutils.Header, key)
+	}
+	req.Header.Set("X-Scope", scope)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+
+	return recorder
+}
+
+func TestMiddlewareReplays(t *testing.T) {
+	next := &countingHandler{}
+	handler := idempotencyutils.Middleware(idempotencyutils.NewStore(time.Hour), scopeFromHeader)(next)
+
+	first := send(handler, "key-1", "qa", `{"name": "demo"}`)
+	assert.Equal(t, http.StatusCreated, first.Code)
+	assert.Empty(t, first.Header().Get(idempotencyutils.ReplayedHeader))
+
+	second := send(handler, "key-1", "qa", `{"name": "demo"}`)
+	assert.Equal(t, http.StatusCreated, second.Code)
+	assert.Equal(t, "true", second.Header().Get(idempotencyutils.ReplayedHeader))
+	assert.Equal(t, "/v1/envs/demo", second.Header().Get("Location"))
+	assert.Equal(t, first.Body.String(), second.Body.String())
+	assert.Equal(t, int32(1), next.calls.Load())
+
+	// Other keys, other scopes and requests without a key run again.
+	send(handler, "key-2", "qa", `{"name": "demo"}`)
+	send(handler, "key-1", "dev", `{"name": "demo"}`)
+	send(handler, "", "qa", `{"name": "demo"}`)
+	send(handler, "", "qa", `{"name": "demo"}`)
+	assert.Equal(t, int32(5), next.calls.Load())
+}
+
+func TestMiddlewareMismatch(t *testing.T) {
+	next := &countingHandler{}
+	handler := idempotencyutils.Middleware(idempotencyutils.NewStore(time.Hour), scopeFromHeader)(next)
+
+	send(handler, "key-1", "qa", `{"name": "demo"}`)
+	resp := send(handler, "key-1", "qa", `{"name": "other"}`)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.Code)
+	assert.Equal(t, problemutils.ContentType, resp.Header().Get("Content-Type"))
+	var problem problemutils.Problem
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&problem))
+	assert.Equal(t, problemutils.CodeIdempotencyKeyMismatch, problem.Code)
+	assert.Equal(t, int32(1), next.calls.Load())
+}
+
+func TestMiddlewareInvalidKey(t *testing.T) {
+	next := &countingHandler{}
+	handler := idempotencyutils.Middleware(idempotencyutils.NewStore(time.Hour), scopeFromHeader)(next)
+
+	resp := send(handler, strings.Repeat("k", idempotencyutils.MaxKeyLength+1), "qa", `{}`)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Zero(t, next.calls.Load())
+}
+
+func TestMiddlewareRetriesServerFailures(t *testing.T) {
+	next := &countingHandler{statuses: []int{http.StatusServiceUnavailable}}
+	handler := idempotencyutils.Middleware(idempotencyutils.NewStore(time.Hour), scopeFromHeader)(next)
+
+	assert.Equal(t, http.StatusServiceUnavailable, send(handler, "key-1", "qa", `{}`).Code)
+	assert.Equal(t, http.StatusCreated, send(handler, "key-1", "qa", `{}`).Code)
+	assert.Equal(t, http.StatusCreated, send(handler, "key-1", "qa", `{}`).Code)
+	assert.Equal(t, int32(2), next.calls.Load())
+}
+
+func TestMiddlewareClientErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		problem   problemutils.Code
+		wantCalls int32
+	}{
+		{"invalid", problemutils.CodeValidationFailed, 1},
+		{"exists", problemutils.CodeEnvAlreadyExists, 1},
+		{"quota", problemutils.CodeQuotaExceeded, 1},
+		{"locked", problemutils.CodeEnvLocked, 2},
+		{"not found", problemutils.CodeEnvNotFound, 2},
+		{"unauthorized", problemutils.CodeUnauthorized, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := &countingHandler{problems: []problemutils.Code{tt.problem}}
+			handler := idempotencyutils.Middleware(idempotencyutils.NewStore(time.Hour), scopeFromHeader)(next)
+
+			assert.Equal(t, tt.problem.Status(), send(handler, "key-1", "qa", `{}`).Code)
+			send(handler, "key-1", "qa", `{}`)
+			assert.Equal(t, tt.wantCalls, next.calls.Load())
+		})
+	}
+}
+
+func TestMiddlewareRetriesAfterConflict(t *testing.T) {
+	next := &countingHandler{problems: []problemutils.Code{problemutils.CodeEnvLocked}}
+	handler := idempotencyutils.Middleware(idempotencyutils.NewStore(time.Hour), scopeFromHeader)(next)
+
+	locked := send(handler, "key-1", "qa", `{}`)
+	assert.Equal(t, http.StatusConflict, locked.Code)
+	var problem problemutils.Problem
+	require.NoError(t, json.NewDecoder(locked.Body).Decode(&problem))
+	assert.Equal(t, problemutils.CodeEnvLocked, problem.Code)
+
+	// Once the other change is done, the retry runs and its success is kept.
+	retry := send(handler, "key-1", "qa", `{}`)
+	assert.Equal(t, http.StatusCreated, retry.Code)
+	assert.Empty(t, retry.Header().Get(idempotencyutils.ReplayedHeader))
+
+	replayed := send(handler, "key-1", "qa", `{}`)
+	assert.Equal(t, http.StatusCreated, replayed.Code)
+	assert.Equal(t, "true", replayed.Header().Get(idempotencyutils.ReplayedHeader))
+	assert.Equal(t, int32(2), next.calls.Load())
+}
+
+func TestMiddlewareRetriesThrottled(t *testing.T) {
+	next := &countingHandler{statuses: []int{http.StatusTooManyRequests}}
+	handler := idempotencyutils.Middleware(idempotencyutils.NewStore(time.Hour), scopeFromHeader)(next)
+
+	assert.Equal(t, http.StatusTooManyRequests, send(handler, "key-1", "qa", `{}`).Code)
+	assert.Equal(t, http.StatusCreated, send(handler, "key-1", "qa", `{}`).Code)
+	assert.Equal(t, int32(2), next.calls.Load())
+}
+
+func TestMiddlewareExpires(t *testing.T) {
+	next := &countingHandler{}
+	handler := idempotencyutils.Middleware(idempotencyutils.NewStore(time.Millisecond), scopeFromHeader)(next)
+
+	send(handler, "key-1", "qa", `{}`)
+	time.Sleep(5 * time.Millisecond)
+	resp := send(handler, "key-1", "qa", `{}`)
+
+	assert.Empty(t, resp.Header().Get(idempotencyutils.ReplayedHeader))
+	assert.Equal(t, int32(2), next.calls.Load())
+}
+
+func TestMiddlewareWaitsForInFlight(t *testing.T) {
+	next := &countingHandler{release: make(chan struct{})}
+	handler := idempotencyutils.Middleware(idempotencyutils.NewStore(time.Hour), scopeFromHeader)(next)
+
+	responses := make([]*httptest.ResponseRecorder, 3)
+	var wg sync.WaitGroup
+	for i := range responses {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			responses[i] = send(handler, "key-1", "qa", `{"name": "demo"}`)
+		}()
+	}
+
+	// Let the requests reach the store before the first one completes.
+	require.Eventually(t, func() bool { return next.calls.Load() == 1 }, time.Second, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	close(next.release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), next.calls.Load())
+	replayed := 0
+	for _, resp := range responses {
+		assert.Equal(t, http.StatusCreated, resp.Code)
+		assert.JSONEq(t, `{"call": 1}`, resp.Body.String())
+		if resp.Header().Get(idempotencyutils.ReplayedHeader) == "true" {
+			replayed++
+		}
+	}
+	assert.Equal(t, 2, replayed)
+}
+
+func TestMiddlewarePanic(t *testing.T) {
+	handler := idempotencyutils.Middleware(idempotencyutils.NewStore(time.Hour), scopeFromHeader)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	assert.Panics(t, func() { send(handler, "key-1", "qa", `{}`) })
+
+	// The failure isn't kept, the retry runs the handler again.
+	assert.Panics(t, func() { send(handler, "key-1", "qa", `{}`) })
+}
+
+func TestMiddlewareBodyTooLarge(t *testing.T) {
+	next := &countingHandler{}
+	handler := idempotencyutils.Middleware(idempotencyutils.NewStore(time.Hour), scopeFromHeader)(next)
+
+	resp := send(handler, "key-1", "qa", strings.Repeat("x", idempotencyutils.MaxBodySize+1))
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Zero(t, next.calls.Load())
+}
+
+func TestMiddlewareWaiterCancelled(t *testing.T) {
+	next := &countingHandler{release: make(chan struct{})}
+	handler := idempotencyutils.Middleware(idempotencyutils.NewStore(time.Hour), scopeFromHeader)(next)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		send(handler, "key-1", "qa", `{}`)
+	}()
+	require.Eventually(t, func() bool { return next.calls.Load() == 1 }, time.Second, time.Millisecond)
+
+	// The retry gives up while the first request is still running.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodPost, "/v1/envs", strings.NewReader(`{}`)).WithContext(ctx)
+	req.Header.Set(idempotencyutils.Header, "key-1")
+	req.Header.Set("X-Scope", "qa")
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusGatewayTimeout, resp.Code)
+	var problem problemutils.Problem
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&problem))
+	assert.Equal(t, problemutils.CodeTimeout, problem.Code)
+
+	close(next.release)
+	<-done
+}
@@ -0,0 +1,129 @@
+package idempotencyutils
+
+import (
+	"encoding/json"
+	"errors"
+	"helm-api/problemutils"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrKeyMismatch is returned when a key is sent again with a different request.
+var ErrKeyMismatch = errors.New("the idempotency key was already used with a different request")
+
+// sweepInterval is how often the expired responses of keys that aren't sent again are dropped.
+const sweepInterval = time.Minute
+
+// keptCodes are the client errors a retry would get again, so they are replayed like successes.
+var keptCodes = map[problemutils.Code]bool{
+	problemutils.CodeValidationFailed: true,
+	problemutils.CodeEnvAlreadyExists: true,
+	problemutils.CodeQuotaExceeded:    true,
+}
+
+// Response is the recorded response of a request.
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// entry is the state of one key. Done is closed once response is set.
+type entry struct {
+	hash     string
+	done     chan struct{}
+	response *Response
+	expires  time.Time
+}
+
+// Store keeps the responses of the requests sent with an idempotency key until they expire.
+// The responses are kept in memory, so each replica only replays the requests it served: with
+// several replicas, retries must reach the same one, e.g. through session affinity.
+type Store struct {
+	ttl       time.Duration
+	mu        sync.Mutex
+	entries   map[string]*entry
+	nextSweep time.Time
+}
+
+// NewStore returns a store keeping the responses for ttl.
+func NewStore(ttl time.Duration) *Store {
+	return &Store{
+		ttl:     ttl,
+		entries: map[string]*entry{},
+	}
+}
+
+// begin returns the entry of the key, creating it when the key is new or its response expired,
+// in which case the caller runs the request and must finish the entry. Known keys sent with
+// another request hash fail with ErrKeyMismatch.
+func (s *Store) begin(key, hash string) (*entry, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.After(s.nextSweep) {
+		for k, e := range s.entries {
+			if e.expired(now) {
+				delete(s.entries, k)
+			}
+		}
+		s.nextSweep = now.Add(sweepInterval)
+	}
+
+	if e, exists := s.entries[key]; exists && !e.expired(now) {
+		if e.hash != hash {
+
+			return nil, false, ErrKeyMismatch
+		}
+
+		return e, false, nil
+	}
+
+	e := &entry{hash: hash, done: make(chan struct{})}
+	s.entries[key] = e
+
+	return e, true, nil
+}
+
+// finish records the response of the entry and releases the requests waiting for it. Responses
+// a retry could change, like server failures, throttling or a conflict with a running change, are
+// handed to those requests but not kept, so a later retry runs again.
+func (s *Store) finish(key string, e *entry, response *Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e.response = response
+	e.expires = time.Now().Add(s.ttl)
+	close(e.done)
+
+	if !kept(response) {
+		delete(s.entries, key)
+	}
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return e.response != nil && now.After(e.expires)
+}
+
+// kept reports whether a response is replayed to the retries: successes and the client errors
+// whose problem code is in keptCodes.
+func kept(response *Response) bool {
+	if response.Status >= http.StatusOK && response.Status < http.StatusMultipleChoices {
+
+		return true
+	}
+	if response.Status < http.StatusBadRequest || response.Status >= http.StatusInternalServerError {
+
+		return false
+	}
+
+	var problem problemutils.Problem
+	if err := json.Unmarshal(response.Body, &problem); err != nil {
+
+		return false
+	}
+
+	return keptCodes[problem.Code]
+}
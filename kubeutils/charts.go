@@ -0,0 +1,148 @@
+package kubeutils
+
+import (
+	"context"
+	"fmt"
+	"helm-api/helmutils"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// ChartLabel is set on the objects holding a chart to the name of the chart.
+	ChartLabel = "helm-api/chart"
+	// ChartPrefix starts the name of the objects holding a chart.
+	ChartPrefix = "helm-api-chart-"
+	// ChartKey is the key of the packed chart in the objects holding it.
+	ChartKey = "chart.tgz"
+)
+
+// ObjectChartStore keeps each chart packed in a ConfigMap, or a Secret when Secrets is set, so
+// every replica reads the same charts without a shared volume. A packed chart must fit the
+// 1MiB limit of an object.
+type ObjectChartStore struct {
+	Client    kubernetes.Interface
+	Namespace string
+	Secrets   bool
+}
+
+var _ helmutils.ChartStore = (*ObjectChartStore)(nil)
+
+// Put creates or replaces the object holding the chart.
+func (s *ObjectChartStore) Put(ctx context.Context, name string, files []*helmutils.ChartFile) error {
+	data, err := helmutils.ArchiveChart(name, files)
+	if err != nil {
+
+		return err
+	}
+
+	meta := metav1.ObjectMeta{
+		Name:      ChartPrefix + name,
+		Namespace: s.Namespace,
+		Labels:    map[string]string{ChartLabel: name, "app.kubernetes.io/managed-by": "helm-api"},
+	}
+
+	if s.Secrets {
+		secrets := s.Client.CoreV1().Secrets(s.Namespace)
+		secret := &corev1.Secret{ObjectMeta: meta, Type: corev1.SecretTypeOpaque, Data: map[string][]byte{ChartKey: data}}
+		_, err = secrets.Update(ctx, secret, metav1.UpdateOptions{})
+		if apierrors.IsNotFound(err) {
+			_, err = secrets.Create(ctx, secret, metav1.CreateOptions{})
+		}
+	} else {
+		configMaps := s.Client.CoreV1().ConfigMaps(s.Namespace)
+		configMap := &corev1.ConfigMap{ObjectMeta: meta, BinaryData: map[string][]byte{ChartKey: data}}
+		_, err = configMaps.Update(ctx, configMap, metav1.UpdateOptions{})
+		if apierrors.IsNotFound(err) {
+			_, err = configMaps.Create(ctx, configMap, metav1.CreateOptions{})
+		}
+	}
+	if err != nil {
+
+		return fmt.Errorf("failed to store chart %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// Get unpacks the chart of the object.
+func (s *ObjectChartStore) Get(ctx context.Context, name string) ([]*helmutils.ChartFile, error) {
+	var data []byte
+	var err error
+	if s.Secrets {
+		var secret *corev1.Secret
+		secret, err = s.Client.CoreV1().Secrets(s.Namespace).Get(ctx, ChartPrefix+name, metav1.GetOptions{})
+		if err == nil {
+			data = secret.Data[ChartKey]
+		}
+	} else {
+		var configMap *corev1.ConfigMap
+		configMap, err = s.Client.CoreV1().ConfigMaps(s.Namespace).Get(ctx, ChartPrefix+name, metav1.GetOptions{})
+		if err == nil {
+			data = configMap.BinaryData[ChartKey]
+		}
+	}
+	if apierrors.IsNotFound(err) {
+
+		return nil, fmt.Errorf("%w: %s", helmutils.ErrChartNotFound, name)
+	}
+	if err != nil {
+
+		return nil, fmt.Errorf("failed to read chart %s: %w", name, err)
+	}
+
+	return helmutils.UnarchiveChart(data)
+}
+
+// List returns the charts of the labeled objects.
+func (s *ObjectChartStore) List(ctx context.Context) ([]string, error) {
+	options := metav1.ListOptions{LabelSelector: ChartLabel}
+	var labels []map[string]string
+	if s.Secrets {
+		secrets, err := s.Client.CoreV1().Secrets(s.Namespace).List(ctx, options)
+		if err != nil {
+
+			return nil, fmt.Errorf("failed to list charts: %w", err)
+		}
+		for _, secret := range secrets.Items {
+			labels = append(labels, secret.Labels)
+		}
+	} else {
+		configMaps, err := s.Client.CoreV1().ConfigMaps(s.Namespace).List(ctx, options)
+		if err != nil {
+
+			return nil, fmt.Errorf("failed to list charts: %w", err)
+		}
+		for _, configMap := range configMaps.Items {
+			labels = append(labels, configMap.Labels)
+		}
+	}
+
+	names := []string{}
+	for _, objectLabels := range labels {
+		names = append(names, objectLabels[ChartLabel])
+	}
+	slices.Sort(names)
+
+	return names, nil
+}
+
+// Delete removes the object holding the chart.
+func (s *ObjectChartStore) Delete(ctx context.Context, name string) error {
+	var err error
+	if s.Secrets {
+		err = s.Client.CoreV1().Secrets(s.Namespace).Delete(ctx, ChartPrefix+name, metav1.DeleteOptions{})
+	} else {
+		err = s.Client.CoreV1().ConfigMaps(s.Namespace).Delete(ctx, ChartPrefix+name, metav1.DeleteOptions{})
+	}
+	if err != nil && !apierrors.IsNotFound(err) {
+
+		return fmt.Errorf("failed to delete chart %s: %w", name, err)
+	}
+
+	return nil
+}
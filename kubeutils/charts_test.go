@@ -0,0 +1,70 @@
+package kubeutils_test
+
+import (
+	"context"
+	"helm-api/helmutils"
+	"helm-api/kubeutils"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestObjectChartStore(t *testing.T) {
+	files := []*helmutils.ChartFile{
+		{Name: "Chart.yaml", Data: []byte("apiVersion: v2\nname: test-demo\nversion: 0.1.0\n")},
+		{Name: "values.yaml", Data: []byte("replicas: 1\n")},
+		{Name: "templates/statefulset.yaml", Data: []byte("kind: StatefulSet\n")},
+	}
+
+	for _, secrets := range []bool{false, true} {
+		t.Run(map[bool]string{false: "configmaps", true: "secrets"}[secrets], func(t *testing.T) {
+			client := fake.NewSimpleClientset()
+			store := &kubeutils.ObjectChartStore{Client: client, Namespace: "helm-api-pg", Secrets: secrets}
+			ctx := context.Background()
+
+			_, err := store.Get(ctx, "test-demo")
+			assert.ErrorIs(t, err, helmutils.ErrChartNotFound)
+
+			require.NoError(t, store.Put(ctx, "test-demo", files))
+			require.NoError(t, store.Put(ctx, "test-other", files[:2]))
+
+			// The chart is kept in the object of the chosen kind.
+			if secrets {
+				secret, err := client.CoreV1().Secrets("helm-api-pg").Get(ctx, kubeutils.ChartPrefix+"test-demo", metav1.GetOptions{})
+				require.NoError(t, err)
+				assert.NotEmpty(t, secret.Data[kubeutils.ChartKey])
+			} else {
+				configMap, err := client.CoreV1().ConfigMaps("helm-api-pg").Get(ctx, kubeutils.ChartPrefix+"test-demo", metav1.GetOptions{})
+				require.NoError(t, err)
+				assert.Equal(t, "test-demo", configMap.Labels[kubeutils.ChartLabel])
+			}
+
+			stored, err := store.Get(ctx, "test-demo")
+			require.NoError(t, err)
+			assert.ElementsMatch(t, files, stored)
+
+			loaded, err := loader.LoadFiles(stored)
+			require.NoError(t, err)
+			assert.Equal(t, "test-demo", loaded.Name())
+
+			names, err := store.List(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"test-demo", "test-other"}, names)
+
+			// Put replaces the chart.
+			require.NoError(t, store.Put(ctx, "test-demo", files[:2]))
+			stored, err = store.Get(ctx, "test-demo")
+			require.NoError(t, err)
+			assert.Len(t, stored, 2)
+
+			require.NoError(t, store.Delete(ctx, "test-demo"))
+			require.NoError(t, store.Delete(ctx, "test-demo"))
+			_, err = store.Get(ctx, "test-demo")
+			assert.ErrorIs(t, err, helmutils.ErrChartNotFound)
+		})
+	}
+}
@@ -0,0 +1,420 @@
+package kubeutils
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+)
+
+// InstanceLabel is set by Helm charts on every object of a release.
+const InstanceLabel = "app.kubernetes.io/instance"
+
+var (
+	// ErrNoPods is returned when a release has no pods to read logs from.
+	ErrNoPods = errors.New("no pods found for release")
+	// ErrContainerNotFound is returned when none of the release pods runs the requested container.
+	ErrContainerNotFound = errors.New("container not found in release pods")
+	// ErrServiceNotFound is returned when no service of the release exposes the requested port.
+	ErrServiceNotFound = errors.New("no service of the release exposes the port")
+	// ErrNoReadyPod is returned when none of the pods behind a service is ready.
+	ErrNoReadyPod = errors.New("no ready pod behind the service")
+)
+
+// Inspector reads the pods, logs and events belonging to Helm releases.
+type Inspector struct {
+	Client    kubernetes.Interface
+	Namespace string
+}
+
+// LogOptions selects the logs returned by OpenLogs.
+type LogOptions struct {
+	// Container limits the logs to one container, all containers are returned when empty.
+	Container string
+	TailLines *int64
+	Since     time.Duration
+	Follow    bool
+}
+
+// Event is a Kubernetes event about an object of a release.
+type Event struct {
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"`
+	Reason  string    `json:"reason"`
+	Object  string    `json:"object"`
+	Message string    `json:"message"`
+	Count   int32     `json:"count,omitempty"`
+}
+
+// Pods returns the pods of the release, sorted by name.
+func (i *Inspector) Pods(ctx context.Context, releaseName string) ([]corev1.Pod, error) {
+	list, err := i.Client.CoreV1().Pods(i.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: InstanceLabel + "=" + releaseName,
+	})
+	if err != nil {
+
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+
+	pods := list.Items
+	sort.Slice(pods, func(a, b int) bool { return pods[a].Name < pods[b].Name })
+
+	return pods, nil
+}
+
+// ServicePod picks a ready pod behind the release service exposing port, given as a port name or
+// number, and returns the matching container port.
+func (i *Inspector) ServicePod(ctx context.Context, releaseName, port string) (string, int32, error) {
+	services, err := i.Client.CoreV1().Services(i.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: InstanceLabel + "=" + releaseName,
+	})
+	if err != nil {
+
+		return "", 0, fmt.Errorf("failed to list services: %w", err)
+	}
+
+	for _, service := range services.Items {
+		// Services without a selector have no pods to forward to.
+		if len(service.Spec.Selector) == 0 {
+			continue
+		}
+
+		for _, servicePort := range service.Spec.Ports {
+			if servicePort.Name != port && strconv.Itoa(int(servicePort.Port)) != port {
+				continue
+			}
+
+			pods, err := i.Client.CoreV1().Pods(i.Namespace).List(ctx, metav1.ListOptions{
+				LabelSelector: labels.SelectorFromSet(service.Spec.Selector).String(),
+			})
+			if err != nil {
+
+				return "", 0, fmt.Errorf("failed to list pods: %w", err)
+			}
+
+			items := pods.Items
+			sort.Slice(items, func(a, b int) bool { return items[a].Name < items[b].Name })
+			for _, pod := range items {
+				if !PodReady(pod) {
+					continue
+				}
+				if target, ok := targetPort(pod, servicePort); ok {
+
+					return pod.Name, target, nil
+				}
+			}
+
+			return "", 0, fmt.Errorf("%w %s", ErrNoReadyPod, service.Name)
+		}
+	}
+
+	return "", 0, fmt.Errorf("%w %s", ErrServiceNotFound, port)
+}
+
+// PodReady reports whether the pod is running and passes its readiness probe.
+func PodReady(pod corev1.Pod) bool {
+	if pod.Status.Phase != corev1.PodRunning || pod.DeletionTimestamp != nil {
+
+		return false
+	}
+
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+
+	return false
+}
+
+// targetPort resolves the service target port, which may be a named container port, on the pod.
+func targetPort(pod corev1.Pod, servicePort corev1.ServicePort) (int32, bool) {
+	switch {
+	case servicePort.TargetPort.Type == intstr.String:
+		for _, container := range pod.Spec.Containers {
+			for _, port := range container.Ports {
+				if port.Name == servicePort.TargetPort.StrVal {
+
+					return port.ContainerPort, true
+				}
+			}
+		}
+
+		return 0, false
+	case servicePort.TargetPort.IntVal != 0:
+
+		return servicePort.TargetPort.IntVal, true
+	}
+
+	return servicePort.Port, true
+}
+
+// LogStream holds the open log streams of a release's containers.
+type LogStream struct {
+	follow  bool
+	streams []containerStream
+}
+
+type containerStream struct {
+	prefix string
+	body   io.ReadCloser
+}
+
+// OpenLogs opens a log stream for every selected container of the release. Nothing is written
+// until Copy is called, so errors can still be reported to the caller.
+func (i *Inspector) OpenLogs(ctx context.Context, releaseName string, opts LogOptions) (*LogStream, error) {
+	pods, err := i.Pods(ctx, releaseName)
+	if err != nil {
+
+		return nil, err
+	}
+	if len(pods) == 0 {
+
+		return nil, ErrNoPods
+	}
+
+	logOptions := corev1.PodLogOptions{
+		Follow:    opts.Follow,
+		TailLines: opts.TailLines,
+	}
+	if opts.Since > 0 {
+		seconds := int64(opts.Since.Seconds())
+		logOptions.SinceSeconds = &seconds
+	}
+
+	stream := &LogStream{follow: opts.Follow}
+	for _, pod := range pods {
+		for _, container := range pod.Spec.Containers {
+			if opts.Container != "" && container.Name != opts.Container {
+				continue
+			}
+
+			containerOptions := logOptions
+			containerOptions.Container = container.Name
+			body, err := i.Client.CoreV1().Pods(i.Namespace).GetLogs(pod.Name, &containerOptions).Stream(ctx)
+			if err != nil {
+				stream.Close()
+
+				return nil, fmt.Errorf("failed to open logs of %s/%s: %w", pod.Name, container.Name, err)
+			}
+
+			stream.streams = append(stream.streams, containerStream{
+				prefix: "[" + pod.Name + "/" + container.Name + "] ",
+				body:   body,
+			})
+		}
+	}
+
+	if len(stream.streams) == 0 {
+
+		return nil, ErrContainerNotFound
+	}
+
+	return stream, nil
+}
+
+// Copy writes the log lines to w, each prefixed with its pod and container. Followed streams
+// are read concurrently and w is flushed after every line when it supports it.
+func (s *LogStream) Copy(w io.Writer) error {
+	var mu sync.Mutex
+	writeLine := func(line string) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if _, err := io.WriteString(w, line); err != nil {
+
+			return err
+		}
+		if flusher, ok := w.(interface{ Flush() }); ok {
+			flusher.Flush()
+		}
+
+		return nil
+	}
+
+	copyStream := func(stream containerStream) error {
+		scanner := bufio.NewScanner(stream.body)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			if err := writeLine(stream.prefix + scanner.Text() + "\n"); err != nil {
+
+				return err
+			}
+		}
+
+		return scanner.Err()
+	}
+
+	if !s.follow {
+		for _, stream := range s.streams {
+			if err := copyStream(stream); err != nil {
+
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	errs := make(chan error, len(s.streams))
+	for _, stream := range s.streams {
+		go func(stream containerStream) {
+			errs <- copyStream(stream)
+		}(stream)
+	}
+
+	var result error
+	for range s.streams {
+		if err := <-errs; err != nil && result == nil {
+			result = err
+		}
+	}
+
+	return result
+}
+
+// Close closes every open stream.
+func (s *LogStream) Close() error {
+	var errs []error
+	for _, stream := range s.streams {
+		if err := stream.body.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Events returns the events about the objects of the release, oldest first.
+func (i *Inspector) Events(ctx context.Context, releaseName string) ([]Event, error) {
+	objects, err := i.releaseObjects(ctx, releaseName)
+	if err != nil {
+
+		return nil, err
+	}
+
+	list, err := i.Client.CoreV1().Events(i.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+
+		return nil, fmt.Errorf("failed to list events: %w", err)
+	}
+
+	events := []Event{}
+	for _, event := range list.Items {
+		object := event.InvolvedObject.Kind + "/" + event.InvolvedObject.Name
+		if !objects[object] {
+			continue
+		}
+
+		events = append(events, Event{
+			Time:    eventTime(event),
+			Type:    event.Type,
+			Reason:  event.Reason,
+			Object:  object,
+			Message: strings.TrimSpace(event.Message),
+			Count:   event.Count,
+		})
+	}
+
+	sort.SliceStable(events, func(a, b int) bool { return events[a].Time.Before(events[b].Time) })
+
+	return events, nil
+}
+
+// releaseObjects returns the kind/name of the objects labelled with the release, plus the
+// volume claims its pods use, which statefulsets create without the release labels.
+func (i *Inspector) releaseObjects(ctx context.Context, releaseName string) (map[string]bool, error) {
+	options := metav1.ListOptions{LabelSelector: InstanceLabel + "=" + releaseName}
+	objects := map[string]bool{}
+
+	pods, err := i.Pods(ctx, releaseName)
+	if err != nil {
+
+		return nil, err
+	}
+	for _, pod := range pods {
+		objects["Pod/"+pod.Name] = true
+		for _, volume := range pod.Spec.Volumes {
+			if volume.PersistentVolumeClaim != nil {
+				objects["PersistentVolumeClaim/"+volume.PersistentVolumeClaim.ClaimName] = true
+			}
+		}
+	}
+
+	statefulSets, err := i.Client.AppsV1().StatefulSets(i.Namespace).List(ctx, options)
+	if err != nil {
+
+		return nil, fmt.Errorf("failed to list statefulsets: %w", err)
+	}
+	for _, item := range statefulSets.Items {
+		objects["StatefulSet/"+item.Name] = true
+	}
+
+	deployments, err := i.Client.AppsV1().Deployments(i.Namespace).List(ctx, options)
+	if err != nil {
+
+		return nil, fmt.Errorf("failed to list deployments: %w", err)
+	}
+	for _, item := range deployments.Items {
+		objects["Deployment/"+item.Name] = true
+	}
+
+	replicaSets, err := i.Client.AppsV1().ReplicaSets(i.Namespace).List(ctx, options)
+	if err != nil {
+
+		return nil, fmt.Errorf("failed to list replicasets: %w", err)
+	}
+	for _, item := range replicaSets.Items {
+		objects["ReplicaSet/"+item.Name] = true
+	}
+
+	services, err := i.Client.CoreV1().Services(i.Namespace).List(ctx, options)
+	if err != nil {
+
+		return nil, fmt.Errorf("failed to list services: %w", err)
+	}
+	for _, item := range services.Items {
+		objects["Service/"+item.Name] = true
+	}
+
+	claims, err := i.Client.CoreV1().PersistentVolumeClaims(i.Namespace).List(ctx, options)
+	if err != nil {
+
+		return nil, fmt.Errorf("failed to list persistent volume claims: %w", err)
+	}
+	for _, item := range claims.Items {
+		objects["PersistentVolumeClaim/"+item.Name] = true
+	}
+
+	return objects, nil
+}
+
+// eventTime returns the most recent time recorded on the event.
+func eventTime(event corev1.Event) time.Time {
+	switch {
+	case !event.LastTimestamp.IsZero():
+
+		return event.LastTimestamp.Time
+	case !event.EventTime.IsZero():
+
+		return event.EventTime.Time
+	case !event.FirstTimestamp.IsZero():
+
+		return event.FirstTimestamp.Time
+	}
+
+	return event.CreationTimestamp.Time
+}
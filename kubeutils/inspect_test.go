@@ -0,0 +1,267 @@
+package kubeutils_test
+
+import (
+	"bytes"
+	"context"
+	"helm-api/kubeutils"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const namespace = "helm-api"
+
+func releaseMeta(name, release string) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:      name,
+		Namespace: namespace,
+		Labels:    map[string]string{kubeutils.InstanceLabel: release},
+	}
+}
+
+func pod(name, release string, containers ...string) *corev1.Pod {
+	p := &corev1.Pod{ObjectMeta: releaseMeta(name, release)}
+	for _, container := range containers {
+		p.Spec.Containers = append(p.Spec.Containers, corev1.Container{Name: container})
+	}
+
+	return p
+}
+
+func event(name, kind, object, reason string, at time.Time) *corev1.Event {
+	return &corev1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Name: name, Namespace: namespace},
+		InvolvedObject: corev1.ObjectReference{Kind: kind, Name: object, Namespace: namespace},
+		Type:           corev1.EventTypeWarning,
+		Reason:         reason,
+		Message:        reason + " " + object,
+		LastTimestamp:  metav1.NewTime(at),
+	}
+}
+
+func newInspector(objects ...runtime.Object) *kubeutils.Inspector {
+	return &kubeutils.Inspector{
+		Client:    fake.NewSimpleClientset(objects...),
+		Namespace: namespace,
+	}
+}
+
+func TestOpenLogs(t *testing.T) {
+	inspector := newInspector(
+		pod("test-demo-1", "test-demo", "mariadb", "metrics"),
+		pod("test-demo-0", "test-demo", "mariadb"),
+		pod("test-other-0", "test-other", "mariadb"),
+	)
+
+	tests := []struct {
+		name     string
+		opts     kubeutils.LogOptions
+		expected string
+		err      error
+	}{
+		{
+			name: "all containers",
+			opts: kubeutils.LogOptions{},
+			// The fake clientset returns "fake logs" for every container.
+			expected: "[test-demo-0/mariadb] fake logs\n" +
+				"[test-demo-1/mariadb] fake logs\n" +
+				"[test-demo-1/metrics] fake logs\n",
+		},
+		{
+			name:     "one container",
+			opts:     kubeutils.LogOptions{Container: "metrics", Since: time.Minute},
+			expected: "[test-demo-1/metrics] fake logs\n",
+		},
+		{
+			name: "unknown container",
+			opts: kubeutils.LogOptions{Container: "sidecar"},
+			err:  kubeutils.ErrContainerNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream, err := inspector.OpenLogs(context.Background(), "test-demo", tt.opts)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+
+				return
+			}
+			require.NoError(t, err)
+			defer stream.Close()
+
+			var buf bytes.Buffer
+			require.NoError(t, stream.Copy(&buf))
+			assert.Equal(t, tt.expected, buf.String())
+		})
+	}
+}
+
+func TestOpenLogsFollow(t *testing.T) {
+	inspector := newInspector(pod("test-demo-0", "test-demo", "mariadb", "metrics"))
+
+	stream, err := inspector.OpenLogs(context.Background(), "test-demo", kubeutils.LogOptions{Follow: true})
+	require.NoError(t, err)
+	defer stream.Close()
+
+	var buf bytes.Buffer
+	require.NoError(t, stream.Copy(&buf))
+	assert.Contains(t, buf.String(), "[test-demo-0/mariadb] fake logs\n")
+	assert.Contains(t, buf.String(), "[test-demo-0/metrics] fake logs\n")
+}
+
+func TestOpenLogsNoPods(t *testing.T) {
+	inspector := newInspector(pod("test-other-0", "test-other", "mariadb"))
+
+	_, err := inspector.OpenLogs(context.Background(), "test-demo", kubeutils.LogOptions{})
+	assert.ErrorIs(t, err, kubeutils.ErrNoPods)
+}
+
+func TestEvents(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+
+	demoPod := pod("test-demo-0", "test-demo", "mariadb")
+	demoPod.Spec.Volumes = []corev1.Volume{{
+		Name: "data",
+		VolumeSource: corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "data-test-demo-0"},
+		},
+	}}
+
+	inspector := newInspector(
+		demoPod,
+		&appsv1.StatefulSet{ObjectMeta: releaseMeta("test-demo", "test-demo")},
+		&corev1.Service{ObjectMeta: releaseMeta("test-demo", "test-demo")},
+		pod("test-other-0", "test-other", "mariadb"),
+		event("e1", "Pod", "test-demo-0", "BackOff", now.Add(-time.Minute)),
+		event("e2", "StatefulSet", "test-demo", "FailedCreate", now.Add(-3*time.Minute)),
+		event("e3", "PersistentVolumeClaim", "data-test-demo-0", "ProvisioningFailed", now.Add(-2*time.Minute)),
+		event("e4", "Pod", "test-other-0", "BackOff", now),
+		// Same name, different kind: not part of the release.
+		event("e5", "Deployment", "test-demo", "ScalingReplicaSet", now),
+	)
+
+	events, err := inspector.Events(context.Background(), "test-demo")
+	require.NoError(t, err)
+
+	var objects []string
+	for _, e := range events {
+		objects = append(objects, e.Object)
+	}
+	assert.Equal(t, []string{
+		"StatefulSet/test-demo",
+		"PersistentVolumeClaim/data-test-demo-0",
+		"Pod/test-demo-0",
+	}, objects)
+	assert.Equal(t, "BackOff", events[2].Reason)
+	assert.Equal(t, "BackOff test-demo-0", events[2].Message)
+	assert.True(t, events[2].Time.Equal(now.Add(-time.Minute)))
+}
+
+func readyPod(name string, ready bool, ports ...corev1.ContainerPort) *corev1.Pod {
+	p := pod(name, "test-demo", "mariadb")
+	p.Labels["app"] = "mariadb"
+	p.Spec.Containers[0].Ports = ports
+	p.Status.Phase = corev1.PodRunning
+	status := corev1.ConditionFalse
+	if ready {
+		status = corev1.ConditionTrue
+	}
+	p.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: status}}
+
+	return p
+}
+
+func service(name string, selector map[string]string, ports ...corev1.ServicePort) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: releaseMeta(name, "test-demo"),
+		Spec:       corev1.ServiceSpec{Selector: selector, Ports: ports},
+	}
+}
+
+func TestServicePod(t *testing.T) {
+	selector := map[string]string{"app": "mariadb"}
+	mysqlPort := corev1.ServicePort{Name: "mysql", Port: 3306, TargetPort: intstr.FromString("mysql")}
+	containerPort := corev1.ContainerPort{Name: "mysql", ContainerPort: 3307}
+
+	tests := []struct {
+		name    string
+		objects []runtime.Object
+		port    string
+		pod     string
+		target  int32
+		err     error
+	}{
+		{
+			name: "first ready pod by port number",
+			objects: []runtime.Object{
+				service("test-demo-mariadb", selector, mysqlPort),
+				readyPod("test-demo-mariadb-1", true, containerPort),
+				readyPod("test-demo-mariadb-0", false, containerPort),
+			},
+			port:   "3306",
+			pod:    "test-demo-mariadb-1",
+			target: 3307,
+		},
+		{
+			name: "port name and numeric target",
+			objects: []runtime.Object{
+				service("test-demo-http", selector, corev1.ServicePort{Name: "http", Port: 80, TargetPort: intstr.FromInt32(8080)}),
+				readyPod("test-demo-web-0", true),
+			},
+			port:   "http",
+			pod:    "test-demo-web-0",
+			target: 8080,
+		},
+		{
+			name: "headless service without selector is skipped",
+			objects: []runtime.Object{
+				service("test-demo-external", nil, mysqlPort),
+			},
+			port: "3306",
+			err:  kubeutils.ErrServiceNotFound,
+		},
+		{
+			name: "no ready pod",
+			objects: []runtime.Object{
+				service("test-demo-mariadb", selector, mysqlPort),
+				readyPod("test-demo-mariadb-0", false, containerPort),
+			},
+			port: "mysql",
+			err:  kubeutils.ErrNoReadyPod,
+		},
+		{
+			name: "unknown port",
+			objects: []runtime.Object{
+				service("test-demo-mariadb", selector, mysqlPort),
+			},
+			port: "5432",
+			err:  kubeutils.ErrServiceNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inspector := newInspector(tt.objects...)
+
+			pod, target, err := inspector.ServicePod(context.Background(), "test-demo", tt.port)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.pod, pod)
+			assert.Equal(t, tt.target, target)
+		})
+	}
+}
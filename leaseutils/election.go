@@ -0,0 +1,111 @@
+package leaseutils
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// LeaderLease is the name of the Lease of the leader election.
+const LeaderLease = "helm-api-leader"
+
+// Job is a background job run by the leader only. Its context is cancelled when the
+// leadership is lost.
+type Job func(ctx context.Context)
+
+// Elector elects one replica through a Lease to run the background jobs.
+type Elector struct {
+	Client    kubernetes.Interface
+	Namespace string
+	// Identity is the replica campaigning, usually the pod name.
+	Identity string
+	// Duration is how long the other replicas wait before taking over a Lease that isn't renewed.
+	Duration time.Duration
+	// RenewDeadline is how long the leader retries renewing the Lease before giving it up.
+	RenewDeadline time.Duration
+	// RetryPeriod is how often the replicas try to take or renew the Lease.
+	RetryPeriod time.Duration
+	Logger      Logger
+
+	leading atomic.Bool
+	// term is held while the jobs of a leadership term run.
+	term sync.Mutex
+}
+
+// IsLeader reports whether this replica leads and runs the jobs.
+func (e *Elector) IsLeader() bool {
+	return e.leading.Load()
+}
+
+// Run campaigns until the context is cancelled and runs the jobs while this replica leads. The
+// Lease is released on cancellation so another replica takes over right away, and Run returns
+// once the jobs did.
+func (e *Elector) Run(ctx context.Context, jobs ...Job) error {
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock: &resourcelock.LeaseLock{
+			LeaseMeta:  metav1.ObjectMeta{Name: LeaderLease, Namespace: e.Namespace},
+			Client:     e.Client.CoordinationV1(),
+			LockConfig: resourcelock.ResourceLockConfig{Identity: e.Identity},
+		},
+		LeaseDuration:   e.Duration,
+		RenewDeadline:   e.RenewDeadline,
+		RetryPeriod:     e.RetryPeriod,
+		ReleaseOnCancel: true,
+		Name:            LeaderLease,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) { e.lead(ctx, jobs) },
+			OnStoppedLeading: func() {},
+		},
+	})
+	if err != nil {
+
+		return fmt.Errorf("failed to configure the leader election: %w", err)
+	}
+
+	// Run returns when the leadership is lost, campaign again until the context is cancelled.
+	for ctx.Err() == nil {
+		elector.Run(ctx)
+	}
+
+	// Wait for the jobs of the last term.
+	e.term.Lock()
+	defer e.term.Unlock()
+
+	return nil
+}
+
+// lead runs the jobs of a term until the leadership is lost. Terms run one at a time, so the jobs
+// of a lost term return before the jobs of the next one start.
+func (e *Elector) lead(ctx context.Context, jobs []Job) {
+	e.term.Lock()
+	defer e.term.Unlock()
+
+	if ctx.Err() != nil {
+
+		return
+	}
+
+	e.leading.Store(true)
+	e.Logger.Infof("%s is leading, running %d background jobs", e.Identity, len(jobs))
+
+	var wg sync.WaitGroup
+	for _, job := range jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			job(ctx)
+		}()
+	}
+	wg.Wait()
+	<-ctx.Done()
+
+	e.leading.Store(false)
+	e.Logger.Infof("%s stopped leading", e.Identity)
+}
@@ -0,0 +1,85 @@
+package leaseutils_test
+
+import (
+	"context"
+	"helm-api/leaseutils"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newElector(client kubernetes.Interface, identity string) *leaseutils.Elector {
+	return &leaseutils.Elector{
+		Client:        client,
+		Namespace:     namespace,
+		Identity:      identity,
+		Duration:      time.Second,
+		RenewDeadline: 500 * time.Millisecond,
+		RetryPeriod:   50 * time.Millisecond,
+		Logger:        discardLogger(),
+	}
+}
+
+func TestElectorRunsJobsOnTheLeader(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	electors := []*leaseutils.Elector{newElector(client, "helm-api-0"), newElector(client, "helm-api-1")}
+
+	// running counts the replicas running the job.
+	var running atomic.Int32
+	job := func(ctx context.Context) {
+		running.Add(1)
+		defer running.Add(-1)
+		<-ctx.Done()
+	}
+
+	cancels := make([]context.CancelFunc, len(electors))
+	done := make([]chan error, len(electors))
+	for i, elector := range electors {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancels[i] = cancel
+		done[i] = make(chan error, 1)
+		go func() { done[i] <- elector.Run(ctx, job) }()
+	}
+	defer func() {
+		for _, cancel := range cancels {
+			cancel()
+		}
+	}()
+
+	leader := func() int {
+		leaders := []int{}
+		for i, elector := range electors {
+			if elector.IsLeader() {
+				leaders = append(leaders, i)
+			}
+		}
+		if len(leaders) != 1 {
+
+			return -1
+		}
+
+		return leaders[0]
+	}
+
+	require.Eventually(t, func() bool { return leader() >= 0 && running.Load() == 1 }, 5*time.Second, 10*time.Millisecond)
+	first := leader()
+
+	// The leader stepping down releases the Lease, the other replica takes over the jobs.
+	cancels[first]()
+	require.NoError(t, <-done[first])
+	assert.False(t, electors[first].IsLeader())
+
+	require.Eventually(t, func() bool { return leader() == 1-first && running.Load() == 1 }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestElectorInvalidConfig(t *testing.T) {
+	elector := newElector(fake.NewSimpleClientset(), "helm-api-0")
+	elector.RenewDeadline = 2 * time.Second
+
+	assert.Error(t, elector.Run(context.Background()))
+}
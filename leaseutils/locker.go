@@ -0,0 +1,244 @@
+package leaseutils
+
+import (
+	"context"
+	"fmt"
+	"helm-api/helmutils"
+	"sync"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// LockPrefix starts the name of the Lease locking a release.
+	LockPrefix = "helm-api-lock-"
+	// OperationAnnotation holds the operation running on the release of a lock Lease.
+	OperationAnnotation = "helm-api/operation"
+)
+
+// Logger reports the Lease renewals that failed.
+type Logger interface {
+	Infof(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// Locker is a helmutils.Locker shared by the replicas through one Lease per release. A Lease
+// not renewed within Duration is expired, so the locks of a replica that died are taken over.
+type Locker struct {
+	Client    kubernetes.Interface
+	Namespace string
+	// Identity is the replica holding the locks, usually the pod name.
+	Identity string
+	// Wait is how long an operation waits for the lock before failing, zero fails right away.
+	Wait time.Duration
+	// Duration is how long a Lease stays held without being renewed, in whole seconds. Held
+	// Leases are renewed every third of it.
+	Duration time.Duration
+	// RetryPeriod is how often a taken Lease is checked while waiting.
+	RetryPeriod time.Duration
+	Logger      Logger
+}
+
+var _ helmutils.Locker = (*Locker)(nil)
+
+// Lock takes the Lease of the release, waiting up to Wait for the replica holding it.
+func (l *Locker) Lock(ctx context.Context, releaseName, operation string) (func(), error) {
+	deadline := time.Now().Add(l.Wait)
+
+	for {
+		lease, holder, err := l.tryLock(ctx, releaseName, operation)
+		if err != nil {
+
+			return nil, err
+		}
+		if lease != nil {
+
+			return l.keep(releaseName, lease), nil
+		}
+
+		if holder != nil && !time.Now().Before(deadline) {
+
+			return nil, helmutils.LockedError(releaseName, holder)
+		}
+
+		select {
+		case <-ctx.Done():
+
+			return nil, ctx.Err()
+		case <-time.After(l.RetryPeriod):
+		}
+	}
+}
+
+// Holder returns the operation holding the Lease of the release, nil when it's free or expired.
+func (l *Locker) Holder(ctx context.Context, releaseName string) (*helmutils.LockInfo, error) {
+	lease, err := l.Client.CoordinationV1().Leases(l.Namespace).Get(ctx, LockPrefix+releaseName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+
+		return nil, nil
+	}
+	if err != nil {
+
+		return nil, fmt.Errorf("failed to read the lock of %s: %w", releaseName, err)
+	}
+
+	if expired(lease, time.Now()) {
+
+		return nil, nil
+	}
+
+	return lockInfo(lease), nil
+}
+
+// tryLock takes the Lease of the release when it's missing or expired. It returns the Lease it
+// took, or the holder of the Lease when it's held. Both are nil when another replica took the
+// Lease at the same time.
+func (l *Locker) tryLock(ctx context.Context, releaseName, operation string) (*coordinationv1.Lease, *helmutils.LockInfo, error) {
+	leases := l.Client.CoordinationV1().Leases(l.Namespace)
+	name := LockPrefix + releaseName
+	now := metav1.NewMicroTime(time.Now())
+	seconds := int32(l.Duration.Seconds())
+	spec := coordinationv1.LeaseSpec{
+		HolderIdentity:       &l.Identity,
+		LeaseDurationSeconds: &seconds,
+		AcquireTime:          &now,
+		RenewTime:            &now,
+	}
+
+	current, err := leases.Get(ctx, name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		lease := &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   l.Namespace,
+				Annotations: map[string]string{OperationAnnotation: operation},
+			},
+			Spec: spec,
+		}
+		created, err := leases.Create(ctx, lease, metav1.CreateOptions{})
+		if apierrors.IsAlreadyExists(err) {
+
+			return nil, nil, nil
+		}
+		if err != nil {
+
+			return nil, nil, fmt.Errorf("failed to create the lock of %s: %w", releaseName, err)
+		}
+
+		return created, nil, nil
+
+	case err != nil:
+
+		return nil, nil, fmt.Errorf("failed to read the lock of %s: %w", releaseName, err)
+	}
+
+	if !expired(current, now.Time) {
+
+		return nil, lockInfo(current), nil
+	}
+
+	// The holder released the Lease or stopped renewing it, the update fails when another
+	// replica takes it first.
+	lease := current.DeepCopy()
+	if lease.Annotations == nil {
+		lease.Annotations = map[string]string{}
+	}
+	lease.Annotations[OperationAnnotation] = operation
+	lease.Spec = spec
+	updated, err := leases.Update(ctx, lease, metav1.UpdateOptions{})
+	if apierrors.IsConflict(err) {
+
+		return nil, nil, nil
+	}
+	if err != nil {
+
+		return nil, nil, fmt.Errorf("failed to take the lock of %s: %w", releaseName, err)
+	}
+
+	return updated, nil, nil
+}
+
+// keep renews the Lease until the returned function releases it.
+func (l *Locker) keep(releaseName string, lease *coordinationv1.Lease) func() {
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(l.Duration / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+
+				return
+			case <-ticker.C:
+				renewed, err := l.renew(lease)
+				if err != nil {
+					l.Logger.Errorf("Renewing the lock of %s failed: %v", releaseName, err)
+
+					continue
+				}
+				lease = renewed
+			}
+		}
+	}()
+
+	var once sync.Once
+
+	return func() {
+		once.Do(func() {
+			close(stop)
+			<-stopped
+
+			// The precondition keeps the Lease when another replica took it over meanwhile.
+			err := l.Client.CoordinationV1().Leases(l.Namespace).Delete(context.Background(), lease.Name, metav1.DeleteOptions{
+				Preconditions: &metav1.Preconditions{UID: &lease.UID, ResourceVersion: &lease.ResourceVersion},
+			})
+			if err != nil && !apierrors.IsNotFound(err) && !apierrors.IsConflict(err) {
+				l.Logger.Errorf("Releasing the lock of %s failed: %v", releaseName, err)
+			}
+		})
+	}
+}
+
+func (l *Locker) renew(lease *coordinationv1.Lease) (*coordinationv1.Lease, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.Duration/3)
+	defer cancel()
+
+	renewed := lease.DeepCopy()
+	now := metav1.NewMicroTime(time.Now())
+	renewed.Spec.RenewTime = &now
+
+	return l.Client.CoordinationV1().Leases(l.Namespace).Update(ctx, renewed, metav1.UpdateOptions{})
+}
+
+// expired reports whether the Lease is released or wasn't renewed in time.
+func expired(lease *coordinationv1.Lease, now time.Time) bool {
+	spec := lease.Spec
+	if spec.HolderIdentity == nil || *spec.HolderIdentity == "" || spec.RenewTime == nil || spec.LeaseDurationSeconds == nil {
+
+		return true
+	}
+
+	return now.After(spec.RenewTime.Add(time.Duration(*spec.LeaseDurationSeconds) * time.Second))
+}
+
+func lockInfo(lease *coordinationv1.Lease) *helmutils.LockInfo {
+	info := &helmutils.LockInfo{Operation: lease.Annotations[OperationAnnotation]}
+	if lease.Spec.HolderIdentity != nil {
+		info.Holder = *lease.Spec.HolderIdentity
+	}
+	if lease.Spec.AcquireTime != nil {
+		info.Since = lease.Spec.AcquireTime.UTC()
+	}
+
+	return info
+}
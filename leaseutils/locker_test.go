@@ -0,0 +1,179 @@
+package leaseutils_test
+
+import (
+	"context"
+	"helm-api/helmutils"
+	"helm-api/leaseutils"
+	"helm-api/logutils"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const namespace = "helm-api-pg"
+
+func discardLogger() logutils.Logger {
+	base := logrus.New()
+	base.SetOutput(io.Discard)
+
+	return logutils.NewLogrus(base)
+}
+
+// newLocker returns the locker of one replica sharing the Leases of client.
+func newLocker(client kubernetes.Interface, identity string, wait time.Duration) *leaseutils.Locker {
+	return &leaseutils.Locker{
+		Client:      client,
+		Namespace:   namespace,
+		Identity:    identity,
+		Wait:        wait,
+		Duration:    15 * time.Second,
+		RetryPeriod: 5 * time.Millisecond,
+		Logger:      discardLogger(),
+	}
+}
+
+func TestLockerSharedByReplicas(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	first := newLocker(client, "helm-api-0", 0)
+	second := newLocker(client, "helm-api-1", 0)
+	ctx := context.Background()
+
+	unlock, err := first.Lock(ctx, "test-demo", "upgrade")
+	require.NoError(t, err)
+
+	lease, err := client.CoordinationV1().Leases(namespace).Get(ctx, leaseutils.LockPrefix+"test-demo", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "helm-api-0", *lease.Spec.HolderIdentity)
+	assert.Equal(t, "upgrade", lease.Annotations[leaseutils.OperationAnnotation])
+
+	// Every replica sees the holder and is rejected.
+	holder, err := second.Holder(ctx, "test-demo")
+	require.NoError(t, err)
+	require.NotNil(t, holder)
+	assert.Equal(t, "upgrade", holder.Operation)
+	assert.Equal(t, "helm-api-0", holder.Holder)
+	assert.WithinDuration(t, time.Now(), holder.Since, time.Minute)
+
+	_, err = second.Lock(ctx, "test-demo", "uninstall")
+	assert.ErrorIs(t, err, helmutils.ErrLocked)
+	assert.Contains(t, err.Error(), "test-demo is running upgrade on helm-api-0")
+
+	// So are the other operations of the same replica.
+	_, err = first.Lock(ctx, "test-demo", "uninstall")
+	assert.ErrorIs(t, err, helmutils.ErrLocked)
+
+	// Other releases aren't affected.
+	unlockOther, err := second.Lock(ctx, "test-other", "install")
+	require.NoError(t, err)
+	unlockOther()
+
+	unlock()
+	// Releasing twice is harmless.
+	unlock()
+
+	_, err = client.CoordinationV1().Leases(namespace).Get(ctx, leaseutils.LockPrefix+"test-demo", metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err), "the Lease is deleted on release")
+
+	holder, err = second.Holder(ctx, "test-demo")
+	require.NoError(t, err)
+	assert.Nil(t, holder)
+
+	unlock, err = second.Lock(ctx, "test-demo", "uninstall")
+	require.NoError(t, err)
+	unlock()
+}
+
+func TestLockerWaits(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	first := newLocker(client, "helm-api-0", 0)
+	second := newLocker(client, "helm-api-1", time.Second)
+
+	unlock, err := first.Lock(context.Background(), "test-demo", "upgrade")
+	require.NoError(t, err)
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		unlock()
+	}()
+
+	start := time.Now()
+	unlockNext, err := second.Lock(context.Background(), "test-demo", "uninstall")
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+	unlockNext()
+
+	// Waiting stops with the context.
+	unlock, err = first.Lock(context.Background(), "test-demo", "upgrade")
+	require.NoError(t, err)
+	defer unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = newLocker(client, "helm-api-1", time.Minute).Lock(ctx, "test-demo", "uninstall")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestLockerTakesOverExpiredLeases(t *testing.T) {
+	// A replica died holding the lock an hour ago.
+	identity := "helm-api-0"
+	seconds := int32(15)
+	renewed := metav1.NewMicroTime(time.Now().Add(-time.Hour))
+	client := fake.NewSimpleClientset(&coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        leaseutils.LockPrefix + "test-demo",
+			Namespace:   namespace,
+			Annotations: map[string]string{leaseutils.OperationAnnotation: "upgrade"},
+		},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       &identity,
+			LeaseDurationSeconds: &seconds,
+			AcquireTime:          &renewed,
+			RenewTime:            &renewed,
+		},
+	})
+	locker := newLocker(client, "helm-api-1", 0)
+
+	holder, err := locker.Holder(context.Background(), "test-demo")
+	require.NoError(t, err)
+	assert.Nil(t, holder)
+
+	unlock, err := locker.Lock(context.Background(), "test-demo", "uninstall")
+	require.NoError(t, err)
+	defer unlock()
+
+	holder, err = locker.Holder(context.Background(), "test-demo")
+	require.NoError(t, err)
+	require.NotNil(t, holder)
+	assert.Equal(t, "helm-api-1", holder.Holder)
+	assert.Equal(t, "uninstall", holder.Operation)
+}
+
+func TestLockerRenews(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	locker := newLocker(client, "helm-api-0", 0)
+	locker.Duration = time.Second
+	ctx := context.Background()
+
+	unlock, err := locker.Lock(ctx, "test-demo", "upgrade")
+	require.NoError(t, err)
+	defer unlock()
+
+	lease, err := client.CoordinationV1().Leases(namespace).Get(ctx, leaseutils.LockPrefix+"test-demo", metav1.GetOptions{})
+	require.NoError(t, err)
+	acquired := lease.Spec.RenewTime.Time
+
+	assert.Eventually(t, func() bool {
+		lease, err := client.CoordinationV1().Leases(namespace).Get(ctx, leaseutils.LockPrefix+"test-demo", metav1.GetOptions{})
+
+		return err == nil && lease.Spec.RenewTime.After(acquired)
+	}, 2*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,218 @@
+package logutils
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// SubsystemHTTP covers request logs and handlers.
+	SubsystemHTTP = "http"
+	// SubsystemHelm covers Helm actions run by the Helm client.
+	SubsystemHelm = "helm"
+	// SubsystemAWS covers AWS clients and API key refreshes.
+	SubsystemAWS = "aws"
+	// SubsystemReaper covers the expired environment reaper.
+	SubsystemReaper = "reaper"
+	// SubsystemGRPC covers call logs of the gRPC API.
+	SubsystemGRPC = "grpc"
+	// SubsystemLeases covers the leader election and the locks shared through Leases.
+	SubsystemLeases = "leases"
+	// SubsystemServer covers startup and shutdown.
+	SubsystemServer = "server"
+
+	// AllSubsystems selects every subsystem when setting a level.
+	AllSubsystems = ""
+	// DefaultLevel names the level of the loggers without a subsystem in Get. Setting it is
+	// the same as setting AllSubsystems, as the default entry of a level file.
+	DefaultLevel = "default"
+)
+
+// Subsystems lists the subsystems whose level can be changed at runtime.
+var Subsystems = []string{SubsystemHTTP, SubsystemHelm, SubsystemAWS, SubsystemReaper, SubsystemGRPC, SubsystemLeases, SubsystemServer}
+
+// Levels holds the log levels used by the loggers returned from ForSubsystem.
+var Levels = NewLevelSet(logrus.InfoLevel)
+
+// LevelSet holds a log level per subsystem that can be changed while loggers are in use.
+type LevelSet struct {
+	levels map[string]*atomic.Uint32
+	// fallback is the level of the loggers not bound to a subsystem, set with AllSubsystems.
+	fallback *atomic.Uint32
+}
+
+// NewLevelSet returns a level set with every subsystem at the given level.
+func NewLevelSet(level logrus.Level) *LevelSet {
+	set := &LevelSet{levels: map[string]*atomic.Uint32{}, fallback: new(atomic.Uint32)}
+	for _, subsystem := range Subsystems {
+		set.levels[subsystem] = new(atomic.Uint32)
+		set.levels[subsystem].Store(uint32(level))
+	}
+	set.fallback.Store(uint32(level))
+
+	return set
+}
+
+// Set changes the level of a subsystem, or of all subsystems when subsystem is AllSubsystems.
+func (s *LevelSet) Set(subsystem, level string) error {
+	return s.Apply(map[string]string{subsystem: level})
+}
+
+// Apply changes several levels at once. Nothing is changed when any entry is invalid.
+// The AllSubsystems entry is applied first so the other entries override it.
+func (s *LevelSet) Apply(levels map[string]string) error {
+	parsed := map[string]logrus.Level{}
+	for subsystem, value := range levels {
+		if subsystem == DefaultLevel {
+			subsystem = AllSubsystems
+		}
+		if _, exists := s.levels[subsystem]; !exists && subsystem != AllSubsystems {
+
+			return fmt.Errorf("unknown log subsystem %q, expected one of %s", subsystem, strings.Join(Subsystems, ", "))
+		}
+
+		level, err := logrus.ParseLevel(value)
+		if err != nil {
+
+			return fmt.Errorf("invalid log level: %w", err)
+		}
+		parsed[subsystem] = level
+	}
+
+	if level, exists := parsed[AllSubsystems]; exists {
+		for _, current := range s.levels {
+			current.Store(uint32(level))
+		}
+		s.fallback.Store(uint32(level))
+		delete(parsed, AllSubsystems)
+	}
+
+	for subsystem, level := range parsed {
+		s.levels[subsystem].Store(uint32(level))
+	}
+
+	return nil
+}
+
+// Get returns the current level name of every subsystem, and the default one as DefaultLevel.
+func (s *LevelSet) Get() map[string]string {
+	levels := make(map[string]string, len(s.levels)+1)
+	for subsystem, level := range s.levels {
+		levels[subsystem] = logrus.Level(level.Load()).String()
+	}
+	levels[DefaultLevel] = logrus.Level(s.fallback.Load()).String()
+
+	return levels
+}
+
+// LevelConfig is the content of a log level file, e.g.
+//
+//	default: info
+//	subsystems:
+//	  helm: debug
+type LevelConfig struct {
+	Default    string            `yaml:"default"`
+	Subsystems map[string]string `yaml:"subsystems"`
+}
+
+// LoadLevels reads a log level file into the form accepted by Apply.
+func LoadLevels(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+
+		return nil, fmt.Errorf("failed to read log level file: %w", err)
+	}
+
+	var config LevelConfig
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+
+		return nil, fmt.Errorf("failed to parse log level file: %w", err)
+	}
+
+	levels := map[string]string{}
+	if config.Default != "" {
+		levels[AllSubsystems] = config.Default
+	}
+	for subsystem, level := range config.Subsystems {
+		levels[subsystem] = level
+	}
+
+	return levels, nil
+}
+
+// WithDefaultLevel returns a logger that drops lines below the level set for AllSubsystems in
+// Levels, for code logging without a subsystem. ForSubsystem replaces that level with its own.
+// The underlying logger should let every level through, filtering happens here.
+func WithDefaultLevel(logger Logger) Logger {
+	if leveled, ok := logger.(*leveledLogger); ok {
+		logger = leveled.logger
+	}
+
+	return &leveledLogger{logger: logger, level: Levels.fallback}
+}
+
+// ForSubsystem returns a logger tagged with the subsystem that drops lines below its level in Levels.
+// The underlying logger should let every level through, filtering happens here.
+func ForSubsystem(logger Logger, subsystem string) Logger {
+	level, exists := Levels.levels[subsystem]
+	if !exists {
+
+		return logger
+	}
+	if leveled, ok := logger.(*leveledLogger); ok {
+		logger = leveled.logger
+	}
+
+	return &leveledLogger{
+		logger: logger.WithFields(Fields{"subsystem": subsystem}),
+		level:  level,
+	}
+}
+
+type leveledLogger struct {
+	logger Logger
+	level  *atomic.Uint32
+}
+
+func (l *leveledLogger) enabled(level logrus.Level) bool {
+	return level <= logrus.Level(l.level.Load())
+}
+
+func (l *leveledLogger) Info(args ...interface{}) {
+	if l.enabled(logrus.InfoLevel) {
+		l.logger.Info(args...)
+	}
+}
+
+func (l *leveledLogger) Infof(format string, args ...interface{}) {
+	if l.enabled(logrus.InfoLevel) {
+		l.logger.Infof(format, args...)
+	}
+}
+
+func (l *leveledLogger) Error(args ...interface{}) {
+	if l.enabled(logrus.ErrorLevel) {
+		l.logger.Error(args...)
+	}
+}
+
+func (l *leveledLogger) Errorf(format string, args ...interface{}) {
+	if l.enabled(logrus.ErrorLevel) {
+		l.logger.Errorf(format, args...)
+	}
+}
+
+func (l *leveledLogger) Debug(args ...interface{}) {
+	if l.enabled(logrus.DebugLevel) {
+		l.logger.Debug(args...)
+	}
+}
+
+func (l *leveledLogger) WithFields(fields Fields) Logger {
+	return &leveledLogger{logger: l.logger.WithFields(fields), level: l.level}
+}
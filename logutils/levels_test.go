@@ -0,0 +1,121 @@
+package logutils_test
+
+import (
+	"bytes"
+	"helm-api/logutils"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLevelSetApply(t *testing.T) {
+	levels := logutils.NewLevelSet(logrus.InfoLevel)
+
+	require.NoError(t, levels.Apply(map[string]string{
+		logutils.AllSubsystems: "warn",
+		logutils.SubsystemHelm: "debug",
+	}))
+	assert.Equal(t, map[string]string{
+		"http":   "warning",
+		"helm":   "debug",
+		"aws":    "warning",
+		"reaper": "warning",
+		"grpc":   "warning",
+		"leases": "warning",
+		"server": "warning",
+		// Loggers without a subsystem follow the level set for all of them.
+		"default": "warning",
+	}, levels.Get())
+
+	// The default entry sets every level, as in a level file.
+	require.NoError(t, levels.Set(logutils.DefaultLevel, "error"))
+	assert.Equal(t, "error", levels.Get()[logutils.DefaultLevel])
+	assert.Equal(t, "error", levels.Get()["helm"])
+	require.NoError(t, levels.Apply(map[string]string{
+		logutils.AllSubsystems: "warn",
+		logutils.SubsystemHelm: "debug",
+	}))
+
+	// Invalid entries leave every level untouched.
+	assert.Error(t, levels.Apply(map[string]string{logutils.SubsystemHTTP: "error", "db": "info"}))
+	assert.Error(t, levels.Set(logutils.SubsystemHTTP, "loud"))
+	assert.Equal(t, "warning", levels.Get()["http"])
+}
+
+func TestForSubsystem(t *testing.T) {
+	defer logutils.Levels.Set(logutils.AllSubsystems, "info")
+
+	var buf bytes.Buffer
+	base := logrus.New()
+	base.SetOutput(&buf)
+	base.SetLevel(logrus.DebugLevel)
+
+	helm := logutils.ForSubsystem(logutils.NewLogrus(base), logutils.SubsystemHelm).WithFields(logutils.Fields{"env": "demo"})
+	http := logutils.ForSubsystem(logutils.NewLogrus(base), logutils.SubsystemHTTP)
+
+	require.NoError(t, logutils.Levels.Set(logutils.AllSubsystems, "info"))
+	helm.Debug("manifest")
+	assert.Empty(t, buf.String())
+
+	// Loggers created before the change pick up the new level.
+	require.NoError(t, logutils.Levels.Set(logutils.SubsystemHelm, "debug"))
+	helm.Debug("manifest")
+	assert.Contains(t, buf.String(), "subsystem=helm")
+	assert.Contains(t, buf.String(), "env=demo")
+
+	buf.Reset()
+	http.Debug("request")
+	assert.Empty(t, buf.String())
+
+	require.NoError(t, logutils.Levels.Set(logutils.SubsystemHTTP, "error"))
+	http.Info("request")
+	assert.Empty(t, buf.String())
+	http.Error("failed")
+	assert.Contains(t, buf.String(), "subsystem=http")
+}
+
+func TestWithDefaultLevel(t *testing.T) {
+	defer logutils.Levels.Set(logutils.AllSubsystems, "info")
+
+	var buf bytes.Buffer
+	base := logrus.New()
+	base.SetOutput(&buf)
+	base.SetLevel(logrus.DebugLevel)
+
+	logger := logutils.WithDefaultLevel(logutils.NewLogrus(base))
+	helm := logutils.ForSubsystem(logger, logutils.SubsystemHelm)
+
+	require.NoError(t, logutils.Levels.Set(logutils.AllSubsystems, "info"))
+	logger.WithFields(logutils.Fields{"pod": "demo-0"}).Debug("tunnel opened")
+	assert.Empty(t, buf.String())
+
+	// Subsystem loggers only follow their own level.
+	require.NoError(t, logutils.Levels.Set(logutils.SubsystemHelm, "debug"))
+	helm.Debug("manifest")
+	assert.Contains(t, buf.String(), "subsystem=helm")
+
+	buf.Reset()
+	require.NoError(t, logutils.Levels.Set(logutils.AllSubsystems, "debug"))
+	logger.Debug("tunnel opened")
+	assert.Contains(t, buf.String(), "tunnel opened")
+}
+
+func TestLoadLevels(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "levels.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("default: warn\nsubsystems:\n  helm: debug\n"), 0600))
+
+	levels, err := logutils.LoadLevels(path)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{logutils.AllSubsystems: "warn", logutils.SubsystemHelm: "debug"}, levels)
+
+	require.NoError(t, os.WriteFile(path, []byte("level: debug\n"), 0600))
+	_, err = logutils.LoadLevels(path)
+	assert.Error(t, err)
+
+	_, err = logutils.LoadLevels(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,154 @@
+package logutils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// FormatText writes human readable log lines.
+	FormatText = "text"
+	// FormatJSON writes one JSON object per log line.
+	FormatJSON = "json"
+)
+
+// Fields are key/value pairs attached to every line written by a logger.
+type Fields map[string]interface{}
+
+// Logger is a leveled logger that can carry structured fields.
+type Logger interface {
+	Info(args ...interface{})
+	Infof(format string, args ...interface{})
+	Error(args ...interface{})
+	Errorf(format string, args ...interface{})
+	Debug(args ...interface{})
+	WithFields(fields Fields) Logger
+}
+
+// SetFormat switches a logrus logger between text and JSON output.
+func SetFormat(logger *logrus.Logger, format string) error {
+	switch format {
+	case "", FormatText:
+		logger.SetFormatter(&logrus.TextFormatter{
+			FullTimestamp: true,
+		})
+	case FormatJSON:
+		logger.SetFormatter(&logrus.JSONFormatter{})
+	default:
+
+		return fmt.Errorf("unknown log format %q", format)
+	}
+
+	return nil
+}
+
+type logrusLogger struct {
+	*logrus.Entry
+}
+
+// NewLogrus adapts a logrus logger to the Logger interface.
+func NewLogrus(logger *logrus.Logger) Logger {
+	return &logrusLogger{Entry: logrus.NewEntry(logger)}
+}
+
+func (l *logrusLogger) WithFields(fields Fields) Logger {
+	return &logrusLogger{Entry: l.Entry.WithFields(logrus.Fields(fields))}
+}
+
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+// NewSlog adapts a log/slog logger to the Logger interface.
+func NewSlog(logger *slog.Logger) Logger {
+	return &slogLogger{logger: logger}
+}
+
+// NewSlogHandler returns a slog handler writing text or JSON to w.
+func NewSlogHandler(w io.Writer, format string, level slog.Leveler) (slog.Handler, error) {
+	options := &slog.HandlerOptions{Level: level}
+
+	switch format {
+	case "", FormatText:
+
+		return slog.NewTextHandler(w, options), nil
+	case FormatJSON:
+
+		return slog.NewJSONHandler(w, options), nil
+	}
+
+	return nil, fmt.Errorf("unknown log format %q", format)
+}
+
+func (l *slogLogger) Info(args ...interface{}) {
+	l.logger.Info(fmt.Sprint(args...))
+}
+
+func (l *slogLogger) Infof(format string, args ...interface{}) {
+	l.logger.Info(fmt.Sprintf(format, args...))
+}
+
+func (l *slogLogger) Error(args ...interface{}) {
+	l.logger.Error(fmt.Sprint(args...))
+}
+
+func (l *slogLogger) Errorf(format string, args ...interface{}) {
+	l.logger.Error(fmt.Sprintf(format, args...))
+}
+
+func (l *slogLogger) Debug(args ...interface{}) {
+	// Skip formatting large values such as manifests when debug is off.
+	if !l.logger.Enabled(context.Background(), slog.LevelDebug) {
+
+		return
+	}
+	l.logger.Debug(fmt.Sprint(args...))
+}
+
+func (l *slogLogger) WithFields(fields Fields) Logger {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	attrs := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		attrs = append(attrs, slog.Any(key, fields[key]))
+	}
+
+	return &slogLogger{logger: l.logger.With(attrs...)}
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the logger.
+func NewContext(ctx context.Context, logger Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the logger carried by ctx, or fallback when there is none.
+func FromContext(ctx context.Context, fallback Logger) Logger {
+	if logger, ok := ctx.Value(contextKey{}).(Logger); ok {
+
+		return logger
+	}
+
+	return fallback
+}
+
+// With adds fields to the logger carried by ctx. Contexts without a logger are returned unchanged.
+func With(ctx context.Context, fields Fields) context.Context {
+	logger, ok := ctx.Value(contextKey{}).(Logger)
+	if !ok {
+
+		return ctx
+	}
+
+	return NewContext(ctx, logger.WithFields(fields))
+}
@@ -0,0 +1,71 @@
+package logutils_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"helm-api/logutils"
+	"log/slog"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogrusJSONFields(t *testing.T) {
+	var buf bytes.Buffer
+	base := logrus.New()
+	base.SetOutput(&buf)
+	require.NoError(t, logutils.SetFormat(base, logutils.FormatJSON))
+
+	logger := logutils.NewLogrus(base).WithFields(logutils.Fields{"request_id": "abc"})
+	logger.WithFields(logutils.Fields{"env": "demo"}).Infof("installed %s", "demo")
+
+	var line map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	assert.Equal(t, "installed demo", line["msg"])
+	assert.Equal(t, "abc", line["request_id"])
+	assert.Equal(t, "demo", line["env"])
+}
+
+func TestSetFormatUnknown(t *testing.T) {
+	assert.Error(t, logutils.SetFormat(logrus.New(), "xml"))
+}
+
+func TestSlogJSONFields(t *testing.T) {
+	var buf bytes.Buffer
+	handler, err := logutils.NewSlogHandler(&buf, logutils.FormatJSON, slog.LevelInfo)
+	require.NoError(t, err)
+
+	logger := logutils.NewSlog(slog.New(handler)).WithFields(logutils.Fields{"env": "demo", "actor": "qa"})
+	logger.Debug("hidden")
+	logger.Errorf("failed: %v", "boom")
+
+	var line map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	assert.Equal(t, "failed: boom", line["msg"])
+	assert.Equal(t, "ERROR", line["level"])
+	assert.Equal(t, "demo", line["env"])
+	assert.Equal(t, "qa", line["actor"])
+}
+
+func TestContext(t *testing.T) {
+	var buf bytes.Buffer
+	base := logrus.New()
+	base.SetOutput(&buf)
+	require.NoError(t, logutils.SetFormat(base, logutils.FormatJSON))
+	fallback := logutils.NewLogrus(base)
+
+	// Without a logger in the context, fields can't be added and the fallback is used.
+	ctx := logutils.With(context.Background(), logutils.Fields{"env": "demo"})
+	assert.Equal(t, fallback, logutils.FromContext(ctx, fallback))
+
+	ctx = logutils.NewContext(context.Background(), fallback)
+	ctx = logutils.With(ctx, logutils.Fields{"env": "demo"})
+	logutils.FromContext(ctx, nil).Info("hello")
+
+	var line map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	assert.Equal(t, "demo", line["env"])
+}
@@ -0,0 +1,70 @@
+package logutils
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// IdentityFunc resolves the actor and key ID of a request.
+type IdentityFunc func(r *http.Request) (actor, keyID string)
+
+// Middleware attaches a request-scoped logger to the request context and logs every
+// completed request under the http subsystem. The context logger isn't bound to a subsystem,
+// code logging through it picks its own with ForSubsystem. It expects chi's RequestID
+// middleware to run first.
+func Middleware(logger Logger, identity IdentityFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			fields := Fields{
+				"method": r.Method,
+				"path":   r.URL.Path,
+			}
+			if requestID := middleware.GetReqID(r.Context()); requestID != "" {
+				fields["request_id"] = requestID
+				w.Header().Set(middleware.RequestIDHeader, requestID)
+			}
+			if spanContext := trace.SpanContextFromContext(r.Context()); spanContext.HasTraceID() {
+				fields["trace_id"] = spanContext.TraceID().String()
+			}
+			if identity != nil {
+				actor, keyID := identity(r)
+				fields["actor"] = actor
+				if keyID != "" {
+					fields["key_id"] = keyID
+				}
+			}
+
+			requestLogger := logger.WithFields(fields)
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r.WithContext(NewContext(r.Context(), requestLogger)))
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			completed := Fields{
+				"status":      status,
+				"bytes":       ww.BytesWritten(),
+				"duration_ms": time.Since(start).Milliseconds(),
+			}
+			if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+				completed["route"] = rctx.RoutePattern()
+			}
+
+			httpLogger := ForSubsystem(requestLogger, SubsystemHTTP).WithFields(completed)
+			if status >= http.StatusInternalServerError {
+				httpLogger.Error("Request failed")
+
+				return
+			}
+			httpLogger.Info("Request completed")
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package logutils_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"helm-api/logutils"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	base := logrus.New()
+	base.SetOutput(&buf)
+	require.NoError(t, logutils.SetFormat(base, logutils.FormatJSON))
+
+	identity := func(r *http.Request) (string, string) {
+		return "qa", "1234abcd"
+	}
+
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(logutils.Middleware(logutils.NewLogrus(base), identity))
+	r.Post("/delete-env/{chartName}", func(w http.ResponseWriter, r *http.Request) {
+		ctx := logutils.With(r.Context(), logutils.Fields{"env": chi.URLParam(r, "chartName")})
+		logutils.FromContext(ctx, nil).Info("deleting")
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/delete-env/demo", nil)
+	req.Header.Set(middleware.RequestIDHeader, "req-1")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	assert.Equal(t, "req-1", rec.Header().Get(middleware.RequestIDHeader))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+
+	var handler, completed map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &handler))
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &completed))
+
+	assert.Equal(t, "deleting", handler["msg"])
+	assert.Equal(t, "req-1", handler["request_id"])
+	assert.Equal(t, "qa", handler["actor"])
+	assert.Equal(t, "1234abcd", handler["key_id"])
+	assert.Equal(t, "demo", handler["env"])
+
+	assert.Equal(t, "Request failed", completed["msg"])
+	assert.Equal(t, "error", completed["level"])
+	assert.Equal(t, float64(http.StatusInternalServerError), completed["status"])
+	assert.Equal(t, "/delete-env/{chartName}", completed["route"])
+	assert.Equal(t, "req-1", completed["request_id"])
+}
@@ -0,0 +1,62 @@
+package logutils
+
+import (
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+const redacted = "[REDACTED]"
+
+// RedactManifest masks the data of Secret objects in a rendered multi-document manifest
+// so it can be logged. Other documents and the "# Source:" comments are kept as they are.
+func RedactManifest(manifest string) string {
+	docs := strings.Split(manifest, "\n---")
+	for i, doc := range docs {
+		docs[i] = redactDocument(doc)
+	}
+
+	return strings.Join(docs, "\n---")
+}
+
+func redactDocument(doc string) string {
+	var object map[string]interface{}
+	if err := yaml.Unmarshal([]byte(doc), &object); err != nil {
+
+		// Unparseable documents can't be checked, so none of their content is kept.
+		return "\n" + redacted
+	}
+
+	if object["kind"] != "Secret" {
+
+		return doc
+	}
+
+	for _, field := range []string{"data", "stringData"} {
+		values, ok := object[field].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for key := range values {
+			values[key] = redacted
+		}
+	}
+
+	data, err := yaml.Marshal(object)
+	if err != nil {
+
+		return "\n" + redacted
+	}
+
+	// Keep the document separator and comment header (e.g. "# Source: chart/templates/secret.yaml").
+	var header []string
+	for _, line := range strings.Split(doc, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed != "" && trimmed != "---" && !strings.HasPrefix(trimmed, "#") {
+			break
+		}
+		header = append(header, line)
+	}
+
+	return strings.Join(append(header, string(data)), "\n")
+}
@@ -0,0 +1,46 @@
+package logutils_test
+
+import (
+	"helm-api/logutils"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactManifest(t *testing.T) {
+	manifest := `---
+# Source: app/templates/secret.yaml
+apiVersion: v1
+kind: Secret
+metadata:
+  name: app
+data:
+  password: c2VjcmV0
+stringData:
+  token: plain-token
+---
+# Source: app/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app
+data:
+  mode: dev
+`
+
+	redacted := logutils.RedactManifest(manifest)
+
+	assert.NotContains(t, redacted, "c2VjcmV0")
+	assert.NotContains(t, redacted, "plain-token")
+	assert.Contains(t, redacted, "password: '[REDACTED]'")
+	assert.Contains(t, redacted, "# Source: app/templates/secret.yaml")
+	assert.Contains(t, redacted, "name: app")
+	// Non-secret documents are kept verbatim.
+	assert.Contains(t, redacted, "# Source: app/templates/configmap.yaml\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: app\ndata:\n  mode: dev\n")
+}
+
+func TestRedactManifestInvalid(t *testing.T) {
+	redacted := logutils.RedactManifest("kind: Secret\ndata: [unterminated")
+
+	assert.NotContains(t, redacted, "unterminated")
+}
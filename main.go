@@ -2,102 +2,273 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"helm-api/apiutils"
+	"helm-api/auditutils"
 	"helm-api/awsutils"
+	"helm-api/client"
 	"helm-api/defaults"
+	"helm-api/envservice"
+	"helm-api/grpcutils"
+	"helm-api/healthutils"
 	"helm-api/helmutils"
+	"helm-api/idempotencyutils"
+	"helm-api/kubeutils"
+	"helm-api/leaseutils"
+	"helm-api/logutils"
+	"helm-api/metricsutils"
+	"helm-api/openapiutils"
+	"helm-api/problemutils"
+	"helm-api/quotautils"
+	"helm-api/sqlutils"
+	"helm-api/tracingutils"
+	"helm-api/tunnelutils"
+	"helm-api/utils"
+	"io"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
+	_ "github.com/go-sql-driver/mysql"
 	"github.com/sirupsen/logrus"
-	"helm.sh/helm/v3/pkg/chart"
+	"k8s.io/client-go/kubernetes"
 )
 
-// Response represents a standard API response.
-type Response struct {
-	Message string   `json:"message"`
-	Error   string   `json:"error,omitempty"`
-	Data    []string `json:"data,omitempty"`
-}
-
-type ScaleAction string
+// The API payloads are defined in the client package, which is shared with API consumers.
+type (
+	Response        = client.Response
+	LogLevelRequest = client.LogLevelRequest
+	QueryRequest    = client.QueryRequest
+	ScaleAction     = client.ScaleAction
+	Request         = client.Request
+	EnvStatus       = client.EnvStatus
+)
 
 const (
-	ScaleUp   ScaleAction = "up"
-	ScaleDown ScaleAction = "down"
+	ScaleUp   = client.ScaleUp
+	ScaleDown = client.ScaleDown
 )
 
-type Request struct {
-	ChartMetadata chart.Metadata `json:"chartMetadata"`
-	Action        *ScaleAction   `json:"action,omitempty"`
-}
-
 func main() {
-	// Initialize a custom logger (e.g., JSONFormatter)
+	// helm-api connect <env> runs the tunnel client instead of the server
+	if len(os.Args) > 1 && os.Args[1] == "connect" {
+		if err := runConnect(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "connect: %v\n", err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	// Initialize a custom logger, HELM_API_LOG_FORMAT=json switches to JSON lines
 	customLogger := logrus.New()
-	customLogger.SetFormatter(&logrus.TextFormatter{
-		FullTimestamp: true,
-	})
-	customLogger.SetLevel(logrus.InfoLevel)
+	if err := logutils.SetFormat(customLogger, os.Getenv("HELM_API_LOG_FORMAT")); err != nil {
+		customLogger.Fatalf("Configuring logger failed: %v", err)
+	}
+	// Levels are applied per subsystem (HELM_API_LOG_LEVEL, HELM_API_LOG_LEVEL_FILE, PUT /admin/log-level)
+	customLogger.SetLevel(logrus.DebugLevel)
+	if err := loadLogLevels(); err != nil {
+		customLogger.Fatalf("Configuring log levels failed: %v", err)
+	}
 
-	if os.Getenv("HELM_API_AWS") == "true" {
+	// Structured logger handed to the Helm client and request handlers
+	logger, err := newLogger(customLogger)
+	if err != nil {
+		customLogger.Fatalf("Configuring logger failed: %v", err)
+	}
+	// Lines logged without a subsystem, such as the tunnel logs, follow the default level
+	logger = logutils.WithDefaultLevel(logger)
+	// Startup and shutdown lines
+	serverLogger := logutils.ForSubsystem(logger, logutils.SubsystemServer)
+	awsLogger := logutils.ForSubsystem(logger, logutils.SubsystemAWS)
+
+	// Background jobs stop when main returns.
+	ctxRefresh, cancelRefresh := context.WithCancel(context.Background())
+	defer cancelRefresh()
+
+	// Load the API keys from the configured secret source.
+	keySource, err := newKeySource(awsLogger)
+	if err != nil {
+		fatalf(serverLogger, "Configuring secret source failed: %v", err)
+	}
 
-		// Create a root context with a timeout for the entire application run.
+	if keySource != nil {
 		ctxTimeOut, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 		defer cancel()
 
-		// Initialize AWS clients.
-		configLoader := &awsutils.RealAWSConfigLoader{}
-		clients, err := awsutils.InitializeAWSClients(ctxTimeOut, configLoader, defaults.AwsRegion)
+		keys, err := keySource.Fetch(ctxTimeOut)
 		if err != nil {
-			customLogger.Fatalf("AWS auth error: %v", err)
+			fatalf(serverLogger, "Setting master API keys failed: %v", err)
 		}
-		customLogger.Info("AWS client initialized successfully")
 
-		// Setting API keys
-		if err = awsutils.GetSSMParameters(ctxTimeOut, clients.SSM, defaults.SsmParams); err != nil {
-			customLogger.Fatalf("Setting master API keys failed: %v", err)
+		// Once loaded, the key store no longer reads the environment, so rotated keys don't stay valid.
+		apiutils.Keys.Rotate(keys, 0)
+
+		// Keep the API keys in sync with the source so rotations don't need a restart.
+		refresher := &apiutils.Refresher{
+			Source:   keySource,
+			Store:    apiutils.Keys,
+			Interval: durationFromEnv(serverLogger, "HELM_API_KEY_REFRESH_INTERVAL", defaults.KeyRefreshInterval),
+			Grace:    durationFromEnv(serverLogger, "HELM_API_KEY_GRACE_PERIOD", defaults.KeyGracePeriod),
+			Timeout:  30 * time.Second,
+			Logger:   awsLogger,
 		}
 
+		go refresher.Run(ctxRefresh)
+	}
+
+	// Every required scope needs a key, keys bound to a team count for their scope.
+	if err := apiutils.Keys.Require(apiutils.RequiredKeyNames...); err != nil {
+		fatalf(serverLogger, "Validating master API keys failed: %v", err)
+	}
+
+	// Initialize tracing, spans are only exported when an OTLP endpoint is set
+	shutdownTracing, err := tracingutils.Setup(context.Background(), os.Getenv("HELM_API_OTLP_ENDPOINT"), "helm-api")
+	if err != nil {
+		fatalf(serverLogger, "Failed to initialize tracing: %v", err)
 	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			serverLogger.Errorf("Failed to flush traces: %v", err)
+		}
+	}()
 
 	// Initialize the helm client
-	helmClient, err := helmutils.NewRealClient(customLogger)
+	helmClient, err := helmutils.NewRealClient(logger)
 	if err != nil {
-		customLogger.Fatalf("Failed to create Helm client: %v", err)
+		fatalf(serverLogger, "Failed to create Helm client: %v", err)
 	}
 
-	customLogger.Info("Helm client initialized successfully")
+	serverLogger.Info("Helm client initialized successfully")
 
-	r := chi.NewRouter()
+	// Report environments by status on every scrape
+	metricsutils.Registry.MustRegister(metricsutils.NewEnvironmentCollector(helmClient))
 
-	// Middleware
-	r.Use(middleware.Logger)
-	r.Use(middleware.Recoverer)
-	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{"*"},
-		AllowedMethods:   []string{"GET", "POST"},
-		AllowedHeaders:   []string{"Accept", "Content-Type"},
-		AllowCredentials: true,
-	}))
+	// Load quota policies
+	quotaConfig, err := quotautils.LoadConfig(os.Getenv("HELM_API_QUOTA_FILE"))
+	if err != nil {
+		fatalf(serverLogger, "Failed to load quota policies: %v", err)
+	}
 
-	//Validate API Key
-	r.Use(apiutils.AuthMiddleware)
+	// Kubernetes client used to read environment pods, logs and events
+	kubeClient, err := helmClient.ActionConfig.KubernetesClientSet()
+	if err != nil {
+		fatalf(serverLogger, "Failed to create Kubernetes client: %v", err)
+	}
 
-	// Routes
-	r.Post("/create-env", createEnvHandler(helmClient))
-	r.Post("/update-env/{chartName}", updateEnvHandler(helmClient))
-	r.Post("/delete-env/{chartName}", deleteEnvHandler(helmClient))
-	r.Get("/health-check", healthCheck)
-	r.Get("/list", listEnvHandler(helmClient))
+	inspector := &kubeutils.Inspector{
+		Client:    kubeClient,
+		Namespace: helmClient.Default.Namespace,
+	}
+
+	// Keep the charts of the environments in the store selected by HELM_API_CHART_STORE
+	charts, err := newChartStore(helmClient, kubeClient, awsLogger)
+	if err != nil {
+		fatalf(serverLogger, "Configuring chart store failed: %v", err)
+	}
+	if charts != nil {
+		helmClient.Charts = charts
+	}
+
+	// Port-forwards to environment pods go through the Kubernetes API
+	restConfig, err := helmClient.ActionConfig.RESTClientGetter.ToRESTConfig()
+	if err != nil {
+		fatalf(serverLogger, "Failed to read Kubernetes client config: %v", err)
+	}
+	forwarder := &tunnelutils.PortForwarder{
+		Config: restConfig,
+		Client: kubeClient,
+	}
+
+	quotas := &quotautils.Enforcer{
+		Config: quotaConfig,
+		Source: helmClient,
+	}
+
+	// Open the audit log
+	auditStore, err := auditutils.NewFileStore(utils.GetEnvOrValue("HELM_API_AUDIT_FILE", defaults.AuditFile))
+	if err != nil {
+		fatalf(serverLogger, "Failed to open audit log: %v", err)
+	}
+	defer auditStore.Close()
+
+	// Responses of the requests sent with an Idempotency-Key, kept in the memory of this replica
+	idempotency := idempotencyutils.NewStore(durationFromEnv(serverLogger, "HELM_API_IDEMPOTENCY_TTL", defaults.IdempotencyTTL))
+
+	envs := newEnvService(helmClient, quotas, inspector, forwarder)
+	r := newRouter(helmClient, envs, quotas, auditStore, idempotency, logger)
+
+	// Delete the environments whose TTL passed
+	reaper := &envservice.Reaper{
+		Envs:     envs,
+		Interval: durationFromEnv(serverLogger, "HELM_API_REAPER_INTERVAL", defaults.ReaperInterval),
+		Logger:   logutils.ForSubsystem(logger, logutils.SubsystemReaper),
+	}
+	jobs := []leaseutils.Job{reaper.Run}
+
+	// With HELM_API_LEASES=true the replicas share the environment locks and elect the one
+	// running the background jobs through Leases, instead of each replica on its own. A failed
+	// election shuts the replica down.
+	var electionDone chan struct{}
+	electionErrors := make(chan error, 1)
+	if os.Getenv("HELM_API_LEASES") == "true" {
+		identity, err := replicaIdentity()
+		if err != nil {
+			fatalf(serverLogger, "Failed to name the replica: %v", err)
+		}
+		leaseLogger := logutils.ForSubsystem(logger, logutils.SubsystemLeases)
+
+		helmClient.Locks = &leaseutils.Locker{
+			Client:      kubeClient,
+			Namespace:   helmClient.Default.Namespace,
+			Identity:    identity,
+			Wait:        helmClient.Default.LockWait,
+			Duration:    defaults.LeaseDuration,
+			RetryPeriod: defaults.LeaseRetryPeriod,
+			Logger:      leaseLogger,
+		}
+
+		elector := &leaseutils.Elector{
+			Client:        kubeClient,
+			Namespace:     helmClient.Default.Namespace,
+			Identity:      identity,
+			Duration:      defaults.LeaseDuration,
+			RenewDeadline: defaults.LeaseRenewDeadline,
+			RetryPeriod:   defaults.LeaseRetryPeriod,
+			Logger:        leaseLogger,
+		}
+		electionDone = make(chan struct{})
+		go func() {
+			defer close(electionDone)
+			if err := elector.Run(ctxRefresh, jobs...); err != nil {
+				electionErrors <- err
+			}
+		}()
+		serverLogger.Infof("Replica %s coordinates through Leases in %s", identity, helmClient.Default.Namespace)
+	} else {
+		for _, job := range jobs {
+			go job(ctxRefresh)
+		}
+	}
+
+	// The gRPC API runs the same environment operations on its own port
+	grpcServer := grpcutils.NewServer(&grpcutils.Server{Envs: envs}, logger)
+	grpcPort := utils.GetEnvOrValue("HELM_API_GRPC_PORT", defaults.GRPCPort)
+	grpcListener, err := net.Listen("tcp", ":"+grpcPort)
+	if err != nil {
+		fatalf(serverLogger, "Failed to listen for gRPC on port %s: %v", grpcPort, err)
+	}
 
 	// Create server
 	port := os.Getenv("HELM_API_PORT")
@@ -110,113 +281,224 @@ func main() {
 		Handler: r,
 	}
 
-	// Channel to listen for errors coming from the listener.
-	serverErrors := make(chan error, 1)
+	// Channel to listen for errors coming from the listeners.
+	serverErrors := make(chan error, 2)
 
 	// Start the server
 	go func() {
-		customLogger.Printf("Server is starting on port %s...", port)
+		serverLogger.Infof("Server is starting on port %s...", port)
 		serverErrors <- server.ListenAndServe()
 	}()
 
+	go func() {
+		serverLogger.Infof("gRPC server is starting on port %s...", grpcPort)
+		serverErrors <- grpcServer.Serve(grpcListener)
+	}()
+
+	// Reload the log levels on SIGHUP.
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go func() {
+		for range reload {
+			if err := loadLogLevels(); err != nil {
+				serverLogger.Errorf("Reloading log levels failed: %v", err)
+
+				continue
+			}
+			serverLogger.Infof("Log levels reloaded: %v", logutils.Levels.Get())
+		}
+	}()
+
 	// Channel to listen for an interrupt or terminate signal from the OS.
 	shutdown := make(chan os.Signal, 1)
 	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
 
-	// Blocking select waiting for either server errors or context cancellation.
+	// Blocking select waiting for either server errors, a failed election or a signal.
+	var failed bool
 	select {
 	case err := <-serverErrors:
-		customLogger.Fatalf("Error starting server: %v", err)
+		fatalf(serverLogger, "Error starting server: %v", err)
+
+	case err := <-electionErrors:
+		serverLogger.Errorf("Leader election failed, start shutdown: %v", err)
+		failed = true
 
 	case sig := <-shutdown:
-		customLogger.Printf("Start shutdown... Signal: %v", sig)
+		serverLogger.Infof("Start shutdown... Signal: %v", sig)
+	}
 
-		// Give outstanding requests a deadline for completion.
-		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-		defer cancel()
+	// Give outstanding requests a deadline for completion.
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
 
-		// Shut down gracefully, but wait no longer than the context timeout.
-		err := server.Shutdown(ctx)
-		if err != nil {
-			customLogger.Printf("Graceful shutdown did not complete in %v : %v", 15*time.Second, err)
-			err = server.Close()
-			if err != nil {
-				customLogger.Printf("Error killing server : %v", err)
-			}
+	// Watch streams only end with their callers, so cut them off at the same deadline.
+	grpcStopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(grpcStopped)
+	}()
+	go func() {
+		select {
+		case <-grpcStopped:
+		case <-ctx.Done():
+			grpcServer.Stop()
 		}
+	}()
 
-		// Exit with status code 1 if there was an error shutting down
+	// Shut down gracefully, but wait no longer than the context timeout.
+	err = server.Shutdown(ctx)
+
+	// Step down so another replica takes over the background jobs right away.
+	cancelRefresh()
+	if electionDone != nil {
+		select {
+		case <-electionDone:
+		case <-ctx.Done():
+		}
+	}
+	if err != nil {
+		serverLogger.Infof("Graceful shutdown did not complete in %v : %v", 15*time.Second, err)
+		err = server.Close()
 		if err != nil {
-			os.Exit(1)
+			serverLogger.Infof("Error killing server : %v", err)
 		}
 	}
 
+	// Exit with status code 1 if there was an error shutting down or electing
+	if err != nil || failed {
+		os.Exit(1)
+	}
+
+}
+
+// fatalf logs the failure and exits with status 1, as logrus' Fatalf does.
+func fatalf(logger logutils.Logger, format string, args ...interface{}) {
+	logger.Errorf(format, args...)
+	os.Exit(1)
+}
+
+// replicaIdentity names this replica in the Leases, HELM_API_POD_NAME or the hostname, which
+// is the pod name in Kubernetes.
+func replicaIdentity() (string, error) {
+	if name := os.Getenv("HELM_API_POD_NAME"); name != "" {
+
+		return name, nil
+	}
+
+	return os.Hostname()
+}
+
+// newRouter wires the middleware and the routes of the API.
+func newRouter(helmClient *helmutils.RealClient, envs *envservice.Service, quotas *quotautils.Enforcer, auditStore auditutils.Store, idempotency *idempotencyutils.Store, logger logutils.Logger) chi.Router {
+	r := chi.NewRouter()
+
+	// Middleware
+	r.Use(tracingutils.Middleware)
+	r.Use(metricsutils.Middleware)
+	r.Use(middleware.RequestID)
+	r.Use(logutils.Middleware(logger, auditIdentity))
+	r.Use(middleware.Recoverer)
+	r.Use(cors.Handler(cors.Options{
+		AllowedOrigins:   []string{"*"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+		AllowedHeaders:   []string{"Accept", "Content-Type", "traceparent", "tracestate", middleware.RequestIDHeader, idempotencyutils.Header},
+		ExposedHeaders:   []string{middleware.RequestIDHeader, idempotencyutils.ReplayedHeader},
+		AllowCredentials: true,
+	}))
+
+	// Record mutating calls, including rejected ones
+	r.Use(auditutils.Middleware(auditStore, auditIdentity, logutils.ForSubsystem(logger, logutils.SubsystemHTTP)))
+
+	//Validate API Key
+	r.Use(apiutils.AuthMiddleware)
+
+	// Retries of the environment changes sent with the same Idempotency-Key get the first response
+	idempotent := idempotencyutils.Middleware(idempotency, idempotencyScope)
+
+	// Routes
+	r.With(idempotent).Post("/create-env", createEnvHandler(envs))
+	r.With(idempotent).Post("/update-env/{chartName}", updateEnvHandler(envs))
+	r.With(idempotent).Post("/delete-env/{chartName}", deleteEnvHandler(envs))
+	r.Get("/livez", healthCheck)
+	r.Get("/readyz", readyzHandler(helmClient.ReadinessChecks()))
+	// Kept for clients probing the old endpoint
+	r.Get("/health-check", healthCheck)
+	r.Get("/list", listEnvHandler(envs))
+	r.Get("/envs/{name}", envStatusHandler(envs))
+	r.Get("/envs/{name}/logs", envLogsHandler(envs, logger))
+	r.Get("/envs/{name}/events", envEventsHandler(envs))
+	r.Post("/envs/{name}/render", envRenderHandler(envs))
+	r.Post("/envs/{name}/query", envQueryHandler(envs))
+	r.Post("/envs/{name}/connect", envConnectHandler(envs, logger))
+	r.Get("/quotas", quotaHandler(quotas))
+	r.Get("/audit", auditHandler(auditStore))
+	r.Method(http.MethodGet, "/metrics", metricsutils.Handler())
+	r.Get("/admin/log-level", getLogLevelHandler)
+	r.Put("/admin/log-level", setLogLevelHandler)
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		problemutils.Write(w, r, problemutils.New(problemutils.CodeNotFound, "Route not found", fmt.Errorf("no route %s", r.URL.Path)))
+	})
+	r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		problemutils.Write(w, r, problemutils.New(problemutils.CodeMethodNotAllowed, "Method not allowed", fmt.Errorf("%s isn't supported by %s", r.Method, r.URL.Path)))
+	})
+	r.Route("/v1", func(r chi.Router) {
+		r.With(idempotent).Post("/envs", v1CreateEnvHandler(envs))
+		r.Get("/envs", v1ListEnvsHandler(envs))
+		r.Get("/envs/{name}", envStatusHandler(envs))
+		r.With(idempotent).Patch("/envs/{name}", v1UpdateEnvHandler(envs))
+		r.With(idempotent).Delete("/envs/{name}", v1DeleteEnvHandler(envs))
+		r.With(idempotent).Post("/envs/{name}:scale", v1ScaleEnvHandler(envs))
+	})
+	r.Get(openAPIPath, openapiutils.Handler(openAPIDocument()))
+	r.Get(docsPath, openapiutils.DocsHandler(openAPIPath, docsPath))
+	r.Method(http.MethodGet, docsAssetsPath, openapiutils.AssetsHandler(docsPath))
+
+	return r
+}
+
+// newEnvService returns the environment operations served by the HTTP and gRPC APIs.
+func newEnvService(helmClient *helmutils.RealClient, quotas *quotautils.Enforcer, inspector *kubeutils.Inspector, forwarder tunnelutils.Forwarder) *envservice.Service {
+	return &envservice.Service{
+		Helm:      helmClient,
+		Quotas:    quotas,
+		Inspector: inspector,
+		Databases: &sqlutils.Resolver{Client: inspector.Client, Namespace: inspector.Namespace},
+		Forwarder: forwarder,
+		Namespace: inspector.Namespace,
+	}
 }
 
 // createEnvHandler handles the creation of Helm chart resources.
-func createEnvHandler(hc *helmutils.RealClient) http.HandlerFunc {
+func createEnvHandler(envs envservice.EnvironmentService) http.HandlerFunc {
 
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		var req Request
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			resp := Response{
-				Message: "Invalid request payload",
-				Error:   err.Error(),
-			}
-			w.WriteHeader(http.StatusBadRequest)
-			if err := json.NewEncoder(w).Encode(resp); err != nil {
-				http.Error(w, "Failed to encode response", http.StatusInternalServerError)
-
-				return
-			}
+			problemutils.Write(w, r, problemutils.New(problemutils.CodeValidationFailed, "Invalid request payload", err))
 
 			return
 		}
 
-		// Validate the input.
-		if req.ChartMetadata.Name == "" {
-			http.Error(w, "Missing required fields in request", http.StatusBadRequest)
+		// Tag the request logs with the environment.
+		ctx := logutils.With(r.Context(), logutils.Fields{"env": req.ChartMetadata.Name})
 
-			return
+		spec, err := createSpec(r, req)
+		var result *envservice.Result
+		if err == nil {
+			result, err = envs.Create(ctx, spec)
 		}
-
-		// Call CreateHelmChartFromSource.
-		chartPath, err := hc.CreateHelmChartFromSource(req.ChartMetadata)
 		if err != nil {
-			resp := Response{
-				Message: "Failed to create Helm chart",
-				Error:   err.Error(),
-			}
-			w.WriteHeader(http.StatusInternalServerError)
-			if err := json.NewEncoder(w).Encode(resp); err != nil {
-				http.Error(w, "Failed to encode response", http.StatusInternalServerError)
-
-				return
-			}
+			problemutils.Write(w, r, envProblem(err))
 
 			return
 		}
 
-		_, err = hc.InstallRelease(chartPath, req.ChartMetadata.Name)
-		if err != nil {
-			resp := Response{
-				Message: "Failed to install Helm chart",
-				Error:   err.Error(),
-			}
-			w.WriteHeader(http.StatusInternalServerError)
-			if err := json.NewEncoder(w).Encode(resp); err != nil {
-				http.Error(w, "Failed to encode response", http.StatusInternalServerError)
-
-				return
-			}
-
-			return
-		}
+		auditutils.SetRevision(r.Context(), result.Revision)
 
 		// Success response.
 		resp := Response{
-			Message: fmt.Sprintf("Helm chart %s created and successfully installed %s", req.ChartMetadata.Name, hc.Default.OutputDir),
+			Message: fmt.Sprintf("Helm chart %s created and successfully installed", req.ChartMetadata.Name),
 		}
 
 		w.WriteHeader(http.StatusCreated)
@@ -228,98 +510,71 @@ func createEnvHandler(hc *helmutils.RealClient) http.HandlerFunc {
 	}
 }
 
-// createEnvHandler handles the creation of Helm chart resources.
-func updateEnvHandler(hc *helmutils.RealClient) http.HandlerFunc {
+// updateEnvHandler scales an environment or merges values into it, then upgrades it.
+func updateEnvHandler(envs envservice.EnvironmentService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		chartName := chi.URLParam(r, "chartName")
 
 		// Validate the input
 		if chartName == "" {
-			http.Error(w, "Missing required fields in request", http.StatusBadRequest)
+			problemutils.Write(w, r, problemutils.New(problemutils.CodeValidationFailed, "Missing required fields in request", errors.New("chartName is required")))
 
 			return
 		}
 
-		releaseName := defaults.EnvPrefix + chartName
+		ctx := logutils.With(r.Context(), logutils.Fields{"env": chartName})
 
-		// Check if helm-chart exists
-		if _, err := os.Stat(hc.Default.OutputDir + "/" + releaseName); os.IsNotExist(err) {
-			http.Error(w, "env doesn't exists,please use creata-env endpoint for brand new env", http.StatusBadRequest)
+		var req Request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			problemutils.Write(w, r, problemutils.New(problemutils.CodeValidationFailed, "Invalid request payload", err))
 
 			return
 		}
 
-		var req Request
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			resp := Response{
-				Message: "Invalid request payload",
-				Error:   err.Error(),
-			}
-			w.WriteHeader(http.StatusBadRequest)
-			if err := json.NewEncoder(w).Encode(resp); err != nil {
-				http.Error(w, "Failed to encode response", http.StatusInternalServerError)
-
-				return
+		if req.Action == nil && len(req.Values) == 0 {
+			// Nothing to change, but the route still refuses environments that don't exist.
+			if _, err := envs.Get(ctx, chartName); err != nil {
+				problemutils.Write(w, r, envProblem(err))
 			}
 
 			return
 		}
 
+		// Requested values, with the replica count of a scale action on top.
+		values := map[string]interface{}{}
+		for key, value := range req.Values {
+			values[key] = value
+		}
 		if req.Action != nil {
-			replicas := map[ScaleAction]int{
-				ScaleUp:   1,
-				ScaleDown: 0,
-			}
-
-			if count, exists := replicas[*req.Action]; exists {
-				if err := hc.UpdateValuesFile(releaseName, count); err != nil {
-					resp := Response{
-						Message: "Updating values.yaml failed",
-						Error:   err.Error(),
-					}
-					w.WriteHeader(http.StatusInternalServerError)
-					if err := json.NewEncoder(w).Encode(resp); err != nil {
-						http.Error(w, "Failed to encode response", http.StatusInternalServerError)
-
-						return
-					}
-
-					return
-				}
-
+			if count, exists := envservice.Replicas(*req.Action); exists {
+				values["replicas"] = count
 			}
+		}
 
-			_, err := hc.UpgradeRelease(releaseName)
-			if err != nil {
-				resp := Response{
-					Message: "Failed to update Helm chart",
-					Error:   err.Error(),
-				}
-				w.WriteHeader(http.StatusInternalServerError)
-				if err := json.NewEncoder(w).Encode(resp); err != nil {
-					http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		result, err := envs.Update(ctx, chartName, values)
+		if err != nil {
+			problemutils.Write(w, r, envProblem(err))
 
-					return
-				}
+			return
+		}
 
-				return
-			}
+		auditutils.SetRevision(r.Context(), result.Revision)
 
-			// Success response.
-			resp := Response{
-				Message: fmt.Sprintf("Helm chart %s successfully updated %s", req.ChartMetadata.Name, hc.Default.OutputDir),
-			}
+		// Success response.
+		resp := Response{
+			Message: fmt.Sprintf("Helm chart %s successfully updated", chartName),
+		}
 
-			w.WriteHeader(http.StatusOK)
-			if err := json.NewEncoder(w).Encode(resp); err != nil {
-				http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
 
-				return
-			}
+			return
 		}
 	}
 }
 
+// healthCheck reports that the process is serving requests. Dependencies are checked by readyzHandler.
 func healthCheck(w http.ResponseWriter, r *http.Request) {
 	resp := Response{
 		Message: "API is healthy",
@@ -332,37 +587,67 @@ func healthCheck(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func deleteEnvHandler(hc *helmutils.RealClient) http.HandlerFunc {
+// readyzHandler reports whether the API can serve requests, with the outcome of every check.
+func readyzHandler(checks []healthutils.Check) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		report := healthutils.Run(r.Context(), checks, defaults.ReadinessTimeout)
+		if !report.Healthy() {
+			resp := Response{
+				Message: "API is not ready",
+				Error:   "one or more readiness checks failed",
+				Health:  report,
+			}
+			w.WriteHeader(http.StatusServiceUnavailable)
+			if err := json.NewEncoder(w).Encode(resp); err != nil {
+				http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+
+				return
+			}
+
+			return
+		}
+
+		resp := Response{
+			Message: "API is ready",
+			Health:  report,
+		}
+
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+
+			return
+		}
+	}
+}
+
+func deleteEnvHandler(envs envservice.EnvironmentService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		chartName := chi.URLParam(r, "chartName")
 
 		// Validate the input.
 		if chartName == "" {
-			http.Error(w, "Missing required fields in request", http.StatusBadRequest)
+			problemutils.Write(w, r, problemutils.New(problemutils.CodeValidationFailed, "Missing required fields in request", errors.New("chartName is required")))
 
 			return
 		}
 
-		releaseName := defaults.EnvPrefix + chartName
-		_, err := hc.UninstallRelease(releaseName)
-		if err != nil {
-			resp := Response{
-				Message: "Failed to uninstall Helm chart",
-				Error:   err.Error(),
-			}
-			w.WriteHeader(http.StatusInternalServerError)
-			if err := json.NewEncoder(w).Encode(resp); err != nil {
-				http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		ctx := logutils.With(r.Context(), logutils.Fields{"env": chartName})
 
-				return
-			}
+		result, err := envs.Delete(ctx, chartName)
+		if err != nil {
+			problemutils.Write(w, r, envProblem(err))
 
 			return
 		}
 
+		auditutils.SetRevision(r.Context(), result.Revision)
+
 		// Success response.
 		resp := Response{
-			Message: fmt.Sprintf("Helm chart %s successfully uninstalled", releaseName),
+			Message: fmt.Sprintf("Helm chart %s successfully uninstalled", result.Release),
 		}
 
 		w.WriteHeader(http.StatusOK)
@@ -375,31 +660,28 @@ func deleteEnvHandler(hc *helmutils.RealClient) http.HandlerFunc {
 	}
 }
 
-func listEnvHandler(hc *helmutils.RealClient) http.HandlerFunc {
+func listEnvHandler(envs envservice.EnvironmentService) http.HandlerFunc {
 
 	return func(w http.ResponseWriter, r *http.Request) {
 
-		chartList, err := hc.ListReleases()
+		names, err := envs.List(r.Context())
 		if err != nil {
-			resp := Response{
-				Message: "Failed to list helm chart with prefix helm-api-",
-				Error:   err.Error(),
-			}
-			w.WriteHeader(http.StatusInternalServerError)
-			if err := json.NewEncoder(w).Encode(resp); err != nil {
-				http.Error(w, "Failed to encode response", http.StatusInternalServerError)
-
-				return
-			}
+			problemutils.Write(w, r, problemutils.New(envservice.ErrorCode(err), "Failed to list helm chart with prefix helm-api-", err))
 
 			return
 		}
 
 		message := "No helm-api related helm chart"
-		if len(chartList) > 0 {
+		if len(names) > 0 {
 			message = "List:"
 		}
 
+		// This route has always listed the release names.
+		var chartList []string
+		for _, name := range names {
+			chartList = append(chartList, envservice.ReleaseName(name))
+		}
+
 		resp := Response{
 			Message: message,
 			Data:    chartList,
@@ -414,3 +696,592 @@ func listEnvHandler(hc *helmutils.RealClient) http.HandlerFunc {
 
 	}
 }
+
+// envStatusHandler reports the release status of an environment and how many of its pods are ready.
+func envStatusHandler(envs envservice.EnvironmentService) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		name := chi.URLParam(r, "name")
+
+		status, err := envs.Get(r.Context(), name)
+		if err != nil {
+			problemutils.Write(w, r, envProblem(err))
+
+			return
+		}
+
+		resp := Response{
+			Message: fmt.Sprintf("Environment %s is %s", name, status.Status),
+			Env:     status,
+		}
+
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+
+			return
+		}
+	}
+}
+
+// envLogsHandler streams the logs of an environment's pods as plain text, one line per log line
+// prefixed with the pod and container. With follow=true the response stays open.
+func envLogsHandler(envs envservice.EnvironmentInspector, logger logutils.Logger) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		query := r.URL.Query()
+		opts := kubeutils.LogOptions{
+			Container: query.Get("container"),
+		}
+
+		var err error
+		if value := query.Get("tailLines"); value != "" {
+			var lines int64
+			if lines, err = strconv.ParseInt(value, 10, 64); err == nil && lines < 0 {
+				err = fmt.Errorf("tailLines must not be negative")
+			}
+			opts.TailLines = &lines
+		}
+		if value := query.Get("since"); value != "" && err == nil {
+			opts.Since, err = time.ParseDuration(value)
+		}
+		if value := query.Get("follow"); value != "" && err == nil {
+			opts.Follow, err = strconv.ParseBool(value)
+		}
+		if err != nil {
+			problemutils.Write(w, r, problemutils.New(problemutils.CodeValidationFailed, "Invalid log parameters", err))
+
+			return
+		}
+
+		stream, err := envs.Logs(r.Context(), chi.URLParam(r, "name"), opts)
+		if err != nil {
+			problemutils.Write(w, r, envProblem(err))
+
+			return
+		}
+		defer stream.Close()
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+
+		// The status is already sent, so failures part way through can only be logged.
+		if err := stream.Copy(w); err != nil && r.Context().Err() == nil {
+			logutils.FromContext(r.Context(), logger).Errorf("Streaming logs of %s failed: %v", chi.URLParam(r, "name"), err)
+		}
+	}
+}
+
+// envEventsHandler returns the Kubernetes events about the objects of an environment.
+func envEventsHandler(envs envservice.EnvironmentInspector) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		events, err := envs.Events(r.Context(), chi.URLParam(r, "name"))
+		if err != nil {
+			problemutils.Write(w, r, envProblem(err))
+
+			return
+		}
+
+		resp := Response{
+			Message: fmt.Sprintf("%d events for %s", len(events), chi.URLParam(r, "name")),
+			Events:  events,
+		}
+
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+
+			return
+		}
+	}
+}
+
+// envRenderHandler renders the environment chart with the requested values merged over its own,
+// without applying anything. Secret data is redacted.
+func envRenderHandler(envs envservice.EnvironmentInspector) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		var req client.RenderRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			problemutils.Write(w, r, problemutils.New(problemutils.CodeValidationFailed, "Invalid request payload", err))
+
+			return
+		}
+
+		manifest, err := envs.Render(r.Context(), chi.URLParam(r, "name"), req.Values)
+		if err != nil {
+			problemutils.Write(w, r, envProblem(err))
+
+			return
+		}
+
+		resp := Response{
+			Message:  fmt.Sprintf("Rendered manifests of %s", chi.URLParam(r, "name")),
+			Manifest: logutils.RedactManifest(manifest),
+		}
+
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+
+			return
+		}
+	}
+}
+
+// envQueryHandler runs a single SQL statement against the environment's MariaDB service and
+// returns the rows as JSON. Statements that aren't read-only need the query write key.
+func envQueryHandler(envs envservice.EnvironmentInspector) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		var req QueryRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			problemutils.Write(w, r, problemutils.New(problemutils.CodeValidationFailed, "Invalid request payload", err))
+
+			return
+		}
+
+		statement, err := sqlutils.Normalize(req.Query)
+		if err != nil {
+			problemutils.Write(w, r, problemutils.New(problemutils.CodeValidationFailed, "Invalid query", err))
+
+			return
+		}
+
+		write := !sqlutils.IsReadOnly(statement)
+		if write && !apiutils.Keys.Valid(apiutils.QueryWriteKeyName, r.Header.Get("X-API-Key")) {
+			problemutils.Write(w, r, problemutils.New(problemutils.CodeForbidden, "Write statements are not allowed", errors.New("only read-only statements can be run with this API key")))
+
+			return
+		}
+
+		target, err := envs.Database(r.Context(), chi.URLParam(r, "name"))
+		if err != nil {
+			problemutils.Write(w, r, envProblem(err))
+
+			return
+		}
+		target.Database = req.Database
+
+		limits := sqlutils.Limits{
+			MaxRows: defaults.QueryMaxRows,
+			Timeout: defaults.QueryTimeout,
+		}
+		if req.MaxRows > 0 && req.MaxRows < limits.MaxRows {
+			limits.MaxRows = req.MaxRows
+		}
+
+		db, err := sql.Open("mysql", target.DSN(limits.Timeout))
+		if err != nil {
+			problemutils.Write(w, r, problemutils.New(problemutils.CodeInternal, "Failed to connect to environment database", err))
+
+			return
+		}
+		defer db.Close()
+
+		result, err := sqlutils.Run(r.Context(), db, statement, write, limits)
+		if err != nil {
+			code := problemutils.CodeUpstreamFailed
+			switch {
+			case sqlutils.IsStatementError(err):
+				code = problemutils.CodeValidationFailed
+			case errors.Is(err, context.DeadlineExceeded):
+				code = problemutils.CodeTimeout
+			}
+
+			problemutils.Write(w, r, problemutils.New(code, "Query failed", err))
+
+			return
+		}
+
+		message := fmt.Sprintf("%d rows", len(result.Rows))
+		if write {
+			message = fmt.Sprintf("%d rows affected", result.RowsAffected)
+		}
+
+		resp := Response{
+			Message: message,
+			Query:   result,
+		}
+
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+
+			return
+		}
+	}
+}
+
+// envConnectHandler upgrades the request to a TCP tunnel relayed through a Kubernetes
+// port-forward to a ready pod behind the environment service exposing ?port= (MariaDB by default).
+func envConnectHandler(envs envservice.EnvironmentInspector, logger logutils.Logger) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		if !apiutils.Keys.Valid(apiutils.ConnectKeyName, r.Header.Get("X-API-Key")) {
+			problemutils.Write(w, r, problemutils.New(problemutils.CodeForbidden, "Tunnels are not allowed", errors.New("opening tunnels needs the connect API key")))
+
+			return
+		}
+
+		if !tunnelutils.IsUpgrade(r) {
+			w.Header().Set("Upgrade", tunnelutils.Protocol)
+			problemutils.Write(w, r, problemutils.New(problemutils.CodeUpgradeRequired, "Upgrade required", tunnelutils.ErrNotUpgrade))
+
+			return
+		}
+
+		port := r.URL.Query().Get("port")
+		if port == "" {
+			port = defaults.ConnectPort
+		}
+
+		tunnel, err := envs.Connect(r.Context(), chi.URLParam(r, "name"), port)
+		if err != nil {
+			problemutils.Write(w, r, envProblem(err))
+
+			return
+		}
+		log := logutils.FromContext(r.Context(), logger).WithFields(logutils.Fields{"pod": tunnel.Pod, "port": tunnel.Port})
+
+		conn, err := tunnelutils.Upgrade(w, r)
+		if err != nil {
+			tunnel.Conn.Close()
+			log.Errorf("Failed to upgrade tunnel connection: %v", err)
+
+			return
+		}
+
+		log.Info("Tunnel opened")
+		if err := tunnelutils.Relay(conn, tunnel.Conn); err != nil {
+			log.Errorf("Tunnel closed with error: %v", err)
+
+			return
+		}
+		log.Info("Tunnel closed")
+	}
+}
+
+func quotaHandler(quotas *quotautils.Enforcer) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		// Teams only see their own usage.
+		team := apiutils.CallerTeam(r.Context())
+		if q := r.URL.Query().Get("team"); q != "" && q != team {
+			problemutils.Write(w, r, problemutils.New(problemutils.CodeForbidden, "Forbidden", fmt.Errorf("the API key belongs to team %s, not %s", team, q)))
+
+			return
+		}
+
+		report, err := quotas.Report(r.Context(), team)
+		if err != nil {
+			problemutils.Write(w, r, problemutils.New(envservice.ErrorCode(err), "Failed to compute quota usage", err))
+
+			return
+		}
+
+		resp := Response{
+			Message: fmt.Sprintf("Quota usage for team %s", team),
+			Quota:   report,
+		}
+
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+
+			return
+		}
+	}
+}
+
+// auditIdentity identifies the caller of a request for the audit log by the name of its key,
+// e.g. HELM_API_CREATE_API_KEY@qa. Unknown keys have no actor.
+func auditIdentity(r *http.Request) (string, string) {
+	apiKey := r.Header.Get("X-API-Key")
+	name, _ := apiutils.Keys.Lookup(apiKey)
+
+	return name, apiutils.KeyID(apiKey)
+}
+
+// idempotencyScope keeps the idempotency keys of every API key apart.
+func idempotencyScope(r *http.Request) string {
+	_, keyID := auditIdentity(r)
+
+	return keyID
+}
+
+func auditHandler(store auditutils.Store) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		query := r.URL.Query()
+		filter := auditutils.Filter{
+			Env:   query.Get("env"),
+			Actor: query.Get("actor"),
+		}
+
+		for param, target := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+			value := query.Get(param)
+			if value == "" {
+				continue
+			}
+
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				problemutils.Write(w, r, problemutils.New(problemutils.CodeValidationFailed, fmt.Sprintf("Invalid %s parameter, expected RFC3339 time", param), err))
+
+				return
+			}
+			*target = parsed
+		}
+
+		entries, err := store.Query(filter)
+		if err != nil {
+			problemutils.Write(w, r, problemutils.New(problemutils.CodeInternal, "Failed to query audit log", err))
+
+			return
+		}
+
+		resp := Response{
+			Message: fmt.Sprintf("%d audit entries", len(entries)),
+			Audit:   entries,
+		}
+
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+
+			return
+		}
+	}
+}
+
+// loadLogLevels sets every subsystem to HELM_API_LOG_LEVEL, then applies HELM_API_LOG_LEVEL_FILE on top.
+func loadLogLevels() error {
+	levels := map[string]string{
+		logutils.AllSubsystems: utils.GetEnvOrValue("HELM_API_LOG_LEVEL", "info"),
+	}
+
+	if path := os.Getenv("HELM_API_LOG_LEVEL_FILE"); path != "" {
+		fromFile, err := logutils.LoadLevels(path)
+		if err != nil {
+
+			return err
+		}
+
+		for subsystem, level := range fromFile {
+			levels[subsystem] = level
+		}
+	}
+
+	return logutils.Levels.Apply(levels)
+}
+
+// newLogger returns the structured logger selected by HELM_API_LOG_BACKEND, logrus by default.
+func newLogger(customLogger *logrus.Logger) (logutils.Logger, error) {
+	switch backend := os.Getenv("HELM_API_LOG_BACKEND"); backend {
+	case "", "logrus":
+
+		return logutils.NewLogrus(customLogger), nil
+
+	case "slog":
+		handler, err := logutils.NewSlogHandler(os.Stderr, os.Getenv("HELM_API_LOG_FORMAT"), slog.LevelDebug)
+		if err != nil {
+
+			return nil, err
+		}
+
+		return logutils.NewSlog(slog.New(handler)), nil
+
+	default:
+
+		return nil, fmt.Errorf("unknown log backend %q", backend)
+	}
+}
+
+func getLogLevelHandler(w http.ResponseWriter, r *http.Request) {
+	resp := Response{
+		Message:   "Current log levels",
+		LogLevels: logutils.Levels.Get(),
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+
+		return
+	}
+}
+
+// setLogLevelHandler changes log levels at runtime. Changes last until the next SIGHUP reload or restart.
+func setLogLevelHandler(w http.ResponseWriter, r *http.Request) {
+	var req LogLevelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problemutils.Write(w, r, problemutils.New(problemutils.CodeValidationFailed, "Invalid request payload", err))
+
+		return
+	}
+
+	if err := logutils.Levels.Set(req.Subsystem, req.Level); err != nil {
+		problemutils.Write(w, r, problemutils.New(problemutils.CodeValidationFailed, "Invalid log level", err))
+
+		return
+	}
+
+	resp := Response{
+		Message:   "Log levels updated",
+		LogLevels: logutils.Levels.Get(),
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+
+		return
+	}
+}
+
+// durationFromEnv parses a duration from the environment, falling back to the default.
+func durationFromEnv(logger logutils.Logger, key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+
+		return defaultValue
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		fatalf(logger, "Invalid duration for %s: %q", key, value)
+	}
+
+	return duration
+}
+
+// newChartStore returns the chart store selected by HELM_API_CHART_STORE, nil for the default
+// local directory.
+func newChartStore(helmClient *helmutils.RealClient, kubeClient kubernetes.Interface, logger logutils.Logger) (helmutils.ChartStore, error) {
+	switch store := os.Getenv("HELM_API_CHART_STORE"); store {
+	case "", defaults.ChartStoreLocal:
+
+		return nil, nil
+
+	case defaults.ChartStoreRelease:
+
+		return &helmutils.ReleaseChartStore{ActionConfig: helmClient.ActionConfig}, nil
+
+	case defaults.ChartStoreConfigMap, defaults.ChartStoreSecret:
+
+		return &kubeutils.ObjectChartStore{
+			Client:    kubeClient,
+			Namespace: helmClient.Default.Namespace,
+			Secrets:   store == defaults.ChartStoreSecret,
+		}, nil
+
+	case defaults.ChartStoreS3:
+		bucket := os.Getenv("HELM_API_S3_BUCKET")
+		if bucket == "" {
+
+			return nil, fmt.Errorf("HELM_API_S3_BUCKET is required for the %s chart store", store)
+		}
+
+		ctxTimeOut, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		region := utils.GetEnvOrValue("HELM_API_AWS_REGION", defaults.AwsRegion)
+		config, err := awsutils.LoadAWSConfig(ctxTimeOut, region)
+		if err != nil {
+
+			return nil, fmt.Errorf("AWS auth error: %w", err)
+		}
+		logger.Info("AWS client initialized successfully")
+
+		return &awsutils.S3ChartStore{
+			Endpoint:    os.Getenv("HELM_API_S3_ENDPOINT"),
+			Region:      region,
+			Bucket:      bucket,
+			Prefix:      utils.GetEnvOrValue("HELM_API_S3_PREFIX", defaults.S3ChartPrefix),
+			Credentials: config.Credentials,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unknown chart store %q", os.Getenv("HELM_API_CHART_STORE"))
+}
+
+// newKeySource returns the configured API key source, or nil when keys come from the environment.
+func newKeySource(logger logutils.Logger) (apiutils.KeySource, error) {
+	source := os.Getenv("HELM_API_SECRET_SOURCE")
+
+	// HELM_API_AWS=true predates HELM_API_SECRET_SOURCE and means SSM.
+	if source == "" && os.Getenv("HELM_API_AWS") == "true" {
+		source = defaults.SecretSourceSSM
+	}
+
+	switch source {
+	case "", defaults.SecretSourceEnv:
+
+		return nil, nil
+
+	case defaults.SecretSourceFile:
+		path := os.Getenv("HELM_API_SECRET_FILE")
+		if path == "" {
+
+			return nil, fmt.Errorf("HELM_API_SECRET_FILE is required for the %s secret source", source)
+		}
+
+		return &apiutils.FileKeySource{Path: path}, nil
+
+	case defaults.SecretSourceSSM, defaults.SecretSourceSecretsManager:
+		ctxTimeOut, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		region := utils.GetEnvOrValue("HELM_API_AWS_REGION", defaults.AwsRegion)
+
+		var ssmConfig *awsutils.SSMConfig
+		if source == defaults.SecretSourceSSM {
+			var err error
+			ssmConfig, err = awsutils.LoadSSMConfig(os.Getenv("HELM_API_SSM_CONFIG"))
+			if err != nil {
+
+				return nil, err
+			}
+			region = ssmConfig.Region
+		}
+
+		// Initialize AWS clients.
+		configLoader := &awsutils.RealAWSConfigLoader{}
+		clients, err := awsutils.InitializeAWSClients(ctxTimeOut, configLoader, region)
+		if err != nil {
+
+			return nil, fmt.Errorf("AWS auth error: %w", err)
+		}
+		logger.Info("AWS client initialized successfully")
+
+		if ssmConfig != nil {
+
+			return &awsutils.SSMKeySource{
+				Client:    clients.SSM,
+				Params:    ssmConfig.Parameters,
+				Path:      ssmConfig.Path,
+				Recursive: ssmConfig.Recursive,
+			}, nil
+		}
+
+		secretID := os.Getenv("HELM_API_SECRET_ID")
+		if secretID == "" {
+
+			return nil, fmt.Errorf("HELM_API_SECRET_ID is required for the %s secret source", source)
+		}
+
+		return &awsutils.SecretsManagerKeySource{Client: clients.SecretsManager, SecretID: secretID}, nil
+	}
+
+	return nil, fmt.Errorf("unknown secret source %q", source)
+}
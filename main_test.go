@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"helm-api/apiutils"
+	"helm-api/auditutils"
+	"helm-api/client"
+	"helm-api/defaults"
+	"helm-api/helmutils"
+	"helm-api/idempotencyutils"
+	"helm-api/kubeutils"
+	"helm-api/logutils"
+	"helm-api/quotautils"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	kubefake "helm.sh/helm/v3/pkg/kube/fake"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// newTestServer serves the router of newTestRouter.
+func newTestServer(t *testing.T, quotaConfig *quotautils.Config) (*httptest.Server, *fake.Clientset) {
+	t.Helper()
+
+	router, kubeClient := newTestRouter(t, quotaConfig)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	return server, kubeClient
+}
+
+// newTestRouter builds the real router on top of in-memory Helm storage, a Kubernetes client
+// that only prints the applied resources, and a fake clientset for the environment pods.
+func newTestRouter(t *testing.T, quotaConfig *quotautils.Config) (chi.Router, *fake.Clientset) {
+	t.Helper()
+
+	// The create key belongs to the qa team.
+	keys := apiutils.Keys
+	apiutils.Keys = apiutils.NewKeyStore()
+	apiutils.Keys.Rotate(map[string]string{
+		"HELM_API_CREATE_API_KEY@qa": "create-key",
+		"HELM_API_UPDATE_API_KEY":    "update-key",
+		"HELM_API_DELETE_API_KEY":    "delete-key",
+		"HELM_API_READ_API_KEY":      "read-key",
+	}, 0)
+	t.Cleanup(func() { apiutils.Keys = keys })
+
+	base := logrus.New()
+	base.SetOutput(io.Discard)
+	logger := logutils.NewLogrus(base)
+
+	helmClient := &helmutils.RealClient{
+		ActionConfig: &action.Configuration{
+			Releases:     storage.Init(driver.NewMemory()),
+			KubeClient:   &kubefake.PrintingKubeClient{Out: io.Discard},
+			Capabilities: chartutil.DefaultCapabilities,
+			Log:          func(format string, v ...interface{}) {},
+		},
+		Logger:      logger,
+		Actioner:    &helmutils.RealHelmActioner{},
+		ChartLoader: &helmutils.RealChartLoader{},
+		Charts:      &helmutils.MemoryChartStore{},
+		Locks:       &helmutils.LockManager{},
+		Default: helmutils.Value{
+			Namespace: defaults.NameSpace,
+			SourceDir: defaults.SourceDir,
+		},
+	}
+
+	kubeClient := fake.NewSimpleClientset()
+	inspector := &kubeutils.Inspector{
+		Client:    kubeClient,
+		Namespace: defaults.NameSpace,
+	}
+
+	quotas := &quotautils.Enforcer{
+		Config: quotaConfig,
+		Source: helmClient,
+	}
+
+	auditStore, err := auditutils.NewFileStore(filepath.Join(t.TempDir(), "audit.jsonl"))
+	require.NoError(t, err)
+	t.Cleanup(func() { auditStore.Close() })
+
+	return newRouter(helmClient, newEnvService(helmClient, quotas, inspector, nil), quotas, auditStore, idempotencyutils.NewStore(time.Hour), logger), kubeClient
+}
+
+func newTestClient(t *testing.T, url, apiKey string) *client.Client {
+	t.Helper()
+
+	c, err := client.New(url, client.WithAPIKey(apiKey), client.WithRetry(client.RetryPolicy{MaxAttempts: 1}))
+	require.NoError(t, err)
+
+	return c
+}
+
+func envPod(name string, ready bool) *corev1.Pod {
+	status := corev1.ConditionFalse
+	if ready {
+		status = corev1.ConditionTrue
+	}
+
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: defaults.NameSpace,
+			Labels:    map[string]string{kubeutils.InstanceLabel: defaults.EnvPrefix + "demo"},
+		},
+		Status: corev1.PodStatus{
+			Phase:      corev1.PodRunning,
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: status}},
+		},
+	}
+}
+
+func TestClientLifecycle(t *testing.T) {
+	server, kubeClient := newTestServer(t, &quotautils.Config{
+		Default: quotautils.Policy{MaxEnvironments: 1},
+	})
+	ctx := context.Background()
+
+	metadata := chart.Metadata{APIVersion: chart.APIVersionV2, Name: "demo", Version: "0.1.0"}
+	create := newTestClient(t, server.URL, "create-key")
+
+	_, err := create.CreateEnv(ctx, client.Request{ChartMetadata: metadata})
+	require.NoError(t, err)
+
+	_, err = create.CreateEnv(ctx, client.Request{ChartMetadata: metadata})
+	assert.ErrorIs(t, err, client.ErrAlreadyExists)
+
+	metadata.Name = "other"
+	_, err = create.CreateEnv(ctx, client.Request{ChartMetadata: metadata})
+	assert.ErrorIs(t, err, client.ErrQuotaExceeded)
+
+	read := newTestClient(t, server.URL, "read-key")
+
+	names, err := read.ListEnvs(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"demo"}, names)
+
+	_, err = kubeClient.CoreV1().Pods(defaults.NameSpace).Create(ctx, envPod("test-demo-0", false), metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	status, err := read.GetEnv(ctx, "demo")
+	require.NoError(t, err)
+	assert.Equal(t, "demo", status.Name)
+	assert.Equal(t, "test-demo", status.Release)
+	assert.Equal(t, "deployed", status.Status)
+	assert.Equal(t, 1, status.Revision)
+	assert.Equal(t, "qa", status.Team)
+	assert.Equal(t, 1, status.Pods)
+	assert.False(t, status.Ready)
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		kubeClient.CoreV1().Pods(defaults.NameSpace).Update(ctx, envPod("test-demo-0", true), metav1.UpdateOptions{})
+	}()
+
+	waitCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	status, err = read.WaitForReady(waitCtx, "demo", 10*time.Millisecond)
+	require.NoError(t, err)
+	assert.True(t, status.Ready)
+	assert.Equal(t, 1, status.ReadyPods)
+
+	update := newTestClient(t, server.URL, "update-key")
+	_, err = update.ScaleEnv(ctx, "demo", client.ScaleDown)
+	require.NoError(t, err)
+
+	status, err = read.GetEnv(ctx, "demo")
+	require.NoError(t, err)
+	assert.Equal(t, 2, status.Revision)
+
+	manifest, err := read.Render(ctx, "demo", map[string]interface{}{"replicas": 3})
+	require.NoError(t, err)
+	assert.Contains(t, manifest, "replicas: 3")
+
+	_, err = update.UpdateEnv(ctx, "demo", client.Request{Values: map[string]interface{}{"replicas": 2}})
+	require.NoError(t, err)
+
+	manifest, err = read.Render(ctx, "demo", nil)
+	require.NoError(t, err)
+	assert.Contains(t, manifest, "replicas: 2")
+
+	_, err = newTestClient(t, server.URL, "read-key").DeleteEnv(ctx, "demo")
+	assert.ErrorIs(t, err, client.ErrUnauthorized)
+
+	_, err = newTestClient(t, server.URL, "delete-key").DeleteEnv(ctx, "demo")
+	require.NoError(t, err)
+
+	_, err = read.GetEnv(ctx, "demo")
+	assert.ErrorIs(t, err, client.ErrNotFound)
+}
+
+func TestAuditIdentity(t *testing.T) {
+	newTestRouter(t, &quotautils.Config{})
+
+	req := httptest.NewRequest(http.MethodPost, "/create-env", nil)
+	req.Header.Set("X-API-Key", "create-key")
+	actor, keyID := auditIdentity(req)
+	assert.Equal(t, "HELM_API_CREATE_API_KEY@qa", actor)
+	assert.Equal(t, apiutils.KeyID("create-key"), keyID)
+
+	// A team header doesn't change the actor, and unknown keys have none.
+	req.Header.Set("X-Team", "admin")
+	actor, _ = auditIdentity(req)
+	assert.Equal(t, "HELM_API_CREATE_API_KEY@qa", actor)
+
+	req.Header.Set("X-API-Key", "unknown-key")
+	actor, keyID = auditIdentity(req)
+	assert.Empty(t, actor)
+	assert.Equal(t, apiutils.KeyID("unknown-key"), keyID)
+}
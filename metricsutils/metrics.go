@@ -0,0 +1,187 @@
+package metricsutils
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+const namespace = "helm_api"
+
+// Registry holds every helm-api metric, served by Handler.
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	httpDuration = promauto.With(Registry).NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route and method.",
+		Buckets:   []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 15, 30, 60, 120, 300},
+	}, []string{"route", "method"})
+
+	helmDuration = promauto.With(Registry).NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "helm_action_duration_seconds",
+		Help:      "Helm action duration by action type.",
+		Buckets:   []float64{0.1, 0.5, 1, 5, 15, 30, 60, 120, 300},
+	}, []string{"action"})
+
+	helmFailures = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "helm_action_failures_total",
+		Help:      "Failed Helm actions by action type.",
+	}, []string{"action"})
+
+	inFlight = promauto.With(Registry).NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "operations_in_flight",
+		Help:      "Helm actions currently running by action type.",
+	}, []string{"action"})
+
+	reaperRuns = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reaper_runs_total",
+		Help:      "TTL reaper runs by result, failure when the environments couldn't be listed.",
+	}, []string{"result"})
+
+	reaperEnvironments = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reaper_environments_total",
+		Help:      "Expired environments handled by the TTL reaper, by result.",
+	}, []string{"result"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// Middleware counts requests and measures their latency per chi route pattern.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		// Use the pattern rather than the path to keep label cardinality bounded.
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		httpRequests.WithLabelValues(route, r.Method, strconv.Itoa(status)).Inc()
+		httpDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+	})
+}
+
+// TrackHelmAction marks a Helm action as in flight. The returned function must be
+// called with the action's result to record its duration and failure.
+func TrackHelmAction(action string) func(err error) {
+	start := time.Now()
+	inFlight.WithLabelValues(action).Inc()
+
+	return func(err error) {
+		inFlight.WithLabelValues(action).Dec()
+		helmDuration.WithLabelValues(action).Observe(time.Since(start).Seconds())
+		if err != nil {
+			helmFailures.WithLabelValues(action).Inc()
+		}
+	}
+}
+
+// RecordReaperRun counts a TTL reaper run, with the environments it deleted and failed to delete
+// and err when it couldn't list them.
+func RecordReaperRun(deleted, failed int, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+
+	reaperRuns.WithLabelValues(result).Inc()
+	reaperEnvironments.WithLabelValues("deleted").Add(float64(deleted))
+	reaperEnvironments.WithLabelValues("failed").Add(float64(failed))
+}
+
+// ReleaseLister lists the helm-api releases for the environment collector.
+type ReleaseLister interface {
+	ListReleaseDetails(ctx context.Context, selector string) ([]*release.Release, error)
+}
+
+// EnvironmentCollector reports the number of environments by release status at scrape time.
+type EnvironmentCollector struct {
+	Lister ReleaseLister
+	desc   *prometheus.Desc
+	errs   *prometheus.Desc
+}
+
+func NewEnvironmentCollector(lister ReleaseLister) *EnvironmentCollector {
+	return &EnvironmentCollector{
+		Lister: lister,
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "environments"),
+			"Environments by Helm release status.",
+			[]string{"status"}, nil,
+		),
+		errs: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "environments_scrape_error"),
+			"1 if listing the environments failed during the last scrape.",
+			nil, nil,
+		),
+	}
+}
+
+func (c *EnvironmentCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+	ch <- c.errs
+}
+
+func (c *EnvironmentCollector) Collect(ch chan<- prometheus.Metric) {
+	releases, err := c.Lister.ListReleaseDetails(context.Background(), "")
+	if err != nil {
+		ch <- prometheus.MustNewConstMetric(c.errs, prometheus.GaugeValue, 1)
+
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.errs, prometheus.GaugeValue, 0)
+
+	counts := map[string]int{}
+	for _, rel := range releases {
+		status := release.StatusUnknown.String()
+		if rel.Info != nil {
+			status = rel.Info.Status.String()
+		}
+		counts[status]++
+	}
+
+	for status, count := range counts {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(count), status)
+	}
+}
@@ -0,0 +1,136 @@
+package metricsutils_test
+
+import (
+	"context"
+	"errors"
+	"helm-api/metricsutils"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+// MockReleaseLister is a mock implementation of the ReleaseLister interface.
+type MockReleaseLister struct {
+	mock.Mock
+}
+
+func (m *MockReleaseLister) ListReleaseDetails(ctx context.Context, selector string) ([]*release.Release, error) {
+	args := m.Called(selector)
+	return args.Get(0).([]*release.Release), args.Error(1)
+}
+
+func TestMiddleware(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(metricsutils.Middleware)
+	r.Post("/delete-env/{chartName}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	r.Method(http.MethodGet, "/metrics", metricsutils.Handler())
+
+	for _, name := range []string{"chart1", "chart2"} {
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/delete-env/"+name, nil))
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	}
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	// Both requests share the route pattern label.
+	assert.Contains(t, rr.Body.String(), `helm_api_http_requests_total{code="500",method="POST",route="/delete-env/{chartName}"} 2`)
+	assert.Contains(t, rr.Body.String(), `helm_api_http_request_duration_seconds_count{method="POST",route="/delete-env/{chartName}"} 2`)
+}
+
+func TestTrackHelmAction(t *testing.T) {
+	done := metricsutils.TrackHelmAction("test-install")
+	assert.Contains(t, gather(t), `helm_api_operations_in_flight{action="test-install"} 1`)
+
+	done(errors.New("timed out waiting for the condition"))
+	metrics := gather(t)
+	assert.Contains(t, metrics, `helm_api_operations_in_flight{action="test-install"} 0`)
+	assert.Contains(t, metrics, `helm_api_helm_action_failures_total{action="test-install"} 1`)
+	assert.Contains(t, metrics, `helm_api_helm_action_duration_seconds_count{action="test-install"} 1`)
+
+	metricsutils.TrackHelmAction("test-install")(nil)
+	metrics = gather(t)
+	assert.Contains(t, metrics, `helm_api_helm_action_failures_total{action="test-install"} 1`)
+	assert.Contains(t, metrics, `helm_api_helm_action_duration_seconds_count{action="test-install"} 2`)
+}
+
+func TestRecordReaperRun(t *testing.T) {
+	metricsutils.RecordReaperRun(2, 1, nil)
+	metricsutils.RecordReaperRun(0, 0, errors.New("cluster unreachable"))
+
+	metrics := gather(t)
+	assert.Contains(t, metrics, `helm_api_reaper_runs_total{result="success"} 1`)
+	assert.Contains(t, metrics, `helm_api_reaper_runs_total{result="failure"} 1`)
+	assert.Contains(t, metrics, `helm_api_reaper_environments_total{result="deleted"} 2`)
+	assert.Contains(t, metrics, `helm_api_reaper_environments_total{result="failed"} 1`)
+}
+
+func TestEnvironmentCollector(t *testing.T) {
+	tests := []struct {
+		name     string
+		releases []*release.Release
+		err      error
+		expected string
+	}{
+		{
+			name: "counts by status",
+			releases: []*release.Release{
+				{Name: "test-1", Info: &release.Info{Status: release.StatusDeployed}},
+				{Name: "test-2", Info: &release.Info{Status: release.StatusDeployed}},
+				{Name: "test-3", Info: &release.Info{Status: release.StatusFailed}},
+			},
+			expected: `
+# HELP helm_api_environments Environments by Helm release status.
+# TYPE helm_api_environments gauge
+helm_api_environments{status="deployed"} 2
+helm_api_environments{status="failed"} 1
+# HELP helm_api_environments_scrape_error 1 if listing the environments failed during the last scrape.
+# TYPE helm_api_environments_scrape_error gauge
+helm_api_environments_scrape_error 0
+`,
+		},
+		{
+			name:     "list error",
+			releases: []*release.Release{},
+			err:      errors.New("cluster unreachable"),
+			expected: `
+# HELP helm_api_environments_scrape_error 1 if listing the environments failed during the last scrape.
+# TYPE helm_api_environments_scrape_error gauge
+helm_api_environments_scrape_error 1
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lister := new(MockReleaseLister)
+			lister.On("ListReleaseDetails", "").Return(tt.releases, tt.err)
+
+			collector := metricsutils.NewEnvironmentCollector(lister)
+			err := testutil.CollectAndCompare(collector, strings.NewReader(tt.expected))
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func gather(t *testing.T) string {
+	t.Helper()
+
+	rr := httptest.NewRecorder()
+	metricsutils.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	return rr.Body.String()
+}
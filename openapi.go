@@ -0,0 +1,441 @@
+package main
+
+import (
+	"helm-api/apiutils"
+	"helm-api/client"
+	"helm-api/idempotencyutils"
+	"helm-api/openapiutils"
+	"helm-api/problemutils"
+	"net/http"
+)
+
+// Paths of the API description, served without a key.
+const (
+	openAPIPath    = "/openapi.json"
+	docsPath       = "/docs"
+	docsAssetsPath = docsPath + "/{asset}"
+)
+
+// Key names of the routes, as configured for apiutils.
+const (
+	createKeyName = "HELM_API_CREATE_API_KEY"
+	updateKeyName = "HELM_API_UPDATE_API_KEY"
+	deleteKeyName = "HELM_API_DELETE_API_KEY"
+	readKeyName   = "HELM_API_READ_API_KEY"
+	auditKeyName  = "HELM_API_AUDIT_API_KEY"
+	adminKeyName  = "HELM_API_ADMIN_API_KEY"
+)
+
+var (
+	okResponse          = openapiutils.Body{Type: Response{}}
+	badRequestResponse  = problemBody("Invalid request")
+	unauthorizedBody    = problemBody("Missing or invalid API key")
+	notFoundResponse    = problemBody("No environment with this name")
+	serverErrorResponse = problemBody("Helm or Kubernetes failure")
+	quotaResponse       = problemBody("Team quota exceeded, see quota")
+	keyReusedResponse   = problemBody("The Idempotency-Key was sent with another request")
+	lockedResponse      = problemBody("Another operation on the environment is in progress")
+	existsResponse      = problemBody("The environment already exists, or another operation on it is in progress")
+)
+
+// idempotencyHeaders document the header of the routes that replay their first response.
+var idempotencyHeaders = []openapiutils.Param{
+	{Name: idempotencyutils.Header, Description: "Retries with the same key get the first response, with Idempotent-Replayed set"},
+}
+
+// problemBody documents an error response, which is always a problem.
+func problemBody(description string) openapiutils.Body {
+	return openapiutils.Body{Description: description, Type: problemutils.Problem{}, ContentType: problemutils.ContentType}
+}
+
+// apiRoutes documents every route of newRouter. TestOpenAPICoversRoutes fails when they disagree.
+var apiRoutes = []openapiutils.Route{
+	{
+		Method:  http.MethodPost,
+		Path:    "/create-env",
+		Summary: "Create an environment from the source chart",
+		Tag:     "environments",
+		KeyName: createKeyName,
+		Request: Request{},
+		Headers: idempotencyHeaders,
+		Responses: map[int]openapiutils.Body{
+			http.StatusCreated:             {Description: "Environment installed", Type: Response{}},
+			http.StatusBadRequest:          badRequestResponse,
+			http.StatusUnauthorized:        unauthorizedBody,
+			http.StatusForbidden:           quotaResponse,
+			http.StatusConflict:            existsResponse,
+			http.StatusUnprocessableEntity: keyReusedResponse,
+			http.StatusInternalServerError: serverErrorResponse,
+		},
+	},
+	{
+		Method:  http.MethodPost,
+		Path:    "/update-env/{chartName}",
+		Summary: "Scale an environment or merge values into it",
+		Tag:     "environments",
+		KeyName: updateKeyName,
+		Request: Request{},
+		Headers: idempotencyHeaders,
+		Responses: map[int]openapiutils.Body{
+			http.StatusOK:                  okResponse,
+			http.StatusBadRequest:          badRequestResponse,
+			http.StatusUnauthorized:        unauthorizedBody,
+			http.StatusForbidden:           quotaResponse,
+			http.StatusConflict:            lockedResponse,
+			http.StatusUnprocessableEntity: keyReusedResponse,
+			http.StatusInternalServerError: serverErrorResponse,
+		},
+	},
+	{
+		Method:  http.MethodPost,
+		Path:    "/delete-env/{chartName}",
+		Summary: "Uninstall an environment",
+		Tag:     "environments",
+		KeyName: deleteKeyName,
+		Headers: idempotencyHeaders,
+		Responses: map[int]openapiutils.Body{
+			http.StatusOK:                  okResponse,
+			http.StatusUnauthorized:        unauthorizedBody,
+			http.StatusConflict:            lockedResponse,
+			http.StatusUnprocessableEntity: keyReusedResponse,
+			http.StatusInternalServerError: serverErrorResponse,
+		},
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    "/list",
+		Summary: "List the environment releases",
+		Tag:     "environments",
+		Responses: map[int]openapiutils.Body{
+			http.StatusOK:                  {Description: "Release names in data", Type: Response{}},
+			http.StatusInternalServerError: serverErrorResponse,
+		},
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    "/envs/{name}",
+		Summary: "Release status and pod readiness of an environment",
+		Tag:     "environments",
+		KeyName: readKeyName,
+		Responses: map[int]openapiutils.Body{
+			http.StatusOK:                  {Description: "Status in env", Type: Response{}},
+			http.StatusUnauthorized:        unauthorizedBody,
+			http.StatusNotFound:            notFoundResponse,
+			http.StatusInternalServerError: serverErrorResponse,
+		},
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    "/envs/{name}/logs",
+		Summary: "Stream the logs of the environment pods",
+		Tag:     "environments",
+		KeyName: readKeyName,
+		Query: []openapiutils.Param{
+			{Name: "container", Description: "Container of the pods, the first one when empty"},
+			{Name: "tailLines", Description: "Lines to return from the end of the logs", Type: "integer"},
+			{Name: "since", Description: "Only logs newer than this duration, e.g. 10m"},
+			{Name: "follow", Description: "Keep streaming new lines", Type: "boolean"},
+		},
+		Responses: map[int]openapiutils.Body{
+			http.StatusOK:                  {Description: "Log lines prefixed with the pod name", ContentType: "text/plain"},
+			http.StatusBadRequest:          badRequestResponse,
+			http.StatusUnauthorized:        unauthorizedBody,
+			http.StatusNotFound:            notFoundResponse,
+			http.StatusInternalServerError: serverErrorResponse,
+		},
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    "/envs/{name}/events",
+		Summary: "Kubernetes events of the environment",
+		Tag:     "environments",
+		KeyName: readKeyName,
+		Responses: map[int]openapiutils.Body{
+			http.StatusOK:                  {Description: "Events in events", Type: Response{}},
+			http.StatusUnauthorized:        unauthorizedBody,
+			http.StatusNotFound:            notFoundResponse,
+			http.StatusInternalServerError: serverErrorResponse,
+		},
+	},
+	{
+		Method:  http.MethodPost,
+		Path:    "/envs/{name}/render",
+		Summary: "Render the manifests of an environment with values merged over its own",
+		Tag:     "environments",
+		KeyName: readKeyName,
+		Request: client.RenderRequest{},
+		Responses: map[int]openapiutils.Body{
+			http.StatusOK:           {Description: "Redacted manifests in manifest", Type: Response{}},
+			http.StatusBadRequest:   badRequestResponse,
+			http.StatusUnauthorized: unauthorizedBody,
+			http.StatusNotFound:     notFoundResponse,
+		},
+	},
+	{
+		Method:  http.MethodPost,
+		Path:    "/envs/{name}/query",
+		Summary: "Run a SQL statement against the environment database",
+		Tag:     "environments",
+		KeyName: readKeyName,
+		Request: QueryRequest{},
+		Responses: map[int]openapiutils.Body{
+			http.StatusOK:                  {Description: "Rows in query", Type: Response{}},
+			http.StatusBadRequest:          badRequestResponse,
+			http.StatusUnauthorized:        unauthorizedBody,
+			http.StatusForbidden:           problemBody("Write statements need " + apiutils.QueryWriteKeyName),
+			http.StatusNotFound:            notFoundResponse,
+			http.StatusInternalServerError: serverErrorResponse,
+			http.StatusBadGateway:          problemBody("The database failed the statement"),
+			http.StatusGatewayTimeout:      problemBody("The statement timed out"),
+		},
+	},
+	{
+		Method:  http.MethodPost,
+		Path:    "/envs/{name}/connect",
+		Summary: "Upgrade to a TCP tunnel to the environment service",
+		Tag:     "environments",
+		KeyName: apiutils.ConnectKeyName,
+		Query: []openapiutils.Param{
+			{Name: "port", Description: "Service port, the database port when empty"},
+		},
+		Responses: map[int]openapiutils.Body{
+			http.StatusSwitchingProtocols: {Description: "Raw TCP stream to the service"},
+			http.StatusUnauthorized:       unauthorizedBody,
+			http.StatusForbidden:          problemBody("The key isn't " + apiutils.ConnectKeyName),
+			http.StatusNotFound:           notFoundResponse,
+			http.StatusUpgradeRequired:    problemBody("The request didn't ask for an upgrade"),
+			http.StatusBadGateway:         problemBody("The port forward failed"),
+			http.StatusServiceUnavailable: problemBody("No ready pod behind the service"),
+		},
+	},
+	{
+		Method:  http.MethodPost,
+		Path:    "/v1/envs",
+		Summary: "Create an environment from the source chart",
+		Tag:     "v1",
+		KeyName: createKeyName,
+		Request: Request{},
+		Headers: idempotencyHeaders,
+		Responses: map[int]openapiutils.Body{
+			http.StatusCreated:             {Description: "Environment installed, Location points to it", Type: Response{}},
+			http.StatusBadRequest:          badRequestResponse,
+			http.StatusUnauthorized:        unauthorizedBody,
+			http.StatusForbidden:           quotaResponse,
+			http.StatusConflict:            existsResponse,
+			http.StatusUnprocessableEntity: keyReusedResponse,
+			http.StatusInternalServerError: serverErrorResponse,
+		},
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    "/v1/envs",
+		Summary: "List the environment names",
+		Tag:     "v1",
+		KeyName: readKeyName,
+		Responses: map[int]openapiutils.Body{
+			http.StatusOK:                  {Description: "Names in data", Type: Response{}},
+			http.StatusUnauthorized:        unauthorizedBody,
+			http.StatusInternalServerError: serverErrorResponse,
+		},
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    "/v1/envs/{name}",
+		Summary: "Release status and pod readiness of an environment",
+		Tag:     "v1",
+		KeyName: readKeyName,
+		Responses: map[int]openapiutils.Body{
+			http.StatusOK:                  {Description: "Status in env", Type: Response{}},
+			http.StatusUnauthorized:        unauthorizedBody,
+			http.StatusNotFound:            notFoundResponse,
+			http.StatusInternalServerError: serverErrorResponse,
+		},
+	},
+	{
+		Method:  http.MethodPatch,
+		Path:    "/v1/envs/{name}",
+		Summary: "Merge values into an environment and upgrade it",
+		Tag:     "v1",
+		KeyName: updateKeyName,
+		Request: client.UpdateRequest{},
+		Headers: idempotencyHeaders,
+		Responses: map[int]openapiutils.Body{
+			http.StatusOK:                  okResponse,
+			http.StatusBadRequest:          badRequestResponse,
+			http.StatusUnauthorized:        unauthorizedBody,
+			http.StatusForbidden:           quotaResponse,
+			http.StatusNotFound:            notFoundResponse,
+			http.StatusConflict:            lockedResponse,
+			http.StatusUnprocessableEntity: keyReusedResponse,
+			http.StatusInternalServerError: serverErrorResponse,
+		},
+	},
+	{
+		Method:  http.MethodDelete,
+		Path:    "/v1/envs/{name}",
+		Summary: "Uninstall an environment",
+		Tag:     "v1",
+		KeyName: deleteKeyName,
+		Headers: idempotencyHeaders,
+		Responses: map[int]openapiutils.Body{
+			http.StatusOK:                  okResponse,
+			http.StatusUnauthorized:        unauthorizedBody,
+			http.StatusNotFound:            notFoundResponse,
+			http.StatusConflict:            lockedResponse,
+			http.StatusUnprocessableEntity: keyReusedResponse,
+			http.StatusInternalServerError: serverErrorResponse,
+		},
+	},
+	{
+		Method:  http.MethodPost,
+		Path:    "/v1/envs/{name}:scale",
+		Summary: "Scale the pods of an environment up or down",
+		Tag:     "v1",
+		KeyName: updateKeyName,
+		Request: client.ScaleRequest{},
+		Headers: idempotencyHeaders,
+		Responses: map[int]openapiutils.Body{
+			http.StatusOK:                  okResponse,
+			http.StatusBadRequest:          badRequestResponse,
+			http.StatusUnauthorized:        unauthorizedBody,
+			http.StatusForbidden:           quotaResponse,
+			http.StatusNotFound:            notFoundResponse,
+			http.StatusConflict:            lockedResponse,
+			http.StatusUnprocessableEntity: keyReusedResponse,
+			http.StatusInternalServerError: serverErrorResponse,
+		},
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    "/quotas",
+		Summary: "Quota usage of the team of the API key",
+		Tag:     "teams",
+		KeyName: readKeyName,
+		Query: []openapiutils.Param{
+			{Name: "team", Description: "Team to report, only the team of the API key is allowed"},
+		},
+		Responses: map[int]openapiutils.Body{
+			http.StatusOK:                  {Description: "Usage in quota", Type: Response{}},
+			http.StatusUnauthorized:        unauthorizedBody,
+			http.StatusForbidden:           problemBody("The team isn't the team of the API key"),
+			http.StatusInternalServerError: serverErrorResponse,
+		},
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    "/audit",
+		Summary: "Audit trail of the mutating calls",
+		Tag:     "admin",
+		KeyName: auditKeyName,
+		Query: []openapiutils.Param{
+			{Name: "env", Description: "Only calls on this environment"},
+			{Name: "actor", Description: "Only calls by this actor"},
+			{Name: "since", Description: "RFC 3339 lower bound"},
+			{Name: "until", Description: "RFC 3339 upper bound"},
+		},
+		Responses: map[int]openapiutils.Body{
+			http.StatusOK:                  {Description: "Entries in audit", Type: Response{}},
+			http.StatusBadRequest:          badRequestResponse,
+			http.StatusUnauthorized:        unauthorizedBody,
+			http.StatusInternalServerError: serverErrorResponse,
+		},
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    "/admin/log-level",
+		Summary: "Log level of every subsystem",
+		Tag:     "admin",
+		KeyName: adminKeyName,
+		Responses: map[int]openapiutils.Body{
+			http.StatusOK:           {Description: "Levels in logLevels", Type: Response{}},
+			http.StatusUnauthorized: unauthorizedBody,
+		},
+	},
+	{
+		Method:  http.MethodPut,
+		Path:    "/admin/log-level",
+		Summary: "Change the log level of one or all subsystems until the next reload",
+		Tag:     "admin",
+		KeyName: adminKeyName,
+		Request: LogLevelRequest{},
+		Responses: map[int]openapiutils.Body{
+			http.StatusOK:           {Description: "Levels in logLevels", Type: Response{}},
+			http.StatusBadRequest:   badRequestResponse,
+			http.StatusUnauthorized: unauthorizedBody,
+		},
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    "/livez",
+		Summary: "Liveness probe",
+		Tag:     "health",
+		Responses: map[int]openapiutils.Body{
+			http.StatusOK: okResponse,
+		},
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    "/health-check",
+		Summary: "Liveness probe, kept for older clients",
+		Tag:     "health",
+		Responses: map[int]openapiutils.Body{
+			http.StatusOK: okResponse,
+		},
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    "/readyz",
+		Summary: "Readiness probe with the outcome of every check",
+		Tag:     "health",
+		Responses: map[int]openapiutils.Body{
+			http.StatusOK:                 {Description: "Checks in health", Type: Response{}},
+			http.StatusServiceUnavailable: {Description: "A check failed, see health", Type: Response{}},
+		},
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    "/metrics",
+		Summary: "Prometheus metrics",
+		Tag:     "health",
+		Responses: map[int]openapiutils.Body{
+			http.StatusOK: {Description: "Prometheus text format", ContentType: "text/plain"},
+		},
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    openAPIPath,
+		Summary: "This document",
+		Tag:     "docs",
+		Responses: map[int]openapiutils.Body{
+			http.StatusOK: {Description: "OpenAPI 3.0 document", ContentType: "application/json"},
+		},
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    docsPath,
+		Summary: "Swagger UI browsing this document",
+		Tag:     "docs",
+		Responses: map[int]openapiutils.Body{
+			http.StatusOK: {Description: "HTML page", ContentType: "text/html"},
+		},
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    docsAssetsPath,
+		Summary: "Scripts and styles of the Swagger UI page",
+		Tag:     "docs",
+		Responses: map[int]openapiutils.Body{
+			http.StatusOK:       {Description: "Swagger UI asset"},
+			http.StatusNotFound: {Description: "Unknown asset"},
+		},
+	},
+}
+
+// openAPIDocument describes the API from apiRoutes and the payload types.
+func openAPIDocument() *openapiutils.Document {
+	return openapiutils.Build(openapiutils.Info{
+		Title:       "helm-api",
+		Version:     "1.0.0",
+		Description: "Creates and manages short-lived environments from a Helm chart. Pass keys in the X-API-Key header.",
+	}, "helm-api/client", apiRoutes)
+}
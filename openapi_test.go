@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAPICoversRoutes(t *testing.T) {
+	router, _ := newTestRouter(t, nil)
+	doc := openAPIDocument()
+
+	registered := map[string]bool{}
+	err := chi.Walk(router, func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		registered[method+" "+route] = true
+		assert.True(t, doc.Has(method, route), "%s %s is registered but missing from the OpenAPI document", method, route)
+
+		return nil
+	})
+	require.NoError(t, err)
+
+	for _, route := range apiRoutes {
+		assert.True(t, registered[route.Method+" "+route.Path], "%s %s is documented but not registered", route.Method, route.Path)
+	}
+}
+
+func TestOpenAPIServed(t *testing.T) {
+	server, _ := newTestServer(t, nil)
+
+	resp, err := http.Get(server.URL + openAPIPath)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+	var doc struct {
+		OpenAPI    string                                `json:"openapi"`
+		Paths      map[string]map[string]json.RawMessage `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]json.RawMessage `json:"properties"`
+				Required   []string                   `json:"required"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&doc))
+	assert.Equal(t, "3.0.3", doc.OpenAPI)
+	assert.Contains(t, doc.Paths["/envs/{name}/query"], "post")
+	assert.Equal(t, []string{"chartMetadata"}, doc.Components.Schemas["Request"].Required)
+	assert.Contains(t, doc.Components.Schemas["Response"].Properties, "quota")
+	assert.Contains(t, doc.Components.Schemas, "QuotaReport")
+	assert.Contains(t, doc.Components.Schemas["Problem"].Properties, "code")
+
+	docs, err := http.Get(server.URL + docsPath)
+	require.NoError(t, err)
+	defer docs.Body.Close()
+	assert.Equal(t, http.StatusOK, docs.StatusCode)
+	body, err := io.ReadAll(docs.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), "openapi.json")
+	assert.Contains(t, string(body), "swagger-ui-bundle.js")
+
+	bundle, err := http.Get(server.URL + docsPath + "/swagger-ui-bundle.js")
+	require.NoError(t, err)
+	defer bundle.Body.Close()
+	assert.Equal(t, http.StatusOK, bundle.StatusCode)
+}
@@ -0,0 +1,246 @@
+package openapiutils
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SecuritySchemeName is the name of the API key scheme in the document.
+const SecuritySchemeName = "apiKey"
+
+// Route documents one route of the API.
+type Route struct {
+	Method  string
+	Path    string
+	Summary string
+	Tag     string
+	// KeyName is the API key the route needs, empty for public routes.
+	KeyName string
+	Query   []Param
+	Headers []Param
+	// Request is a value of the JSON request body type, nil when there is no body.
+	Request   interface{}
+	Responses map[int]Body
+}
+
+// Param is a query or header parameter.
+type Param struct {
+	Name        string
+	Description string
+	// Type is an OpenAPI type, string when empty.
+	Type string
+}
+
+func (p Param) parameter(in string) *Parameter {
+	paramType := p.Type
+	if paramType == "" {
+		paramType = "string"
+	}
+
+	return &Parameter{
+		Name:        p.Name,
+		In:          in,
+		Description: p.Description,
+		Schema:      &Schema{Type: paramType},
+	}
+}
+
+// Body is a response of an operation.
+type Body struct {
+	Description string
+	// Type is a value of the JSON response type, sent as ContentType when set. ContentType alone
+	// describes other bodies.
+	Type        interface{}
+	ContentType string
+}
+
+// Document is an OpenAPI 3.0 document.
+type Document struct {
+	OpenAPI    string                           `json:"openapi"`
+	Info       Info                             `json:"info"`
+	Paths      map[string]map[string]*Operation `json:"paths"`
+	Components Components                       `json:"components"`
+}
+
+// Info describes the API.
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// Components holds the schemas and security schemes referenced by the operations.
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes"`
+}
+
+// SecurityScheme is an OpenAPI security scheme.
+type SecurityScheme struct {
+	Type        string `json:"type"`
+	In          string `json:"in"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// Operation is an OpenAPI operation object.
+type Operation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []*Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []map[string][]string `json:"security"`
+}
+
+// Parameter is an OpenAPI parameter object.
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Required    bool    `json:"required,omitempty"`
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// RequestBody is an OpenAPI request body object.
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+// Response is an OpenAPI response object.
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+// MediaType is an OpenAPI media type object.
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+var pathParam = regexp.MustCompile(`\{([^}]+)\}`)
+
+// Build returns the document of the routes, with the schemas of their request and response
+// types generated for the types of pkg.
+func Build(info Info, pkg string, routes []Route) *Document {
+	generator := NewGenerator(pkg)
+
+	doc := &Document{
+		OpenAPI: "3.0.3",
+		Info:    info,
+		Paths:   map[string]map[string]*Operation{},
+		Components: Components{
+			SecuritySchemes: map[string]*SecurityScheme{
+				SecuritySchemeName: {
+					Type:        "apiKey",
+					In:          "header",
+					Name:        "X-API-Key",
+					Description: "Each route needs its own key, named in the operation description.",
+				},
+			},
+		},
+	}
+
+	for _, op := range routes {
+		operation := &Operation{
+			OperationID: operationID(op.Method, op.Path),
+			Summary:     op.Summary,
+			Responses:   map[string]*Response{},
+			Security:    []map[string][]string{},
+		}
+		if op.Tag != "" {
+			operation.Tags = []string{op.Tag}
+		}
+		if op.KeyName != "" {
+			operation.Description = "Requires `" + op.KeyName + "`."
+			operation.Security = []map[string][]string{{SecuritySchemeName: {}}}
+		}
+
+		for _, match := range pathParam.FindAllStringSubmatch(op.Path, -1) {
+			operation.Parameters = append(operation.Parameters, &Parameter{
+				Name:     match[1],
+				In:       "path",
+				Required: true,
+				Schema:   &Schema{Type: "string"},
+			})
+		}
+		for _, param := range op.Query {
+			operation.Parameters = append(operation.Parameters, param.parameter("query"))
+		}
+		for _, param := range op.Headers {
+			operation.Parameters = append(operation.Parameters, param.parameter("header"))
+		}
+
+		if op.Request != nil {
+			operation.RequestBody = &RequestBody{
+				Required: true,
+				Content: map[string]*MediaType{
+					"application/json": {Schema: generator.SchemaOf(op.Request)},
+				},
+			}
+		}
+
+		statuses := make([]int, 0, len(op.Responses))
+		for status := range op.Responses {
+			statuses = append(statuses, status)
+		}
+		sort.Ints(statuses)
+		for _, status := range statuses {
+			body := op.Responses[status]
+			response := &Response{Description: body.Description}
+			switch {
+			case body.Type != nil:
+				contentType := body.ContentType
+				if contentType == "" {
+					contentType = "application/json"
+				}
+				response.Content = map[string]*MediaType{
+					contentType: {Schema: generator.SchemaOf(body.Type)},
+				}
+			case body.ContentType != "":
+				response.Content = map[string]*MediaType{
+					body.ContentType: {Schema: &Schema{Type: "string"}},
+				}
+			}
+			if response.Description == "" {
+				response.Description = http.StatusText(status)
+			}
+			operation.Responses[strconv.Itoa(status)] = response
+		}
+
+		if doc.Paths[op.Path] == nil {
+			doc.Paths[op.Path] = map[string]*Operation{}
+		}
+		doc.Paths[op.Path][strings.ToLower(op.Method)] = operation
+	}
+
+	doc.Components.Schemas = generator.Schemas()
+
+	return doc
+}
+
+// Has reports whether the document describes the method on the path.
+func (d *Document) Has(method, path string) bool {
+	_, exists := d.Paths[path][strings.ToLower(method)]
+
+	return exists
+}
+
+// operationID turns "GET /envs/{name}/logs" into "getEnvsNameLogs".
+func operationID(method, path string) string {
+	var builder strings.Builder
+	builder.WriteString(strings.ToLower(method))
+	for _, part := range strings.FieldsFunc(path, func(r rune) bool {
+		return r == '/' || r == '{' || r == '}' || r == '-' || r == '.' || r == '_' || r == ':'
+	}) {
+		builder.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+
+	return builder.String()
+}
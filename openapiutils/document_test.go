@@ -0,0 +1,70 @@
+package openapiutils_test
+
+import (
+	"helm-api/openapiutils"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type createRequest struct {
+	Name string `json:"name"`
+}
+
+type createResponse struct {
+	Message string `json:"message"`
+}
+
+func TestBuild(t *testing.T) {
+	doc := openapiutils.Build(openapiutils.Info{Title: "test", Version: "1"}, "helm-api/openapiutils_test", []openapiutils.Route{
+		{
+			Method:  http.MethodPost,
+			Path:    "/teams/{team}/envs",
+			Summary: "Create an environment",
+			KeyName: "CREATE_KEY",
+			Query:   []openapiutils.Param{{Name: "dryRun", Type: "boolean"}},
+			Headers: []openapiutils.Param{{Name: "Idempotency-Key"}},
+			Request: createRequest{},
+			Responses: map[int]openapiutils.Body{
+				http.StatusCreated:      {Type: createResponse{}},
+				http.StatusUnauthorized: {ContentType: "text/plain"},
+				http.StatusConflict:     {Type: createResponse{}, ContentType: "application/problem+json"},
+			},
+		},
+		{
+			Method: http.MethodGet,
+			Path:   "/livez",
+			Responses: map[int]openapiutils.Body{
+				http.StatusOK: {Description: "Alive"},
+			},
+		},
+	})
+
+	assert.True(t, doc.Has(http.MethodPost, "/teams/{team}/envs"))
+	assert.True(t, doc.Has(http.MethodGet, "/livez"))
+	assert.False(t, doc.Has(http.MethodGet, "/teams/{team}/envs"))
+	assert.False(t, doc.Has(http.MethodGet, "/missing"))
+
+	create := doc.Paths["/teams/{team}/envs"]["post"]
+	assert.Equal(t, "postTeamsTeamEnvs", create.OperationID)
+	assert.Equal(t, "Requires `CREATE_KEY`.", create.Description)
+	assert.Equal(t, []map[string][]string{{openapiutils.SecuritySchemeName: {}}}, create.Security)
+	require.Len(t, create.Parameters, 3)
+	assert.Equal(t, &openapiutils.Parameter{Name: "team", In: "path", Required: true, Schema: &openapiutils.Schema{Type: "string"}}, create.Parameters[0])
+	assert.Equal(t, &openapiutils.Parameter{Name: "dryRun", In: "query", Schema: &openapiutils.Schema{Type: "boolean"}}, create.Parameters[1])
+	assert.Equal(t, &openapiutils.Parameter{Name: "Idempotency-Key", In: "header", Schema: &openapiutils.Schema{Type: "string"}}, create.Parameters[2])
+	assert.Equal(t, "#/components/schemas/createRequest", create.RequestBody.Content["application/json"].Schema.Ref)
+	assert.Equal(t, "Created", create.Responses["201"].Description)
+	assert.Equal(t, "#/components/schemas/createResponse", create.Responses["201"].Content["application/json"].Schema.Ref)
+	assert.Contains(t, create.Responses["401"].Content, "text/plain")
+	assert.Equal(t, "#/components/schemas/createResponse", create.Responses["409"].Content["application/problem+json"].Schema.Ref)
+	assert.Contains(t, doc.Components.Schemas, "createRequest")
+	assert.Contains(t, doc.Components.Schemas, "createResponse")
+
+	livez := doc.Paths["/livez"]["get"]
+	assert.Empty(t, livez.Security, "public routes override the global security")
+	assert.Nil(t, livez.RequestBody)
+	assert.Empty(t, livez.Responses["200"].Content)
+}
@@ -0,0 +1,59 @@
+package openapiutils
+
+import (
+	"embed"
+	"encoding/json"
+	"helm-api/problemutils"
+	"html/template"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed swagger.html
+var swaggerPage string
+
+// Swagger UI is vendored so the docs don't load scripts from a third party CDN.
+//
+//go:embed swagger-ui/swagger-ui.css swagger-ui/swagger-ui-bundle.js
+var swaggerAssets embed.FS
+
+var swaggerTemplate = template.Must(template.New("swagger").Parse(swaggerPage))
+
+// Handler serves the document as JSON. It is encoded once, the routes don't change at runtime.
+func Handler(doc *Document) http.HandlerFunc {
+	body, err := json.MarshalIndent(doc, "", "  ")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err != nil {
+			problemutils.Write(w, r, problemutils.New(problemutils.CodeInternal, "Failed to encode OpenAPI document", err))
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	}
+}
+
+// DocsHandler serves a Swagger UI page browsing the document at specURL, with the
+// scripts and styles served by AssetsHandler under assetsURL.
+func DocsHandler(specURL, assetsURL string) http.HandlerFunc {
+	page := struct{ Spec, Assets string }{Spec: specURL, Assets: assetsURL}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := swaggerTemplate.Execute(w, page); err != nil {
+			http.Error(w, "Failed to render docs", http.StatusInternalServerError)
+
+			return
+		}
+	}
+}
+
+// AssetsHandler serves the vendored Swagger UI files below prefix.
+func AssetsHandler(prefix string) http.Handler {
+	assets, _ := fs.Sub(swaggerAssets, "swagger-ui")
+
+	return http.StripPrefix(prefix, http.FileServer(http.FS(assets)))
+}
@@ -0,0 +1,58 @@
+package openapiutils_test
+
+import (
+	"encoding/json"
+	"helm-api/openapiutils"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler(t *testing.T) {
+	doc := openapiutils.Build(openapiutils.Info{Title: "test", Version: "1"}, "", nil)
+
+	recorder := httptest.NewRecorder()
+	openapiutils.Handler(doc)(recorder, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+
+	var served map[string]interface{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &served))
+	assert.Equal(t, "3.0.3", served["openapi"])
+
+	recorder = httptest.NewRecorder()
+	openapiutils.DocsHandler("/spec.json", "/docs")(recorder, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), `\/spec.json`)
+	assert.Contains(t, recorder.Body.String(), "SwaggerUIBundle")
+	assert.Contains(t, recorder.Body.String(), `src="/docs/swagger-ui-bundle.js"`)
+	assert.NotContains(t, recorder.Body.String(), "https://")
+	assert.NotContains(t, recorder.Body.String(), "persistAuthorization")
+}
+
+func TestAssetsHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		path        string
+		wantStatus  int
+		contentType string
+	}{
+		{"bundle", "/docs/swagger-ui-bundle.js", http.StatusOK, "text/javascript; charset=utf-8"},
+		{"styles", "/docs/swagger-ui.css", http.StatusOK, "text/css; charset=utf-8"},
+		{"not vendored", "/docs/swagger-ui.js", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			openapiutils.AssetsHandler("/docs").ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			assert.Equal(t, tt.wantStatus, recorder.Code)
+			if tt.contentType != "" {
+				assert.Equal(t, tt.contentType, recorder.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package openapiutils
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Schema is an OpenAPI 3.0 schema object.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	durationType      = reflect.TypeOf(time.Duration(0))
+	rawMessageType    = reflect.TypeOf(json.RawMessage{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// Generator derives schemas from Go types the way encoding/json serializes them. Named structs
+// are collected as components and referenced.
+type Generator struct {
+	// Package is the import path whose type names are used as is. Types of other packages are
+	// prefixed with their package name, e.g. quotautils.Report becomes QuotaReport.
+	Package string
+
+	schemas map[string]*Schema
+	names   map[reflect.Type]string
+}
+
+// NewGenerator returns a generator for the types of pkg.
+func NewGenerator(pkg string) *Generator {
+	return &Generator{
+		Package: pkg,
+		schemas: map[string]*Schema{},
+		names:   map[reflect.Type]string{},
+	}
+}
+
+// Schemas returns the component schemas collected so far.
+func (g *Generator) Schemas() map[string]*Schema {
+	return g.schemas
+}
+
+// SchemaOf returns the schema of the type of v.
+func (g *Generator) SchemaOf(v interface{}) *Schema {
+	return g.schema(reflect.TypeOf(v))
+}
+
+func (g *Generator) schema(t reflect.Type) *Schema {
+	if t == nil {
+
+		return &Schema{}
+	}
+
+	switch t {
+	case timeType:
+
+		return &Schema{Type: "string", Format: "date-time"}
+	case durationType:
+
+		return &Schema{Type: "integer", Format: "int64", Description: "nanoseconds"}
+	case rawMessageType:
+
+		return &Schema{}
+	}
+
+	if t.Kind() == reflect.Pointer {
+		schema := g.schema(t.Elem())
+		if schema.Ref != "" {
+
+			return schema
+		}
+		schema.Nullable = true
+
+		return schema
+	}
+
+	// Types with their own encoding, like resource quantities, serialize to strings.
+	if t.Kind() == reflect.Struct && (reflect.PointerTo(t).Implements(jsonMarshalerType) ||
+		reflect.PointerTo(t).Implements(textMarshalerType)) {
+
+		return &Schema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+
+		return &Schema{Type: "number"}
+	case reflect.String:
+
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+
+			return &Schema{Type: "string", Format: "byte"}
+		}
+
+		return &Schema{Type: "array", Items: g.schema(t.Elem())}
+	case reflect.Map:
+
+		return &Schema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+	case reflect.Struct:
+
+		return g.structRef(t)
+	}
+
+	// Interfaces accept any value.
+	return &Schema{}
+}
+
+// structRef registers the struct as a component and returns a reference to it.
+func (g *Generator) structRef(t reflect.Type) *Schema {
+	if t.Name() == "" {
+
+		return g.structSchema(t)
+	}
+
+	name, exists := g.names[t]
+	if !exists {
+		name = g.componentName(t)
+		g.names[t] = name
+		// Registered before the fields so recursive types end up referencing themselves.
+		g.schemas[name] = &Schema{}
+		*g.schemas[name] = *g.structSchema(t)
+	}
+
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+func (g *Generator) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" && options == "" {
+			continue
+		}
+
+		// Embedded structs without a name are inlined by encoding/json.
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				inlined := g.structSchema(embedded)
+				for property, propertySchema := range inlined.Properties {
+					schema.Properties[property] = propertySchema
+				}
+				schema.Required = append(schema.Required, inlined.Required...)
+				continue
+			}
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		schema.Properties[name] = g.schema(field.Type)
+		if !strings.Contains(options, "omitempty") && field.Type.Kind() != reflect.Pointer {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+
+	return schema
+}
+
+func (g *Generator) componentName(t reflect.Type) string {
+	if t.PkgPath() == g.Package {
+
+		return t.Name()
+	}
+
+	pkg := t.PkgPath()
+	pkg = strings.TrimSuffix(pkg[strings.LastIndex(pkg, "/")+1:], "utils")
+	prefix := []rune(pkg)
+	prefix[0] = unicode.ToUpper(prefix[0])
+	if strings.HasPrefix(t.Name(), string(prefix)) {
+
+		return t.Name()
+	}
+
+	name := string(prefix) + t.Name()
+	// Another package may reduce to the same name.
+	for other, taken := range g.names {
+		if taken == name && other != t {
+			name = strings.ReplaceAll(t.PkgPath(), "/", "_") + "_" + t.Name()
+
+			break
+		}
+	}
+
+	return name
+}
@@ -0,0 +1,70 @@
+package openapiutils_test
+
+import (
+	"encoding/json"
+	"helm-api/openapiutils"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+type Base struct {
+	ID string `json:"id"`
+}
+
+type Node struct {
+	Base
+	Name     string            `json:"name"`
+	Note     string            `json:"note,omitempty"`
+	Parent   *Node             `json:"parent,omitempty"`
+	Children []Node            `json:"children"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Created  time.Time         `json:"created"`
+	Timeout  time.Duration     `json:"timeout"`
+	Count    *int              `json:"count"`
+	Size     resource.Quantity `json:"size"`
+	Raw      json.RawMessage   `json:"raw,omitempty"`
+	Data     []byte            `json:"data,omitempty"`
+	Skipped  string            `json:"-"`
+	Untagged bool
+	hidden   string
+}
+
+func TestSchemaOf(t *testing.T) {
+	generator := openapiutils.NewGenerator("helm-api/openapiutils_test")
+
+	schema := generator.SchemaOf(Node{})
+	assert.Equal(t, "#/components/schemas/Node", schema.Ref)
+
+	node := generator.Schemas()["Node"]
+	require.NotNil(t, node)
+	assert.Equal(t, "object", node.Type)
+	assert.ElementsMatch(t, []string{"id", "name", "children", "created", "timeout", "size", "Untagged"}, node.Required)
+	assert.NotContains(t, node.Properties, "Skipped")
+	assert.NotContains(t, node.Properties, "hidden")
+
+	assert.Equal(t, &openapiutils.Schema{Type: "string"}, node.Properties["id"])
+	assert.Equal(t, "#/components/schemas/Node", node.Properties["parent"].Ref)
+	assert.Equal(t, "#/components/schemas/Node", node.Properties["children"].Items.Ref)
+	assert.Equal(t, &openapiutils.Schema{Type: "object", AdditionalProperties: &openapiutils.Schema{Type: "string"}}, node.Properties["labels"])
+	assert.Equal(t, "date-time", node.Properties["created"].Format)
+	assert.Equal(t, "int64", node.Properties["timeout"].Format)
+	assert.Equal(t, &openapiutils.Schema{Type: "integer", Format: "int32", Nullable: true}, node.Properties["count"])
+	assert.Equal(t, &openapiutils.Schema{Type: "string"}, node.Properties["size"])
+	assert.Equal(t, &openapiutils.Schema{}, node.Properties["raw"])
+	assert.Equal(t, "byte", node.Properties["data"].Format)
+	assert.Equal(t, "boolean", node.Properties["Untagged"].Type)
+}
+
+func TestSchemaOfOtherPackages(t *testing.T) {
+	generator := openapiutils.NewGenerator("helm-api/client")
+
+	generator.SchemaOf(openapiutils.Info{})
+	generator.SchemaOf([]openapiutils.Route{})
+
+	assert.Contains(t, generator.Schemas(), "OpenapiInfo")
+	assert.Contains(t, generator.Schemas(), "OpenapiRoute")
+}
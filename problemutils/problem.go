@@ -0,0 +1,136 @@
+package problemutils
+
+import (
+	"encoding/json"
+	"helm-api/quotautils"
+	"net/http"
+)
+
+// ContentType is the media type of error responses.
+const ContentType = "application/problem+json"
+
+// TypePrefix prefixes the code of a problem to form its type URI.
+const TypePrefix = "urn:helm-api:problem:"
+
+// Code is the machine-readable category of a failure, shared by the HTTP and gRPC APIs.
+type Code string
+
+const (
+	// CodeEnvNotFound is returned for environments that don't exist.
+	CodeEnvNotFound Code = "ENV_NOT_FOUND"
+	// CodeEnvAlreadyExists is returned when creating an environment that exists.
+	CodeEnvAlreadyExists Code = "ENV_ALREADY_EXISTS"
+	// CodeValidationFailed is returned when a request, or the chart values it sets, are invalid.
+	CodeValidationFailed Code = "VALIDATION_FAILED"
+	// CodeHelmTimeout is returned when a Helm action didn't complete in time.
+	CodeHelmTimeout Code = "HELM_TIMEOUT"
+	// CodeClusterUnreachable is returned when the Kubernetes API can't be reached.
+	CodeClusterUnreachable Code = "CLUSTER_UNREACHABLE"
+	// CodeQuotaExceeded is returned when a change would exceed the team quota.
+	CodeQuotaExceeded Code = "QUOTA_EXCEEDED"
+	// CodeEnvLocked is returned when another operation on the environment is in progress.
+	CodeEnvLocked Code = "ENV_LOCKED"
+
+	// CodeUnauthorized is returned when the API key is missing or doesn't grant the route.
+	CodeUnauthorized Code = "UNAUTHORIZED"
+	// CodeForbidden is returned when the key is valid but not allowed to perform the action.
+	CodeForbidden Code = "FORBIDDEN"
+	// CodeNotFound is returned for routes and environment resources, like pods, that don't exist.
+	CodeNotFound Code = "NOT_FOUND"
+	// CodeMethodNotAllowed is returned when the route doesn't support the method.
+	CodeMethodNotAllowed Code = "METHOD_NOT_ALLOWED"
+	// CodeUpgradeRequired is returned when a tunnel is requested without a connection upgrade.
+	CodeUpgradeRequired Code = "UPGRADE_REQUIRED"
+	// CodeTimeout is returned when an environment service, like its database, timed out.
+	CodeTimeout Code = "TIMEOUT"
+	// CodeUpstreamFailed is returned when an environment service failed the request.
+	CodeUpstreamFailed Code = "UPSTREAM_FAILED"
+	// CodeUnavailable is returned when an environment service has no ready pod.
+	CodeUnavailable Code = "UNAVAILABLE"
+	// CodeIdempotencyKeyMismatch is returned when an idempotency key is sent again with another request.
+	CodeIdempotencyKeyMismatch Code = "IDEMPOTENCY_KEY_MISMATCH"
+	// CodeInternal is returned for every other failure.
+	CodeInternal Code = "INTERNAL_ERROR"
+)
+
+var statuses = map[Code]int{
+	CodeEnvNotFound:            http.StatusNotFound,
+	CodeEnvAlreadyExists:       http.StatusConflict,
+	CodeValidationFailed:       http.StatusBadRequest,
+	CodeHelmTimeout:            http.StatusGatewayTimeout,
+	CodeClusterUnreachable:     http.StatusServiceUnavailable,
+	CodeQuotaExceeded:          http.StatusForbidden,
+	CodeEnvLocked:              http.StatusConflict,
+	CodeUnauthorized:           http.StatusUnauthorized,
+	CodeForbidden:              http.StatusForbidden,
+	CodeNotFound:               http.StatusNotFound,
+	CodeMethodNotAllowed:       http.StatusMethodNotAllowed,
+	CodeUpgradeRequired:        http.StatusUpgradeRequired,
+	CodeTimeout:                http.StatusGatewayTimeout,
+	CodeUpstreamFailed:         http.StatusBadGateway,
+	CodeUnavailable:            http.StatusServiceUnavailable,
+	CodeIdempotencyKeyMismatch: http.StatusUnprocessableEntity,
+	CodeInternal:               http.StatusInternalServerError,
+}
+
+// Codes lists every code, in the order they are documented.
+var Codes = []Code{
+	CodeEnvNotFound, CodeEnvAlreadyExists, CodeValidationFailed, CodeHelmTimeout, CodeClusterUnreachable, CodeQuotaExceeded,
+	CodeEnvLocked, CodeUnauthorized, CodeForbidden, CodeNotFound, CodeMethodNotAllowed, CodeUpgradeRequired, CodeTimeout,
+	CodeUpstreamFailed, CodeUnavailable, CodeIdempotencyKeyMismatch, CodeInternal,
+}
+
+// Status returns the HTTP status of the code, 500 for unknown codes.
+func (c Code) Status() int {
+	if status, exists := statuses[c]; exists {
+
+		return status
+	}
+
+	return http.StatusInternalServerError
+}
+
+// Problem is an RFC 7807 problem details response.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Code     Code   `json:"code"`
+	// Message and Error repeat Title and Detail under the names of the earlier error responses.
+	Message string `json:"message"`
+	Error   string `json:"error,omitempty"`
+	// Quota is the evaluated quota when Code is QUOTA_EXCEEDED.
+	Quota *quotautils.Report `json:"quota,omitempty"`
+}
+
+// New returns the problem of a failure. Title summarizes the step that failed and err, which
+// may be nil, is the cause.
+func New(code Code, title string, err error) *Problem {
+	problem := &Problem{
+		Type:    TypePrefix + string(code),
+		Title:   title,
+		Status:  code.Status(),
+		Code:    code,
+		Message: title,
+	}
+	if err != nil {
+		problem.Detail = err.Error()
+		problem.Error = problem.Detail
+	}
+
+	return problem
+}
+
+// Write sends the problem with its status, using the request path as instance when it has none.
+func Write(w http.ResponseWriter, r *http.Request, problem *Problem) {
+	if problem.Instance == "" && r != nil {
+		problem.Instance = r.URL.Path
+	}
+
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(problem.Status)
+	// The status is already sent, so an encoding failure can't be reported.
+	_ = json.NewEncoder(w).Encode(problem)
+}
@@ -0,0 +1,61 @@
+package problemutils_test
+
+import (
+	"encoding/json"
+	"errors"
+	"helm-api/problemutils"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCodeStatus(t *testing.T) {
+	assert.Equal(t, http.StatusNotFound, problemutils.CodeEnvNotFound.Status())
+	assert.Equal(t, http.StatusConflict, problemutils.CodeEnvAlreadyExists.Status())
+	assert.Equal(t, http.StatusBadRequest, problemutils.CodeValidationFailed.Status())
+	assert.Equal(t, http.StatusGatewayTimeout, problemutils.CodeHelmTimeout.Status())
+	assert.Equal(t, http.StatusServiceUnavailable, problemutils.CodeClusterUnreachable.Status())
+	assert.Equal(t, http.StatusForbidden, problemutils.CodeQuotaExceeded.Status())
+	assert.Equal(t, http.StatusUnprocessableEntity, problemutils.CodeIdempotencyKeyMismatch.Status())
+	assert.Equal(t, http.StatusInternalServerError, problemutils.Code("UNKNOWN").Status())
+
+	for _, code := range problemutils.Codes {
+		assert.NotZero(t, code.Status(), code)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/v1/envs/demo", nil)
+
+	problem := problemutils.New(problemutils.CodeEnvNotFound, "Environment not found", errors.New("no environment named demo"))
+	problemutils.Write(recorder, req, problem)
+
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	assert.Equal(t, problemutils.ContentType, recorder.Header().Get("Content-Type"))
+
+	var body map[string]interface{}
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&body))
+	assert.Equal(t, map[string]interface{}{
+		"type":     "urn:helm-api:problem:ENV_NOT_FOUND",
+		"title":    "Environment not found",
+		"status":   float64(http.StatusNotFound),
+		"detail":   "no environment named demo",
+		"instance": "/v1/envs/demo",
+		"code":     "ENV_NOT_FOUND",
+		"message":  "Environment not found",
+		"error":    "no environment named demo",
+	}, body)
+}
+
+func TestNewWithoutCause(t *testing.T) {
+	problem := problemutils.New(problemutils.CodeUnauthorized, "Unauthorized", nil)
+
+	assert.Equal(t, http.StatusUnauthorized, problem.Status)
+	assert.Empty(t, problem.Detail)
+	assert.Empty(t, problem.Error)
+	assert.Equal(t, "Unauthorized", problem.Message)
+}
@@ -0,0 +1,280 @@
+package quotautils
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v2"
+	"helm.sh/helm/v3/pkg/release"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	// TeamLabel is the Helm release label recording the owning team.
+	TeamLabel = "helm-api/team"
+	// ExpiresAtLabel is the Helm release label recording the environment expiry (unix seconds).
+	ExpiresAtLabel = "helm-api/expires-at"
+	// DefaultTeam is the team of the API keys that aren't bound to one.
+	DefaultTeam = "default"
+)
+
+// Policy describes the limits applied to a single team. Zero values mean unlimited.
+type Policy struct {
+	MaxEnvironments int    `yaml:"maxEnvironments" json:"maxEnvironments,omitempty"`
+	MaxCPU          string `yaml:"maxCPU" json:"maxCPU,omitempty"`
+	MaxMemory       string `yaml:"maxMemory" json:"maxMemory,omitempty"`
+	MaxPVCSize      string `yaml:"maxPVCSize" json:"maxPVCSize,omitempty"`
+	MaxTTL          string `yaml:"maxTTL" json:"maxTTL,omitempty"`
+}
+
+// Config holds the default policy and the per-team overrides.
+type Config struct {
+	Default Policy            `yaml:"default"`
+	Teams   map[string]Policy `yaml:"teams"`
+}
+
+// LoadConfig reads quota policies from a YAML file. An empty path disables quotas.
+func LoadConfig(path string) (*Config, error) {
+	if path == "" {
+
+		return &Config{}, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+
+		return nil, fmt.Errorf("failed to read quota file: %w", err)
+	}
+
+	var config Config
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+
+		return nil, fmt.Errorf("failed to parse quota file: %w", err)
+	}
+
+	if err := config.Default.validate(); err != nil {
+
+		return nil, fmt.Errorf("default policy: %w", err)
+	}
+
+	for team, policy := range config.Teams {
+		if err := policy.validate(); err != nil {
+
+			return nil, fmt.Errorf("policy for team %s: %w", team, err)
+		}
+	}
+
+	return &config, nil
+}
+
+// PolicyFor returns the policy of the team, falling back to the default policy.
+func (c *Config) PolicyFor(team string) Policy {
+	if policy, exists := c.Teams[team]; exists {
+
+		return policy
+	}
+
+	return c.Default
+}
+
+func (p Policy) validate() error {
+	for _, limit := range []string{p.MaxCPU, p.MaxMemory, p.MaxPVCSize} {
+		if limit == "" {
+			continue
+		}
+		if _, err := resource.ParseQuantity(limit); err != nil {
+
+			return fmt.Errorf("invalid quantity %q: %w", limit, err)
+		}
+	}
+
+	if p.MaxTTL != "" {
+		if _, err := time.ParseDuration(p.MaxTTL); err != nil {
+
+			return fmt.Errorf("invalid ttl %q: %w", p.MaxTTL, err)
+		}
+	}
+
+	return nil
+}
+
+// Item is a single line of a quota report.
+type Item struct {
+	Resource  string `json:"resource"`
+	Limit     string `json:"limit,omitempty"`
+	Used      string `json:"used"`
+	Requested string `json:"requested,omitempty"`
+	Exceeded  bool   `json:"exceeded,omitempty"`
+}
+
+// Report is the quota breakdown returned to callers.
+type Report struct {
+	Team    string `json:"team"`
+	Allowed bool   `json:"allowed"`
+	Items   []Item `json:"items"`
+}
+
+// Check compares current usage plus the requested resources against the policy.
+func (p Policy) Check(team string, used, requested Resources, ttl time.Duration) *Report {
+	report := &Report{Team: team, Allowed: true}
+
+	add := func(item Item) {
+		if item.Exceeded {
+			report.Allowed = false
+		}
+		report.Items = append(report.Items, item)
+	}
+
+	envs := Item{
+		Resource: "environments",
+		Used:     fmt.Sprint(used.Environments),
+	}
+	if requested.Environments > 0 {
+		envs.Requested = fmt.Sprint(requested.Environments)
+	}
+	if p.MaxEnvironments > 0 {
+		envs.Limit = fmt.Sprint(p.MaxEnvironments)
+		envs.Exceeded = used.Environments+requested.Environments > p.MaxEnvironments
+	}
+	add(envs)
+
+	add(totalItem("cpu", p.MaxCPU, used.CPU, requested.CPU))
+	add(totalItem("memory", p.MaxMemory, used.Memory, requested.Memory))
+
+	// PVC size is a per-claim limit, so only the requested claims are checked.
+	pvc := Item{
+		Resource:  "pvcSize",
+		Used:      used.PVCSize.String(),
+		Requested: requested.PVCSize.String(),
+	}
+	if p.MaxPVCSize != "" {
+		limit := resource.MustParse(p.MaxPVCSize)
+		pvc.Limit = limit.String()
+		pvc.Exceeded = requested.PVCSize.Cmp(limit) > 0
+	}
+	add(pvc)
+
+	// TTL is fixed when an environment is created, so it only applies to new environments.
+	if p.MaxTTL != "" && requested.Environments > 0 {
+		limit, _ := time.ParseDuration(p.MaxTTL)
+		item := Item{
+			Resource: "ttl",
+			Limit:    limit.String(),
+			Used:     "-",
+		}
+		// Environments without a TTL never expire, which exceeds any limit.
+		if ttl > 0 {
+			item.Requested = ttl.String()
+		} else {
+			item.Requested = "unlimited"
+		}
+		item.Exceeded = ttl <= 0 || ttl > limit
+		add(item)
+	}
+
+	return report
+}
+
+func totalItem(name, limit string, used, requested resource.Quantity) Item {
+	item := Item{
+		Resource:  name,
+		Used:      used.String(),
+		Requested: requested.String(),
+	}
+
+	if limit != "" {
+		max := resource.MustParse(limit)
+		total := used.DeepCopy()
+		total.Add(requested)
+		item.Limit = max.String()
+		item.Exceeded = total.Cmp(max) > 0
+	}
+
+	return item
+}
+
+// ReleaseSource gives the enforcer access to rendered charts and existing releases.
+type ReleaseSource interface {
+	RenderManifests(ctx context.Context, chartName, releaseName string, values map[string]interface{}) (string, error)
+	ListReleaseDetails(ctx context.Context, selector string) ([]*release.Release, error)
+}
+
+// Enforcer evaluates quota policies against a release source.
+type Enforcer struct {
+	Config *Config
+	Source ReleaseSource
+}
+
+// Usage returns the resources currently consumed by the team, skipping the excluded release.
+func (e *Enforcer) Usage(ctx context.Context, team, exclude string) (Resources, error) {
+	var used Resources
+
+	releases, err := e.Source.ListReleaseDetails(ctx, TeamLabel+"="+team)
+	if err != nil {
+
+		return used, err
+	}
+
+	for _, rel := range releases {
+		if rel.Name == exclude {
+			continue
+		}
+
+		res, err := ManifestResources(rel.Manifest)
+		if err != nil {
+
+			return used, fmt.Errorf("failed to compute resources of %s: %w", rel.Name, err)
+		}
+
+		used.Add(res)
+		used.Environments++
+	}
+
+	return used, nil
+}
+
+// Check renders the chart with the given values and checks the result against the team policy.
+// The chart is named as in helmutils.RealClient.RenderManifests.
+// A new environment counts towards the environment limit, an existing one doesn't.
+func (e *Enforcer) Check(ctx context.Context, team, chartName, releaseName string, values map[string]interface{}, newEnv bool, ttl time.Duration) (*Report, error) {
+	manifest, err := e.Source.RenderManifests(ctx, chartName, releaseName, values)
+	if err != nil {
+
+		return nil, err
+	}
+
+	requested, err := ManifestResources(manifest)
+	if err != nil {
+
+		return nil, fmt.Errorf("failed to compute requested resources: %w", err)
+	}
+	if newEnv {
+		requested.Environments = 1
+	}
+
+	used, err := e.Usage(ctx, team, releaseName)
+	if err != nil {
+
+		return nil, err
+	}
+
+	return e.Config.PolicyFor(team).Check(team, used, requested, ttl), nil
+}
+
+// PolicyFor returns the policy of the team.
+func (e *Enforcer) PolicyFor(team string) Policy {
+	return e.Config.PolicyFor(team)
+}
+
+// Report returns the current usage of the team against its policy.
+func (e *Enforcer) Report(ctx context.Context, team string) (*Report, error) {
+	used, err := e.Usage(ctx, team, "")
+	if err != nil {
+
+		return nil, err
+	}
+
+	return e.Config.PolicyFor(team).Check(team, used, Resources{}, 0), nil
+}
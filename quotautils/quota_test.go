@@ -0,0 +1,164 @@
+package quotautils_test
+
+import (
+	"context"
+	"helm-api/quotautils"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+// MockReleaseSource is a mock implementation of the ReleaseSource interface.
+type MockReleaseSource struct {
+	mock.Mock
+}
+
+func (m *MockReleaseSource) RenderManifests(ctx context.Context, chartName, releaseName string, values map[string]interface{}) (string, error) {
+	args := m.Called(chartName, releaseName, values)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockReleaseSource) ListReleaseDetails(ctx context.Context, selector string) ([]*release.Release, error) {
+	args := m.Called(selector)
+	return args.Get(0).([]*release.Release), args.Error(1)
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	valid := filepath.Join(dir, "valid.yaml")
+	require.NoError(t, os.WriteFile(valid, []byte(`default:
+  maxEnvironments: 2
+teams:
+  qa:
+    maxEnvironments: 5
+    maxCPU: "2"
+    maxMemory: 4Gi
+    maxPVCSize: 10Gi
+    maxTTL: 72h
+`), 0644))
+
+	invalid := filepath.Join(dir, "invalid.yaml")
+	require.NoError(t, os.WriteFile(invalid, []byte(`default:
+  maxCPU: lots
+`), 0644))
+
+	config, err := quotautils.LoadConfig(valid)
+	require.NoError(t, err)
+	assert.Equal(t, 5, config.PolicyFor("qa").MaxEnvironments)
+	assert.Equal(t, 2, config.PolicyFor("unknown").MaxEnvironments)
+
+	_, err = quotautils.LoadConfig(invalid)
+	assert.Error(t, err)
+
+	_, err = quotautils.LoadConfig(filepath.Join(dir, "missing.yaml"))
+	assert.Error(t, err)
+
+	config, err = quotautils.LoadConfig("")
+	require.NoError(t, err)
+	assert.Equal(t, quotautils.Policy{}, config.PolicyFor("qa"))
+}
+
+func TestEnforcerCheck(t *testing.T) {
+	existing := []*release.Release{
+		{Name: "test-existing", Manifest: statefulSetManifest},
+	}
+
+	tests := []struct {
+		name        string
+		policy      quotautils.Policy
+		newEnv      bool
+		ttl         time.Duration
+		wantAllowed bool
+		wantExceed  []string
+	}{
+		{
+			name:        "unlimited policy",
+			policy:      quotautils.Policy{},
+			newEnv:      true,
+			wantAllowed: true,
+		},
+		{
+			name:        "environment limit reached",
+			policy:      quotautils.Policy{MaxEnvironments: 1},
+			newEnv:      true,
+			wantAllowed: false,
+			wantExceed:  []string{"environments"},
+		},
+		{
+			name:        "environment limit ignored for updates",
+			policy:      quotautils.Policy{MaxEnvironments: 1},
+			newEnv:      false,
+			wantAllowed: true,
+		},
+		{
+			name:        "cpu, memory and pvc limits",
+			policy:      quotautils.Policy{MaxCPU: "150m", MaxMemory: "1Gi", MaxPVCSize: "5Gi"},
+			newEnv:      true,
+			wantAllowed: false,
+			wantExceed:  []string{"cpu", "pvcSize"},
+		},
+		{
+			name:        "ttl within limit",
+			policy:      quotautils.Policy{MaxTTL: "24h"},
+			newEnv:      true,
+			ttl:         time.Hour,
+			wantAllowed: true,
+		},
+		{
+			name:        "missing ttl exceeds limit",
+			policy:      quotautils.Policy{MaxTTL: "24h"},
+			newEnv:      true,
+			wantAllowed: false,
+			wantExceed:  []string{"ttl"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := new(MockReleaseSource)
+			source.On("RenderManifests", "charts/test-new", "test-new", mock.Anything).Return(statefulSetManifest, nil)
+			source.On("ListReleaseDetails", quotautils.TeamLabel+"=qa").Return(existing, nil)
+
+			enforcer := &quotautils.Enforcer{
+				Config: &quotautils.Config{Teams: map[string]quotautils.Policy{"qa": tt.policy}},
+				Source: source,
+			}
+
+			report, err := enforcer.Check(context.Background(), "qa", "charts/test-new", "test-new", nil, tt.newEnv, tt.ttl)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantAllowed, report.Allowed)
+
+			var exceeded []string
+			for _, item := range report.Items {
+				if item.Exceeded {
+					exceeded = append(exceeded, item.Resource)
+				}
+			}
+			assert.Equal(t, tt.wantExceed, exceeded)
+
+			source.AssertExpectations(t)
+		})
+	}
+}
+
+func TestEnforcerUsageSkipsExcluded(t *testing.T) {
+	source := new(MockReleaseSource)
+	source.On("ListReleaseDetails", quotautils.TeamLabel+"=qa").Return([]*release.Release{
+		{Name: "test-one", Manifest: statefulSetManifest},
+		{Name: "test-two", Manifest: statefulSetManifest},
+	}, nil)
+
+	enforcer := &quotautils.Enforcer{Config: &quotautils.Config{}, Source: source}
+
+	used, err := enforcer.Usage(context.Background(), "qa", "test-two")
+	require.NoError(t, err)
+	assert.Equal(t, 1, used.Environments)
+	assert.Equal(t, "100m", used.CPU.String())
+}
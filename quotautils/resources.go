@@ -0,0 +1,112 @@
+package quotautils
+
+import (
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Resources is the amount of cluster resources requested by one or more environments.
+type Resources struct {
+	Environments int
+	CPU          resource.Quantity
+	Memory       resource.Quantity
+	// PVCSize is the largest single persistent volume claim.
+	PVCSize resource.Quantity
+}
+
+// Add accumulates other into r.
+func (r *Resources) Add(other Resources) {
+	r.Environments += other.Environments
+	r.CPU.Add(other.CPU)
+	r.Memory.Add(other.Memory)
+	if other.PVCSize.Cmp(r.PVCSize) > 0 {
+		r.PVCSize = other.PVCSize.DeepCopy()
+	}
+}
+
+// ManifestResources sums the CPU and memory requests and finds the largest PVC in a rendered manifest.
+func ManifestResources(manifest string) (Resources, error) {
+	var total Resources
+
+	for _, doc := range strings.Split(manifest, "\n---") {
+		if strings.TrimSpace(doc) == "" {
+			continue
+		}
+
+		var meta metav1.TypeMeta
+		if err := yaml.Unmarshal([]byte(doc), &meta); err != nil {
+
+			return total, fmt.Errorf("failed to parse manifest: %w", err)
+		}
+
+		var (
+			replicas  int32 = 1
+			podSpec   *corev1.PodSpec
+			claimSpec []corev1.PersistentVolumeClaim
+		)
+
+		switch meta.Kind {
+		case "Deployment":
+			var obj appsv1.Deployment
+			if err := yaml.Unmarshal([]byte(doc), &obj); err != nil {
+
+				return total, fmt.Errorf("failed to parse %s: %w", meta.Kind, err)
+			}
+			if obj.Spec.Replicas != nil {
+				replicas = *obj.Spec.Replicas
+			}
+			podSpec = &obj.Spec.Template.Spec
+		case "StatefulSet":
+			var obj appsv1.StatefulSet
+			if err := yaml.Unmarshal([]byte(doc), &obj); err != nil {
+
+				return total, fmt.Errorf("failed to parse %s: %w", meta.Kind, err)
+			}
+			if obj.Spec.Replicas != nil {
+				replicas = *obj.Spec.Replicas
+			}
+			podSpec = &obj.Spec.Template.Spec
+			claimSpec = obj.Spec.VolumeClaimTemplates
+		case "Pod":
+			var obj corev1.Pod
+			if err := yaml.Unmarshal([]byte(doc), &obj); err != nil {
+
+				return total, fmt.Errorf("failed to parse %s: %w", meta.Kind, err)
+			}
+			podSpec = &obj.Spec
+		case "PersistentVolumeClaim":
+			var obj corev1.PersistentVolumeClaim
+			if err := yaml.Unmarshal([]byte(doc), &obj); err != nil {
+
+				return total, fmt.Errorf("failed to parse %s: %w", meta.Kind, err)
+			}
+			claimSpec = []corev1.PersistentVolumeClaim{obj}
+		default:
+			continue
+		}
+
+		if podSpec != nil {
+			for _, container := range podSpec.Containers {
+				for i := int32(0); i < replicas; i++ {
+					total.CPU.Add(*container.Resources.Requests.Cpu())
+					total.Memory.Add(*container.Resources.Requests.Memory())
+				}
+			}
+		}
+
+		for _, claim := range claimSpec {
+			size := claim.Spec.Resources.Requests.Storage()
+			if size.Cmp(total.PVCSize) > 0 {
+				total.PVCSize = size.DeepCopy()
+			}
+		}
+	}
+
+	return total, nil
+}
@@ -0,0 +1,120 @@
+package quotautils_test
+
+import (
+	"helm-api/quotautils"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const statefulSetManifest = `---
+# Source: mariadb/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: test-chart1
+spec:
+  ports:
+    - port: 3306
+---
+# Source: mariadb/templates/statefulset.yaml
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: test-chart1
+spec:
+  replicas: 2
+  template:
+    spec:
+      containers:
+        - name: mariadb
+          image: mariadb:latest
+          resources:
+            requests:
+              cpu: 50m
+              memory: 125Mi
+  volumeClaimTemplates:
+    - metadata:
+        name: data
+      spec:
+        resources:
+          requests:
+            storage: 10Gi
+`
+
+func TestManifestResources(t *testing.T) {
+	tests := []struct {
+		name        string
+		manifest    string
+		wantCPU     string
+		wantMemory  string
+		wantPVCSize string
+		wantErr     bool
+	}{
+		{
+			name:        "statefulset with replicas and claims",
+			manifest:    statefulSetManifest,
+			wantCPU:     "100m",
+			wantMemory:  "250Mi",
+			wantPVCSize: "10Gi",
+		},
+		{
+			name: "deployment defaults to one replica",
+			manifest: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  template:
+    spec:
+      containers:
+        - name: app
+          resources:
+            requests:
+              cpu: "1"
+              memory: 1Gi
+---
+apiVersion: v1
+kind: PersistentVolumeClaim
+metadata:
+  name: extra
+spec:
+  resources:
+    requests:
+      storage: 5Gi
+`,
+			wantCPU:     "1",
+			wantMemory:  "1Gi",
+			wantPVCSize: "5Gi",
+		},
+		{
+			name:        "empty manifest",
+			manifest:    "",
+			wantCPU:     "0",
+			wantMemory:  "0",
+			wantPVCSize: "0",
+		},
+		{
+			name:     "invalid manifest",
+			manifest: "kind: [",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := quotautils.ManifestResources(tt.manifest)
+			if tt.wantErr {
+				assert.Error(t, err)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantCPU, res.CPU.String())
+			assert.Equal(t, tt.wantMemory, res.Memory.String())
+			assert.Equal(t, tt.wantPVCSize, res.PVCSize.String())
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package sqlutils
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrEmptyStatement is returned when the query holds no statement.
+	ErrEmptyStatement = errors.New("empty statement")
+	// ErrMultipleStatements is returned when the query holds more than one statement.
+	ErrMultipleStatements = errors.New("only a single statement is allowed")
+)
+
+// readOnlyKeywords are the leading keywords of statements that don't change data.
+var readOnlyKeywords = map[string]bool{
+	"SELECT":   true,
+	"SHOW":     true,
+	"DESCRIBE": true,
+	"DESC":     true,
+	"EXPLAIN":  true,
+	"WITH":     true,
+}
+
+// Limits bound the work done by a single query.
+type Limits struct {
+	MaxRows int
+	Timeout time.Duration
+}
+
+// Result is the outcome of a statement. Read statements fill Columns and Rows,
+// write statements fill RowsAffected.
+type Result struct {
+	Columns      []string        `json:"columns,omitempty"`
+	Rows         [][]interface{} `json:"rows,omitempty"`
+	RowsAffected int64           `json:"rowsAffected,omitempty"`
+	Truncated    bool            `json:"truncated,omitempty"`
+	DurationMs   int64           `json:"durationMs"`
+}
+
+// Normalize strips the comments and trailing semicolon of a single statement.
+// It fails when the query is empty or holds several statements.
+func Normalize(query string) (string, error) {
+	var (
+		quote     rune
+		statement strings.Builder
+		ended     bool
+	)
+
+	runes := []rune(query)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		next := rune(0)
+		if i+1 < len(runes) {
+			next = runes[i+1]
+		}
+
+		if quote != 0 {
+			statement.WriteRune(c)
+			if c == '\\' && quote != '`' && next != 0 {
+				statement.WriteRune(next)
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		}
+
+		switch {
+		case c == '-' && next == '-', c == '#':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+			statement.WriteRune(' ')
+			continue
+		case c == '/' && next == '*':
+			// Executable comments (/*! ... */) are dropped too, so they never reach the server.
+			for i += 2; i+1 < len(runes) && (runes[i] != '*' || runes[i+1] != '/'); i++ {
+			}
+			i++
+			statement.WriteRune(' ')
+			continue
+		}
+
+		if ended {
+			if c != ';' && !isSpace(c) {
+
+				return "", ErrMultipleStatements
+			}
+			continue
+		}
+
+		switch c {
+		case '\'', '"', '`':
+			quote = c
+		case ';':
+			ended = true
+			continue
+		}
+		statement.WriteRune(c)
+	}
+
+	normalized := strings.TrimSpace(statement.String())
+	if normalized == "" {
+
+		return "", ErrEmptyStatement
+	}
+
+	return normalized, nil
+}
+
+// IsReadOnly reports whether a normalized statement only reads data.
+func IsReadOnly(statement string) bool {
+	fields := strings.Fields(strings.ToUpper(statement))
+	if len(fields) == 0 || !readOnlyKeywords[strings.TrimLeft(fields[0], "(")] {
+
+		return false
+	}
+
+	// SELECT ... INTO OUTFILE writes to the server's filesystem.
+	for i := 0; i+1 < len(fields); i++ {
+		if fields[i] == "INTO" && (fields[i+1] == "OUTFILE" || fields[i+1] == "DUMPFILE") {
+
+			return false
+		}
+	}
+
+	return true
+}
+
+// Run executes a normalized statement in its own transaction. Read statements run in a
+// read-only transaction that is rolled back, write statements are committed.
+func Run(ctx context.Context, db *sql.DB, statement string, write bool, limits Limits) (*Result, error) {
+	if limits.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, limits.Timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: !write})
+	if err != nil {
+
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if write {
+		res, err := tx.ExecContext(ctx, statement)
+		if err != nil {
+
+			return nil, fmt.Errorf("statement failed: %w", err)
+		}
+
+		affected, err := res.RowsAffected()
+		if err != nil {
+
+			return nil, fmt.Errorf("failed to read affected rows: %w", err)
+		}
+
+		if err := tx.Commit(); err != nil {
+
+			return nil, fmt.Errorf("failed to commit: %w", err)
+		}
+
+		return &Result{RowsAffected: affected, DurationMs: time.Since(start).Milliseconds()}, nil
+	}
+
+	rows, err := tx.QueryContext(ctx, statement)
+	if err != nil {
+
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+
+		return nil, fmt.Errorf("failed to read columns: %w", err)
+	}
+
+	result := &Result{Columns: columns, Rows: [][]interface{}{}}
+	for rows.Next() {
+		if limits.MaxRows > 0 && len(result.Rows) == limits.MaxRows {
+			result.Truncated = true
+
+			break
+		}
+
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+
+			return nil, fmt.Errorf("failed to read row: %w", err)
+		}
+
+		// The driver returns text columns as bytes, which would be base64 encoded in JSON.
+		for i, value := range values {
+			if b, ok := value.([]byte); ok {
+				values[i] = string(b)
+			}
+		}
+		result.Rows = append(result.Rows, values)
+	}
+
+	if err := rows.Err(); err != nil {
+
+		return nil, fmt.Errorf("failed to read rows: %w", err)
+	}
+
+	result.DurationMs = time.Since(start).Milliseconds()
+
+	return result, nil
+}
+
+func isSpace(c rune) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
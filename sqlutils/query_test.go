@@ -0,0 +1,126 @@
+package sqlutils_test
+
+import (
+	"context"
+	"errors"
+	"helm-api/sqlutils"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		expected string
+		err      error
+	}{
+		{"plain", "SELECT * FROM users", "SELECT * FROM users", nil},
+		{"trailing semicolon", "  SELECT 1;\n", "SELECT 1", nil},
+		{"comments", "-- list users\nSELECT /* all */ * FROM users # done", "SELECT   * FROM users", nil},
+		{"semicolon in string", "SELECT * FROM users WHERE name = 'a;b'", "SELECT * FROM users WHERE name = 'a;b'", nil},
+		{"escaped quote", `SELECT 'it\'s; fine'`, `SELECT 'it\'s; fine'`, nil},
+		{"executable comment dropped", "SELECT 1 /*!; DROP TABLE users */", "SELECT 1", nil},
+		{"two statements", "SELECT 1; DROP TABLE users", "", sqlutils.ErrMultipleStatements},
+		{"statement after comment", "SELECT 1; -- note\nDELETE FROM users", "", sqlutils.ErrMultipleStatements},
+		{"empty", " ; -- nothing", "", sqlutils.ErrEmptyStatement},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statement, err := sqlutils.Normalize(tt.query)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, statement)
+		})
+	}
+}
+
+func TestIsReadOnly(t *testing.T) {
+	tests := []struct {
+		statement string
+		expected  bool
+	}{
+		{"SELECT * FROM users", true},
+		{"select id from users", true},
+		{"(SELECT 1) UNION (SELECT 2)", true},
+		{"SHOW TABLES", true},
+		{"DESCRIBE users", true},
+		{"EXPLAIN SELECT * FROM users", true},
+		{"WITH ids AS (SELECT id FROM users) SELECT * FROM ids", true},
+		{"SELECT * FROM users INTO OUTFILE '/tmp/users'", false},
+		{"INSERT INTO users VALUES (2, 'qa')", false},
+		{"UPDATE users SET name = 'x'", false},
+		{"DROP TABLE users", false},
+		{"SET GLOBAL read_only = 0", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.statement, func(t *testing.T) {
+			assert.Equal(t, tt.expected, sqlutils.IsReadOnly(tt.statement))
+		})
+	}
+}
+
+func TestRunRead(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id, name FROM users").WillReturnRows(
+		sqlmock.NewRows([]string{"id", "name"}).
+			AddRow(int64(1), []byte("admin")).
+			AddRow(int64(2), []byte("qa")).
+			AddRow(int64(3), nil),
+	)
+	mock.ExpectRollback()
+
+	result, err := sqlutils.Run(context.Background(), db, "SELECT id, name FROM users", false, sqlutils.Limits{MaxRows: 2, Timeout: time.Second})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"id", "name"}, result.Columns)
+	assert.Equal(t, [][]interface{}{{int64(1), "admin"}, {int64(2), "qa"}}, result.Rows)
+	assert.True(t, result.Truncated)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRunWrite(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE users").WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectCommit()
+
+	result, err := sqlutils.Run(context.Background(), db, "UPDATE users SET name = 'x'", true, sqlutils.Limits{})
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(3), result.RowsAffected)
+	assert.Nil(t, result.Rows)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRunFailure(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT").WillReturnError(errors.New("table doesn't exist"))
+	mock.ExpectRollback()
+
+	_, err = sqlutils.Run(context.Background(), db, "SELECT * FROM missing", false, sqlutils.Limits{})
+	assert.ErrorContains(t, err, "table doesn't exist")
+	assert.False(t, sqlutils.IsStatementError(err))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,120 @@
+package sqlutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"helm-api/kubeutils"
+	"strconv"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// portName is the name of the MariaDB port on the environment service.
+	portName = "mysql"
+	// defaultUser is used when the environment has no credentials secret (noAuth charts).
+	defaultUser = "root"
+)
+
+// ErrNoDatabase is returned when the release has no MariaDB service.
+var ErrNoDatabase = errors.New("no database service found")
+
+// Target is the database of an environment.
+type Target struct {
+	Host     string
+	Port     int32
+	User     string
+	Password string
+	Database string
+}
+
+// ResolveTarget finds the MariaDB service of the release and its credentials. Credentials are
+// read from the "<service>-creds" secret when it exists, otherwise root without a password is used.
+func ResolveTarget(ctx context.Context, client kubernetes.Interface, namespace, releaseName string) (*Target, error) {
+	services, err := client.CoreV1().Services(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: kubeutils.InstanceLabel + "=" + releaseName,
+	})
+	if err != nil {
+
+		return nil, fmt.Errorf("failed to list services: %w", err)
+	}
+
+	var target *Target
+	for _, service := range services.Items {
+		if port, ok := databasePort(service); ok {
+			target = &Target{
+				Host: service.Name + "." + namespace + ".svc",
+				Port: port,
+				User: defaultUser,
+			}
+
+			secret, err := client.CoreV1().Secrets(namespace).Get(ctx, service.Name+"-creds", metav1.GetOptions{})
+			if err != nil && !apierrors.IsNotFound(err) {
+
+				return nil, fmt.Errorf("failed to read database credentials: %w", err)
+			}
+			if err == nil {
+				target.User = string(secret.Data["username"])
+				target.Password = string(secret.Data["password"])
+			}
+
+			break
+		}
+	}
+
+	if target == nil {
+
+		return nil, fmt.Errorf("%w for %s", ErrNoDatabase, releaseName)
+	}
+
+	return target, nil
+}
+
+// Resolver finds the databases of the releases in a namespace.
+type Resolver struct {
+	Client    kubernetes.Interface
+	Namespace string
+}
+
+// ResolveTarget finds the database of the release, see ResolveTarget.
+func (r *Resolver) ResolveTarget(ctx context.Context, releaseName string) (*Target, error) {
+	return ResolveTarget(ctx, r.Client, r.Namespace, releaseName)
+}
+
+// DSN returns the driver connection string of the target.
+func (t *Target) DSN(timeout time.Duration) string {
+	config := mysql.NewConfig()
+	config.Net = "tcp"
+	config.Addr = t.Host + ":" + strconv.Itoa(int(t.Port))
+	config.User = t.User
+	config.Passwd = t.Password
+	config.DBName = t.Database
+	config.Timeout = timeout
+
+	return config.FormatDSN()
+}
+
+// IsStatementError reports whether the server rejected the statement itself (syntax, privileges,
+// writes in a read-only transaction) rather than the connection failing.
+func IsStatementError(err error) bool {
+	var mysqlErr *mysql.MySQLError
+
+	return errors.As(err, &mysqlErr)
+}
+
+func databasePort(service corev1.Service) (int32, bool) {
+	for _, port := range service.Spec.Ports {
+		if port.Name == portName || port.Port == 3306 {
+
+			return port.Port, true
+		}
+	}
+
+	return 0, false
+}
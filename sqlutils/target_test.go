@@ -0,0 +1,107 @@
+package sqlutils_test
+
+import (
+	"context"
+	"fmt"
+	"helm-api/kubeutils"
+	"helm-api/sqlutils"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func service(name, release string, port int32, portName string) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "helm-api",
+			Labels:    map[string]string{kubeutils.InstanceLabel: release},
+		},
+		Spec: corev1.ServiceSpec{
+			Ports: []corev1.ServicePort{{Name: portName, Port: port}},
+		},
+	}
+}
+
+func TestResolveTarget(t *testing.T) {
+	tests := []struct {
+		name     string
+		objects  []runtime.Object
+		expected *sqlutils.Target
+		err      error
+	}{
+		{
+			name:    "no auth",
+			objects: []runtime.Object{service("test-demo-mariadb", "test-demo", 3306, "mysql")},
+			expected: &sqlutils.Target{
+				Host: "test-demo-mariadb.helm-api.svc",
+				Port: 3306,
+				User: "root",
+			},
+		},
+		{
+			name: "credentials secret",
+			objects: []runtime.Object{
+				service("test-demo-metrics", "test-demo", 9104, "metrics"),
+				service("test-demo-mariadb", "test-demo", 3307, "mysql"),
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: "test-demo-mariadb-creds", Namespace: "helm-api"},
+					Data:       map[string][]byte{"username": []byte("app"), "password": []byte("s3cret")},
+				},
+			},
+			expected: &sqlutils.Target{
+				Host:     "test-demo-mariadb.helm-api.svc",
+				Port:     3307,
+				User:     "app",
+				Password: "s3cret",
+			},
+		},
+		{
+			name:    "other release only",
+			objects: []runtime.Object{service("test-other-mariadb", "test-other", 3306, "mysql")},
+			err:     sqlutils.ErrNoDatabase,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset(tt.objects...)
+
+			target, err := sqlutils.ResolveTarget(context.Background(), client, "helm-api", "test-demo")
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, target)
+		})
+	}
+}
+
+func TestDSN(t *testing.T) {
+	target := &sqlutils.Target{Host: "db.helm-api.svc", Port: 3306, User: "app", Password: "p@ss:word", Database: "myapp"}
+
+	config, err := mysql.ParseDSN(target.DSN(5 * time.Second))
+	require.NoError(t, err)
+
+	assert.Equal(t, "db.helm-api.svc:3306", config.Addr)
+	assert.Equal(t, "app", config.User)
+	assert.Equal(t, "p@ss:word", config.Passwd)
+	assert.Equal(t, "myapp", config.DBName)
+	assert.Equal(t, 5*time.Second, config.Timeout)
+}
+
+func TestIsStatementError(t *testing.T) {
+	err := fmt.Errorf("query failed: %w", &mysql.MySQLError{Number: 1792, Message: "Cannot execute statement in a READ ONLY transaction"})
+
+	assert.True(t, sqlutils.IsStatementError(err))
+	assert.False(t, sqlutils.IsStatementError(context.DeadlineExceeded))
+}
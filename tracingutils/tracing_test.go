@@ -0,0 +1,71 @@
+package tracingutils_test
+
+import (
+	"context"
+	"errors"
+	"helm-api/tracingutils"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func setupRecorder(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+
+	_, err := tracingutils.Setup(context.Background(), "", "helm-api-test")
+	require.NoError(t, err)
+
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	return recorder
+}
+
+func TestMiddleware(t *testing.T) {
+	recorder := setupRecorder(t)
+
+	r := chi.NewRouter()
+	r.Use(tracingutils.Middleware)
+	r.Post("/update-env/{chartName}", func(w http.ResponseWriter, r *http.Request) {
+		_, span := tracingutils.Start(r.Context(), "helm.UpgradeRelease")
+		tracingutils.End(span, errors.New("upgrade failed"))
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodPost, "/update-env/chart1", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+
+	child, server := spans[0], spans[1]
+	assert.Equal(t, "helm.UpgradeRelease", child.Name())
+	assert.Equal(t, codes.Error, child.Status().Code)
+	assert.Equal(t, server.SpanContext().SpanID(), child.Parent().SpanID())
+
+	assert.Equal(t, "POST /update-env/{chartName}", server.Name())
+	assert.Equal(t, codes.Error, server.Status().Code)
+
+	// The server span continues the caller's trace.
+	assert.Equal(t, traceID, server.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", server.Parent().SpanID().String())
+	assert.True(t, server.Parent().IsRemote())
+}
+
+func TestSetupWithEndpoint(t *testing.T) {
+	shutdown, err := tracingutils.Setup(context.Background(), "http://localhost:4318", "helm-api-test")
+	require.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+}
@@ -0,0 +1,104 @@
+package tunnelutils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+)
+
+// Forwarder opens TCP connections to pod ports.
+type Forwarder interface {
+	Dial(ctx context.Context, namespace, pod string, port int32) (io.ReadWriteCloser, error)
+}
+
+// PortForwarder reaches pod ports through the Kubernetes API port-forward subresource,
+// so helm-api doesn't need network access to the pods.
+type PortForwarder struct {
+	Config *rest.Config
+	Client kubernetes.Interface
+}
+
+// Dial starts a port-forward to the pod on a random loopback port and connects to it.
+// Closing the returned connection stops the port-forward.
+func (f *PortForwarder) Dial(ctx context.Context, namespace, pod string, port int32) (io.ReadWriteCloser, error) {
+	transport, upgrader, err := spdy.RoundTripperFor(f.Config)
+	if err != nil {
+
+		return nil, fmt.Errorf("failed to create port-forward transport: %w", err)
+	}
+
+	url := f.Client.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(pod).
+		SubResource("portforward").
+		URL()
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, url)
+
+	stop := make(chan struct{})
+	ready := make(chan struct{})
+	var errOut strings.Builder
+
+	forwarder, err := portforward.NewOnAddresses(dialer, []string{"127.0.0.1"}, []string{"0:" + strconv.Itoa(int(port))}, stop, ready, io.Discard, &errOut)
+	if err != nil {
+
+		return nil, fmt.Errorf("failed to create port-forward: %w", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- forwarder.ForwardPorts()
+	}()
+
+	select {
+	case <-ready:
+	case err := <-done:
+
+		return nil, fmt.Errorf("port-forward to %s failed: %w", pod, err)
+	case <-ctx.Done():
+		close(stop)
+
+		return nil, ctx.Err()
+	}
+
+	ports, err := forwarder.GetPorts()
+	if err != nil || len(ports) == 0 {
+		close(stop)
+
+		return nil, fmt.Errorf("failed to read forwarded port: %w", err)
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", "127.0.0.1:"+strconv.Itoa(int(ports[0].Local)))
+	if err != nil {
+		close(stop)
+
+		return nil, fmt.Errorf("failed to connect to forwarded port: %w", err)
+	}
+
+	return &forwardedConn{Conn: conn, stop: stop}, nil
+}
+
+// forwardedConn stops its port-forward when closed.
+type forwardedConn struct {
+	net.Conn
+	stop chan struct{}
+	once sync.Once
+}
+
+func (c *forwardedConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(func() { close(c.stop) })
+
+	return err
+}
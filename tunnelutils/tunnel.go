@@ -0,0 +1,201 @@
+package tunnelutils
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Protocol is the Upgrade token of a helm-api tunnel.
+const Protocol = "helm-api-tunnel"
+
+// ErrNotUpgrade is returned when a request doesn't ask for a tunnel upgrade.
+var ErrNotUpgrade = errors.New("request is not a " + Protocol + " upgrade")
+
+// IsUpgrade reports whether the request asks to switch to a tunnel.
+func IsUpgrade(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), Protocol) &&
+		headerContains(r.Header, "Connection", "upgrade")
+}
+
+// Upgrade switches the connection to a raw TCP tunnel. Nothing must be written to w before.
+func Upgrade(w http.ResponseWriter, r *http.Request) (net.Conn, error) {
+	if !IsUpgrade(r) {
+
+		return nil, ErrNotUpgrade
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+
+		return nil, errors.New("connection can't be hijacked")
+	}
+
+	w.Header().Set("Upgrade", Protocol)
+	w.Header().Set("Connection", "Upgrade")
+	w.WriteHeader(http.StatusSwitchingProtocols)
+
+	conn, buffered, err := hijacker.Hijack()
+	if err != nil {
+
+		return nil, fmt.Errorf("failed to hijack connection: %w", err)
+	}
+
+	// Bytes the client sent right after the request may already be buffered.
+	if buffered.Reader.Buffered() > 0 {
+
+		return &bufferedConn{Conn: conn, reader: buffered.Reader}, nil
+	}
+
+	return conn, nil
+}
+
+// Relay copies data both ways until either side is done, then closes both.
+func Relay(a, b io.ReadWriteCloser) error {
+	var (
+		once   sync.Once
+		result error
+		wg     sync.WaitGroup
+	)
+
+	copyHalf := func(dst, src io.ReadWriteCloser) {
+		defer wg.Done()
+
+		_, err := io.Copy(dst, src)
+		once.Do(func() {
+			result = err
+			a.Close()
+			b.Close()
+		})
+	}
+
+	wg.Add(2)
+	go copyHalf(a, b)
+	go copyHalf(b, a)
+	wg.Wait()
+
+	if errors.Is(result, net.ErrClosed) {
+
+		return nil
+	}
+
+	return result
+}
+
+// Dial opens a tunnel to the port of an environment through the API at serverURL.
+func Dial(ctx context.Context, client *http.Client, serverURL, env, port, apiKey string) (io.ReadWriteCloser, error) {
+	endpoint := strings.TrimRight(serverURL, "/") + "/envs/" + env + "/connect"
+	if port != "" {
+		endpoint += "?port=" + port
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, nil)
+	if err != nil {
+
+		return nil, fmt.Errorf("failed to create tunnel request: %w", err)
+	}
+	req.Header.Set("Upgrade", Protocol)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("X-API-Key", apiKey)
+
+	resp, err := client.Do(req)
+	if err != nil {
+
+		return nil, fmt.Errorf("tunnel request failed: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		defer resp.Body.Close()
+
+		return nil, responseError(resp)
+	}
+
+	conn, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		resp.Body.Close()
+
+		return nil, errors.New("tunnel response body is not writable")
+	}
+
+	return conn, nil
+}
+
+// Serve accepts local connections and relays each of them through a new tunnel from dial.
+// It returns when the listener is closed.
+func Serve(listener net.Listener, dial func() (io.ReadWriteCloser, error), onError func(error)) error {
+	for {
+		local, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+
+				return nil
+			}
+
+			return err
+		}
+
+		go func() {
+			remote, err := dial()
+			if err != nil {
+				local.Close()
+				onError(err)
+
+				return
+			}
+
+			if err := Relay(local, remote); err != nil {
+				onError(err)
+			}
+		}()
+	}
+}
+
+// responseError turns a failed tunnel response into an error, using the API message when present.
+func responseError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+
+	var apiError struct {
+		Message string `json:"message"`
+		Error   string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &apiError); err == nil && apiError.Message != "" {
+		if apiError.Error != "" {
+
+			return fmt.Errorf("%s (%d): %s", apiError.Message, resp.StatusCode, apiError.Error)
+		}
+
+		return fmt.Errorf("%s (%d)", apiError.Message, resp.StatusCode)
+	}
+
+	return fmt.Errorf("tunnel refused (%d): %s", resp.StatusCode, strings.TrimSpace(string(body)))
+}
+
+func headerContains(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// bufferedConn reads the bytes buffered during the HTTP exchange before the connection.
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
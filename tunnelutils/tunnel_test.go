@@ -0,0 +1,139 @@
+package tunnelutils_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"helm-api/tunnelutils"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// echoServer upgrades requests carrying the right key and echoes every line back.
+func echoServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-API-Key") != "connect-key" {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]string{"message": "Tunnels are not allowed", "error": "bad key"})
+
+			return
+		}
+		if r.URL.Path != "/envs/demo/connect" || r.URL.Query().Get("port") != "mysql" {
+			w.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		conn, err := tunnelutils.Upgrade(w, r)
+		if err != nil {
+			w.WriteHeader(http.StatusUpgradeRequired)
+
+			return
+		}
+		defer conn.Close()
+
+		io.Copy(conn, conn)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestDial(t *testing.T) {
+	server := echoServer(t)
+
+	conn, err := tunnelutils.Dial(context.Background(), server.Client(), server.URL, "demo", "mysql", "connect-key")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = io.WriteString(conn, "ping\n")
+	require.NoError(t, err)
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "ping\n", line)
+}
+
+func TestDialRefused(t *testing.T) {
+	server := echoServer(t)
+
+	_, err := tunnelutils.Dial(context.Background(), server.Client(), server.URL, "demo", "mysql", "read-key")
+	require.Error(t, err)
+	assert.Equal(t, "Tunnels are not allowed (403): bad key", err.Error())
+
+	_, err = tunnelutils.Dial(context.Background(), server.Client(), server.URL, "other", "mysql", "connect-key")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "(404)")
+}
+
+func TestUpgradeRejectsPlainRequests(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/envs/demo/connect", nil)
+
+	assert.False(t, tunnelutils.IsUpgrade(req))
+	_, err := tunnelutils.Upgrade(httptest.NewRecorder(), req)
+	assert.ErrorIs(t, err, tunnelutils.ErrNotUpgrade)
+
+	req.Header.Set("Upgrade", tunnelutils.Protocol)
+	req.Header.Set("Connection", "keep-alive, Upgrade")
+	assert.True(t, tunnelutils.IsUpgrade(req))
+}
+
+func TestServe(t *testing.T) {
+	server := echoServer(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	errs := make(chan error, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- tunnelutils.Serve(listener, func() (io.ReadWriteCloser, error) {
+			return tunnelutils.Dial(context.Background(), server.Client(), server.URL, "demo", "mysql", "connect-key")
+		}, func(err error) { errs <- err })
+	}()
+
+	for i := 0; i < 2; i++ {
+		local, err := net.Dial("tcp", listener.Addr().String())
+		require.NoError(t, err)
+
+		_, err = io.WriteString(local, "hello\n")
+		require.NoError(t, err)
+
+		line, err := bufio.NewReader(local).ReadString('\n')
+		require.NoError(t, err)
+		assert.Equal(t, "hello\n", line)
+		local.Close()
+	}
+
+	require.NoError(t, listener.Close())
+	assert.NoError(t, <-done)
+	assert.Empty(t, errs)
+}
+
+func TestRelay(t *testing.T) {
+	clientA, serverA := net.Pipe()
+	clientB, serverB := net.Pipe()
+
+	done := make(chan error, 1)
+	go func() { done <- tunnelutils.Relay(serverA, serverB) }()
+
+	go io.WriteString(clientA, "data")
+	buf := make([]byte, 4)
+	_, err := io.ReadFull(clientB, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "data", string(buf))
+
+	// Closing one side tears down the other.
+	clientA.Close()
+	assert.NoError(t, <-done)
+	_, err = clientB.Read(buf)
+	assert.Error(t, err)
+}
@@ -17,6 +17,8 @@ func GetEnvOrDefault(key, value string) string {
 }
 
 // Validate required API keys
+//
+// Deprecated: startup checks apiutils.Keys with Require, which accepts keys bound to a team.
 func ValidateAPIKeys() error {
 	required := []string{
 		"HELM_API_CREATE_API_KEY",
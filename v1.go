@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"helm-api/auditutils"
+	"helm-api/client"
+	"helm-api/envservice"
+	"helm-api/logutils"
+	"helm-api/problemutils"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// The /v1 routes expose the environments as a resource: POST /v1/envs creates one, and
+// GET, PATCH and DELETE /v1/envs/{name} read, change and remove it.
+
+// v1CreateEnvHandler creates an environment and points to it in the Location header.
+func v1CreateEnvHandler(envs envservice.EnvironmentService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req Request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			problemutils.Write(w, r, problemutils.New(problemutils.CodeValidationFailed, "Invalid request payload", err))
+
+			return
+		}
+
+		name := req.ChartMetadata.Name
+		ctx := logutils.With(r.Context(), logutils.Fields{"env": name})
+
+		spec, err := createSpec(r, req)
+		var result *envservice.Result
+		if err == nil {
+			result, err = envs.Create(ctx, spec)
+		}
+		if err != nil {
+			problemutils.Write(w, r, envProblem(err))
+
+			return
+		}
+
+		auditutils.SetRevision(r.Context(), result.Revision)
+
+		resp := Response{
+			Message: fmt.Sprintf("Environment %s created", name),
+		}
+
+		w.Header().Set("Location", "/v1/envs/"+name)
+		w.WriteHeader(http.StatusCreated)
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+
+			return
+		}
+	}
+}
+
+// v1ListEnvsHandler lists the environment names, without the release prefix.
+func v1ListEnvsHandler(envs envservice.EnvironmentService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		names, err := envs.List(r.Context())
+		if err != nil {
+			problemutils.Write(w, r, envProblem(err))
+
+			return
+		}
+
+		resp := Response{
+			Message: fmt.Sprintf("%d environments", len(names)),
+			Data:    names,
+		}
+
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+
+			return
+		}
+	}
+}
+
+// v1UpdateEnvHandler merges the request values into the values of an environment and upgrades it.
+func v1UpdateEnvHandler(envs envservice.EnvironmentService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := chi.URLParam(r, "name")
+		ctx := logutils.With(r.Context(), logutils.Fields{"env": name})
+
+		var req client.UpdateRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err == nil && len(req.Values) == 0 {
+			err = errors.New("values must hold at least one value to change")
+		}
+		if err != nil {
+			problemutils.Write(w, r, problemutils.New(problemutils.CodeValidationFailed, "Invalid request payload", err))
+
+			return
+		}
+
+		result, err := envs.Update(ctx, name, req.Values)
+		if err != nil {
+			problemutils.Write(w, r, envProblem(err))
+
+			return
+		}
+
+		auditutils.SetRevision(r.Context(), result.Revision)
+
+		resp := Response{
+			Message: fmt.Sprintf("Environment %s updated to revision %d", name, result.Revision),
+		}
+
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+
+			return
+		}
+	}
+}
+
+// v1ScaleEnvHandler scales the pods of an environment up or down.
+func v1ScaleEnvHandler(envs envservice.EnvironmentService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := chi.URLParam(r, "name")
+		ctx := logutils.With(r.Context(), logutils.Fields{"env": name})
+
+		var req client.ScaleRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			problemutils.Write(w, r, problemutils.New(problemutils.CodeValidationFailed, "Invalid request payload", err))
+
+			return
+		}
+
+		result, err := envs.Scale(ctx, name, req.Action)
+		if err != nil {
+			problemutils.Write(w, r, envProblem(err))
+
+			return
+		}
+
+		auditutils.SetRevision(r.Context(), result.Revision)
+
+		resp := Response{
+			Message: fmt.Sprintf("Environment %s scaled %s", name, req.Action),
+		}
+
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+
+			return
+		}
+	}
+}
+
+// v1DeleteEnvHandler uninstalls an environment and removes its chart.
+func v1DeleteEnvHandler(envs envservice.EnvironmentService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := chi.URLParam(r, "name")
+		ctx := logutils.With(r.Context(), logutils.Fields{"env": name})
+
+		result, err := envs.Delete(ctx, name)
+		if err != nil {
+			problemutils.Write(w, r, envProblem(err))
+
+			return
+		}
+
+		auditutils.SetRevision(r.Context(), result.Revision)
+
+		resp := Response{
+			Message: fmt.Sprintf("Environment %s deleted", name),
+		}
+
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+
+			return
+		}
+	}
+}
@@ -0,0 +1,450 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"helm-api/apiutils"
+	"helm-api/envservice"
+	"helm-api/idempotencyutils"
+	"helm-api/kubeutils"
+	"helm-api/logutils"
+	"helm-api/problemutils"
+	"helm-api/quotautils"
+	"helm-api/sqlutils"
+	"helm-api/tunnelutils"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// call sends a JSON request to the test server and decodes the response.
+func call(t *testing.T, method, url, apiKey, body string) (*http.Response, Response) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", apiKey)
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var decoded Response
+	if resp.StatusCode != http.StatusUnauthorized {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&decoded))
+	}
+
+	return resp, decoded
+}
+
+func TestV1Lifecycle(t *testing.T) {
+	server, _ := newTestServer(t, &quotautils.Config{})
+	envs := server.URL + "/v1/envs"
+	create := `{"chartMetadata": {"apiVersion": "v2", "name": "demo", "version": "0.1.0"}}`
+
+	resp, body := call(t, http.MethodPost, envs, "create-key", create)
+	require.Equal(t, http.StatusCreated, resp.StatusCode, body.Error)
+	assert.Equal(t, "/v1/envs/demo", resp.Header.Get("Location"))
+
+	resp, body = call(t, http.MethodPost, envs, "create-key", create)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Contains(t, body.Error, "already exist")
+
+	// The original route answers with the same problem.
+	resp, body = call(t, http.MethodPost, server.URL+"/create-env", "create-key", create)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Equal(t, problemutils.ContentType, resp.Header.Get("Content-Type"))
+
+	resp, _ = call(t, http.MethodPost, envs, "create-key", `{"chartMetadata": {}}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, body = call(t, http.MethodGet, envs, "read-key", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{"demo"}, body.Data)
+
+	resp, body = call(t, http.MethodGet, envs+"/demo", "read-key", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "deployed", body.Env.Status)
+
+	resp, _ = call(t, http.MethodGet, envs+"/missing", "read-key", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, body = call(t, http.MethodPatch, envs+"/demo", "update-key", `{"values": {"replicas": 2}}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode, body.Error)
+	assert.Equal(t, "Environment demo updated to revision 2", body.Message)
+
+	resp, _ = call(t, http.MethodPatch, envs+"/demo", "update-key", `{"values": {}}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, _ = call(t, http.MethodPatch, envs+"/missing", "update-key", `{"values": {"replicas": 2}}`)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// The original route refuses missing environments with the same problem, even without changes.
+	resp, body = call(t, http.MethodPost, server.URL+"/update-env/missing", "update-key", `{}`)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Contains(t, body.Error, "no environment named missing")
+
+	resp, _ = call(t, http.MethodPatch, envs+"/demo", "read-key", `{"values": {"replicas": 2}}`)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp, body = call(t, http.MethodPost, envs+"/demo:scale", "update-key", `{"action": "down"}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode, body.Error)
+
+	resp, _ = call(t, http.MethodPost, envs+"/demo:scale", "update-key", `{"action": "sideways"}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, _ = call(t, http.MethodPost, envs+"/missing:scale", "update-key", `{"action": "up"}`)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, body = call(t, http.MethodGet, envs+"/demo", "read-key", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 3, body.Env.Revision)
+
+	resp, _ = call(t, http.MethodDelete, envs+"/demo", "update-key", "")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp, body = call(t, http.MethodDelete, envs+"/demo", "delete-key", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode, body.Error)
+
+	resp, _ = call(t, http.MethodDelete, envs+"/demo", "delete-key", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestIdempotentCreate(t *testing.T) {
+	server, _ := newTestServer(t, &quotautils.Config{})
+	create := `{"chartMetadata": {"apiVersion": "v2", "name": "demo", "version": "0.1.0"}}`
+
+	send := func(path, key, body string) *http.Response {
+		req, err := http.NewRequest(http.MethodPost, server.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("X-API-Key", "create-key")
+		req.Header.Set(idempotencyutils.Header, key)
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		return resp
+	}
+
+	resp := send("/v1/envs", "ci-run-1", create)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	// The retry gets the original result instead of a conflict.
+	resp = send("/v1/envs", "ci-run-1", create)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "true", resp.Header.Get(idempotencyutils.ReplayedHeader))
+	assert.Equal(t, "/v1/envs/demo", resp.Header.Get("Location"))
+
+	resp = send("/v1/envs", "ci-run-1", `{"chartMetadata": {"apiVersion": "v2", "name": "other", "version": "0.1.0"}}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+
+	resp = send("/create-env", "ci-run-1", create)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode, "keys are shared by the routes")
+
+	resp = send("/create-env", "ci-run-2", create)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+}
+
+// fakeEnvService records the calls of the handlers and fails them with err when set.
+type fakeEnvService struct {
+	err     error
+	specs   []envservice.Spec
+	updates []string
+}
+
+func (f *fakeEnvService) Create(ctx context.Context, spec envservice.Spec) (*envservice.Result, error) {
+	f.specs = append(f.specs, spec)
+
+	return f.result(spec.Metadata.Name)
+}
+
+func (f *fakeEnvService) Update(ctx context.Context, name string, values map[string]interface{}) (*envservice.Result, error) {
+	f.updates = append(f.updates, name)
+
+	return f.result(name)
+}
+
+func (f *fakeEnvService) Scale(ctx context.Context, name string, action ScaleAction) (*envservice.Result, error) {
+	f.updates = append(f.updates, name)
+
+	return f.result(name)
+}
+
+func (f *fakeEnvService) Delete(ctx context.Context, name string) (*envservice.Result, error) {
+	return f.result(name)
+}
+
+func (f *fakeEnvService) Get(ctx context.Context, name string) (*EnvStatus, error) {
+	if f.err != nil {
+
+		return nil, f.err
+	}
+
+	return &EnvStatus{Name: name, Status: "deployed"}, nil
+}
+
+func (f *fakeEnvService) List(ctx context.Context) ([]string, error) {
+	if f.err != nil {
+
+		return nil, f.err
+	}
+
+	return []string{"demo"}, nil
+}
+
+func (f *fakeEnvService) Logs(ctx context.Context, name string, opts kubeutils.LogOptions) (envservice.LogStream, error) {
+	if f.err != nil {
+
+		return nil, f.err
+	}
+
+	return fakeLogStream("[demo-0/app] started\n"), nil
+}
+
+func (f *fakeEnvService) Events(ctx context.Context, name string) ([]kubeutils.Event, error) {
+	if f.err != nil {
+
+		return nil, f.err
+	}
+
+	return []kubeutils.Event{{Reason: "Started"}}, nil
+}
+
+func (f *fakeEnvService) Render(ctx context.Context, name string, values map[string]interface{}) (string, error) {
+	if f.err != nil {
+
+		return "", f.err
+	}
+
+	return "kind: ConfigMap\n", nil
+}
+
+func (f *fakeEnvService) Database(ctx context.Context, name string) (*sqlutils.Target, error) {
+	return nil, f.err
+}
+
+func (f *fakeEnvService) Connect(ctx context.Context, name, port string) (*envservice.Tunnel, error) {
+	return nil, f.err
+}
+
+// fakeLogStream is a log stream of fixed lines.
+type fakeLogStream string
+
+func (s fakeLogStream) Copy(w io.Writer) error {
+	_, err := io.WriteString(w, string(s))
+
+	return err
+}
+
+func (s fakeLogStream) Close() error {
+	return nil
+}
+
+func (f *fakeEnvService) result(name string) (*envservice.Result, error) {
+	if f.err != nil {
+
+		return nil, f.err
+	}
+
+	return &envservice.Result{Name: name, Release: envservice.ReleaseName(name), Revision: 1}, nil
+}
+
+func TestEnvHandlerStatusCodes(t *testing.T) {
+	notFound := &envservice.Error{Message: "Environment not found", Kind: envservice.ErrNotFound, Err: errors.New("no environment named demo")}
+	quota := &envservice.Error{Message: "Quota exceeded", Kind: envservice.ErrQuotaExceeded, Err: errors.New("team qa exceeded its quota"), Quota: &quotautils.Report{Team: "qa"}}
+	exists := &envservice.Error{Message: "Environment already exists", Kind: envservice.ErrAlreadyExists, Err: errors.New("release for demo already exist")}
+	internal := errors.New("cluster unreachable")
+	locked := &envservice.Error{Message: "Environment is busy", Err: fmt.Errorf("%w: test-demo is running upgrade", envservice.ErrLocked)}
+
+	tests := []struct {
+		name    string
+		err     error
+		handler func(envservice.EnvironmentService) http.HandlerFunc
+		method  string
+		pattern string
+		path    string
+		body    string
+		status  int
+	}{
+		{"v1 create exists", exists, v1CreateEnvHandler, http.MethodPost, "/v1/envs", "/v1/envs", `{"chartMetadata": {"name": "demo"}}`, http.StatusConflict},
+		{"legacy create exists", exists, createEnvHandler, http.MethodPost, "/create-env", "/create-env", `{"chartMetadata": {"name": "demo"}}`, http.StatusConflict},
+		{"v1 create quota", quota, v1CreateEnvHandler, http.MethodPost, "/v1/envs", "/v1/envs", `{"chartMetadata": {"name": "demo"}}`, http.StatusForbidden},
+		{"legacy create quota", quota, createEnvHandler, http.MethodPost, "/create-env", "/create-env", `{"chartMetadata": {"name": "demo"}}`, http.StatusForbidden},
+		{"invalid ttl", nil, createEnvHandler, http.MethodPost, "/create-env", "/create-env", `{"chartMetadata": {"name": "demo"}, "ttl": "-1h"}`, http.StatusBadRequest},
+		{"v1 update missing", notFound, v1UpdateEnvHandler, http.MethodPatch, "/v1/envs/{name}", "/v1/envs/demo", `{"values": {"a": 1}}`, http.StatusNotFound},
+		{"legacy update missing", notFound, updateEnvHandler, http.MethodPost, "/update-env/{chartName}", "/update-env/demo", `{"action": "up"}`, http.StatusNotFound},
+		{"v1 delete missing", notFound, v1DeleteEnvHandler, http.MethodDelete, "/v1/envs/{name}", "/v1/envs/demo", "", http.StatusNotFound},
+		{"legacy delete missing", notFound, deleteEnvHandler, http.MethodPost, "/delete-env/{chartName}", "/delete-env/demo", "", http.StatusNotFound},
+		{"status missing", notFound, envStatusHandler, http.MethodGet, "/envs/{name}", "/envs/demo", "", http.StatusNotFound},
+		{"v1 list internal", internal, v1ListEnvsHandler, http.MethodGet, "/v1/envs", "/v1/envs", "", http.StatusInternalServerError},
+		{"legacy list", nil, listEnvHandler, http.MethodGet, "/list", "/list", "", http.StatusOK},
+		{"v1 scale locked", locked, v1ScaleEnvHandler, http.MethodPost, "/v1/envs/{name}:scale", "/v1/envs/demo:scale", `{"action": "up"}`, http.StatusConflict},
+		{"legacy delete locked", locked, deleteEnvHandler, http.MethodPost, "/delete-env/{chartName}", "/delete-env/demo", "", http.StatusConflict},
+		{"v1 scale", nil, v1ScaleEnvHandler, http.MethodPost, "/v1/envs/{name}:scale", "/v1/envs/demo:scale", `{"action": "up"}`, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &fakeEnvService{err: tt.err}
+			router := chi.NewRouter()
+			router.Method(tt.method, tt.pattern, tt.handler(service))
+
+			recorder := httptest.NewRecorder()
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			router.ServeHTTP(recorder, req)
+
+			assert.Equal(t, tt.status, recorder.Code)
+
+			if tt.status < http.StatusBadRequest {
+
+				return
+			}
+
+			var problem problemutils.Problem
+			assert.Equal(t, problemutils.ContentType, recorder.Header().Get("Content-Type"))
+			require.NoError(t, json.NewDecoder(recorder.Body).Decode(&problem))
+			assert.Equal(t, tt.status, problem.Status)
+			assert.Equal(t, tt.path, problem.Instance)
+			if errors.Is(tt.err, envservice.ErrQuotaExceeded) {
+				assert.Equal(t, problemutils.CodeQuotaExceeded, problem.Code)
+				assert.Equal(t, "qa", problem.Quota.Team)
+			}
+			if tt.err != nil {
+				assert.Equal(t, tt.err.Error(), problem.Error)
+			}
+		})
+	}
+}
+
+func TestInspectHandlerStatusCodes(t *testing.T) {
+	notFound := &envservice.Error{Message: "Environment not found", Kind: envservice.ErrNotFound, Err: errors.New("no environment named demo")}
+	noPods := &envservice.Error{Message: "Failed to read environment logs", Err: fmt.Errorf("%w: test-demo", kubeutils.ErrNoPods)}
+	noDatabase := &envservice.Error{Message: "Failed to find environment database", Err: fmt.Errorf("%w for test-demo", sqlutils.ErrNoDatabase)}
+	notReady := &envservice.Error{Message: "Failed to find environment service", Err: fmt.Errorf("%w: test-demo", kubeutils.ErrNoReadyPod)}
+	dial := &envservice.Error{Message: "Failed to open port-forward", Kind: envservice.ErrPortForward, Err: errors.New("connection refused")}
+	internal := errors.New("cluster unreachable")
+
+	keys := apiutils.Keys
+	apiutils.Keys = apiutils.NewKeyStore()
+	apiutils.Keys.Rotate(map[string]string{apiutils.ConnectKeyName: "connect-key"}, 0)
+	t.Cleanup(func() { apiutils.Keys = keys })
+
+	base := logrus.New()
+	base.SetOutput(io.Discard)
+	logger := logutils.NewLogrus(base)
+	logs := func(s envservice.EnvironmentInspector) http.HandlerFunc { return envLogsHandler(s, logger) }
+	connect := func(s envservice.EnvironmentInspector) http.HandlerFunc { return envConnectHandler(s, logger) }
+
+	tests := []struct {
+		name    string
+		err     error
+		handler func(envservice.EnvironmentInspector) http.HandlerFunc
+		method  string
+		path    string
+		body    string
+		status  int
+		code    problemutils.Code
+	}{
+		{"logs", nil, logs, http.MethodGet, "/envs/demo/logs", "", http.StatusOK, ""},
+		{"logs missing", notFound, logs, http.MethodGet, "/envs/demo/logs", "", http.StatusNotFound, problemutils.CodeEnvNotFound},
+		{"logs no pods", noPods, logs, http.MethodGet, "/envs/demo/logs", "", http.StatusNotFound, problemutils.CodeNotFound},
+		{"events", nil, envEventsHandler, http.MethodGet, "/envs/demo/events", "", http.StatusOK, ""},
+		{"events internal", internal, envEventsHandler, http.MethodGet, "/envs/demo/events", "", http.StatusInternalServerError, problemutils.CodeInternal},
+		{"render", nil, envRenderHandler, http.MethodPost, "/envs/demo/render", `{"values": {"replicas": 0}}`, http.StatusOK, ""},
+		{"render missing", notFound, envRenderHandler, http.MethodPost, "/envs/demo/render", "", http.StatusNotFound, problemutils.CodeEnvNotFound},
+		{"query no database", noDatabase, envQueryHandler, http.MethodPost, "/envs/demo/query", `{"query": "SELECT 1"}`, http.StatusNotFound, problemutils.CodeNotFound},
+		{"connect not ready", notReady, connect, http.MethodPost, "/envs/demo/connect", "", http.StatusServiceUnavailable, problemutils.CodeUnavailable},
+		{"connect dial", dial, connect, http.MethodPost, "/envs/demo/connect", "", http.StatusBadGateway, problemutils.CodeUpstreamFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &fakeEnvService{err: tt.err}
+			router := chi.NewRouter()
+			router.Method(tt.method, "/envs/{name}/*", tt.handler(service))
+
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("X-API-Key", "connect-key")
+			req.Header.Set("Connection", "Upgrade")
+			req.Header.Set("Upgrade", tunnelutils.Protocol)
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+
+			assert.Equal(t, tt.status, recorder.Code)
+
+			if tt.status < http.StatusBadRequest {
+
+				return
+			}
+
+			var problem problemutils.Problem
+			require.NoError(t, json.NewDecoder(recorder.Body).Decode(&problem))
+			assert.Equal(t, tt.code, problem.Code)
+			assert.Equal(t, tt.err.Error(), problem.Error)
+		})
+	}
+}
+
+func TestLegacyHandlersPassRequest(t *testing.T) {
+	service := &fakeEnvService{}
+	router := chi.NewRouter()
+	router.Post("/create-env", createEnvHandler(service))
+	router.Post("/update-env/{chartName}", updateEnvHandler(service))
+	router.Get("/list", listEnvHandler(service))
+
+	req := httptest.NewRequest(http.MethodPost, "/create-env", strings.NewReader(`{"chartMetadata": {"name": "demo"}, "ttl": "24h"}`))
+	req = req.WithContext(apiutils.WithCaller(req.Context(), "HELM_API_CREATE_API_KEY@qa"))
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	require.Len(t, service.specs, 1)
+	assert.Equal(t, "demo", service.specs[0].Metadata.Name)
+	assert.Equal(t, "qa", service.specs[0].Team)
+	assert.Equal(t, 24*time.Hour, service.specs[0].TTL)
+
+	req = httptest.NewRequest(http.MethodPost, "/update-env/demo", strings.NewReader(`{"action": "down"}`))
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, []string{"demo"}, service.updates)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/list", nil))
+	var resp Response
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&resp))
+	assert.Equal(t, []string{"test-demo"}, resp.Data)
+}
+
+func TestQuotasOfKeyTeam(t *testing.T) {
+	server, _ := newTestServer(t, &quotautils.Config{})
+	quotas := server.URL + "/quotas"
+
+	resp, body := call(t, http.MethodPost, server.URL+"/v1/envs", "create-key", `{"chartMetadata": {"apiVersion": "v2", "name": "demo", "version": "0.1.0"}}`)
+	require.Equal(t, http.StatusCreated, resp.StatusCode, body.Error)
+
+	resp, _ = call(t, http.MethodGet, quotas, "", "")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	// The create key belongs to qa, which owns the environment.
+	resp, body = call(t, http.MethodGet, quotas, "create-key", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode, body.Error)
+	assert.Equal(t, "qa", body.Quota.Team)
+	assert.Equal(t, "1", body.Quota.Items[0].Used)
+
+	resp, body = call(t, http.MethodGet, quotas, "read-key", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode, body.Error)
+	assert.Equal(t, quotautils.DefaultTeam, body.Quota.Team)
+	assert.Equal(t, "0", body.Quota.Items[0].Used)
+
+	resp, _ = call(t, http.MethodGet, quotas+"?team=qa", "read-key", "")
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}